@@ -9,25 +9,47 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/sourcegraph/conc/iter"
+	"github.com/tphoney/plex-lookup/health"
 	"github.com/tphoney/plex-lookup/types"
 	"github.com/tphoney/plex-lookup/utils"
 )
 
 const (
-	amazonURL      = "https://www.blu-ray.com/movies/search.php?keyword="
+	DefaultURL     = "https://www.blu-ray.com"
 	LanguageGerman = "german"
+	ProviderName   = "Amazon"
 )
 
 var (
+	amazonURL = utils.NewBaseURL(DefaultURL)
+	// Matches a search result title such as "Cats (1998)" or "Cat's Eye: Season 1 (1983-1984)"
+	titleYearRegex = regexp.MustCompile(`^(.*?)\s*\(([^()]*)\)$`)
+	// Matches the result count in a search heading such as "Search movies (22 matches)"
+	matchCountRegex = regexp.MustCompile(`\((\d+) match(?:es)?\)`)
 	// Regex to match date patterns with abbreviated or full month names
 	// Note: May appears in both abbreviated and full month lists, but we don't need it twice
 	dateRegex = regexp.MustCompile(`(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec|January|February|March|April|June|July|August|September|October|November|December)\s+(\d{1,2}),\s+(\d{4})`)
+	// Matches the region letters in a playback line such as "2K Blu-ray: Region A (B, C untested)"
+	regionCodeRegex = regexp.MustCompile(`\b[ABC]\b`)
+	// Matches a bracketed detail such as "(35.98 Mbps)" or "(48kHz, 24-bit)"
+	bracketedRegex = regexp.MustCompile(`\s*\([^()]*\)`)
+	// Matches a price such as "£17.35", "$9.99" or "19,99 €"
+	priceRegex = regexp.MustCompile(`([£$€¥]|kr)?\s*(\d[\d.,]*)\s*([£$€¥]|kr)?`)
+	// regionCurrencies are the currencies blu-ray.com shows prices in for each country cookie
+	regionCurrencies = map[string]string{
+		"uk": "GBP", "us": "USD", "ca": "CAD", "au": "AUD", "nz": "NZD", "jp": "JPY",
+		"de": "EUR", "fr": "EUR", "it": "EUR", "es": "EUR", "nl": "EUR", "at": "EUR", "be": "EUR", "fi": "EUR", "ie": "EUR", "pt": "EUR",
+		"se": "SEK", "dk": "DKK", "no": "NOK", "ch": "CHF",
+	}
+	symbolCurrencies = map[string]string{"£": "GBP", "€": "EUR", "¥": "JPY"}
 	//nolint: mnd
 	seasonNumberToInt = map[string]int{
 		"one":       1,
@@ -76,13 +98,24 @@ var (
 	}
 )
 
-// MoviesInParallel processes movies in parallel with progress tracking.
+// RegionCurrency is the currency blu-ray.com shows prices in for a region, empty for an unknown region.
+func RegionCurrency(region string) string {
+	return regionCurrencies[region]
+}
+
+// SetURL points blu-ray.com lookups at a mirror, proxy or fixture server. An empty url restores the default.
+func SetURL(baseURL string) {
+	amazonURL.Set(baseURL)
+}
+
+// MoviesInParallel processes movies in parallel with progress tracking, the status tells whether the parser looks broken.
 //
 //nolint:dupl // Cannot be unified with TVInParallel due to different generic types (PlexMovie vs PlexTVShow)
-func MoviesInParallel(ctx context.Context, progressFunc func(), plexMovies []types.PlexMovie, language, region string) (searchResults []types.MovieSearchResponse) {
+func MoviesInParallel(ctx context.Context, progressFunc func(), plexMovies []types.PlexMovie, language, region string) (searchResults []types.MovieSearchResponse, status health.ParserStatus) {
 	mapper := iter.Mapper[types.PlexMovie, types.MovieSearchResponse]{
 		MaxGoroutines: types.ConcurrencyLimit,
 	}
+	detector := health.NewBreakageDetector(ProviderName)
 	searchResults = mapper.Map(plexMovies, func(m *types.PlexMovie) types.MovieSearchResponse {
 		// Check for cancellation
 		select {
@@ -90,23 +123,25 @@ func MoviesInParallel(ctx context.Context, progressFunc func(), plexMovies []typ
 			return types.MovieSearchResponse{}
 		default:
 		}
-		result := searchMovieValue(m, language, region)
+		result := searchMovieValue(m, language, region, detector)
 		if progressFunc != nil {
 			progressFunc()
 		}
 		return result
 	})
+	status = detector.Finish()
 	slog.Info("Amazon movies found", "count", len(searchResults))
-	return searchResults
+	return searchResults, status
 }
 
-// TVInParallel processes TV shows in parallel with progress tracking.
+// TVInParallel processes TV shows in parallel with progress tracking, the status tells whether the parser looks broken.
 //
 //nolint:dupl // Cannot be unified with MoviesInParallel due to different generic types (PlexTVShow vs PlexMovie)
-func TVInParallel(ctx context.Context, progressFunc func(), plexTVShows []types.PlexTVShow, language, region string) (searchResults []types.TVSearchResponse) {
+func TVInParallel(ctx context.Context, progressFunc func(), plexTVShows []types.PlexTVShow, language, region string) (searchResults []types.TVSearchResponse, status health.ParserStatus) {
 	mapper := iter.Mapper[types.PlexTVShow, types.TVSearchResponse]{
 		MaxGoroutines: types.ConcurrencyLimit,
 	}
+	detector := health.NewBreakageDetector(ProviderName)
 	searchResults = mapper.Map(plexTVShows, func(tv *types.PlexTVShow) types.TVSearchResponse {
 		// Check for cancellation
 		select {
@@ -114,14 +149,42 @@ func TVInParallel(ctx context.Context, progressFunc func(), plexTVShows []types.
 			return types.TVSearchResponse{}
 		default:
 		}
-		result := searchTVValue(tv, language, region)
+		result := searchTVValue(tv, language, region, detector)
 		if progressFunc != nil {
 			progressFunc()
 		}
 		return result
 	})
+	status = detector.Finish()
 	slog.Info("Amazon TV shows found", "count", len(searchResults))
-	return searchResults
+	return searchResults, status
+}
+
+// MoviesInRegions searches every region in turn, scraping release dates as it goes, and attaches each region's best
+// matches to the results of the first region so they can be compared side by side.
+func MoviesInRegions(ctx context.Context, progressFunc func(), plexMovies []types.PlexMovie, language string, regions []string) (searchResults []types.MovieSearchResponse, status health.ParserStatus) {
+	for _, region := range regions {
+		regionResults, regionStatus := MoviesInParallel(ctx, progressFunc, plexMovies, language, region)
+		// a broken parser in any region is worth reporting
+		if !status.LikelyBroken {
+			status = regionStatus
+		}
+		regionResults = ScrapeMovieTitlesParallel(ctx, nil, regionResults, region)
+		if searchResults == nil {
+			searchResults = regionResults
+		}
+		// results come back in the same order as plexMovies
+		for i := range regionResults {
+			availability := types.RegionAvailability{Region: region}
+			for j := range regionResults[i].MovieSearchResults {
+				if regionResults[i].MovieSearchResults[j].BestMatch {
+					availability.Discs = append(availability.Discs, regionResults[i].MovieSearchResults[j])
+				}
+			}
+			searchResults[i].Regions = append(searchResults[i].Regions, availability)
+		}
+	}
+	return searchResults, status
 }
 
 // ScrapeTitlesParallel now only handles TV. Use ScrapeMovieTitlesParallel for movies.
@@ -227,6 +290,179 @@ func extractReleaseDate(rawData string) (time.Time, error) {
 	return releaseDate, nil
 }
 
+// extractProductDetails reads the disc specifications and the lowest new price from a product page.
+func extractProductDetails(rawData, region string) (disc types.DiscDetails, price types.Price) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rawData))
+	if err != nil {
+		return disc, price
+	}
+	sections := specSections(doc)
+	return extractDiscDetails(doc, sections), extractPrice(sections["Price"], region)
+}
+
+// extractDiscDetails reads the video, audio, subtitle, region and runtime specifications from a product page.
+func extractDiscDetails(doc *goquery.Document, sections map[string][]string) (disc types.DiscDetails) {
+	if runtime := doc.Find("span#runtime").First(); runtime.Length() > 0 {
+		minutes, _, _ := strings.Cut(strings.TrimSpace(runtime.Text()), " ")
+		disc.RuntimeMinutes, _ = strconv.Atoi(minutes)
+	}
+	for _, line := range sections["Video"] {
+		name, value, found := strings.Cut(line, ": ")
+		if !found {
+			continue
+		}
+		switch name {
+		case "Codec":
+			disc.VideoCodec = bracketedRegex.ReplaceAllString(value, "")
+		case "Resolution":
+			disc.VideoResolution = value
+		case "HDR":
+			disc.HDRFormats = strings.Split(value, ", ")
+		}
+	}
+	for _, line := range sections["Audio"] {
+		language, format, found := strings.Cut(line, ": ")
+		if !found || language == "Note" {
+			continue
+		}
+		disc.AudioTracks = append(disc.AudioTracks, types.DiscAudioTrack{
+			Language: language,
+			Format:   bracketedRegex.ReplaceAllString(format, ""),
+		})
+	}
+	for _, line := range sections["Subtitles"] {
+		disc.Subtitles = append(disc.Subtitles, strings.Split(line, ", ")...)
+	}
+	disc.RegionCodes = extractRegionCodes(sections["Playback"])
+	return disc
+}
+
+// extractPrice prefers the "New from" price and falls back to the list price. The currency comes from the price's
+// symbol, or the region when the symbol is ambiguous like $.
+func extractPrice(lines []string, region string) (price types.Price) {
+	var newFrom, listPrice string
+	for _, line := range lines {
+		name, value, found := strings.Cut(line, ": ")
+		if !found {
+			continue
+		}
+		switch name {
+		case "New from":
+			newFrom = value
+		case "List price":
+			listPrice = value
+		}
+	}
+	value := newFrom
+	if value == "" {
+		value = listPrice
+	}
+	match := priceRegex.FindStringSubmatch(bracketedRegex.ReplaceAllString(value, ""))
+	if match == nil {
+		return price
+	}
+	price.Amount = parseAmount(match[2])
+	price.Currency = regionCurrencies[region]
+	symbol := match[1] + match[3]
+	if currency, ok := symbolCurrencies[symbol]; ok {
+		price.Currency = currency
+	} else if symbol == "$" && price.Currency == "" {
+		price.Currency = "USD"
+	}
+	return price
+}
+
+// parseAmount handles both "1,299.99" and "1.299,99" styles of number.
+func parseAmount(amount string) float64 {
+	lastComma := strings.LastIndex(amount, ",")
+	lastDot := strings.LastIndex(amount, ".")
+	if lastComma > lastDot {
+		amount = strings.ReplaceAll(amount, ".", "")
+		amount = strings.Replace(amount, ",", ".", 1)
+	} else {
+		amount = strings.ReplaceAll(amount, ",", "")
+	}
+	value, _ := strconv.ParseFloat(amount, 64)
+	return value
+}
+
+// extractRegionCodes returns the regions that every disc in the set plays in. A set with a 4K disc and a region
+// locked 2K disc only plays fully in the 2K disc's regions.
+func extractRegionCodes(playback []string) (codes []string) {
+	codes = []string{"A", "B", "C"}
+	found := false
+	for _, line := range playback {
+		_, region, ok := strings.Cut(line, "Region ")
+		if !ok {
+			continue
+		}
+		found = true
+		if strings.HasPrefix(region, "free") {
+			continue
+		}
+		// anything in brackets is untested or a note
+		lineCodes := regionCodeRegex.FindAllString(bracketedRegex.ReplaceAllString(region, ""), -1)
+		codes = slices.DeleteFunc(codes, func(code string) bool {
+			return !slices.Contains(lineCodes, code)
+		})
+	}
+	if !found {
+		return nil
+	}
+	return codes
+}
+
+// specSections splits the specification column of a product page into lines of text under each subheading.
+func specSections(doc *goquery.Document) map[string][]string {
+	sections := make(map[string][]string)
+	doc.Find("span.subheading").Parent().Each(func(_ int, column *goquery.Selection) {
+		heading := ""
+		var line strings.Builder
+		flush := func() {
+			text := strings.TrimSpace(strings.ReplaceAll(line.String(), "\u00a0", " "))
+			if heading != "" && text != "" {
+				sections[heading] = append(sections[heading], text)
+			}
+			line.Reset()
+		}
+		var walk func(nodes *goquery.Selection)
+		walk = func(nodes *goquery.Selection) {
+			nodes.Each(func(_ int, node *goquery.Selection) {
+				switch goquery.NodeName(node) {
+				case "#text":
+					line.WriteString(node.Text())
+				case "br":
+					flush()
+				case "span":
+					if node.HasClass("subheading") {
+						flush()
+						heading = strings.TrimSpace(node.Text())
+						// the price column repeats its heading, keep the first
+						if _, seen := sections[heading]; seen {
+							heading = ""
+						}
+						return
+					}
+					walk(node.Contents())
+				case "div":
+					// the expanded audio and subtitle lists are hidden copies of the short ones
+					if strings.Contains(strings.ReplaceAll(node.AttrOr("style", ""), " ", ""), "display:none") {
+						return
+					}
+					flush()
+					walk(node.Contents())
+					flush()
+				default:
+					walk(node.Contents())
+				}
+			})
+		}
+		walk(column.Contents())
+		flush()
+	})
+	return sections
+}
+
 //nolint:dupl // Acceptable duplication - type-specific wrapper for movies
 func scrapeMovieTitlesValue(searchResult *types.MovieSearchResponse, region string) types.MovieSearchResponse {
 	dateAdded := searchResult.DateAdded
@@ -249,6 +485,7 @@ func scrapeMovieTitlesValue(searchResult *types.MovieSearchResponse, region stri
 		} else {
 			searchResult.MovieSearchResults[i].ReleaseDate = releaseDate
 		}
+		searchResult.MovieSearchResults[i].Disc, searchResult.MovieSearchResults[i].Price = extractProductDetails(rawData, region)
 
 		if searchResult.MovieSearchResults[i].ReleaseDate.After(dateAdded) {
 			searchResult.MovieSearchResults[i].NewRelease = true
@@ -281,6 +518,11 @@ func scrapeTVTitlesValue(searchResult *types.TVSearchResponse, region string) ty
 		} else {
 			searchResult.TVSearchResults[i].ReleaseDate = releaseDate
 		}
+		// each amazon tv result is a single disc, so its seasons share the page price
+		_, price := extractProductDetails(rawData, region)
+		for j := range searchResult.TVSearchResults[i].Seasons {
+			searchResult.TVSearchResults[i].Seasons[j].Price = price
+		}
 
 		if searchResult.TVSearchResults[i].ReleaseDate.After(dateAdded) {
 			searchResult.TVSearchResults[i].NewRelease = true
@@ -290,12 +532,12 @@ func scrapeTVTitlesValue(searchResult *types.TVSearchResponse, region string) ty
 }
 
 // searchMovieValue is a value-returning version for use with iter.Map
-func searchMovieValue(plexMovie *types.PlexMovie, language, region string) types.MovieSearchResponse {
+func searchMovieValue(plexMovie *types.PlexMovie, language, region string, detector *health.BreakageDetector) types.MovieSearchResponse {
 	result := types.MovieSearchResponse{}
 	result.PlexMovie = *plexMovie
 
 	urlEncodedTitle := url.QueryEscape(plexMovie.Title)
-	searchURL := amazonURL + urlEncodedTitle
+	searchURL := amazonURL.String() + "/movies/search.php?keyword=" + urlEncodedTitle
 	// this searches for the movie in a language
 	switch language {
 	case LanguageGerman:
@@ -309,22 +551,24 @@ func searchMovieValue(plexMovie *types.PlexMovie, language, region string) types
 	rawData, err := makeRequest(searchURL, region)
 	if err != nil {
 		slog.Error("searchMovie: error making request", "error", err)
+		result.SearchFailed = true
 		return result
 	}
 
-	moviesFound, _ := findTitlesInResponse(rawData, true)
+	moviesFound, _, structurallyEmpty := findTitlesInResponse(rawData, true)
+	detector.Record(structurallyEmpty)
 	result.MovieSearchResults = moviesFound
 	result = utils.MarkBestMatchMovieResponse(&result)
 	return result
 }
 
 // searchTVValue is a value-returning version for use with iter.Map
-func searchTVValue(plexTVShow *types.PlexTVShow, language, region string) types.TVSearchResponse {
+func searchTVValue(plexTVShow *types.PlexTVShow, language, region string, detector *health.BreakageDetector) types.TVSearchResponse {
 	result := types.TVSearchResponse{}
 	result.PlexTVShow = *plexTVShow
 
 	urlEncodedTitle := url.QueryEscape(plexTVShow.Title)
-	searchURL := amazonURL + urlEncodedTitle
+	searchURL := amazonURL.String() + "/movies/search.php?keyword=" + urlEncodedTitle
 	// this searches for the TV show in a language
 	switch language {
 	case LanguageGerman:
@@ -337,10 +581,12 @@ func searchTVValue(plexTVShow *types.PlexTVShow, language, region string) types.
 	rawData, err := makeRequest(searchURL, region)
 	if err != nil {
 		slog.Error("searchTV: error making request", "error", err)
+		result.SearchFailed = true
 		return result
 	}
 
-	_, titlesFound := findTitlesInResponse(rawData, false)
+	_, titlesFound, structurallyEmpty := findTitlesInResponse(rawData, false)
+	detector.Record(structurallyEmpty)
 	// sort the seasons
 	sort.Slice(titlesFound, func(i, j int) bool {
 		if len(titlesFound[i].Seasons) == 0 || len(titlesFound[j].Seasons) == 0 {
@@ -371,68 +617,60 @@ func searchTVValue(plexTVShow *types.PlexTVShow, language, region string) types.
 	return result
 }
 
-func findTitlesInResponse(response string, movie bool) (movieResults []types.MovieSearchResult, tvResults []types.TVSearchResult) {
-	// Find the start and end index of the entry
-	for {
-		startIndex := strings.Index(response, `<a class="hoverlink" data-globalproductid=`)
-		// remove everything before the start index
-		if startIndex == -1 {
-			break
-		}
-		response = response[startIndex:]
-		endIndex := strings.Index(response, `</div></div>`)
-		// If both start and end index are found
-		if endIndex != -1 {
-			// Extract the entry
-			entry := response[0:endIndex]
-			// Find the URL
-			urlStartIndex := strings.Index(entry, "href=\"") + len("href=\"")
-			urlEndIndex := strings.Index(entry[urlStartIndex:], "\"") + urlStartIndex
-			returnURL := entry[urlStartIndex:urlEndIndex]
-			// Find the title
-			r := regexp.MustCompile(`title="(.*?)\s*\((.*?)\)"`)
-			// Find the first match
-			match := r.FindStringSubmatch(entry)
-
-			if match != nil {
-				// Extract and print title and year
-				foundTitle := match[1]
-				year := match[2]
-				// Find the formats of the movie
-				// if the title ends with 4k, then it is 4k
-				var format string
-				if strings.HasSuffix(foundTitle, " 4K") {
-					format = types.Disk4K
-					foundTitle = strings.TrimSuffix(foundTitle, " 4K")
-				} else {
-					foundTitle = strings.TrimSuffix(foundTitle, " Blu-ray")
-					format = types.DiskBluray
-				}
-
-				if movie {
-					movieResults = append(movieResults, types.MovieSearchResult{
-						URL: returnURL, Format: format, Year: year, FoundTitle: foundTitle, UITitle: format})
-				} else {
-					decipheredTitle, number, boxSet, boxSetTitle := decipherTVName(foundTitle)
-					// split year
-					splitYear := strings.Split(year, "-")
-					if len(splitYear) > 0 {
-						year = strings.Trim(splitYear[0], " ")
-					}
-					tvResult := types.TVSearchResult{
-						URL: returnURL, Format: []string{format}, FirstAiredYear: year, FoundTitle: decipheredTitle, UITitle: decipheredTitle}
-					tvResult.Seasons = append(tvResult.Seasons, types.TVSeasonResult{
-						URL: returnURL, Format: format, Number: number, BoxSet: boxSet, BoxSetName: boxSetTitle})
-					tvResults = append(tvResults, tvResult)
-				}
-			}
-			// remove the movie entry from the response
-			response = response[endIndex:]
+func findTitlesInResponse(response string, movie bool) (movieResults []types.MovieSearchResult, tvResults []types.TVSearchResult, structurallyEmpty bool) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(response))
+	if err != nil {
+		slog.Error("findTitlesInResponse: error parsing HTML", "error", err)
+		return movieResults, tvResults, true
+	}
+	entries := doc.Find("a.hoverlink[data-globalproductid]")
+	entries.Each(func(_ int, entry *goquery.Selection) {
+		returnURL, _ := entry.Attr("href")
+		title, _ := entry.Attr("title")
+		match := titleYearRegex.FindStringSubmatch(strings.TrimSpace(title))
+		if match == nil {
+			return
+		}
+		foundTitle := match[1]
+		year := match[2]
+		// if the title ends with 4k, then it is 4k
+		var format string
+		if strings.HasSuffix(foundTitle, " 4K") {
+			format = types.Disk4K
+			foundTitle = strings.TrimSuffix(foundTitle, " 4K")
 		} else {
-			break
+			foundTitle = strings.TrimSuffix(foundTitle, " Blu-ray")
+			format = types.DiskBluray
+		}
+
+		if movie {
+			movieResults = append(movieResults, types.MovieSearchResult{
+				URL: returnURL, Format: format, Year: year, FoundTitle: foundTitle, UITitle: format})
+			return
 		}
+		decipheredTitle, number, boxSet, boxSetTitle := decipherTVName(foundTitle)
+		// split year
+		splitYear := strings.Split(year, "-")
+		if len(splitYear) > 0 {
+			year = strings.Trim(splitYear[0], " ")
+		}
+		tvResult := types.TVSearchResult{
+			URL: returnURL, Format: []string{format}, FirstAiredYear: year, FoundTitle: decipheredTitle, UITitle: decipheredTitle}
+		tvResult.Seasons = append(tvResult.Seasons, types.TVSeasonResult{
+			URL: returnURL, Format: format, Number: number, BoxSet: boxSet, BoxSetName: boxSetTitle})
+		tvResults = append(tvResults, tvResult)
+	})
+	return movieResults, tvResults, entries.Length() == 0 && !isSearchPage(doc)
+}
+
+// isSearchPage reports whether a page without results is still a blu-ray.com search page, one whose results heading
+// counts no matches or, without a heading, one that has the search form. A heading counting matches the parser did
+// not find means the result markup has changed.
+func isSearchPage(doc *goquery.Document) bool {
+	if match := matchCountRegex.FindStringSubmatch(doc.Find("h2.oswaldcollection").Text()); match != nil {
+		return match[1] == "0"
 	}
-	return movieResults, tvResults
+	return doc.Find("form#quicksearch_form, form[name=sortbyform]").Length() > 0
 }
 
 func makeRequest(inputURL, region string) (response string, err error) {
@@ -3,9 +3,13 @@ package amazon
 import (
 	"context"
 	"fmt"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/tphoney/plex-lookup/fixtures"
 	"github.com/tphoney/plex-lookup/types"
 )
 
@@ -25,7 +29,7 @@ func TestFindMoviesInResponse(t *testing.T) {
 		t.Errorf("Error reading testdata/cats_search.html: %s", err)
 	}
 
-	searchResult, _ := findTitlesInResponse(string(rawdata), true)
+	searchResult, _, _ := findTitlesInResponse(string(rawdata), true)
 
 	if len(searchResult) != 19 {
 		t.Fatalf("Expected 2 search result, but got %d", len(searchResult))
@@ -44,7 +48,7 @@ func TestFindMoviesInResponse(t *testing.T) {
 }
 
 func TestSearchAmazon(t *testing.T) {
-	result := MoviesInParallel(context.Background(), nil, []types.PlexMovie{{Title: "napoleon dynamite", Year: "2004"}}, "", amazonRegion)
+	result, _ := MoviesInParallel(context.Background(), nil, []types.PlexMovie{{Title: "napoleon dynamite", Year: "2004"}}, "", amazonRegion)
 	if len(result) == 0 {
 		t.Errorf("Expected search results, but got none")
 	}
@@ -67,7 +71,7 @@ func TestSearchAmazonTV(t *testing.T) {
 		Title: "Star Trek: Enterprise",
 		Year:  "2001",
 	}
-	result := TVInParallel(t.Context(), nil, []types.PlexTVShow{show}, "", amazonRegion)
+	result, _ := TVInParallel(t.Context(), nil, []types.PlexTVShow{show}, "", amazonRegion)
 
 	if len(result) == 0 {
 		t.Errorf("Expected search results, but got none")
@@ -163,3 +167,184 @@ func Test_decipherTVName(t *testing.T) {
 		})
 	}
 }
+
+func TestMoviesInParallelOffline(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+	SetURL(fixtures.ProviderURLs(server.URL).Amazon)
+	defer SetURL("")
+
+	result, _ := MoviesInParallel(t.Context(), nil, []types.PlexMovie{{Title: "Cats", Year: "1998"}}, "", amazonRegion)
+	if len(result) != 1 || len(result[0].MovieSearchResults) == 0 {
+		t.Fatalf("Expected recorded search results, but got %v", result)
+	}
+	if !strings.HasPrefix(result[0].MovieSearchResults[0].URL, server.URL) {
+		t.Errorf("Expected result url to point at the fixture server, but got %s", result[0].MovieSearchResults[0].URL)
+	}
+
+	scraped := ScrapeMovieTitlesParallel(t.Context(), nil, []types.MovieSearchResponse{{
+		MovieSearchResults: []types.MovieSearchResult{{
+			URL:       server.URL + fixtures.BlurayPrefix + "/movies/Anchorman-The-Legend-of-Ron-Burgundy-Blu-ray/13517/",
+			BestMatch: true,
+		}},
+	}}, amazonRegion)
+	if scraped[0].MovieSearchResults[0].ReleaseDate.IsZero() {
+		t.Errorf("Expected a release date from the recorded detail page")
+	}
+	if len(scraped[0].MovieSearchResults[0].Disc.AudioTracks) == 0 {
+		t.Errorf("Expected disc audio tracks from the recorded detail page")
+	}
+	if scraped[0].MovieSearchResults[0].Price != (types.Price{Amount: 17.35, Currency: "GBP"}) {
+		t.Errorf("Expected the new from price of the recorded detail page, but got %+v", scraped[0].MovieSearchResults[0].Price)
+	}
+}
+
+func TestExtractDiscDetails(t *testing.T) {
+	rawdata, err := os.ReadFile("testdata/anchorman.html")
+	if err != nil {
+		t.Fatalf("Error reading testdata/anchorman.html: %s", err)
+	}
+	// trimmed from a 4K product page
+	uhdPage := `<span id="runtime" title="2 hr 35 min">155 min</span><table><tr><td>
+		<span class="subheading">Video</span><br>
+Codec: HEVC / H.265 (61.47 Mbps)<br>Resolution: Native 4K (2160p)<br>HDR: Dolby Vision, HDR10<br>
+<br>
+		<span class="subheading">Audio</span><br>
+		<div id="shortaudio">
+English: Dolby Atmos<br>English: Dolby TrueHD 7.1<br>German: DTS:X<br></div>
+<br>		<span class="subheading">Subtitles</span><br>
+		<div id="shortsubs">
+English&nbsp;SDH, German		</div>
+<br><span class="subheading">Playback</span><br>
+4K Blu-ray: Region free<br>2K Blu-ray: Region B (A, C untested)
+<br></td></tr></table>`
+
+	tests := []struct {
+		name string
+		page string
+		want types.DiscDetails
+	}{
+		{
+			name: "blu-ray",
+			page: string(rawdata),
+			want: types.DiscDetails{
+				VideoCodec:      "MPEG-4 AVC",
+				VideoResolution: "1080p",
+				AudioTracks: []types.DiscAudioTrack{
+					{Language: "English", Format: "DTS-HD Master Audio 5.1"},
+					{Language: "French", Format: "Dolby Digital 5.1"},
+					{Language: "Spanish", Format: "Dolby Digital 5.1"},
+				},
+				Subtitles:      []string{"English", "English SDH", "French", "Spanish"},
+				RegionCodes:    []string{"A", "B", "C"},
+				RuntimeMinutes: 97,
+			},
+		},
+		{
+			name: "4k blu-ray with a region locked 2k disc",
+			page: uhdPage,
+			want: types.DiscDetails{
+				VideoCodec:      "HEVC / H.265",
+				VideoResolution: "Native 4K (2160p)",
+				HDRFormats:      []string{"Dolby Vision", "HDR10"},
+				AudioTracks: []types.DiscAudioTrack{
+					{Language: "English", Format: "Dolby Atmos"},
+					{Language: "English", Format: "Dolby TrueHD 7.1"},
+					{Language: "German", Format: "DTS:X"},
+				},
+				Subtitles:      []string{"English SDH", "German"},
+				RegionCodes:    []string{"B"},
+				RuntimeMinutes: 155,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := extractProductDetails(tt.page, amazonRegion)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractDiscDetails() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractPrice(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		region string
+		want   types.Price
+	}{
+		{
+			name:   "new from price",
+			lines:  []string{"List price: £12.99", "New from: £17.35", "Used from: £2.50 (Save 81%)"},
+			region: "uk",
+			want:   types.Price{Amount: 17.35, Currency: "GBP"},
+		},
+		{
+			name:   "list price only",
+			lines:  []string{"List price: $24.99"},
+			region: "us",
+			want:   types.Price{Amount: 24.99, Currency: "USD"},
+		},
+		{
+			name:   "dollar currency comes from the region",
+			lines:  []string{"New from: $1,029.99"},
+			region: "ca",
+			want:   types.Price{Amount: 1029.99, Currency: "CAD"},
+		},
+		{
+			name:   "decimal comma",
+			lines:  []string{"New from: 19,99 €"},
+			region: "de",
+			want:   types.Price{Amount: 19.99, Currency: "EUR"},
+		},
+		{
+			name:   "no price",
+			lines:  []string{"Buy new on Amazon"},
+			region: "uk",
+			want:   types.Price{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractPrice(tt.lines, tt.region); got != tt.want {
+				t.Errorf("extractPrice() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindTitlesStructurallyEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		page     string
+		wantHits bool
+		want     bool
+	}{
+		{name: "results", file: "testdata/cats_search.html", wantHits: true, want: false},
+		{name: "no results", file: "testdata/no_results.html", want: false},
+		{name: "results the parser missed", page: `<h2 class="oswaldcollection">Search movies (22 matches)</h2><a class="movie" href="/movies/Cats-Blu-ray/1/" title="Cats (1998)">Cats</a>`, want: true},
+		{name: "unrecognised page", page: `<html><body><h1>Service unavailable</h1></body></html>`, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := tt.page
+			if tt.file != "" {
+				rawdata, err := os.ReadFile(tt.file)
+				if err != nil {
+					t.Fatalf("Error reading %s: %s", tt.file, err)
+				}
+				page = string(rawdata)
+			}
+			movies, _, structurallyEmpty := findTitlesInResponse(page, true)
+			if (len(movies) > 0) != tt.wantHits {
+				t.Errorf("findTitlesInResponse() found %d movies, want hits %v", len(movies), tt.wantHits)
+			}
+			if structurallyEmpty != tt.want {
+				t.Errorf("findTitlesInResponse() structurallyEmpty = %v, want %v", structurallyEmpty, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package audioquality
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/sourcegraph/conc/iter"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+const (
+	// mixedCodec is the codec of an album whose tracks use more than one
+	mixedCodec = "mixed"
+	// formatsConcurrency is kept low, MusicBrainz allows one request a second and Discogs rate limits
+	formatsConcurrency = 2
+)
+
+// rippableFormats are the physical formats a lossless copy can be made from, as MusicBrainz and Discogs name them.
+var rippableFormats = []string{"cd", "hdcd", "sacd", "vinyl", "dvd-audio", "blu-ray", "cassette"}
+
+// Album is the audio quality of one owned album, made from the qualities of its tracks.
+type Album struct {
+	Artist    string `json:"artist"`
+	Title     string `json:"title"`
+	Year      string `json:"year,omitempty"`
+	RatingKey string `json:"ratingKey"`
+	Tracks    int    `json:"tracks"`
+	types.AudioQuality
+	// Formats are the physical formats the album was released on, filled in by FormatsInParallel
+	Formats []string `json:"formats,omitempty"`
+	Err     error    `json:"-"`
+}
+
+// Report counts the albums by quality and lists the lossy ones, the lowest bitrate first, as re-rip candidates.
+type Report struct {
+	Albums     int     `json:"albums"`
+	Lossless   int     `json:"lossless"`
+	Lossy      int     `json:"lossy"`
+	Unknown    int     `json:"unknown"`
+	Candidates []Album `json:"candidates"`
+}
+
+// Albums groups the track qualities by album. Albums without tracks in the listing are left out.
+func Albums(artists []types.PlexMusicArtist, tracks []types.PlexTrackQuality) (albums []Album) {
+	byAlbum := make(map[string][]types.AudioQuality)
+	for i := range tracks {
+		byAlbum[tracks[i].AlbumRatingKey] = append(byAlbum[tracks[i].AlbumRatingKey], tracks[i].AudioQuality)
+	}
+	for i := range artists {
+		for _, album := range artists[i].Albums {
+			qualities, found := byAlbum[album.RatingKey]
+			if !found {
+				continue
+			}
+			albums = append(albums, Album{Artist: artists[i].Name, Title: album.Title, Year: album.Year, RatingKey: album.RatingKey,
+				Tracks: len(qualities), AudioQuality: albumQuality(qualities)})
+		}
+	}
+	return albums
+}
+
+// albumQuality sums up the tracks of an album. It is lossless only when every track is, the bitrate is the average
+// and the bit depth and sample rate are the lowest, so one poor track marks the album.
+func albumQuality(tracks []types.AudioQuality) (quality types.AudioQuality) {
+	if len(tracks) == 0 {
+		return quality
+	}
+	quality = types.AudioQuality{Codec: tracks[0].Codec, Lossless: true}
+	total, rated := 0, 0
+	for _, track := range tracks {
+		if track.Codec != quality.Codec {
+			quality.Codec = mixedCodec
+		}
+		quality.Lossless = quality.Lossless && track.Lossless
+		if track.Bitrate > 0 {
+			total += track.Bitrate
+			rated++
+		}
+		quality.BitDepth = lowestKnown(quality.BitDepth, track.BitDepth)
+		quality.SampleRate = lowestKnown(quality.SampleRate, track.SampleRate)
+	}
+	if rated > 0 {
+		quality.Bitrate = total / rated
+	}
+	return quality
+}
+
+// lowestKnown is the smaller of two values, ignoring zeroes which plex uses for unknown.
+func lowestKnown(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// NewReport counts the albums and picks the lossy ones. Albums without a codec are counted as unknown.
+func NewReport(albums []Album) (report Report) {
+	report.Albums = len(albums)
+	for i := range albums {
+		switch {
+		case albums[i].Lossless:
+			report.Lossless++
+		case albums[i].Codec == "":
+			report.Unknown++
+		default:
+			report.Lossy++
+			report.Candidates = append(report.Candidates, albums[i])
+		}
+	}
+	slices.SortStableFunc(report.Candidates, func(a, b Album) int {
+		if byBitrate := cmp.Compare(a.Bitrate, b.Bitrate); byBitrate != 0 {
+			return byBitrate
+		}
+		return cmp.Compare(strings.ToLower(a.Artist+a.Title), strings.ToLower(b.Artist+b.Title))
+	})
+	return report
+}
+
+// FormatsInParallel looks up the physical formats of each album, a failed lookup is kept in the album's Err.
+func FormatsInParallel(ctx context.Context, progressFunc func(), source types.ReleaseFormats, albums []Album) []Album {
+	mapper := iter.Mapper[Album, Album]{
+		MaxGoroutines: formatsConcurrency,
+	}
+	return mapper.Map(albums, func(album *Album) Album {
+		result := *album
+		// Check for cancellation
+		select {
+		case <-ctx.Done():
+			result.Err = ctx.Err()
+			return result
+		default:
+		}
+		result.Formats, result.Err = source.AlbumFormats(ctx, album.Artist, album.Title)
+		if progressFunc != nil {
+			progressFunc()
+		}
+		if result.Err != nil {
+			slog.Debug("album formats lookup failed", "source", source.Name(), "album", album.Title, "error", result.Err)
+		}
+		return result
+	})
+}
+
+// Rippable reports whether any of the formats can be ripped to lossless.
+func Rippable(formats []string) bool {
+	for _, format := range formats {
+		format = strings.ToLower(format)
+		for _, rippable := range rippableFormats {
+			if strings.Contains(format, rippable) {
+				return true
+			}
+		}
+	}
+	return false
+}
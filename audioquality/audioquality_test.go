@@ -0,0 +1,82 @@
+package audioquality
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+type stubFormats struct {
+	formats map[string][]string
+}
+
+func (stubFormats) Name() string { return "stub" }
+
+func (s stubFormats) AlbumFormats(_ context.Context, _, album string) ([]string, error) {
+	formats, found := s.formats[album]
+	if !found {
+		return nil, errors.New("not found")
+	}
+	return formats, nil
+}
+
+func TestAlbumQuality(t *testing.T) {
+	flac := types.AudioQuality{Codec: "flac", Bitrate: 900, BitDepth: 24, SampleRate: 96000, Lossless: true}
+	tests := []struct {
+		name   string
+		tracks []types.AudioQuality
+		want   types.AudioQuality
+	}{
+		{name: "lossless", tracks: []types.AudioQuality{flac, {Codec: "flac", Bitrate: 1100, BitDepth: 16, SampleRate: 44100, Lossless: true}},
+			want: types.AudioQuality{Codec: "flac", Bitrate: 1000, BitDepth: 16, SampleRate: 44100, Lossless: true}},
+		{name: "mixed", tracks: []types.AudioQuality{flac, {Codec: "mp3", Bitrate: 128}},
+			want: types.AudioQuality{Codec: mixedCodec, Bitrate: 514, BitDepth: 24, SampleRate: 96000}},
+		{name: "unknown bitrate", tracks: []types.AudioQuality{{Codec: "aac"}, {Codec: "aac", Bitrate: 256}},
+			want: types.AudioQuality{Codec: "aac", Bitrate: 256}},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := albumQuality(tt.tracks); got != tt.want {
+				t.Errorf("albumQuality() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	artists := []types.PlexMusicArtist{{Name: "Radiohead", Albums: []types.PlexMusicAlbum{
+		{Title: "OK Computer", RatingKey: "1"}, {Title: "Kid A", RatingKey: "2"}, {Title: "Amnesiac", RatingKey: "3"},
+		{Title: "In Rainbows", RatingKey: "4"}, {Title: "Not Listed", RatingKey: "5"}}}}
+	tracks := []types.PlexTrackQuality{
+		{AlbumRatingKey: "1", AudioQuality: types.AudioQuality{Codec: "mp3", Bitrate: 320}},
+		{AlbumRatingKey: "2", AudioQuality: types.AudioQuality{Codec: "flac", Lossless: true}},
+		{AlbumRatingKey: "3", AudioQuality: types.AudioQuality{Codec: "mp3", Bitrate: 128}},
+		{AlbumRatingKey: "4", AudioQuality: types.AudioQuality{}},
+	}
+	albums := Albums(artists, tracks)
+	if len(albums) != 4 {
+		t.Fatalf("Albums() = %+v, want 4 albums", albums)
+	}
+	report := NewReport(albums)
+	if report.Albums != 4 || report.Lossless != 1 || report.Lossy != 2 || report.Unknown != 1 {
+		t.Errorf("NewReport() = %+v", report)
+	}
+	if len(report.Candidates) != 2 || report.Candidates[0].Title != "Amnesiac" || report.Candidates[1].Title != "OK Computer" {
+		t.Errorf("NewReport() candidates = %+v, want the lowest bitrate first", report.Candidates)
+	}
+
+	source := stubFormats{formats: map[string][]string{"Amnesiac": {"CD", "12\" Vinyl"}}}
+	withFormats := FormatsInParallel(t.Context(), nil, source, report.Candidates)
+	if !Rippable(withFormats[0].Formats) || withFormats[0].Err != nil {
+		t.Errorf("FormatsInParallel()[0] = %+v, want rippable formats", withFormats[0])
+	}
+	if withFormats[1].Err == nil || Rippable(withFormats[1].Formats) {
+		t.Errorf("FormatsInParallel()[1] = %+v, want an error", withFormats[1])
+	}
+	if Rippable([]string{"Digital Media"}) {
+		t.Error("Rippable() digital media should not be rippable")
+	}
+}
@@ -14,21 +14,40 @@ import (
 	"strings"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/sourcegraph/conc/iter"
+	"github.com/tphoney/plex-lookup/health"
 	"github.com/tphoney/plex-lookup/types"
 	"github.com/tphoney/plex-lookup/utils"
 )
 
 const (
-	cinemaparadisoSearchURL = "https://www.cinemaparadiso.co.uk/catalog-w/Search.aspx"
-	cinemaparadisoSeriesURL = "https://www.cinemaparadiso.co.uk/ajax/CPMain.wsFilmDescription,CPMain.ashx?_method=ShowSeries&_session=r"
+	ProviderName     = "Cinema Paradiso"
+	DefaultURL       = "https://www.cinemaparadiso.co.uk"
+	searchPath       = "/catalog-w/Search.aspx"
+	seriesPath       = "/ajax/CPMain.wsFilmDescription,CPMain.ashx?_method=ShowSeries&_session=r"
+	rentalPathFormat = "/rentals/%s.html#%s"
 )
 
+var (
+	cinemaparadisoURL = utils.NewBaseURL(DefaultURL)
+	// Matches a search result title such as "Cats (1998)" or "Friends (1994-2004)"
+	titleYearRegex = regexp.MustCompile(`^(.*?)\s*\(([^()]*)\)$`)
+	// Matches the result count in a search message such as "We found 66 results"
+	resultCountRegex = regexp.MustCompile(`(\d+)\s+results?`)
+)
+
+// SetURL points Cinema Paradiso lookups at a mirror, proxy or fixture server. An empty url restores the default.
+func SetURL(baseURL string) {
+	cinemaparadisoURL.Set(baseURL)
+}
+
 // nolint: dupl, nolintlint
-func MoviesInParallel(ctx context.Context, progressFunc func(), plexMovies []types.PlexMovie) (searchResults []types.MovieSearchResponse) {
+func MoviesInParallel(ctx context.Context, progressFunc func(), plexMovies []types.PlexMovie) (searchResults []types.MovieSearchResponse, status health.ParserStatus) {
 	mapper := iter.Mapper[types.PlexMovie, types.MovieSearchResponse]{
 		MaxGoroutines: types.ConcurrencyLimit,
 	}
+	detector := health.NewBreakageDetector(ProviderName)
 	searchResults = mapper.Map(plexMovies, func(pm *types.PlexMovie) types.MovieSearchResponse {
 		// Check for cancellation
 		select {
@@ -36,13 +55,14 @@ func MoviesInParallel(ctx context.Context, progressFunc func(), plexMovies []typ
 			return types.MovieSearchResponse{}
 		default:
 		}
-		result := searchCinemaParadisoMovieResponse(pm)
+		result := searchCinemaParadisoMovieResponse(pm, detector)
 		if progressFunc != nil {
 			progressFunc()
 		}
 		return result
 	})
-	return searchResults
+	status = detector.Finish()
+	return searchResults, status
 }
 
 func ScrapeMoviesParallel(ctx context.Context, progressFunc func(), searchResults []types.MovieSearchResponse) []types.MovieSearchResponse {
@@ -66,10 +86,11 @@ func ScrapeMoviesParallel(ctx context.Context, progressFunc func(), searchResult
 }
 
 // nolint: dupl, nolintlint
-func TVInParallel(ctx context.Context, progressFunc func(), plexTVShows []types.PlexTVShow) (searchResults []types.TVSearchResponse) {
+func TVInParallel(ctx context.Context, progressFunc func(), plexTVShows []types.PlexTVShow) (searchResults []types.TVSearchResponse, status health.ParserStatus) {
 	mapper := iter.Mapper[types.PlexTVShow, types.TVSearchResponse]{
 		MaxGoroutines: types.ConcurrencyLimit,
 	}
+	detector := health.NewBreakageDetector(ProviderName)
 	searchResults = mapper.Map(plexTVShows, func(tv *types.PlexTVShow) types.TVSearchResponse {
 		// Check for cancellation
 		select {
@@ -77,28 +98,31 @@ func TVInParallel(ctx context.Context, progressFunc func(), plexTVShows []types.
 			return types.TVSearchResponse{}
 		default:
 		}
-		result := searchTVShowResponseValue(tv)
+		result := searchTVShowResponseValue(tv, detector)
 		if progressFunc != nil {
 			progressFunc()
 		}
 		return result
 	})
-	return searchResults
+	status = detector.Finish()
+	return searchResults, status
 }
 
 // searchTVShowResponseValue is a value-returning version for use with iter.Map
-func searchTVShowResponseValue(plexTVShow *types.PlexTVShow) types.TVSearchResponse {
+func searchTVShowResponseValue(plexTVShow *types.PlexTVShow, detector *health.BreakageDetector) types.TVSearchResponse {
 	result := types.TVSearchResponse{}
 	urlEncodedTitle := url.QueryEscape(plexTVShow.Title)
 	result.PlexTVShow = *plexTVShow
-	result.SearchURL = cinemaparadisoSearchURL + "?form-search-field=" + urlEncodedTitle
+	result.SearchURL = cinemaparadisoURL.String() + searchPath + "?form-search-field=" + urlEncodedTitle
 	rawData, err := makeRequest(result.SearchURL, http.MethodGet, "")
 	if err != nil {
 		slog.Error("searchTVShow: error making web request", "error", err)
+		result.SearchFailed = true
 		return result
 	}
 
-	_, tvFound := findTitlesInResponse(rawData, false)
+	_, tvFound, structurallyEmpty := findTitlesInResponse(rawData, false)
+	detector.Record(structurallyEmpty)
 	result.TVSearchResults = tvFound
 	result = utils.MarkBestMatchTVResponse(&result)
 	for i := range result.TVSearchResults {
@@ -129,18 +153,20 @@ func searchTVShowResponseValue(plexTVShow *types.PlexTVShow) types.TVSearchRespo
 	return result
 }
 
-func searchCinemaParadisoMovieResponse(plexMovie *types.PlexMovie) types.MovieSearchResponse {
+func searchCinemaParadisoMovieResponse(plexMovie *types.PlexMovie, detector *health.BreakageDetector) types.MovieSearchResponse {
 	result := types.MovieSearchResponse{}
 	result.PlexMovie = *plexMovie
 	urlEncodedTitle := url.QueryEscape(plexMovie.Title)
-	result.SearchURL = cinemaparadisoSearchURL + "?form-search-field=" + urlEncodedTitle
+	result.SearchURL = cinemaparadisoURL.String() + searchPath + "?form-search-field=" + urlEncodedTitle
 	rawData, err := makeRequest(result.SearchURL, http.MethodPost, fmt.Sprintf("form-search-field=%s", urlEncodedTitle))
 	if err != nil {
 		slog.Error("searchCinemaParadisoMovie: error making request", "error", err)
+		result.SearchFailed = true
 		return result
 	}
 
-	moviesFound, _ := findTitlesInResponse(rawData, true)
+	moviesFound, _, structurallyEmpty := findTitlesInResponse(rawData, true)
+	detector.Record(structurallyEmpty)
 	result.MovieSearchResults = moviesFound
 	result = utils.MarkBestMatchMovieResponse(&result)
 	return result
@@ -237,7 +263,7 @@ func findTVSeasonsInResponse(response string) (tvSeasons []types.TVSeasonResult)
 }
 
 func makeSeasonRequest(tv *types.TVSeasonResult) (result []types.TVSeasonResult, err error) {
-	rawData, err := makeRequest(cinemaparadisoSeriesURL, http.MethodPost, fmt.Sprintf("FilmID=%s", tv.URL))
+	rawData, err := makeRequest(cinemaparadisoURL.String()+seriesPath, http.MethodPost, fmt.Sprintf("FilmID=%s", tv.URL))
 	if err != nil {
 		return result, fmt.Errorf("makeSeasonRequest: error making request: %w", err)
 	}
@@ -251,7 +277,7 @@ func makeSeasonRequest(tv *types.TVSeasonResult) (result []types.TVSeasonResult,
 		newSeason := types.TVSeasonResult{}
 		newSeason.Number = tv.Number
 		newSeason.Format = strings.ReplaceAll(match[1], "\\", "")
-		newSeason.URL = fmt.Sprintf("https://www.cinemaparadiso.co.uk/rentals/%s.html#%s", tv.URL, newSeason.Format)
+		newSeason.URL = cinemaparadisoURL.String() + fmt.Sprintf(rentalPathFormat, tv.URL, newSeason.Format)
 		// strip slashes from the date
 		date := strings.ReplaceAll(match[2], "\\", "")
 		var releaseDate time.Time
@@ -265,108 +291,69 @@ func makeSeasonRequest(tv *types.TVSeasonResult) (result []types.TVSeasonResult,
 	return result, nil
 }
 
-func findTitlesInResponse(response string, movie bool) (movieResults []types.MovieSearchResult, tvResults []types.TVSearchResult) {
-	// look for the movies in the response
-	// will be surrounded by <li class="clearfix"> and </li>
-	// Find the start and end index of the movie entry
-	for {
-		startIndex := strings.Index(response, "<li class=\"clearfix\">")
-		// remove everything before the start index
-		if startIndex == -1 {
-			break
+func findTitlesInResponse(response string, movie bool) (movieResults []types.MovieSearchResult, tvResults []types.TVSearchResult, structurallyEmpty bool) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(response))
+	if err != nil {
+		slog.Error("findTitlesInResponse: error parsing HTML", "error", err)
+		return movieResults, tvResults, true
+	}
+	// each movie/TV show is a <li class="clearfix"> inside the search results
+	entries := doc.Find("div.search-results li.clearfix")
+	entries.Each(func(_ int, entry *goquery.Selection) {
+		// the image link comes first, fall back to the title link
+		returnURL, ok := entry.Find("a[href]").First().Attr("href")
+		if !ok {
+			return
 		}
-		response = response[startIndex:]
-		endIndex := strings.Index(response, "</a></div>")
-
-		// If both start and end index are found
-		if endIndex != -1 {
-			// Extract the movie entry
-			movieEntry := response[0:endIndex]
-
-			// Find the URL of the movie/TV show
-			// For TV shows with h4 tags, the URL might be in the h4 link or the image link
-			urlStartIndex := strings.Index(movieEntry, "href=\"")
-			if urlStartIndex == -1 {
-				response = response[endIndex:]
-				continue
-			}
-			urlStartIndex += len("href=\"")
-			urlEndIndex := strings.Index(movieEntry[urlStartIndex:], "\"")
-			if urlEndIndex == -1 {
-				response = response[endIndex:]
-				continue
-			}
-			urlEndIndex += urlStartIndex
-			returnURL := movieEntry[urlStartIndex:urlEndIndex]
-			// Make sure URL is absolute
-			if !strings.HasPrefix(returnURL, "http") {
-				returnURL = "https://www.cinemaparadiso.co.uk" + returnURL
-			}
-
-			// Find the formats of the movies
-			formats := extractDiscFormats(movieEntry)
-
-			// Find the title of the movie/TV show
-			// For movies: <a>Title (Year)</a>
-			// For TV shows: <a>Title</a> or <a>Title (Year)</a> or <h4><a>Title</a></h4>
-			var r *regexp.Regexp
-			if movie {
-				r = regexp.MustCompile(`<a.*?>(.*?)\s*\((.*?)\)</a>`)
-			} else {
-				// For TV shows, try both patterns: with year and without year, and handle h4 tags
-				// Check for year pattern first (more specific), then h4 with year, then h4 without year
-				r = regexp.MustCompile(`<a[^>]*>(.*?)\s*\((.*?)\)</a>|<h4><a[^>]*>(.*?)\s*\((.*?)\)</a></h4>|<h4><a[^>]*>(.*?)</a></h4>`)
-			}
-
-			// Find the first match
-			match := r.FindStringSubmatch(movieEntry)
+		// Make sure URL is absolute
+		if !strings.HasPrefix(returnURL, "http") {
+			returnURL = cinemaparadisoURL.String() + returnURL
+		}
+		formats := extractDiscFormats(entry)
 
-			if match != nil {
-				// Extract and print title and year
-				var foundTitle, year string
-				if movie {
-					foundTitle = match[1]
-					year = match[2]
-				} else {
-					// For TV shows, check which pattern matched
-					if match[1] != "" {
-						// Matched <a>Title (Year)</a> pattern
-						foundTitle = strings.TrimSpace(match[1])
-						year = match[2]
-					} else if match[3] != "" {
-						// Matched <h4><a>Title (Year)</a></h4> pattern
-						foundTitle = strings.TrimSpace(match[3])
-						year = match[4]
-					} else if match[5] != "" {
-						// Matched <h4><a>Title</a></h4> pattern (no year)
-						foundTitle = strings.TrimSpace(match[5])
-						year = "" // No year available
-					} else {
-						// No match, skip
-						response = response[endIndex:]
-						continue
-					}
-				}
-				splitYear := strings.Split(year, "-")
-				year = strings.Trim(splitYear[0], " ")
-				if movie {
-					for _, format := range formats {
-						movieResults = append(movieResults, types.MovieSearchResult{
-							URL: returnURL, Format: format, Year: year, FoundTitle: foundTitle, UITitle: format})
-					}
-				} else {
-					tvResults = append(tvResults, types.TVSearchResult{
-						URL: returnURL, Format: formats, FirstAiredYear: year, FoundTitle: foundTitle, UITitle: foundTitle})
-				}
+		// For movies: Title (Year)
+		// For TV shows: Title (Year) or Title
+		titleLink := entry.Find(".title h4 a").First()
+		if titleLink.Length() == 0 {
+			titleLink = entry.Find("h4 a").First()
+		}
+		titleText := strings.TrimSpace(titleLink.Text())
+		var foundTitle, year string
+		if match := titleYearRegex.FindStringSubmatch(titleText); match != nil {
+			foundTitle = strings.TrimSpace(match[1])
+			year = match[2]
+		} else if !movie && titleText != "" {
+			foundTitle = titleText
+		} else {
+			return
+		}
+		splitYear := strings.Split(year, "-")
+		year = strings.Trim(splitYear[0], " ")
+		if movie {
+			for _, format := range formats {
+				movieResults = append(movieResults, types.MovieSearchResult{
+					URL: returnURL, Format: format, Year: year, FoundTitle: foundTitle, UITitle: format})
 			}
-			// remove the entry from the response
-			response = response[endIndex:]
 		} else {
-			break
+			tvResults = append(tvResults, types.TVSearchResult{
+				URL: returnURL, Format: formats, FirstAiredYear: year, FoundTitle: foundTitle, UITitle: foundTitle})
 		}
-	}
+	})
+
+	return movieResults, tvResults, entries.Length() == 0 && !isSearchPage(doc)
+}
 
-	return movieResults, tvResults
+// isSearchPage reports whether a page without results is still a Cinema Paradiso search page. Every search page has a
+// results message, one counting results the parser did not find means the result markup has changed.
+func isSearchPage(doc *goquery.Document) bool {
+	message := doc.Find("div.search-results-message")
+	if message.Length() == 0 {
+		return false
+	}
+	if match := resultCountRegex.FindStringSubmatch(message.Text()); match != nil {
+		return match[1] == "0"
+	}
+	return true
 }
 
 func makeRequest(urlEncodedTitle, method, content string) (rawResponse string, err error) {
@@ -419,19 +406,11 @@ func makeRequest(urlEncodedTitle, method, content string) (rawResponse string, e
 	return rawData, nil
 }
 
-func extractDiscFormats(movieEntry string) []string {
-	ulStartIndex := strings.Index(movieEntry, `<ul class="media-types">`) + len(`<ul class="media-types">`)
-	ulEndIndex := strings.Index(movieEntry[ulStartIndex:], "</ul>") + ulStartIndex
-	ulChunk := movieEntry[ulStartIndex:ulEndIndex]
-	r := regexp.MustCompile(`title="(.*?)"`)
-
-	// Find all matches
-	matches := r.FindAllStringSubmatch(ulChunk, -1)
-
-	// Extract and return titles
+func extractDiscFormats(entry *goquery.Selection) []string {
 	var formats []string
-	for _, match := range matches {
-		formats = append(formats, strings.TrimSpace(match[1]))
-	}
+	entry.Find("ul.media-types [title]").Each(func(_ int, format *goquery.Selection) {
+		title, _ := format.Attr("title")
+		formats = append(formats, strings.TrimSpace(title))
+	})
 	return formats
 }
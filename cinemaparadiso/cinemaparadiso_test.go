@@ -1,10 +1,14 @@
 package cinemaparadiso
 
 import (
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
+	"github.com/tphoney/plex-lookup/fixtures"
 	"github.com/tphoney/plex-lookup/types"
 )
 
@@ -18,7 +22,11 @@ func TestExtractDiscFormats(t *testing.T) {
 	movieEntry := `<ul class="media-types"><li><span class="cpi-dvd cp-tab" title="DVD" data-json={"action":"media-format","filmId":0,"mediaTypeId":1}></span></li><li><span class="cpi-blu-ray cp-tab" title=" Blu-ray" data-json={"action":"media-format","filmId":0,"mediaTypeId":3}></span></li><li><span class="cpi-4-k cp-tab" title=" 4K Blu-ray" data-json={"action":"media-format","filmId":0,"mediaTypeId":14}></span></li></ul>`
 
 	expectedFormats := []string{types.DiskDVD, types.DiskBluray, types.Disk4K}
-	formats := extractDiscFormats(movieEntry)
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(movieEntry))
+	if err != nil {
+		t.Fatalf("Error parsing movie entry: %s", err)
+	}
+	formats := extractDiscFormats(doc.Selection)
 
 	if len(formats) != len(expectedFormats) {
 		t.Errorf("Expected %d formats, but got %d", len(expectedFormats), len(formats))
@@ -39,7 +47,7 @@ func TestFindTitlesInResponse(t *testing.T) {
 		t.Errorf("Error reading testdata/cats.html: %s", err)
 	}
 
-	searchResult, _ := findTitlesInResponse(string(rawdata), true)
+	searchResult, _, _ := findTitlesInResponse(string(rawdata), true)
 
 	if len(searchResult) != 21 {
 		t.Fatalf("Expected 21 search result, but got %d", len(searchResult))
@@ -162,7 +170,7 @@ func TestSearchCinemaParadisoTV(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got := searchTVShowResponseValue(&tc.show)
+			got := searchTVShowResponseValue(&tc.show, nil)
 
 			if got.SearchURL == "" {
 				t.Errorf("%s: expected searchurl, but got none", tc.name)
@@ -206,7 +214,7 @@ func TestSearchCinemaParadisoMovies(t *testing.T) {
 		Title: "Cats",
 		Year:  "1998",
 	}
-	result := searchCinemaParadisoMovieResponse(&movie)
+	result := searchCinemaParadisoMovieResponse(&movie, nil)
 
 	if len(result.MovieSearchResults) == 0 {
 		t.Errorf("Expected search results, but got none")
@@ -245,3 +253,66 @@ func TestScrapeMovieTitlesParallel(t *testing.T) {
 		t.Errorf("Expected release date, but got none")
 	}
 }
+
+func TestSearchCinemaParadisoOffline(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+	SetURL(fixtures.ProviderURLs(server.URL).CinemaParadiso)
+	defer SetURL("")
+
+	movies, _ := MoviesInParallel(t.Context(), nil, []types.PlexMovie{{Title: "Cats", Year: "1998"}})
+	if len(movies) != 1 || len(movies[0].MovieSearchResults) == 0 {
+		t.Fatalf("Expected recorded movie search results, but got %v", movies)
+	}
+
+	seasons, err := findTVSeasonInfo(server.URL + fixtures.CinemaParadisoPrefix + "/rentals/friends-145582.html")
+	if err != nil {
+		t.Fatalf("findTVSeasonInfo() error = %v", err)
+	}
+	// only series 1 and 2 have recorded formats
+	if len(seasons) != 4 {
+		t.Fatalf("Expected 4 season formats, but got %d: %v", len(seasons), seasons)
+	}
+	if seasons[0].Number != 1 || seasons[0].Format != "DVD" {
+		t.Errorf("Expected series 1 on DVD, but got %v", seasons[0])
+	}
+	if !strings.HasPrefix(seasons[0].URL, server.URL) {
+		t.Errorf("Expected season url to point at the fixture server, but got %s", seasons[0].URL)
+	}
+}
+
+func TestFindTitlesStructurallyEmpty(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		file     string
+		page     string
+		wantHits bool
+		want     bool
+	}{
+		{name: "results", file: "testdata/cats.html", wantHits: true, want: false},
+		{name: "no results", file: "testdata/no_results.html", want: false},
+		{name: "sorry message", page: `<div class="search-results-message"><p>Sorry, we couldn't find any results.</p></div>`, want: false},
+		{name: "results the parser missed", page: `<div class="search-results-message"><p>We found 66 results</p></div><div class="search-results"><ul><li class="film">Cats (1998)</li></ul></div>`, want: true},
+		{name: "unrecognised page", page: `<html><body><h1>Service unavailable</h1></body></html>`, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := tt.page
+			if tt.file != "" {
+				rawdata, err := os.ReadFile(tt.file)
+				if err != nil {
+					t.Fatalf("Error reading %s: %s", tt.file, err)
+				}
+				page = string(rawdata)
+			}
+			movies, _, structurallyEmpty := findTitlesInResponse(page, true)
+			if (len(movies) > 0) != tt.wantHits {
+				t.Errorf("findTitlesInResponse() found %d movies, want hits %v", len(movies), tt.wantHits)
+			}
+			if structurallyEmpty != tt.want {
+				t.Errorf("findTitlesInResponse() structurallyEmpty = %v, want %v", structurallyEmpty, tt.want)
+			}
+		})
+	}
+}
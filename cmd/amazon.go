@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/tphoney/plex-lookup/amazon"
 	"github.com/tphoney/plex-lookup/types"
@@ -22,10 +23,11 @@ movies that of higher quality than DVD.`,
 
 func performAmazonLookup() {
 	initializeFlags()
+	amazon.SetURL(os.Getenv("AMAZON_URL"))
 	if libraryType == types.PlexMovieType {
 		plexMovies := initializePlexMovies()
 		// lets search movies in amazon
-		searchResults := amazon.MoviesInParallel(context.Background(), nil, plexMovies, "", amazonRegion)
+		searchResults, _ := amazon.MoviesInParallel(context.Background(), nil, plexMovies, "", amazonRegion)
 		for i := range searchResults {
 			for _, individualResult := range searchResults[i].MovieSearchResults {
 				if individualResult.BestMatch && (individualResult.Format == types.DiskBluray || individualResult.Format == types.Disk4K) {
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tphoney/plex-lookup/audioquality"
+	"github.com/tphoney/plex-lookup/discogs"
+	"github.com/tphoney/plex-lookup/musicbrainz"
+	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/types"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	audioQualityLibraryID string
+	audioQualityFormats   bool
+	audioQualityBrainzURL string
+	audioQualityJSON      bool
+	audioQualityLookup    string
+)
+
+var audioQualityCmd = &cobra.Command{
+	Use:   "audioquality",
+	Short: "List the lossy albums in your plex music library",
+	Long: `This command counts the lossless and lossy albums in your plex music library and lists the lossy
+ones, lowest bitrate first, as candidates to re-rip. With --formats each lossy album is looked up on
+musicbrainz, or discogs with --formatsLookup discogs and DISCOGS_TOKEN, to show whether it was released on
+CD or vinyl.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		printAudioQuality()
+	},
+}
+
+func init() {
+	audioQualityCmd.Flags().StringVar(&audioQualityLibraryID, "plexMusicLibraryID", "", "Plex Music Library ID")
+	audioQualityCmd.Flags().BoolVar(&audioQualityFormats, "formats", false, "Look up the release formats of the lossy albums")
+	audioQualityCmd.Flags().StringVar(&audioQualityBrainzURL, "musicBrainzURL", "https://musicbrainz.org/ws/2", "MusicBrainz URL")
+	audioQualityCmd.Flags().BoolVar(&audioQualityJSON, "json", false, "Print the report as JSON")
+	audioQualityCmd.Flags().StringVar(&audioQualityLookup, "formatsLookup", "musicbrainz", "Release formats lookup (musicbrainz, discogs)")
+}
+
+func printAudioQuality() {
+	plexIP = rootCmd.PersistentFlags().Lookup("plexIP").Value.String()
+	plexToken = rootCmd.PersistentFlags().Lookup("plexToken").Value.String()
+	if plexIP == "" || plexToken == "" || audioQualityLibraryID == "" {
+		panic("plexIP, plexToken and plexMusicLibraryID are required")
+	}
+	ctx := context.Background()
+	artists, err := plex.Server{IP: plexIP, Token: plexToken}.MusicArtists(ctx, audioQualityLibraryID)
+	if err != nil {
+		panic(err)
+	}
+	tracks, err := plex.GetMusicTrackQualities(plexIP, plexToken, audioQualityLibraryID)
+	if err != nil {
+		panic(err)
+	}
+	report := audioquality.NewReport(audioquality.Albums(artists, tracks))
+	if audioQualityFormats {
+		var source types.ReleaseFormats
+		switch audioQualityLookup {
+		case "musicbrainz":
+			source = musicbrainz.NewClient(audioQualityBrainzURL)
+		case "discogs":
+			discogs.SetURL(os.Getenv("DISCOGS_URL"))
+			source = discogs.NewClient(os.Getenv("DISCOGS_TOKEN"))
+		default:
+			panic("formatsLookup must be musicbrainz or discogs")
+		}
+		report.Candidates = audioquality.FormatsInParallel(ctx, nil, source, report.Candidates)
+	}
+	if audioQualityJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(report); encodeErr != nil {
+			panic(encodeErr)
+		}
+		return
+	}
+	for i := range report.Candidates {
+		album := report.Candidates[i]
+		fmt.Printf("%s - %s [%s]: %s %d kbps", album.Artist, album.Title, album.Year, album.Codec, album.Bitrate)
+		if len(album.Formats) > 0 {
+			fmt.Printf(", released on %s", strings.Join(album.Formats, ", "))
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%d albums: %d lossless, %d lossy, %d unknown\n", report.Albums, report.Lossless, report.Lossy, report.Unknown)
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/tphoney/plex-lookup/cinemaparadiso"
 	"github.com/tphoney/plex-lookup/types"
@@ -22,10 +23,11 @@ movies that of higher quality than DVD.`,
 
 func performCinemaParadisoLookup() {
 	initializeFlags()
+	cinemaparadiso.SetURL(os.Getenv("CINEMAPARADISO_URL"))
 	if libraryType == types.PlexMovieType {
 		plexMovies := initializePlexMovies()
 		// lets search movies in cinemaparadiso
-		searchResults := cinemaparadiso.MoviesInParallel(context.Background(), nil, plexMovies)
+		searchResults, _ := cinemaparadiso.MoviesInParallel(context.Background(), nil, plexMovies)
 		// if hit, and contains any format that isnt dvd, print the movie
 		for i := range searchResults {
 			for _, individualResult := range searchResults[i].MovieSearchResults {
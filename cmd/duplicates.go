@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tphoney/plex-lookup/duplicates"
+	"github.com/tphoney/plex-lookup/plex"
+
+	"github.com/spf13/cobra"
+)
+
+var duplicatesJSON bool
+
+var duplicatesCmd = &cobra.Command{
+	Use:   "duplicates",
+	Short: "List the movies in your plex library with more than one copy",
+	Long: `This command lists the movies with several versions, or added more than once, and the lower
+resolution copies that can be deleted once a better copy exists.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		printDuplicates()
+	},
+}
+
+func init() {
+	duplicatesCmd.Flags().BoolVar(&duplicatesJSON, "json", false, "Print the report as JSON")
+}
+
+func printDuplicates() {
+	initializeFlags()
+	if plexIP == "" {
+		panic("plexIP Address is required")
+	}
+	if plexToken == "" {
+		panic("plexToken is required")
+	}
+	if plexMovieLibraryID == "" {
+		panic("plexMovieLibraryID is required")
+	}
+	movies, err := plex.Server{IP: plexIP, Token: plexToken}.Movies(context.Background(), plexMovieLibraryID)
+	if err != nil {
+		panic(err)
+	}
+	report := duplicates.Movies(movies)
+	if duplicatesJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(report); encodeErr != nil {
+			panic(encodeErr)
+		}
+		return
+	}
+	for _, duplicate := range report.Duplicates {
+		fmt.Printf("%s [%s]\n", duplicate.Title, duplicate.Year)
+		for _, version := range duplicate.Copies {
+			action := "keep"
+			if version.Redundant {
+				action = "delete"
+			}
+			fmt.Printf("  %-6s %-5s %.1f GB %s\n", action, version.Resolution, float64(version.Size)/(1<<30), //nolint:mnd // bytes in a GB
+				strings.Join(version.Files, ", "))
+		}
+	}
+	fmt.Printf("%d duplicated movies, %.1f GB can be reclaimed\n", len(report.Duplicates),
+		float64(report.Reclaimable)/(1<<30)) //nolint:mnd // bytes in a GB
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	"github.com/tphoney/plex-lookup/fixtures"
+)
+
+var (
+	fixturesPort int
+
+	fixturesCmd = &cobra.Command{
+		Use:   "fixtures",
+		Short: "Recorded provider responses for offline testing",
+	}
+
+	fixturesServeCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve recorded blu-ray.com, Cinema Paradiso, Spotify, MusicBrainz, TVmaze, Last.fm, Discogs, Deezer and Plex responses",
+		Long: `This command starts a local server that replays recorded provider responses. Point plex-lookup at it
+with the printed environment variables to run lookups without touching the network.`,
+		Run: func(_ *cobra.Command, _ []string) {
+			serveFixtures()
+		},
+	}
+)
+
+func init() {
+	fixturesServeCmd.Flags().IntVar(&fixturesPort, "port", 9191, "Port to serve fixtures on")
+	fixturesCmd.AddCommand(fixturesServeCmd)
+}
+
+func serveFixtures() {
+	urls := fixtures.ProviderURLs(fmt.Sprintf("http://localhost:%d", fixturesPort))
+	fmt.Printf("Serving fixtures on port %d, use:\n", fixturesPort)
+	fmt.Printf("PLEX_IP=%s\nAMAZON_URL=%s\nCINEMAPARADISO_URL=%s\nSPOTIFY_API_URL=%s\nSPOTIFY_ACCOUNTS_URL=%s\nMUSICBRAINZ_URL=%s\nTVMAZE_URL=%s\nLASTFM_URL=%s\nDISCOGS_URL=%s\nDEEZER_URL=%s\n",
+		urls.Plex, urls.Amazon, urls.CinemaParadiso, urls.SpotifyAPI, urls.SpotifyAccounts, urls.MusicBrainz, urls.TVMaze, urls.LastFM,
+		urls.Discogs, urls.Deezer)
+	err := http.ListenAndServe(fmt.Sprintf(":%d", fixturesPort), fixtures.Handler()) //nolint: gosec
+	if err != nil {
+		slog.Error("Failed to start fixture server", "port", fixturesPort, "error", err)
+		panic(err)
+	}
+}
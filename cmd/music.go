@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tphoney/plex-lookup/completeness"
+	"github.com/tphoney/plex-lookup/deezer"
+	"github.com/tphoney/plex-lookup/discogs"
+	"github.com/tphoney/plex-lookup/musicbrainz"
+	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/spotify"
+	"github.com/tphoney/plex-lookup/types"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	musicLibraryID  string
+	musicLookup     string
+	musicAlbumTypes string
+	musicBrainzURL  string
+	musicTracks     bool
+)
+
+var musicCmd = &cobra.Command{
+	Use:   "music",
+	Short: "Find releases missing from the artists in your plex music library",
+	Long: `This command looks up the artists in your plex music library on spotify or musicbrainz and prints
+the releases that are not in plex. Spotify needs SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET to be set,
+discogs needs DISCOGS_TOKEN and deezer needs nothing.
+With --checkTracks it also prints the owned albums that are missing tracks.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		performMusicLookup()
+	},
+}
+
+func init() {
+	musicCmd.Flags().StringVar(&musicLibraryID, "plexMusicLibraryID", "", "Plex Music Library ID")
+	musicCmd.Flags().StringVar(&musicLookup, "lookup", "spotify", "Lookup service (spotify, musicbrainz, discogs, deezer)")
+	musicCmd.Flags().StringVar(&musicAlbumTypes, "albumTypes", types.AlbumTypeAlbum,
+		"Comma separated release types to look for, eg album,ep,live (album, ep, single, live, compilation, soundtrack, remix)")
+	musicCmd.Flags().StringVar(&musicBrainzURL, "musicBrainzURL", "https://musicbrainz.org/ws/2", "MusicBrainz URL")
+	musicCmd.Flags().BoolVar(&musicTracks, "checkTracks", false, "Compare the tracks of owned albums with the lookup's tracklist")
+}
+
+func performMusicLookup() {
+	plexIP = rootCmd.PersistentFlags().Lookup("plexIP").Value.String()
+	plexToken = rootCmd.PersistentFlags().Lookup("plexToken").Value.String()
+	plexFilter = rootCmd.PersistentFlags().Lookup("plexFilter").Value.String()
+	if plexIP == "" || plexToken == "" || musicLibraryID == "" {
+		panic("plexIP, plexToken and plexMusicLibraryID are required")
+	}
+	albumTypes, err := types.ParseAlbumTypes([]string{musicAlbumTypes})
+	if err != nil {
+		panic(err)
+	}
+	filters, err := plex.ParseFilters(plexFilter)
+	if err != nil {
+		panic(err)
+	}
+	artists, err := plex.GetFilteredMusicArtists(plexIP, plexToken, musicLibraryID, filters)
+	if err != nil {
+		panic(err)
+	}
+	ctx := context.Background()
+	var results []types.MusicSearchResponse
+	var trackList types.TrackList
+	switch musicLookup {
+	case "musicbrainz":
+		client := musicbrainz.NewClient(musicBrainzURL)
+		results = client.GetArtistsInParallel(ctx, nil, artists, albumTypes)
+		trackList = client
+	case "spotify":
+		spotify.SetURLs(os.Getenv("SPOTIFY_API_URL"), os.Getenv("SPOTIFY_ACCOUNTS_URL"))
+		client := spotify.NewClient(os.Getenv("SPOTIFY_CLIENT_ID"), os.Getenv("SPOTIFY_CLIENT_SECRET"))
+		if _, tokenErr := client.Token(ctx); tokenErr != nil {
+			panic(tokenErr)
+		}
+		results = client.GetArtistsInParallel(ctx, nil, artists)
+		results = client.GetAlbumsInParallel(ctx, nil, results, albumTypes)
+		trackList = client
+	case "discogs":
+		discogs.SetURL(os.Getenv("DISCOGS_URL"))
+		client := discogs.NewClient(os.Getenv("DISCOGS_TOKEN"))
+		results = client.GetArtistsInParallel(ctx, nil, artists)
+		results = client.GetAlbumsInParallel(ctx, nil, results, albumTypes)
+		trackList = client
+	case "deezer":
+		deezer.SetURL(os.Getenv("DEEZER_URL"))
+		client := deezer.NewClient()
+		results = client.GetArtistsInParallel(ctx, nil, artists)
+		results = client.GetAlbumsInParallel(ctx, nil, results, albumTypes)
+		trackList = client
+	default:
+		panic("lookup must be spotify, musicbrainz, discogs or deezer")
+	}
+	fmt.Println()
+	results = completeness.SanitizeAlbumTitles(results)
+	for i := range results {
+		if len(results[i].MusicSearchResults) == 0 {
+			continue
+		}
+		found := results[i].MusicSearchResults[0].FoundAlbums
+		var owned []string
+		for _, plexAlbum := range results[i].Albums {
+			owned = append(owned, completeness.MatchingAlbumIDs(plexAlbum, found)...)
+		}
+		for _, album := range found {
+			if slices.Contains(owned, album.ID) {
+				continue
+			}
+			fmt.Printf("%s - %s (%s, %s): %s", results[i].Name, album.Title, album.Year, album.Type, album.URL)
+			if len(album.Formats) > 0 {
+				fmt.Printf(" %s", strings.Join(album.Formats, ", "))
+			}
+			if album.ForSale > 0 {
+				fmt.Printf(", %d for sale from %.2f", album.ForSale, album.LowestPrice)
+			}
+			fmt.Println()
+		}
+	}
+	if musicTracks {
+		printIncompleteAlbums(ctx, trackList, completeness.OwnedAlbums(results))
+	}
+}
+
+func printIncompleteAlbums(ctx context.Context, trackList types.TrackList, albums []completeness.Album) {
+	plexTracks := func(_ context.Context, album *types.PlexMusicAlbum) ([]types.AlbumTrack, error) {
+		return plex.GetAlbumTracks(plexIP, plexToken, album.RatingKey)
+	}
+	incomplete := completeness.Incomplete(completeness.IncompleteInParallel(ctx, nil, trackList, plexTracks, albums))
+	fmt.Printf("\n%d of %d owned albums are missing tracks\n", len(incomplete), len(albums))
+	for i := range incomplete {
+		if incomplete[i].Err != nil {
+			fmt.Printf("%s - %s: unable to check: %s\n", incomplete[i].Artist, incomplete[i].Title, incomplete[i].Err)
+			continue
+		}
+		var missing []string
+		for _, track := range incomplete[i].MissingTracks {
+			missing = append(missing, fmt.Sprintf("%d-%d %s", track.Disc, track.Number, track.Title))
+		}
+		fmt.Printf("%s - %s (%d of %d tracks): missing %s\n", incomplete[i].Artist, incomplete[i].Title,
+			incomplete[i].PlexTracks, incomplete[i].ProviderTracks, strings.Join(missing, ", "))
+	}
+}
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/tphoney/plex-lookup/importlist"
 	"github.com/tphoney/plex-lookup/plex"
 	"github.com/tphoney/plex-lookup/types"
 )
@@ -17,6 +19,8 @@ var (
 	plexIP             string
 	plexMovieLibraryID string
 	plexToken          string
+	plexFilter         string
+	importFile         string
 	libraryType        string
 
 	rootCmd = &cobra.Command{
@@ -34,11 +38,18 @@ func Execute() error {
 	rootCmd.PersistentFlags().StringVar(&plexMovieLibraryID, "plexMovieLibraryID", "", "Plex Library ID")
 	rootCmd.PersistentFlags().StringVar(&plexToken, "plexToken", "", "Plex Token")
 	// add modifier flags
+	rootCmd.PersistentFlags().StringVar(&plexFilter, "plexFilter", "", "Plex filter expression, eg resolution=sd&decade=1990")
+	rootCmd.PersistentFlags().StringVar(&importFile, "importFile", "", "Search the titles in a CSV, Letterboxd export ZIP or Trakt JSON export instead of Plex")
 	rootCmd.PersistentFlags().StringVar(&libraryType, "type", types.PlexMovieType, "Library Type (Movie, TV)")
 	// add subcommands
 	rootCmd.AddCommand(amazonCmd)
+	rootCmd.AddCommand(audioQualityCmd)
 	rootCmd.AddCommand(cinemaParadisoCmd)
+	rootCmd.AddCommand(duplicatesCmd)
+	rootCmd.AddCommand(fixturesCmd)
+	rootCmd.AddCommand(musicCmd)
 	rootCmd.AddCommand(plexCmd)
+	rootCmd.AddCommand(statsCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(webCmd)
 	return rootCmd.Execute()
@@ -48,8 +59,17 @@ func initializeFlags() {
 	plexIP = rootCmd.PersistentFlags().Lookup("plexIP").Value.String()
 	plexMovieLibraryID = rootCmd.PersistentFlags().Lookup("plexMovieLibraryID").Value.String()
 	plexToken = rootCmd.PersistentFlags().Lookup("plexToken").Value.String()
+	plexFilter = rootCmd.PersistentFlags().Lookup("plexFilter").Value.String()
 	libraryType = rootCmd.PersistentFlags().Lookup("type").Value.String()
+	importFile = rootCmd.PersistentFlags().Lookup("importFile").Value.String()
 
+	if libraryType != types.PlexMovieType && libraryType != "TV" {
+		panic("type of library must be Movie or TV")
+	}
+	// an import replaces plex
+	if importFile != "" {
+		return
+	}
 	if plexIP == "" {
 		panic("plexIP Address is required")
 	}
@@ -59,14 +79,29 @@ func initializeFlags() {
 	if plexToken == "" {
 		panic("plexToken is required")
 	}
-	if libraryType != types.PlexMovieType && libraryType != "TV" {
-		panic("type of library must be Movie or TV")
-	}
 }
 
 func initializePlexMovies() []types.PlexMovie {
-	var allMovies []types.PlexMovie
-	allMovies = append(allMovies, plex.AllMovies(plexIP, plexMovieLibraryID, plexToken)...)
+	if importFile != "" {
+		data, err := os.ReadFile(importFile)
+		if err != nil {
+			panic(err)
+		}
+		imported, err := importlist.Parse(importFile, data)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("\nThere are a total of %d movies in %s.\n\nMovies available:\n", len(imported.Movies), importFile)
+		return imported.Movies
+	}
+	filters, err := plex.ParseFilters(plexFilter)
+	if err != nil {
+		panic(err)
+	}
+	allMovies, err := plex.GetFilteredMovies(plexIP, plexToken, plexMovieLibraryID, filters)
+	if err != nil {
+		panic(err)
+	}
 
 	fmt.Printf("\nThere are a total of %d movies in the library.\n\nMovies available:\n", len(allMovies))
 	return allMovies
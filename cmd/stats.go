@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/stats"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsTVLibraryID    string
+	statsMusicLibraryID string
+	statsJSON           bool
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show statistics about your plex libraries",
+	Long: `This command counts the resolutions, codecs, audio languages, file sizes, decades and added dates
+of your movie, TV and music libraries. Libraries without an ID are skipped.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		printStats()
+	},
+}
+
+func init() {
+	statsCmd.Flags().StringVar(&statsTVLibraryID, "plexTVLibraryID", "", "Plex TV Library ID")
+	statsCmd.Flags().StringVar(&statsMusicLibraryID, "plexMusicLibraryID", "", "Plex Music Library ID")
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "Print the statistics as JSON")
+}
+
+func printStats() {
+	// the movie library is optional here, so skip initializeFlags which requires it
+	plexIP = rootCmd.PersistentFlags().Lookup("plexIP").Value.String()
+	plexToken = rootCmd.PersistentFlags().Lookup("plexToken").Value.String()
+	plexMovieLibraryID = rootCmd.PersistentFlags().Lookup("plexMovieLibraryID").Value.String()
+	if plexIP == "" || plexToken == "" {
+		panic("plexIP and plexToken are required")
+	}
+	server := plex.Server{IP: plexIP, Token: plexToken}
+	library, err := stats.Collect(context.Background(), server, plexMovieLibraryID, statsTVLibraryID, statsMusicLibraryID)
+	if err != nil {
+		panic(err)
+	}
+	if statsJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(library); encodeErr != nil {
+			panic(encodeErr)
+		}
+		return
+	}
+	printSection("Movies", library.Movies)
+	printSection("TV", library.TV)
+	printSection("Music", library.Music)
+}
+
+func printSection(title string, section *stats.Section) {
+	if section == nil {
+		return
+	}
+	fmt.Printf("%s: %d titles, %d files, %.1f GB\n", title, section.Titles, section.Files, float64(section.TotalSize)/(1<<30)) //nolint:mnd // bytes in a GB
+	for _, distribution := range []struct {
+		name   string
+		counts []stats.Count
+	}{
+		{"Resolution", section.Resolutions},
+		{"Video codec", section.VideoCodecs},
+		{"Audio codec", section.AudioCodecs},
+		{"Audio language", section.AudioLanguages},
+		{"File size", section.FileSizes},
+		{"Decade", section.Decades},
+		{"Added", section.AddedByYear},
+	} {
+		if len(distribution.counts) == 0 {
+			continue
+		}
+		fmt.Printf("  %s\n", distribution.name)
+		for _, count := range distribution.counts {
+			fmt.Printf("    %-12s %d\n", count.Name, count.Count)
+		}
+	}
+	fmt.Println()
+}
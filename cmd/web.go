@@ -25,6 +25,11 @@ func startServer() {
 	config.PlexTVLibraryID = os.Getenv("PLEX_TV_LIBRARY_ID")
 	config.PlexMusicLibraryID = os.Getenv("PLEX_MUSIC_LIBRARY_ID")
 	config.PlexToken = os.Getenv("PLEX_TOKEN")
+	// jellyfin or emby instead of plex, the library IDs above are used for them too
+	config.MediaServer = os.Getenv("MEDIA_SERVER")
+	config.MediaServerURL = os.Getenv("MEDIA_SERVER_URL")
+	config.MediaServerAPIKey = os.Getenv("MEDIA_SERVER_API_KEY")
+	config.MediaServerUserID = os.Getenv("MEDIA_SERVER_USER_ID")
 	config.AmazonRegion = os.Getenv("AMAZON_REGION")
 	if config.AmazonRegion == "" {
 		config.AmazonRegion = "uk"
@@ -35,6 +40,23 @@ func startServer() {
 	}
 	config.SpotifyClientID = os.Getenv("SPOTIFY_CLIENT_ID")
 	config.SpotifyClientSecret = os.Getenv("SPOTIFY_CLIENT_SECRET")
+	config.LastFMAPIKey = os.Getenv("LASTFM_API_KEY")
+	config.DiscogsToken = os.Getenv("DISCOGS_TOKEN")
+	// provider endpoints, these default to the public sites
+	config.AmazonURL = os.Getenv("AMAZON_URL")
+	config.CinemaParadisoURL = os.Getenv("CINEMAPARADISO_URL")
+	config.SpotifyAPIURL = os.Getenv("SPOTIFY_API_URL")
+	config.SpotifyAccountsURL = os.Getenv("SPOTIFY_ACCOUNTS_URL")
+	config.TVMazeURL = os.Getenv("TVMAZE_URL")
+	config.LastFMURL = os.Getenv("LASTFM_URL")
+	config.DiscogsURL = os.Getenv("DISCOGS_URL")
+	config.DeezerURL = os.Getenv("DEEZER_URL")
+	// price tracking, the history defaults to the user config directory
+	config.PriceHistoryFile = os.Getenv("PRICE_HISTORY_FILE")
+	config.PriceAlertWebhook = os.Getenv("PRICE_ALERT_WEBHOOK")
+	// titles with a better disc available, kept current by the plex webhook
+	config.WantedListFile = os.Getenv("WANTED_LIST_FILE")
+	config.PlexWebhookSecret = os.Getenv("PLEX_WEBHOOK_SECRET")
 
 	web.StartServer(&config)
 }
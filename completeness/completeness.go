@@ -0,0 +1,88 @@
+package completeness
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/sourcegraph/conc/iter"
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
+)
+
+// trackListConcurrency is kept low, the providers rate limit and MusicBrainz allows one request a second.
+const trackListConcurrency = 2
+
+// Album pairs an owned album with the provider's copy of it.
+type Album struct {
+	Artist string
+	Plex   types.PlexMusicAlbum
+	Found  types.MusicAlbumSearchResult
+}
+
+// PlexTracks fetches the tracks of an owned album from the media server.
+type PlexTracks func(ctx context.Context, album *types.PlexMusicAlbum) ([]types.AlbumTrack, error)
+
+// IncompleteInParallel compares the tracks of each album with the provider's tracklist.
+func IncompleteInParallel(ctx context.Context, progressFunc func(), trackList types.TrackList, plexTracks PlexTracks, albums []Album) []types.IncompleteAlbumResponse {
+	mapper := iter.Mapper[Album, types.IncompleteAlbumResponse]{
+		MaxGoroutines: trackListConcurrency,
+	}
+	return mapper.Map(albums, func(album *Album) types.IncompleteAlbumResponse {
+		result := types.IncompleteAlbumResponse{Artist: album.Artist, PlexMusicAlbum: album.Plex, Album: album.Found, TrackList: trackList.Name()}
+		// Check for cancellation
+		select {
+		case <-ctx.Done():
+			result.Err = ctx.Err()
+			return result
+		default:
+		}
+		owned, err := plexTracks(ctx, &album.Plex)
+		var listed []types.AlbumTrack
+		if err == nil {
+			listed, err = trackList.AlbumTracks(ctx, album.Found.ID)
+		}
+		if progressFunc != nil {
+			progressFunc()
+		}
+		if err != nil {
+			slog.Debug("album track lookup failed", "trackList", trackList.Name(), "album", album.Plex.Title, "error", err)
+			result.Err = err
+			return result
+		}
+		result.PlexTracks = len(owned)
+		result.ProviderTracks = len(listed)
+		result.MissingTracks = Missing(owned, listed)
+		return result
+	})
+}
+
+// Missing lists the provider's tracks that are not in Plex. A track is owned when Plex has the same disc and track
+// number, or a track with the same title, which catches albums numbered straight through rather than per disc.
+func Missing(plexTracks, providerTracks []types.AlbumTrack) (missing []types.AlbumTrack) {
+	type position struct{ disc, number int }
+	numbers := make(map[position]bool)
+	titles := make(map[string]bool)
+	for _, track := range plexTracks {
+		numbers[position{max(track.Disc, 1), track.Number}] = true
+		if title := utils.SanitizedAlbumTitle(track.Title); title != "" {
+			titles[title] = true
+		}
+	}
+	for _, track := range providerTracks {
+		if numbers[position{max(track.Disc, 1), track.Number}] || titles[utils.SanitizedAlbumTitle(track.Title)] {
+			continue
+		}
+		missing = append(missing, track)
+	}
+	return missing
+}
+
+// Incomplete keeps the albums with missing tracks, and those that could not be checked.
+func Incomplete(results []types.IncompleteAlbumResponse) (incomplete []types.IncompleteAlbumResponse) {
+	for i := range results {
+		if results[i].Err != nil || len(results[i].MissingTracks) > 0 {
+			incomplete = append(incomplete, results[i])
+		}
+	}
+	return incomplete
+}
@@ -0,0 +1,124 @@
+package completeness
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+type stubTrackList struct {
+	tracks []types.AlbumTrack
+	err    error
+}
+
+func (stubTrackList) Name() string { return "stub" }
+
+func (l stubTrackList) AlbumTracks(_ context.Context, _ string) ([]types.AlbumTrack, error) {
+	return l.tracks, l.err
+}
+
+func TestMissing(t *testing.T) {
+	plexTracks := []types.AlbumTrack{
+		{Disc: 1, Number: 1, Title: "Taxman"},
+		{Disc: 1, Number: 3, Title: "Love You To"},
+		// numbered straight through, disc 2 track 1 on the provider
+		{Disc: 1, Number: 15, Title: "Paperback Writer"},
+		{Number: 4, Title: "Here, There and Everywhere"},
+	}
+	providerTracks := []types.AlbumTrack{
+		{Disc: 1, Number: 1, Title: "Taxman - Remastered 2009"},
+		{Disc: 1, Number: 2, Title: "Eleanor Rigby"},
+		{Disc: 1, Number: 3, Title: "Love You To"},
+		{Disc: 1, Number: 4, Title: "Here There And Everywhere"},
+		{Disc: 2, Number: 1, Title: "Paperback Writer"},
+		{Disc: 2, Number: 2, Title: "Rain"},
+	}
+	got := Missing(plexTracks, providerTracks)
+	want := []types.AlbumTrack{{Disc: 1, Number: 2, Title: "Eleanor Rigby"}, {Disc: 2, Number: 2, Title: "Rain"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Missing() = %v, want %v", got, want)
+	}
+}
+
+func TestIncompleteInParallel(t *testing.T) {
+	albums := []Album{
+		{Artist: "The Beatles", Plex: types.PlexMusicAlbum{Title: "Revolver"}, Found: types.MusicAlbumSearchResult{ID: "revolver"}},
+		{Artist: "The Beatles", Plex: types.PlexMusicAlbum{Title: "Help!"}, Found: types.MusicAlbumSearchResult{ID: "help"}},
+	}
+	plexTracks := func(_ context.Context, album *types.PlexMusicAlbum) ([]types.AlbumTrack, error) {
+		if album.Title == "Help!" {
+			return []types.AlbumTrack{{Disc: 1, Number: 1, Title: "Help!"}, {Disc: 1, Number: 2, Title: "The Night Before"}}, nil
+		}
+		return []types.AlbumTrack{{Disc: 1, Number: 1, Title: "Taxman"}}, nil
+	}
+	trackList := stubTrackList{tracks: []types.AlbumTrack{{Disc: 1, Number: 1, Title: "Help!"}, {Disc: 1, Number: 2, Title: "The Night Before"}}}
+	got := IncompleteInParallel(context.Background(), nil, trackList, plexTracks, albums)
+	if len(got) != 2 || got[0].TrackList != "stub" || got[0].PlexTracks != 1 || got[0].ProviderTracks != 2 || len(got[0].MissingTracks) != 1 {
+		t.Fatalf("IncompleteInParallel() = %+v", got)
+	}
+	if incomplete := Incomplete(got); len(incomplete) != 1 || incomplete[0].Title != "Revolver" {
+		t.Errorf("Incomplete() = %+v", incomplete)
+	}
+
+	failed := IncompleteInParallel(context.Background(), nil, stubTrackList{err: errors.New("down")}, plexTracks, albums[:1])
+	if len(failed) != 1 || failed[0].Err == nil || len(Incomplete(failed)) != 1 {
+		t.Errorf("IncompleteInParallel() expected the error to be reported, got %+v", failed)
+	}
+}
+
+func TestMatchingAlbumIDs(t *testing.T) {
+	plexAlbum := types.PlexMusicAlbum{
+		Title:     "So‐Called Chaos",
+		RatingKey: "94388",
+		Year:      "2004",
+	}
+
+	original := []types.MusicAlbumSearchResult{
+		{SanitizedTitle: "the storm before the calm", ID: "id0"},
+		{SanitizedTitle: "such pretty forks in the mix", ID: "id1"},
+		{SanitizedTitle: "such pretty forks in the road", ID: "id2"},
+		{SanitizedTitle: "jagged little pill", ID: "id3"},
+		{SanitizedTitle: "jagged little pill", ID: "id4"},
+		{SanitizedTitle: "jagged little pill", ID: "id5"},
+		{SanitizedTitle: "jagged little pill", ID: "id6"},
+		{SanitizedTitle: "live at montreux 2012", ID: "id7"},
+		{SanitizedTitle: "havoc and bright lights", ID: "id8"},
+		{SanitizedTitle: "flavours of entanglement", ID: "id9"},
+		{SanitizedTitle: "flavours of entanglement", ID: "id10"},
+		{SanitizedTitle: "jagged little pill", ID: "id11"},
+		{SanitizedTitle: "so-called chaos", ID: "id12"},
+		{SanitizedTitle: "feast on scraps", ID: "id13"},
+		{SanitizedTitle: "under rug swept", ID: "id14"},
+		{SanitizedTitle: "live / unplugged", ID: "id15"},
+		{SanitizedTitle: "supposed former infatuation junkie", ID: "id16"},
+		{SanitizedTitle: "supposed former infatuation junkie", ID: "id17"},
+		{SanitizedTitle: "jagged little pill", ID: "id18"},
+	}
+
+	foundIDs := MatchingAlbumIDs(plexAlbum, original)
+
+	expected := []string{"id12"}
+	if !reflect.DeepEqual(foundIDs, expected) {
+		t.Errorf("Expected %v, got %v", expected, foundIDs)
+	}
+}
+
+func TestOwnedAlbums(t *testing.T) {
+	searchResults := []types.MusicSearchResponse{
+		{
+			PlexMusicArtist: types.PlexMusicArtist{Name: "The Beatles", Albums: []types.PlexMusicAlbum{{Title: "Revolver"}, {Title: "Bootleg"}}},
+			MusicSearchResults: []types.MusicArtistSearchResult{{FoundAlbums: []types.MusicAlbumSearchResult{
+				{ID: "1", Title: "Help!", SanitizedTitle: "help!"},
+				{ID: "2", Title: "Revolver", SanitizedTitle: "revolver"},
+			}}},
+		},
+		{PlexMusicArtist: types.PlexMusicArtist{Name: "Unknown", Albums: []types.PlexMusicAlbum{{Title: "Revolver"}}}},
+	}
+	got := OwnedAlbums(searchResults)
+	if len(got) != 1 || got[0].Artist != "The Beatles" || got[0].Plex.Title != "Revolver" || got[0].Found.ID != "2" {
+		t.Errorf("OwnedAlbums() = %+v", got)
+	}
+}
@@ -0,0 +1,79 @@
+package completeness
+
+import (
+	"sort"
+
+	"github.com/lithammer/fuzzysearch/fuzzy"
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
+)
+
+// SanitizeAlbumTitles sets the SanitizedTitle of every album the lookup found, MatchingAlbumIDs compares them.
+func SanitizeAlbumTitles(searchResults []types.MusicSearchResponse) []types.MusicSearchResponse {
+	for i := range searchResults {
+		if len(searchResults[i].MusicSearchResults) > 0 {
+			for j := range searchResults[i].MusicSearchResults[0].FoundAlbums {
+				searchResults[i].MusicSearchResults[0].FoundAlbums[j].SanitizedTitle =
+					utils.SanitizedAlbumTitle(searchResults[i].MusicSearchResults[0].FoundAlbums[j].Title)
+			}
+		}
+	}
+	return searchResults
+}
+
+// OwnedAlbums pairs each plex album with the best matching album the lookup found, albums it did not find are
+// not checked.
+func OwnedAlbums(searchResults []types.MusicSearchResponse) (albums []Album) {
+	for i := range searchResults {
+		if len(searchResults[i].MusicSearchResults) == 0 {
+			continue
+		}
+		found := searchResults[i].MusicSearchResults[0].FoundAlbums
+		for _, plexAlbum := range searchResults[i].Albums {
+			ids := MatchingAlbumIDs(plexAlbum, found)
+			if len(ids) == 0 {
+				continue
+			}
+			for j := range found {
+				if found[j].ID == ids[0] {
+					albums = append(albums, Album{Artist: searchResults[i].Name, Plex: plexAlbum, Found: found[j]})
+					break
+				}
+			}
+		}
+	}
+	return albums
+}
+
+// MatchingAlbumIDs are the found albums whose sanitised title fuzzily matches the plex album, best match first.
+func MatchingAlbumIDs(plexAlbum types.PlexMusicAlbum, found []types.MusicAlbumSearchResult) (foundIDs []string) {
+	plexSanitizedTitle := utils.SanitizedAlbumTitle(plexAlbum.Title)
+	sanitizedAlbumTitles := make([]string, 0)
+	for _, searchAlbum := range found {
+		sanitizedAlbumTitles = append(sanitizedAlbumTitles, searchAlbum.SanitizedTitle)
+	}
+	matches := fuzzy.RankFind(plexSanitizedTitle, sanitizedAlbumTitles)
+	sort.Sort(matches)
+
+	for _, match := range matches {
+		if match.Distance < 0 {
+			continue // Skip negative scores
+		}
+		// Find the index of the matched album in the found slice
+		for j := range found {
+			if found[j].SanitizedTitle == match.Target {
+				foundIDs = append(foundIDs, found[j].ID)
+			}
+		}
+	}
+	keys := make(map[string]bool)
+	cleaned := []string{}
+
+	for _, entry := range foundIDs {
+		if _, value := keys[entry]; !value {
+			keys[entry] = true
+			cleaned = append(cleaned, entry)
+		}
+	}
+	return cleaned
+}
@@ -0,0 +1,275 @@
+package deezer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/conc/iter"
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
+)
+
+// api docs https://developers.deezer.com/api
+
+const (
+	DefaultURL    = "https://api.deezer.com"
+	ProviderName  = "Deezer"
+	lookupTimeout = 10
+	maxAttempts   = 4
+	// deezer allows 50 requests every 5 seconds
+	deezerConcurrency = 4
+	pageSize          = 100
+	// maxPages stops runaway paging, 1000 releases is more than any artist has
+	maxPages     = 10
+	artistLimit  = 10
+	errorQuota   = 4
+	errorMissing = 800
+	// quotaWait is how long to wait when over the request quota
+	quotaWait = 5 * time.Second
+)
+
+var (
+	deezerURL = utils.NewBaseURL(DefaultURL)
+	// api retries requests over the quota, deezer sends that error with a 200
+	api = &utils.APIClient{
+		Name:          "deezer",
+		Timeout:       lookupTimeout * time.Second,
+		MaxAttempts:   maxAttempts,
+		RateLimitWait: quotaWait,
+		RateLimited: func(body []byte) bool {
+			var errorResponse page
+			return json.Unmarshal(body, &errorResponse) == nil && errorResponse.Error != nil &&
+				errorResponse.Error.Code == errorQuota
+		},
+	}
+	// deezerTypes maps record_type to types.AlbumTypes, deezer does not mark live albums, soundtracks or remixes
+	deezerTypes = map[string]string{
+		"album":   types.AlbumTypeAlbum,
+		"ep":      types.AlbumTypeEP,
+		"single":  types.AlbumTypeSingle,
+		"compile": types.AlbumTypeCompilation,
+	}
+)
+
+// apiError is sent with a 200 status, code 4 is the request quota.
+type apiError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+type page struct {
+	Next  string    `json:"next"`
+	Error *apiError `json:"error"`
+}
+
+type artistsResponse struct {
+	page
+	Data []artist `json:"data"`
+}
+
+type artist struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Link    string `json:"link"`
+	NbAlbum int    `json:"nb_album"`
+	NbFan   int    `json:"nb_fan"`
+}
+
+type albumsResponse struct {
+	page
+	Data []struct {
+		ID          int    `json:"id"`
+		Title       string `json:"title"`
+		Link        string `json:"link"`
+		ReleaseDate string `json:"release_date"`
+		RecordType  string `json:"record_type"`
+	} `json:"data"`
+}
+
+type tracksResponse struct {
+	page
+	Data []struct {
+		Title         string `json:"title"`
+		TrackPosition int    `json:"track_position"`
+		DiskNumber    int    `json:"disk_number"`
+	} `json:"data"`
+}
+
+// SetURL points Deezer lookups at a mirror, proxy or fixture server. An empty url restores the default.
+func SetURL(baseURL string) {
+	deezerURL.Set(baseURL)
+}
+
+// Client searches the public Deezer API, which needs no account.
+type Client struct{}
+
+// NewClient returns a Deezer client.
+func NewClient() *Client {
+	return &Client{}
+}
+
+// Name is shown in the incomplete albums report.
+func (c *Client) Name() string {
+	return ProviderName
+}
+
+// GetArtistsInParallel finds each plex artist on Deezer.
+func (c *Client) GetArtistsInParallel(ctx context.Context, progressFunc func(), plexArtists []types.PlexMusicArtist) []types.MusicSearchResponse {
+	mapper := iter.Mapper[types.PlexMusicArtist, types.MusicSearchResponse]{
+		MaxGoroutines: deezerConcurrency,
+	}
+	return mapper.Map(plexArtists, func(plexArtist *types.PlexMusicArtist) types.MusicSearchResponse {
+		// Check for cancellation
+		select {
+		case <-ctx.Done():
+			return types.MusicSearchResponse{}
+		default:
+		}
+		result, err := c.SearchArtist(ctx, plexArtist)
+		if err != nil {
+			fmt.Printf("deezer: unable to find %s: %s\n", plexArtist.Name, err.Error())
+		}
+		if progressFunc != nil {
+			progressFunc()
+		}
+		fmt.Print(".")
+		return result
+	})
+}
+
+// GetAlbumsInParallel looks up the releases of each artist found by GetArtistsInParallel, keeping the albumTypes.
+func (c *Client) GetAlbumsInParallel(ctx context.Context, progressFunc func(), artistsSearchResults []types.MusicSearchResponse, albumTypes []string) []types.MusicSearchResponse {
+	mapper := iter.Mapper[types.MusicSearchResponse, types.MusicSearchResponse]{
+		MaxGoroutines: deezerConcurrency,
+	}
+	return mapper.Map(artistsSearchResults, func(result *types.MusicSearchResponse) types.MusicSearchResponse {
+		// Check for cancellation
+		select {
+		case <-ctx.Done():
+			return types.MusicSearchResponse{}
+		default:
+		}
+		res := *result
+		if len(res.MusicSearchResults) > 0 {
+			albums, err := c.SearchAlbums(ctx, res.MusicSearchResults[0].ID, albumTypes)
+			if err != nil {
+				fmt.Printf("deezer: unable to find the albums of %s: %s\n", res.Name, err.Error())
+			}
+			res.MusicSearchResults[0].FoundAlbums = albums
+		}
+		if progressFunc != nil {
+			progressFunc()
+		}
+		fmt.Print(".")
+		return res
+	})
+}
+
+// SearchArtist finds the Deezer artist that is the plex artist, see pickArtist.
+func (c *Client) SearchArtist(ctx context.Context, plexArtist *types.PlexMusicArtist) (result types.MusicSearchResponse, err error) {
+	result.PlexMusicArtist = *plexArtist
+	query := url.Values{}
+	query.Set("q", plexArtist.Name)
+	query.Set("limit", strconv.Itoa(artistLimit))
+	var response artistsResponse
+	if err = getJSON(ctx, deezerURL.String()+"/search/artist?"+query.Encode(), &response); err != nil {
+		return result, err
+	}
+	found, ok := pickArtist(plexArtist.Name, response.Data)
+	if !ok {
+		return result, nil
+	}
+	result.MusicSearchResults = append(result.MusicSearchResults, types.MusicArtistSearchResult{
+		Name: found.Name,
+		ID:   strconv.Itoa(found.ID),
+		URL:  found.Link,
+	})
+	return result, nil
+}
+
+// SearchAlbums returns the releases of the albumTypes by the Deezer artist, following the next links. Re-releases
+// with the same title are listed once, the earliest wins.
+func (c *Client) SearchAlbums(ctx context.Context, artistID string, albumTypes []string) (albums []types.MusicAlbumSearchResult, err error) {
+	albumsURL := fmt.Sprintf("%s/artist/%s/albums?limit=%d", deezerURL.String(), url.PathEscape(artistID), pageSize)
+	seen := make(map[string]int)
+	for pages := 0; albumsURL != "" && pages < maxPages; pages++ {
+		var response albumsResponse
+		if err = getJSON(ctx, albumsURL, &response); err != nil {
+			return albums, err
+		}
+		for i := range response.Data {
+			albumType := deezerTypes[response.Data[i].RecordType]
+			if !slices.Contains(albumTypes, albumType) {
+				continue
+			}
+			album := types.MusicAlbumSearchResult{
+				Title: response.Data[i].Title,
+				ID:    strconv.Itoa(response.Data[i].ID),
+				URL:   response.Data[i].Link,
+				Year:  strings.Split(response.Data[i].ReleaseDate, "-")[0],
+				Type:  albumType,
+			}
+			key := utils.SanitizedAlbumTitle(album.Title) + "|" + albumType
+			if j, found := seen[key]; found {
+				if album.Year < albums[j].Year {
+					albums[j] = album
+				}
+				continue
+			}
+			seen[key] = len(albums)
+			albums = append(albums, album)
+		}
+		albumsURL = response.Next
+	}
+	return albums, nil
+}
+
+// AlbumTracks returns the tracklist of a Deezer album.
+func (c *Client) AlbumTracks(ctx context.Context, albumID string) (tracks []types.AlbumTrack, err error) {
+	tracksURL := fmt.Sprintf("%s/album/%s/tracks?limit=%d", deezerURL.String(), url.PathEscape(albumID), pageSize)
+	for pages := 0; tracksURL != "" && pages < maxPages; pages++ {
+		var response tracksResponse
+		if err = getJSON(ctx, tracksURL, &response); err != nil {
+			return tracks, err
+		}
+		for i := range response.Data {
+			tracks = append(tracks, types.AlbumTrack{
+				Disc:   max(response.Data[i].DiskNumber, 1),
+				Number: response.Data[i].TrackPosition,
+				Title:  response.Data[i].Title,
+			})
+		}
+		tracksURL = response.Next
+	}
+	return tracks, nil
+}
+
+// getJSON decodes a Deezer response, waiting and retrying when over the request quota.
+func getJSON(ctx context.Context, inputURL string, target any) error {
+	body, err := api.Get(ctx, inputURL)
+	if err != nil {
+		return err
+	}
+	var errorResponse page
+	if jsonErr := json.Unmarshal(body, &errorResponse); jsonErr != nil {
+		return fmt.Errorf("deezer: unable to parse response: %w", jsonErr)
+	}
+	switch apiErr := errorResponse.Error; {
+	case apiErr == nil:
+		if jsonErr := json.Unmarshal(body, target); jsonErr != nil {
+			return fmt.Errorf("deezer: unable to parse response: %w", jsonErr)
+		}
+		return nil
+	case apiErr.Code == errorMissing:
+		return fmt.Errorf("deezer: not found")
+	default:
+		return fmt.Errorf("deezer: %s: %s", apiErr.Type, apiErr.Message)
+	}
+}
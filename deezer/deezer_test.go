@@ -0,0 +1,83 @@
+package deezer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tphoney/plex-lookup/fixtures/fixturestest"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestDeezerOffline(t *testing.T) {
+	SetURL(fixturestest.Start(t).Deezer)
+	t.Cleanup(func() { SetURL("") })
+	client := NewClient()
+	ctx := context.Background()
+
+	artists := client.GetArtistsInParallel(ctx, nil, []types.PlexMusicArtist{{Name: "The Beatles"}, {Name: "Unknown Artist"}})
+	if len(artists) != 2 || len(artists[0].MusicSearchResults) != 1 {
+		t.Fatalf("GetArtistsInParallel() = %+v", artists)
+	}
+	results := client.GetAlbumsInParallel(ctx, nil, artists, []string{types.AlbumTypeAlbum, types.AlbumTypeEP})
+	albums := results[0].MusicSearchResults[0].FoundAlbums
+	if len(albums) != 3 {
+		t.Fatalf("GetAlbumsInParallel() found %d albums, want 3: %+v", len(albums), albums)
+	}
+	tracks, err := client.AlbumTracks(ctx, albums[0].ID)
+	if err != nil || len(tracks) != 3 {
+		t.Fatalf("AlbumTracks() = %+v, error = %v", tracks, err)
+	}
+
+	// the second page holds the EP, the Revolver re-release is merged and the compilation and single are not wanted
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "artist id", got: artists[0].MusicSearchResults[0].ID, want: "1"},
+		{name: "artist url", got: artists[0].MusicSearchResults[0].URL, want: "https://www.deezer.com/artist/1"},
+		{name: "unknown artist", got: len(artists[1].MusicSearchResults), want: 0},
+		{name: "merged re-release title", got: albums[1].Title, want: "Revolver (Remastered)"},
+		{name: "merged re-release year", got: albums[1].Year, want: "1966"},
+		{name: "second page title", got: albums[2].Title, want: "Magical Mystery Tour (Remastered)"},
+		{name: "second page type", got: albums[2].Type, want: types.AlbumTypeEP},
+		{name: "album track", got: tracks[1], want: types.AlbumTrack{Disc: 1, Number: 2, Title: "Something (Remastered 2009)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %+v, want %+v", tt.got, tt.want)
+			}
+		})
+	}
+
+	if _, err := client.AlbumTracks(ctx, "404"); err == nil {
+		t.Error("AlbumTracks() expected an error for an unknown album")
+	}
+}
+
+func TestQuotaRetry(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) == 1 {
+			fmt.Fprint(w, `{"error": {"type": "Exception", "message": "Quota limit exceeded", "code": 4}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"id": 27, "name": "Daft Punk", "link": "https://www.deezer.com/artist/27"}]}`)
+	}))
+	defer server.Close()
+	SetURL(server.URL)
+	defer SetURL("")
+	defer func(wait time.Duration) { api.RateLimitWait = wait }(api.RateLimitWait)
+	api.RateLimitWait = time.Millisecond
+
+	got, err := NewClient().SearchArtist(context.Background(), &types.PlexMusicArtist{Name: "Daft Punk"})
+	if err != nil || len(got.MusicSearchResults) != 1 || got.MusicSearchResults[0].ID != "27" {
+		t.Errorf("SearchArtist() = %+v, error = %v, want the retried result", got, err)
+	}
+}
@@ -0,0 +1,39 @@
+package deezer
+
+import (
+	"github.com/tphoney/plex-lookup/utils"
+)
+
+// Deezer's search ranks by popularity, so a cover band can come before the artist. A candidate needs one of these
+// name matches to be picked, fans separate candidates with the same name.
+const (
+	exactNameScore = 2
+	nameScore      = 1
+)
+
+// nameMatchScore is how well a Deezer name matches the plex name, 0 for no match.
+func nameMatchScore(plexName, deezerName string) int {
+	if plexName == deezerName {
+		return exactNameScore
+	}
+	if name := utils.NormalisedArtistName(plexName); name != "" && name == utils.NormalisedArtistName(deezerName) {
+		return nameScore
+	}
+	return 0
+}
+
+// pickArtist chooses the best named candidate, the one with the most fans when several match as well, which skips
+// the duplicate profiles deezer has for some artists.
+func pickArtist(plexName string, candidates []artist) (picked artist, found bool) {
+	bestScore := 0
+	for i := range candidates {
+		score := nameMatchScore(plexName, candidates[i].Name)
+		if score == 0 {
+			continue
+		}
+		if score > bestScore || score == bestScore && candidates[i].NbFan > picked.NbFan {
+			picked, bestScore = candidates[i], score
+		}
+	}
+	return picked, bestScore > 0
+}
@@ -0,0 +1,52 @@
+package deezer
+
+import "testing"
+
+func TestNameMatchScore(t *testing.T) {
+	tests := []struct {
+		plexName, deezerName string
+		want                 int
+	}{
+		{plexName: "The Beatles", deezerName: "The Beatles", want: exactNameScore},
+		{plexName: "Beatles", deezerName: "The Beatles", want: nameScore},
+		{plexName: "Beyonce", deezerName: "Beyoncé", want: nameScore},
+		{plexName: "Simon & Garfunkel", deezerName: "Simon and Garfunkel", want: nameScore},
+		{plexName: "The Beatles", deezerName: "The Beatles Tribute Band", want: 0},
+		{plexName: "!!!", deezerName: "Chk Chk Chk", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plexName+"/"+tt.deezerName, func(t *testing.T) {
+			if got := nameMatchScore(tt.plexName, tt.deezerName); got != tt.want {
+				t.Errorf("nameMatchScore(%q, %q) = %d, want %d", tt.plexName, tt.deezerName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickArtist(t *testing.T) {
+	candidates := []artist{
+		{ID: 1, Name: "Nirvana Tribute", NbFan: 9000},
+		{ID: 2, Name: "NIRVANA", NbFan: 10},
+		{ID: 3, Name: "Nirvana", NbFan: 20},
+		{ID: 4, Name: "nirvana", NbFan: 500},
+	}
+	tests := []struct {
+		plexName string
+		want     int
+		found    bool
+	}{
+		// the exact name wins over more fans
+		{plexName: "Nirvana", want: 3, found: true},
+		// without an exact name the most fans wins
+		{plexName: "Nírvana", want: 4, found: true},
+		{plexName: "Bush", found: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plexName, func(t *testing.T) {
+			got, found := pickArtist(tt.plexName, candidates)
+			if found != tt.found || got.ID != tt.want {
+				t.Errorf("pickArtist(%q) = %d, %v, want %d, %v", tt.plexName, got.ID, found, tt.want, tt.found)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package discogs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/conc/iter"
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
+)
+
+// api docs https://www.discogs.com/developers
+
+const (
+	DefaultURL   = "https://api.discogs.com"
+	ProviderName = "Discogs"
+	siteURL      = "https://www.discogs.com"
+	userAgent    = "plex-lookup/0.0.1"
+	// publicHost is limited to 60 authenticated requests a minute, measured over a moving minute
+	publicHost         = "api.discogs.com"
+	publicBurst        = 10
+	lookupTimeout      = 10
+	maxAttempts        = 4
+	rateLimitPause     = 10 * time.Second
+	discogsConcurrency = 2
+	searchPageSize     = 100
+	// maxSearchPages stops runaway paging, 500 masters is more than any artist has
+	maxSearchPages = 5
+)
+
+var (
+	discogsURL    = utils.NewBaseURL(DefaultURL)
+	publicLimiter = utils.NewLimiter(time.Second, publicBurst)
+	// nameNumber is the " (2)" discogs adds to tell artists with the same name apart
+	nameNumber = regexp.MustCompile(`\s\(\d+\)$`)
+	// discPosition is a track position on a numbered disc, eg "2-5" or "CD2-5"
+	discPosition = regexp.MustCompile(`^[A-Za-z]*(\d+)[-.](\d+)$`)
+	// carriers are the format names that are a physical or digital medium, the rest of a format list describes it,
+	// eg "LP", "Album" or "Reissue"
+	carriers = []string{"Vinyl", "CD", "CDr", "SACD", "Cassette", "DVD", "Blu-ray", "File", "Minidisc", "Reel-To-Reel",
+		"8-Track Cartridge", "Shellac", "Flexi-disc", "Lathe Cut", "Hybrid"}
+)
+
+type searchResponse struct {
+	Pagination struct {
+		Page  int `json:"page"`
+		Pages int `json:"pages"`
+	} `json:"pagination"`
+	Results []struct {
+		ID     int      `json:"id"`
+		Type   string   `json:"type"`
+		Title  string   `json:"title"`
+		Year   string   `json:"year"`
+		URI    string   `json:"uri"`
+		Format []string `json:"format"`
+		Label  []string `json:"label"`
+		Style  []string `json:"style"`
+	} `json:"results"`
+}
+
+type masterResponse struct {
+	ID          int     `json:"id"`
+	Title       string  `json:"title"`
+	NumForSale  int     `json:"num_for_sale"`
+	LowestPrice float64 `json:"lowest_price"`
+	Tracklist   []struct {
+		Position string `json:"position"`
+		Type     string `json:"type_"`
+		Title    string `json:"title"`
+	} `json:"tracklist"`
+}
+
+type versionsResponse struct {
+	Versions []struct {
+		ID           int      `json:"id"`
+		Title        string   `json:"title"`
+		MajorFormats []string `json:"major_formats"`
+	} `json:"versions"`
+}
+
+// SetURL points Discogs lookups at a mirror, proxy or fixture server. An empty url restores the default.
+func SetURL(baseURL string) {
+	discogsURL.Set(baseURL)
+}
+
+// Client searches Discogs with a personal access token. Requests to api.discogs.com share one limiter that keeps to
+// its rate limit, a fixture server or proxy is not limited.
+type Client struct {
+	api *utils.APIClient
+}
+
+// NewClient returns a client for a Discogs personal access token, made on the developer settings page.
+func NewClient(token string) *Client {
+	api := &utils.APIClient{
+		Name:          "discogs",
+		Header:        http.Header{"User-Agent": {userAgent}},
+		Timeout:       lookupTimeout * time.Second,
+		MaxAttempts:   maxAttempts,
+		RateLimitWait: rateLimitPause,
+	}
+	if token != "" {
+		api.Header.Set("Authorization", "Discogs token="+token)
+	}
+	if parsed, err := url.Parse(discogsURL.String()); err == nil && parsed.Host == publicHost {
+		api.Limiter = publicLimiter
+	}
+	return &Client{api: api}
+}
+
+// Name is shown in the incomplete albums and audio quality reports.
+func (c *Client) Name() string {
+	return ProviderName
+}
+
+// GetArtistsInParallel finds each plex artist on Discogs.
+func (c *Client) GetArtistsInParallel(ctx context.Context, progressFunc func(), plexArtists []types.PlexMusicArtist) []types.MusicSearchResponse {
+	mapper := iter.Mapper[types.PlexMusicArtist, types.MusicSearchResponse]{
+		MaxGoroutines: discogsConcurrency,
+	}
+	return mapper.Map(plexArtists, func(artist *types.PlexMusicArtist) types.MusicSearchResponse {
+		// Check for cancellation
+		select {
+		case <-ctx.Done():
+			return types.MusicSearchResponse{}
+		default:
+		}
+		result, err := c.SearchArtist(ctx, artist)
+		if err != nil {
+			fmt.Printf("discogs: unable to find %s: %s\n", artist.Name, err.Error())
+		}
+		if progressFunc != nil {
+			progressFunc()
+		}
+		fmt.Print(".")
+		return result
+	})
+}
+
+// GetAlbumsInParallel looks up the releases of each artist found by GetArtistsInParallel, keeping the albumTypes.
+// The albums missing from plex also get their marketplace availability.
+func (c *Client) GetAlbumsInParallel(ctx context.Context, progressFunc func(), artistsSearchResults []types.MusicSearchResponse, albumTypes []string) []types.MusicSearchResponse {
+	mapper := iter.Mapper[types.MusicSearchResponse, types.MusicSearchResponse]{
+		MaxGoroutines: discogsConcurrency,
+	}
+	return mapper.Map(artistsSearchResults, func(result *types.MusicSearchResponse) types.MusicSearchResponse {
+		// Check for cancellation
+		select {
+		case <-ctx.Done():
+			return types.MusicSearchResponse{}
+		default:
+		}
+		res := *result
+		if len(res.MusicSearchResults) > 0 {
+			albums, err := c.SearchAlbums(ctx, res.MusicSearchResults[0].Name, albumTypes)
+			if err != nil {
+				fmt.Printf("discogs: unable to find the albums of %s: %s\n", res.Name, err.Error())
+			}
+			res.MusicSearchResults[0].FoundAlbums = c.addMarketplace(ctx, albums, res.Albums)
+		}
+		if progressFunc != nil {
+			progressFunc()
+		}
+		fmt.Print(".")
+		return res
+	})
+}
+
+// SearchArtist finds the Discogs artist with the plex artist's name, ignoring case, punctuation and the number
+// discogs gives artists that share a name.
+func (c *Client) SearchArtist(ctx context.Context, plexArtist *types.PlexMusicArtist) (artist types.MusicSearchResponse, err error) {
+	artist.PlexMusicArtist = *plexArtist
+	query := url.Values{}
+	query.Set("q", plexArtist.Name)
+	query.Set("type", "artist")
+	var response searchResponse
+	if err = c.getJSON(ctx, discogsURL.String()+"/database/search?"+query.Encode(), &response); err != nil {
+		return artist, err
+	}
+	for i := range response.Results {
+		if artistMatches(plexArtist.Name, response.Results[i].Title) {
+			artist.MusicSearchResults = append(artist.MusicSearchResults, types.MusicArtistSearchResult{
+				Name: response.Results[i].Title,
+				ID:   strconv.Itoa(response.Results[i].ID),
+				URL:  siteLink(response.Results[i].URI),
+			})
+			return artist, nil
+		}
+	}
+	return artist, nil
+}
+
+// SearchAlbums returns the masters credited to the Discogs artist of the albumTypes, with their formats and labels.
+func (c *Client) SearchAlbums(ctx context.Context, artistName string, albumTypes []string) (albums []types.MusicAlbumSearchResult, err error) {
+	query := url.Values{}
+	query.Set("artist", artistName)
+	query.Set("type", "master")
+	query.Set("per_page", strconv.Itoa(searchPageSize))
+	prefix := strings.ToLower(artistName) + " - "
+	for page := 1; page <= maxSearchPages; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var response searchResponse
+		if err = c.getJSON(ctx, discogsURL.String()+"/database/search?"+query.Encode(), &response); err != nil {
+			return albums, err
+		}
+		for i := range response.Results {
+			found := response.Results[i]
+			// the artist search is fuzzy, the title is "Artist - Album"
+			if !strings.HasPrefix(strings.ToLower(found.Title), prefix) {
+				continue
+			}
+			albumType := discogsAlbumType(found.Format, found.Style)
+			if !slices.Contains(albumTypes, albumType) {
+				continue
+			}
+			albums = append(albums, types.MusicAlbumSearchResult{
+				Title:   found.Title[len(prefix):],
+				ID:      strconv.Itoa(found.ID),
+				URL:     siteLink(found.URI),
+				Year:    found.Year,
+				Type:    albumType,
+				Formats: carrierFormats(found.Format),
+				Labels:  unique(found.Label),
+			})
+		}
+		if response.Pagination.Page >= response.Pagination.Pages {
+			break
+		}
+	}
+	return albums, nil
+}
+
+// addMarketplace looks up how many copies are for sale of the albums not in plex, owned albums are left as they are.
+func (c *Client) addMarketplace(ctx context.Context, albums []types.MusicAlbumSearchResult, owned []types.PlexMusicAlbum) []types.MusicAlbumSearchResult {
+	ownedTitles := make(map[string]bool)
+	for i := range owned {
+		ownedTitles[utils.SanitizedAlbumTitle(owned[i].Title)] = true
+	}
+	for i := range albums {
+		if ownedTitles[utils.SanitizedAlbumTitle(albums[i].Title)] || ctx.Err() != nil {
+			continue
+		}
+		master, err := c.master(ctx, albums[i].ID)
+		if err != nil {
+			fmt.Printf("discogs: unable to find the marketplace for %s: %s\n", albums[i].Title, err.Error())
+			continue
+		}
+		albums[i].ForSale = master.NumForSale
+		albums[i].LowestPrice = master.LowestPrice
+	}
+	return albums
+}
+
+// AlbumTracks returns the tracklist of a master. Positions like "2-5" give the disc, vinyl sides and unnumbered
+// tracks are counted through as one disc.
+func (c *Client) AlbumTracks(ctx context.Context, masterID string) (tracks []types.AlbumTrack, err error) {
+	master, err := c.master(ctx, masterID)
+	if err != nil {
+		return tracks, err
+	}
+	counts := make(map[int]int)
+	for _, track := range master.Tracklist {
+		// headings and index tracks group the tracks under them
+		if track.Type != "" && track.Type != "track" {
+			continue
+		}
+		disc, number := 1, 0
+		if match := discPosition.FindStringSubmatch(track.Position); match != nil {
+			disc, _ = strconv.Atoi(match[1])
+			number, _ = strconv.Atoi(match[2])
+		}
+		counts[disc]++
+		if number == 0 {
+			number = counts[disc]
+		}
+		tracks = append(tracks, types.AlbumTrack{Disc: max(disc, 1), Number: number, Title: track.Title})
+	}
+	return tracks, nil
+}
+
+// AlbumFormats returns the formats every version of an album was released on, eg CD, Vinyl or File.
+func (c *Client) AlbumFormats(ctx context.Context, artist, album string) (formats []string, err error) {
+	query := url.Values{}
+	query.Set("artist", artist)
+	query.Set("release_title", album)
+	query.Set("type", "master")
+	var response searchResponse
+	if err = c.getJSON(ctx, discogsURL.String()+"/database/search?"+query.Encode(), &response); err != nil {
+		return formats, err
+	}
+	title := utils.SanitizedAlbumTitle(album)
+	for i := range response.Results {
+		_, foundTitle, found := strings.Cut(response.Results[i].Title, " - ")
+		if !found || utils.SanitizedAlbumTitle(foundTitle) != title {
+			continue
+		}
+		var versions versionsResponse
+		versionsURL := fmt.Sprintf("%s/masters/%d/versions?per_page=%d", discogsURL.String(), response.Results[i].ID, searchPageSize)
+		if err = c.getJSON(ctx, versionsURL, &versions); err != nil {
+			return formats, err
+		}
+		for _, version := range versions.Versions {
+			formats = append(formats, version.MajorFormats...)
+		}
+		return unique(formats), nil
+	}
+	return formats, fmt.Errorf("discogs: %s by %s not found", album, artist)
+}
+
+func (c *Client) master(ctx context.Context, masterID string) (master masterResponse, err error) {
+	err = c.getJSON(ctx, fmt.Sprintf("%s/masters/%s", discogsURL.String(), url.PathEscape(masterID)), &master)
+	return master, err
+}
+
+// getJSON decodes a Discogs response, waiting and retrying when rate limited.
+func (c *Client) getJSON(ctx context.Context, inputURL string, target any) error {
+	err := c.api.GetJSON(ctx, inputURL, target)
+	var statusErr *utils.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("discogs: the token was rejected")
+	}
+	return err
+}
+
+// discogsAlbumType maps the format descriptions and styles of a master to one of types.AlbumTypes. Discogs does not
+// mark live albums or remixes, so those are albums.
+func discogsAlbumType(formats, styles []string) string {
+	switch {
+	case slices.Contains(formats, "Compilation"):
+		return types.AlbumTypeCompilation
+	case slices.Contains(styles, "Soundtrack"):
+		return types.AlbumTypeSoundtrack
+	case slices.Contains(formats, "Single") || slices.Contains(formats, "Maxi-Single"):
+		return types.AlbumTypeSingle
+	case slices.Contains(formats, "EP") || slices.Contains(formats, "Mini-Album"):
+		return types.AlbumTypeEP
+	default:
+		return types.AlbumTypeAlbum
+	}
+}
+
+// artistMatches compares normalised names, ignoring the number discogs adds to artists with the same name.
+func artistMatches(plexName, discogsName string) bool {
+	return utils.NormalisedArtistName(plexName) == utils.NormalisedArtistName(nameNumber.ReplaceAllString(discogsName, ""))
+}
+
+// carrierFormats keeps the media of a format list, dropping descriptions like "LP" or "Reissue".
+func carrierFormats(formats []string) []string {
+	var kept []string
+	for _, format := range formats {
+		if slices.Contains(carriers, format) {
+			kept = append(kept, format)
+		}
+	}
+	return unique(kept)
+}
+
+func unique(values []string) (kept []string) {
+	for _, value := range values {
+		if value != "" && !slices.Contains(kept, value) {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
+
+// siteLink makes the relative uri of a search result a link to the discogs website.
+func siteLink(uri string) string {
+	if strings.HasPrefix(uri, "/") {
+		return siteURL + uri
+	}
+	return uri
+}
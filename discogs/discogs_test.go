@@ -0,0 +1,118 @@
+package discogs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/fixtures/fixturestest"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestDiscogsOffline(t *testing.T) {
+	SetURL(fixturestest.Start(t).Discogs)
+	t.Cleanup(func() { SetURL("") })
+	client := NewClient("token")
+	ctx := context.Background()
+
+	artists := client.GetArtistsInParallel(ctx, nil, []types.PlexMusicArtist{
+		{Name: "The Beatles", Albums: []types.PlexMusicAlbum{{Title: "Revolver"}}}, {Name: "Unknown Artist"}})
+	if len(artists) != 2 || len(artists[0].MusicSearchResults) != 1 {
+		t.Fatalf("GetArtistsInParallel() = %+v", artists)
+	}
+	results := client.GetAlbumsInParallel(ctx, nil, artists, []string{types.AlbumTypeAlbum, types.AlbumTypeEP})
+	albums := results[0].MusicSearchResults[0].FoundAlbums
+	if len(albums) != 4 {
+		t.Fatalf("GetAlbumsInParallel() found %d albums, want 4: %+v", len(albums), albums)
+	}
+	abbeyRoad := albums[0]
+	tracks, err := client.AlbumTracks(ctx, abbeyRoad.ID)
+	if err != nil || len(tracks) != 5 {
+		t.Fatalf("AlbumTracks() = %+v, error = %v", tracks, err)
+	}
+	formats, err := client.AlbumFormats(ctx, "The Beatles", "Abbey Road")
+	if err != nil {
+		t.Fatalf("AlbumFormats() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "artist id", got: artists[0].MusicSearchResults[0].ID, want: "82730"},
+		{name: "artist url", got: artists[0].MusicSearchResults[0].URL, want: "https://www.discogs.com/artist/82730-The-Beatles"},
+		{name: "unknown artist", got: len(artists[1].MusicSearchResults), want: 0},
+		{name: "album title", got: abbeyRoad.Title, want: "Abbey Road"},
+		{name: "album year", got: abbeyRoad.Year, want: "1969"},
+		{name: "album type", got: abbeyRoad.Type, want: types.AlbumTypeAlbum},
+		{name: "album formats", got: abbeyRoad.Formats, want: []string{"Vinyl"}},
+		{name: "album labels", got: abbeyRoad.Labels, want: []string{"Apple Records", "Parlophone"}},
+		{name: "copies for sale", got: abbeyRoad.ForSale, want: 4215},
+		{name: "lowest price", got: abbeyRoad.LowestPrice, want: 2.21},
+		{name: "ep title", got: albums[3].Title, want: "Magical Mystery Tour"},
+		{name: "ep type", got: albums[3].Type, want: types.AlbumTypeEP},
+		{name: "album track", got: tracks[3], want: types.AlbumTrack{Disc: 1, Number: 4, Title: "Here Comes The Sun"}},
+		{name: "formats of every release", got: formats, want: []string{"Vinyl", "CD", "Cassette"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got %+v, want %+v", tt.got, tt.want)
+			}
+		})
+	}
+
+	if _, err := client.AlbumFormats(ctx, "Unknown Artist", "Unknown Album"); err == nil {
+		t.Error("AlbumFormats() expected an error for an unknown album")
+	}
+}
+
+func TestAlbumTracksDiscs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Discogs token=secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": 1, "tracklist": [
+			{"position": "1-1", "type_": "track", "title": "One"},
+			{"position": "1-2", "type_": "track", "title": "Two"},
+			{"position": "CD2-1", "type_": "track", "title": "Three"},
+			{"position": "", "type_": "index", "title": "Medley"}]}`))
+	}))
+	defer server.Close()
+	SetURL(server.URL)
+	defer SetURL("")
+
+	tracks, err := NewClient("secret").AlbumTracks(context.Background(), "1")
+	want := []types.AlbumTrack{{Disc: 1, Number: 1, Title: "One"}, {Disc: 1, Number: 2, Title: "Two"}, {Disc: 2, Number: 1, Title: "Three"}}
+	if err != nil || !reflect.DeepEqual(tracks, want) {
+		t.Errorf("AlbumTracks() = %+v, error = %v, want %+v", tracks, err, want)
+	}
+	if _, err := NewClient("wrong").AlbumTracks(context.Background(), "1"); err == nil {
+		t.Error("AlbumTracks() expected an error for a rejected token")
+	}
+}
+
+func TestArtistMatches(t *testing.T) {
+	tests := []struct {
+		plexName, discogsName string
+		want                  bool
+	}{
+		{plexName: "The Beatles", discogsName: "The Beatles", want: true},
+		{plexName: "Nirvana", discogsName: "Nirvana (2)", want: true},
+		{plexName: "R.E.M.", discogsName: "REM", want: true},
+		{plexName: "Sigur Rós", discogsName: "Sigur Ros", want: true},
+		{plexName: "The Beatles", discogsName: "The Beatles Revival Band", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.discogsName, func(t *testing.T) {
+			if got := artistMatches(tt.plexName, tt.discogsName); got != tt.want {
+				t.Errorf("artistMatches(%q, %q) = %v, want %v", tt.plexName, tt.discogsName, got, tt.want)
+			}
+		})
+	}
+}
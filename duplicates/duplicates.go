@@ -0,0 +1,94 @@
+package duplicates
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+// Copy is one version of a movie on the server.
+type Copy struct {
+	RatingKey  string   `json:"ratingKey"`
+	Resolution string   `json:"resolution"`
+	VideoCodec string   `json:"videoCodec,omitempty"`
+	Files      []string `json:"files,omitempty"`
+	Size       int64    `json:"size"`
+	// Redundant copies are a lower resolution or a smaller file than the best copy, so can be deleted
+	Redundant bool `json:"redundant"`
+}
+
+// Duplicate is a movie with more than one copy, best copy first.
+type Duplicate struct {
+	Title       string `json:"title"`
+	Year        string `json:"year"`
+	Copies      []Copy `json:"copies"`
+	Reclaimable int64  `json:"reclaimable"`
+}
+
+// Report lists the duplicated movies, the ones freeing the most space first.
+type Report struct {
+	Duplicates  []Duplicate `json:"duplicates"`
+	Reclaimable int64       `json:"reclaimable"`
+}
+
+// Movies finds movies with several versions, and movies listed more than once under different rating keys. Titles
+// are matched on their name and year.
+func Movies(movies []types.PlexMovie) (report Report) {
+	var order []string
+	groups := make(map[string]*Duplicate)
+	for i := range movies {
+		key := strings.ToLower(strings.TrimSpace(movies[i].Title)) + "(" + movies[i].Year + ")"
+		group, found := groups[key]
+		if !found {
+			group = &Duplicate{Title: movies[i].Title, Year: movies[i].Year}
+			groups[key] = group
+			order = append(order, key)
+		}
+		group.Copies = append(group.Copies, copies(&movies[i])...)
+	}
+	for _, key := range order {
+		group := groups[key]
+		if len(group.Copies) < 2 { //nolint:mnd // a duplicate needs two copies
+			continue
+		}
+		rank(group)
+		report.Duplicates = append(report.Duplicates, *group)
+		report.Reclaimable += group.Reclaimable
+	}
+	slices.SortStableFunc(report.Duplicates, func(a, b Duplicate) int {
+		return cmp.Compare(b.Reclaimable, a.Reclaimable)
+	})
+	return report
+}
+
+// copies lists the versions of a movie, a movie without versions (eg from jellyfin) is one copy.
+func copies(movie *types.PlexMovie) (list []Copy) {
+	if len(movie.Versions) == 0 {
+		return []Copy{{RatingKey: movie.RatingKey, Resolution: movie.Resolution, VideoCodec: movie.VideoCodec, Size: movie.FileSize}}
+	}
+	for _, version := range movie.Versions {
+		list = append(list, Copy{RatingKey: movie.RatingKey, Resolution: version.Resolution, VideoCodec: version.VideoCodec,
+			Files: version.Files, Size: version.FileSize})
+	}
+	return list
+}
+
+// rank sorts the copies best first, the highest resolution then the largest file, and marks every other copy with
+// a known resolution as redundant.
+func rank(group *Duplicate) {
+	slices.SortStableFunc(group.Copies, func(a, b Copy) int {
+		if byResolution := cmp.Compare(types.ResolutionRank(b.Resolution), types.ResolutionRank(a.Resolution)); byResolution != 0 {
+			return byResolution
+		}
+		return cmp.Compare(b.Size, a.Size)
+	})
+	for i := range group.Copies[1:] {
+		c := &group.Copies[i+1]
+		if types.ResolutionRank(c.Resolution) >= 0 {
+			c.Redundant = true
+			group.Reclaimable += c.Size
+		}
+	}
+}
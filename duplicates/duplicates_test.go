@@ -0,0 +1,50 @@
+package duplicates
+
+import (
+	"testing"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestMovies(t *testing.T) {
+	movies := []types.PlexMovie{
+		{Title: "Cats", Year: "2019", RatingKey: "1", Versions: []types.PlexMovieVersion{
+			{Resolution: types.PlexResolution1080, FileSize: 8},
+			{Resolution: types.PlexResolution4K, FileSize: 50},
+			{Resolution: types.PlexResolutionSD, FileSize: 2},
+		}},
+		{Title: "Elf", Year: "2003", RatingKey: "2", Resolution: types.PlexResolution720, FileSize: 4},
+		{Title: "elf", Year: "2003", RatingKey: "3", Resolution: types.PlexResolution1080, FileSize: 9},
+		{Title: "Heat", Year: "1995", RatingKey: "4", Resolution: types.PlexResolution1080, FileSize: 9},
+		{Title: "Heat", Year: "1995", RatingKey: "5", Resolution: types.PlexResolution1080, FileSize: 7},
+		{Title: "Heat", Year: "1986", RatingKey: "6", Resolution: types.PlexResolutionSD, FileSize: 1},
+		{Title: "Up", Year: "2009", RatingKey: "7", Versions: []types.PlexMovieVersion{{Resolution: types.PlexResolution1080}}},
+	}
+	report := Movies(movies)
+	if len(report.Duplicates) != 3 || report.Reclaimable != 21 {
+		t.Fatalf("Movies() = %+v", report)
+	}
+	tests := []struct {
+		title       string
+		reclaimable int64
+		redundant   []bool
+		bestKey     string
+	}{
+		{title: "Cats", reclaimable: 10, redundant: []bool{false, true, true}, bestKey: "1"},
+		{title: "Heat", reclaimable: 7, redundant: []bool{false, true}, bestKey: "4"},
+		{title: "Elf", reclaimable: 4, redundant: []bool{false, true}, bestKey: "3"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			got := report.Duplicates[i]
+			if got.Title != tt.title || got.Reclaimable != tt.reclaimable || got.Copies[0].RatingKey != tt.bestKey {
+				t.Fatalf("Movies()[%d] = %+v", i, got)
+			}
+			for j, redundant := range tt.redundant {
+				if got.Copies[j].Redundant != redundant {
+					t.Errorf("Movies()[%d].Copies[%d].Redundant = %v, want %v", i, j, got.Copies[j].Redundant, redundant)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package emby
+
+import (
+	"github.com/tphoney/plex-lookup/jellyfin"
+)
+
+// api docs https://dev.emby.media/doc/restapi/index.html
+// Jellyfin forked from Emby and kept its api, only the auth header and the name differ.
+
+const ProviderName = "Emby"
+
+// New returns an Emby server, the api key is created in the server dashboard under Advanced, API Keys. Include the
+// "/emby" path in the url if your server needs it.
+func New(serverURL, apiKey, userID string) *jellyfin.Server {
+	return jellyfin.NewCompatible(ProviderName, serverURL, userID, "X-Emby-Token", apiKey)
+}
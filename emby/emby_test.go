@@ -0,0 +1,29 @@
+package emby
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Emby-Token") != "secret" || r.URL.Path != "/emby/Library/MediaFolders" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"Items":[{"Name":"Music","Id":"7","CollectionType":"music"}]}`)
+	}))
+	defer server.Close()
+
+	emby := New(server.URL+"/emby", "secret", "")
+	if emby.Name() != ProviderName {
+		t.Errorf("Name() = %q, want %q", emby.Name(), ProviderName)
+	}
+	libraries, err := emby.Libraries(context.Background())
+	if err != nil || len(libraries) != 1 || libraries[0].Type != "artist" || libraries[0].ID != "7" {
+		t.Errorf("Libraries() = %v, error = %v", libraries, err)
+	}
+}
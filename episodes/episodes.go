@@ -0,0 +1,80 @@
+package episodes
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sourcegraph/conc/iter"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+// guideConcurrency is kept low, public episode guides rate limit aggressively.
+const guideConcurrency = 2
+
+// MissingInParallel compares each show with the episode guide.
+func MissingInParallel(ctx context.Context, progressFunc func(), guide types.EpisodeGuide, plexShows []types.PlexTVShow) []types.MissingEpisodesResponse {
+	mapper := iter.Mapper[types.PlexTVShow, types.MissingEpisodesResponse]{
+		MaxGoroutines: guideConcurrency,
+	}
+	now := time.Now()
+	return mapper.Map(plexShows, func(show *types.PlexTVShow) types.MissingEpisodesResponse {
+		// Check for cancellation
+		select {
+		case <-ctx.Done():
+			return types.MissingEpisodesResponse{PlexTVShow: *show, Guide: guide.Name(), Err: ctx.Err()}
+		default:
+		}
+		guideEpisodes, err := guide.Episodes(ctx, show)
+		if progressFunc != nil {
+			progressFunc()
+		}
+		if err != nil {
+			slog.Debug("episode guide lookup failed", "guide", guide.Name(), "show", show.Title, "error", err)
+			return types.MissingEpisodesResponse{PlexTVShow: *show, Guide: guide.Name(), Err: err}
+		}
+		result := Missing(show, guideEpisodes, now)
+		result.Guide = guide.Name()
+		return result
+	})
+}
+
+// Missing lists the episodes that aired before now and are not in Plex. Episodes of seasons Plex does not have at
+// all are reported as missing seasons instead. Specials (season 0) are ignored.
+func Missing(show *types.PlexTVShow, guideEpisodes []types.GuideEpisode, now time.Time) (result types.MissingEpisodesResponse) {
+	result.PlexTVShow = *show
+	inPlex := make(map[int]map[int]bool)
+	for i := range show.Seasons {
+		episodes := make(map[int]bool)
+		for j := range show.Seasons[i].Episodes {
+			if index, err := strconv.Atoi(show.Seasons[i].Episodes[j].Index); err == nil {
+				episodes[index] = true
+			}
+		}
+		inPlex[show.Seasons[i].Number] = episodes
+	}
+	for _, episode := range guideEpisodes {
+		if episode.Season <= 0 || episode.Aired.IsZero() || episode.Aired.After(now) {
+			continue
+		}
+		episodes, seasonInPlex := inPlex[episode.Season]
+		switch {
+		case !seasonInPlex:
+			if !slices.Contains(result.MissingSeasons, episode.Season) {
+				result.MissingSeasons = append(result.MissingSeasons, episode.Season)
+			}
+		case !episodes[episode.Number]:
+			result.MissingEpisodes = append(result.MissingEpisodes, episode)
+		}
+	}
+	slices.Sort(result.MissingSeasons)
+	slices.SortFunc(result.MissingEpisodes, func(a, b types.GuideEpisode) int {
+		if a.Season != b.Season {
+			return a.Season - b.Season
+		}
+		return a.Number - b.Number
+	})
+	return result
+}
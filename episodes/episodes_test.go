@@ -0,0 +1,69 @@
+package episodes
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+type stubGuide struct {
+	episodes []types.GuideEpisode
+	err      error
+}
+
+func (stubGuide) Name() string { return "stub" }
+
+func (g stubGuide) Episodes(_ context.Context, _ *types.PlexTVShow) ([]types.GuideEpisode, error) {
+	return g.episodes, g.err
+}
+
+func aired(year int) time.Time {
+	return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestMissing(t *testing.T) {
+	show := types.PlexTVShow{
+		Title: "Friends",
+		Seasons: []types.PlexTVSeason{
+			{Number: 1, Episodes: []types.PlexTVEpisode{{Index: "1"}, {Index: "3"}}},
+			{Number: 2, Episodes: []types.PlexTVEpisode{{Index: "1"}}},
+		},
+	}
+	guideEpisodes := []types.GuideEpisode{
+		{Season: 0, Number: 1, Aired: aired(1994)},
+		{Season: 1, Number: 1, Aired: aired(1994)},
+		{Season: 1, Number: 4, Aired: aired(1994)},
+		{Season: 1, Number: 2, Aired: aired(1994)},
+		{Season: 1, Number: 3, Aired: aired(1994)},
+		{Season: 2, Number: 1, Aired: aired(1995)},
+		{Season: 2, Number: 2, Aired: aired(2030)},
+		{Season: 2, Number: 3},
+		{Season: 4, Number: 1, Aired: aired(1997)},
+		{Season: 3, Number: 1, Aired: aired(1996)},
+		{Season: 3, Number: 2, Aired: aired(1996)},
+	}
+	got := Missing(&show, guideEpisodes, aired(2025))
+	wantEpisodes := []types.GuideEpisode{{Season: 1, Number: 2, Aired: aired(1994)}, {Season: 1, Number: 4, Aired: aired(1994)}}
+	if !reflect.DeepEqual(got.MissingEpisodes, wantEpisodes) {
+		t.Errorf("Missing() episodes = %v, want %v", got.MissingEpisodes, wantEpisodes)
+	}
+	if want := []int{3, 4}; !reflect.DeepEqual(got.MissingSeasons, want) {
+		t.Errorf("Missing() seasons = %v, want %v", got.MissingSeasons, want)
+	}
+}
+
+func TestMissingInParallel(t *testing.T) {
+	shows := []types.PlexTVShow{{Title: "Friends", Seasons: []types.PlexTVSeason{{Number: 1}}}}
+	results := MissingInParallel(context.Background(), nil, stubGuide{episodes: []types.GuideEpisode{{Season: 1, Number: 1, Aired: aired(1994)}}}, shows)
+	if len(results) != 1 || len(results[0].MissingEpisodes) != 1 || results[0].Guide != "stub" {
+		t.Errorf("MissingInParallel() = %+v", results)
+	}
+	results = MissingInParallel(context.Background(), nil, stubGuide{err: errors.New("not found")}, shows)
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("MissingInParallel() should keep the lookup error, got %+v", results)
+	}
+}
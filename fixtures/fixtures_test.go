@@ -0,0 +1,87 @@
+package fixtures
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		wantStatus   int
+		wantContains string
+	}{
+		{
+			name:         "bluray search is recorded",
+			method:       http.MethodGet,
+			path:         BlurayPrefix + "/movies/search.php?keyword=Cats",
+			wantStatus:   http.StatusOK,
+			wantContains: server.URL + BlurayPrefix + "/movies/Cats-Blu-ray/",
+		},
+		{
+			name:         "unknown bluray search is empty",
+			method:       http.MethodGet,
+			path:         BlurayPrefix + "/movies/search.php?keyword=nothing",
+			wantStatus:   http.StatusOK,
+			wantContains: "Search movies (0 matches)",
+		},
+		{
+			name:         "cinema paradiso series from form body",
+			method:       http.MethodPost,
+			path:         CinemaParadisoPrefix + "/ajax/CPMain.wsFilmDescription,CPMain.ashx?_method=ShowSeries&_session=r",
+			body:         "FilmID=1835",
+			wantStatus:   http.StatusOK,
+			wantContains: "17/10/2005",
+		},
+		{
+			name:         "spotify links point at the fixture server",
+			method:       http.MethodGet,
+			path:         SpotifyAPIPrefix + "/search?q=" + url.QueryEscape("The Beatles") + "&type=artist&limit=10",
+			wantStatus:   http.StatusOK,
+			wantContains: server.URL + SpotifyAPIPrefix + "/artists/3WrFJ7ztbogyGnTHbHJFl2",
+		},
+		{
+			name:         "musicbrainz release groups match on artist id",
+			method:       http.MethodGet,
+			path:         MusicBrainzPrefix + "/ws/2/release-group?query=" + url.QueryEscape("arid:b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d AND status:official"),
+			wantStatus:   http.StatusOK,
+			wantContains: "Abbey Road",
+		},
+		{
+			name:       "unknown plex item",
+			method:     http.MethodGet,
+			path:       PlexPrefix + "/library/metadata/1",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(t.Context(), tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if !strings.Contains(string(body), tt.wantContains) {
+				t.Errorf("body does not contain %q", tt.wantContains)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package fixturestest
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/fixtures"
+)
+
+// Start runs a fixture server until the test finishes and returns the provider urls that talk to it. It lives
+// outside fixtures so the binary does not link the testing packages.
+func Start(t testing.TB) fixtures.URLs {
+	t.Helper()
+	server := httptest.NewServer(fixtures.Handler())
+	t.Cleanup(server.Close)
+	return fixtures.ProviderURLs(server.URL)
+}
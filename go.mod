@@ -3,6 +3,7 @@ module github.com/tphoney/plex-lookup
 go 1.25.6
 
 require (
+	github.com/PuerkitoBio/goquery v1.11.0
 	github.com/lithammer/fuzzysearch v1.1.8
 	github.com/michiwend/gomusicbrainz v0.0.0-20181012083520-6c07e13dd396
 	github.com/rainycape/unidecode v0.0.0-20150907023854-cb7f23ec59be
@@ -11,10 +12,12 @@ require (
 )
 
 require (
+	github.com/andybalholm/cascadia v1.3.3 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/michiwend/golang-pretty v0.0.0-20141116172505-8ac61812ea3f // indirect
 	github.com/spf13/pflag v1.0.10 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
+	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/text v0.35.0 // indirect
 )
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// minSearchesForBreakage stops a handful of obscure titles from looking like a broken parser.
+	minSearchesForBreakage = 5
+)
+
+// ParserStatus is the outcome of the last batch of searches made against a provider.
+type ParserStatus struct {
+	Provider     string
+	Searches     int
+	EmptyPages   int
+	LikelyBroken bool
+	CheckedAt    time.Time
+}
+
+// BreakageDetector counts how many search pages in a batch contained none of the markup the provider parser looks for.
+type BreakageDetector struct {
+	provider   string
+	searches   atomic.Int32
+	emptyPages atomic.Int32
+}
+
+// NewBreakageDetector creates a detector for a single batch of searches against a provider.
+func NewBreakageDetector(provider string) *BreakageDetector {
+	return &BreakageDetector{provider: provider}
+}
+
+// Record notes whether a downloaded search page was structurally empty. It is safe to call on a nil detector.
+func (d *BreakageDetector) Record(structurallyEmpty bool) {
+	if d == nil {
+		return
+	}
+	d.searches.Add(1)
+	if structurallyEmpty {
+		d.emptyPages.Add(1)
+	}
+}
+
+// Finish returns the status of the batch, for the job that made the searches to report, and logs a warning if every
+// page came back structurally empty.
+func (d *BreakageDetector) Finish() ParserStatus {
+	status := ParserStatus{
+		Provider:   d.provider,
+		Searches:   int(d.searches.Load()),
+		EmptyPages: int(d.emptyPages.Load()),
+		CheckedAt:  time.Now(),
+	}
+	status.LikelyBroken = status.Searches >= minSearchesForBreakage && status.EmptyPages == status.Searches
+	if status.LikelyBroken {
+		slog.Warn("Parser likely broken, every search page was structurally empty",
+			"provider", status.Provider, "searches", status.Searches)
+	}
+	return status
+}
@@ -0,0 +1,65 @@
+package health
+
+import (
+	"testing"
+)
+
+func TestBreakageDetector(t *testing.T) {
+	tests := []struct {
+		name         string
+		provider     string
+		pages        []bool
+		wantBroken   bool
+		wantSearches int
+	}{
+		{
+			name:         "all pages empty",
+			provider:     "all-empty",
+			pages:        []bool{true, true, true, true, true, true},
+			wantBroken:   true,
+			wantSearches: 6,
+		},
+		{
+			name:         "one page has results",
+			provider:     "one-result",
+			pages:        []bool{true, true, false, true, true, true},
+			wantBroken:   false,
+			wantSearches: 6,
+		},
+		{
+			name:         "batch too small",
+			provider:     "too-small",
+			pages:        []bool{true, true},
+			wantBroken:   false,
+			wantSearches: 2,
+		},
+		{
+			name:         "no searches",
+			provider:     "none",
+			pages:        []bool{},
+			wantBroken:   false,
+			wantSearches: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := NewBreakageDetector(tt.provider)
+			for _, empty := range tt.pages {
+				detector.Record(empty)
+			}
+			got := detector.Finish()
+			if got.LikelyBroken != tt.wantBroken {
+				t.Errorf("Finish() LikelyBroken = %v, want %v", got.LikelyBroken, tt.wantBroken)
+			}
+			if got.Searches != tt.wantSearches {
+				t.Errorf("Finish() Searches = %d, want %d", got.Searches, tt.wantSearches)
+			}
+		})
+	}
+}
+
+func TestRecordNilDetector(t *testing.T) {
+	var detector *BreakageDetector
+	// Should not panic when searches are made without a detector
+	detector.Record(true)
+}
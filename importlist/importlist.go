@@ -0,0 +1,282 @@
+package importlist
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+// Letterboxd export docs https://letterboxd.com/about/importing-data/
+// Trakt export docs https://trakt.docs.apiary.io, the exports use the same objects as the sync endpoints.
+
+const (
+	// MaxSize is the largest export we read, a Letterboxd ZIP of a big diary is a few MB.
+	MaxSize = 20 << 20
+	// ratingKeyPrefix marks titles that did not come from a media server.
+	ratingKeyPrefix = "import:"
+)
+
+// the Letterboxd export files that list films, the others are reviews, likes and comments
+var letterboxdFiles = []string{"watched.csv", "watchlist.csv", "ratings.csv", "diary.csv"}
+
+// trakt resolutions mapped to the plex names
+var traktResolutions = map[string]string{
+	"uhd_4k":   types.PlexResolution4K,
+	"hd_1080p": types.PlexResolution1080,
+	"hd_1080i": types.PlexResolution1080,
+	"hd_720p":  types.PlexResolution720,
+	"sd_576p":  types.PlexResolution576,
+	"sd_576i":  types.PlexResolution576,
+	"sd_480p":  types.PlexResolution480,
+	"sd_480i":  types.PlexResolution480,
+}
+
+// List is the movies and TV shows read from an export.
+type List struct {
+	Movies []types.PlexMovie
+	TV     []types.PlexTVShow
+	// the index of each title in Movies and TV, keyed by titleKey
+	movieIndex map[string]int
+	showIndex  map[string]int
+}
+
+type traktItem struct {
+	Movie    *traktMedia   `json:"movie"`
+	Show     *traktMedia   `json:"show"`
+	Metadata traktMetadata `json:"metadata"`
+	Seasons  []struct {
+		Number   int `json:"number"`
+		Episodes []struct {
+			Number   int           `json:"number"`
+			Metadata traktMetadata `json:"metadata"`
+		} `json:"episodes"`
+	} `json:"seasons"`
+}
+
+type traktMedia struct {
+	Title string `json:"title"`
+	Year  int    `json:"year"`
+	IDs   struct {
+		Trakt int `json:"trakt"`
+	} `json:"ids"`
+}
+
+type traktMetadata struct {
+	Resolution string `json:"resolution"`
+}
+
+// Parse reads a CSV, a Letterboxd export ZIP, a Trakt JSON export or a ZIP of Trakt JSON files. The file name
+// picks the format. Titles in more than one file of an export are only listed once.
+func Parse(filename string, data []byte) (list List, err error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		err = list.addCSV(data)
+	case ".json":
+		err = list.addTrakt(data)
+	case ".zip":
+		err = list.addZIP(data)
+	default:
+		return list, fmt.Errorf("importlist: unsupported file %q, use a .csv, .json or .zip export", filename)
+	}
+	if err != nil {
+		return list, err
+	}
+	if len(list.Movies) == 0 && len(list.TV) == 0 {
+		return list, fmt.Errorf("importlist: no titles found in %q", filename)
+	}
+	return list, nil
+}
+
+func (l *List) addZIP(data []byte) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("importlist: unable to open zip: %w", err)
+	}
+	for _, file := range reader.File {
+		name := strings.ToLower(path.Base(file.Name))
+		isLetterboxd := slices.Contains(letterboxdFiles, name) && !strings.Contains(file.Name, "/")
+		if !isLetterboxd && path.Ext(name) != ".json" {
+			continue
+		}
+		contents, readErr := readZIPFile(file)
+		if readErr != nil {
+			return readErr
+		}
+		if isLetterboxd {
+			err = l.addCSV(contents)
+		} else {
+			err = l.addTrakt(contents)
+		}
+		if err != nil {
+			return fmt.Errorf("importlist: %s: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+func readZIPFile(file *zip.File) ([]byte, error) {
+	if file.UncompressedSize64 > MaxSize {
+		return nil, fmt.Errorf("importlist: %s is too large", file.Name)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("importlist: unable to open %s: %w", file.Name, err)
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, MaxSize))
+}
+
+// addCSV reads a CSV with a header row. It needs a title (or Letterboxd's name) column, year, type (movie or show)
+// and resolution columns are optional. Every row is a movie unless the type says otherwise.
+func (l *List) addCSV(data []byte) error {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("importlist: unable to read csv header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	titleColumn, ok := columns["title"]
+	if !ok {
+		if titleColumn, ok = columns["name"]; !ok {
+			return errors.New("importlist: the csv needs a title or name column")
+		}
+	}
+	value := func(record []string, column string) string {
+		if i, found := columns[column]; found && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	for {
+		record, readErr := reader.Read()
+		if errors.Is(readErr, io.EOF) {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("importlist: unable to read csv: %w", readErr)
+		}
+		if titleColumn >= len(record) || strings.TrimSpace(record[titleColumn]) == "" {
+			continue
+		}
+		title, year := strings.TrimSpace(record[titleColumn]), value(record, "year")
+		switch strings.ToLower(value(record, "type")) {
+		case "show", "tv", "series":
+			l.addShow(types.PlexTVShow{Title: title, Year: year, RatingKey: ratingKey(title, year)})
+		default:
+			l.addMovie(types.PlexMovie{Title: title, Year: year, RatingKey: ratingKey(title, year),
+				Resolution: strings.ToLower(value(record, "resolution"))})
+		}
+	}
+}
+
+// addTrakt reads a Trakt export, eg watched-movies.json, watchlist.json or collection-shows.json. Collections carry
+// the resolution of each movie and episode.
+func (l *List) addTrakt(data []byte) error {
+	// the user profile and settings are objects, not lists of titles
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return nil
+	}
+	var items []traktItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("importlist: unable to parse trakt export: %w", err)
+	}
+	for i := range items {
+		switch {
+		case items[i].Movie != nil:
+			movie := items[i].Movie
+			l.addMovie(types.PlexMovie{Title: movie.Title, Year: traktYear(movie.Year), RatingKey: traktKey(movie),
+				Resolution: traktResolutions[items[i].Metadata.Resolution]})
+		case items[i].Show != nil:
+			show := types.PlexTVShow{Title: items[i].Show.Title, Year: traktYear(items[i].Show.Year), RatingKey: traktKey(items[i].Show)}
+			for _, traktSeason := range items[i].Seasons {
+				season := types.PlexTVSeason{Number: traktSeason.Number}
+				var resolutions []string
+				for _, traktEpisode := range traktSeason.Episodes {
+					resolution := traktResolutions[traktEpisode.Metadata.Resolution]
+					resolutions = append(resolutions, resolution)
+					season.Episodes = append(season.Episodes, types.PlexTVEpisode{Index: strconv.Itoa(traktEpisode.Number), Resolution: resolution})
+				}
+				season.LowestResolution = types.LowestResolution(resolutions)
+				show.Seasons = append(show.Seasons, season)
+			}
+			l.addShow(show)
+		}
+	}
+	return nil
+}
+
+// addMovie skips titles already in the list, keeping the first one that has a resolution.
+func (l *List) addMovie(movie types.PlexMovie) {
+	if l.movieIndex == nil {
+		l.movieIndex = make(map[string]int)
+	}
+	key := titleKey(movie.Title, movie.Year)
+	if i, found := l.movieIndex[key]; found {
+		if l.Movies[i].Resolution == "" {
+			l.Movies[i].Resolution = movie.Resolution
+		}
+		return
+	}
+	l.movieIndex[key] = len(l.Movies)
+	l.Movies = append(l.Movies, movie)
+}
+
+// addShow skips titles already in the list, keeping the first one that has seasons.
+func (l *List) addShow(show types.PlexTVShow) {
+	if l.showIndex == nil {
+		l.showIndex = make(map[string]int)
+	}
+	key := titleKey(show.Title, show.Year)
+	if i, found := l.showIndex[key]; found {
+		if len(l.TV[i].Seasons) == 0 {
+			l.TV[i].Seasons = show.Seasons
+		}
+		return
+	}
+	l.showIndex[key] = len(l.TV)
+	l.TV = append(l.TV, show)
+}
+
+// titleKey matches titles regardless of case.
+func titleKey(title, year string) string {
+	return strings.ToLower(title) + "(" + year + ")"
+}
+
+// ratingKey gives imported titles a stable key, so the wanted list and result checkboxes work.
+func ratingKey(title, year string) string {
+	return ratingKeyPrefix + titleKey(title, year)
+}
+
+func traktKey(media *traktMedia) string {
+	if media.IDs.Trakt == 0 {
+		return ratingKey(media.Title, traktYear(media.Year))
+	}
+	return ratingKeyPrefix + "trakt:" + strconv.Itoa(media.IDs.Trakt)
+}
+
+func traktYear(year int) string {
+	if year == 0 {
+		return ""
+	}
+	return strconv.Itoa(year)
+}
+
+// IsImported reports whether a rating key came from an import rather than a media server.
+func IsImported(ratingKey string) bool {
+	return strings.HasPrefix(ratingKey, ratingKeyPrefix)
+}
@@ -0,0 +1,127 @@
+package importlist
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+const traktCollection = `[
+	{"collected_at":"2024-01-01T00:00:00.000Z","metadata":{"media_type":"bluray","resolution":"hd_1080p"},
+	 "movie":{"title":"Cats","year":2019,"ids":{"trakt":123,"imdb":"tt5697572"}}},
+	{"show":{"title":"Friends","year":1994,"ids":{"trakt":1}},"seasons":[{"number":1,"episodes":[
+		{"number":1,"metadata":{"resolution":"hd_1080p"}},{"number":2,"metadata":{"resolution":"sd_480p"}}]}]}
+]`
+
+func letterboxdZIP(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := map[string]string{
+		"watched.csv":       "Date,Name,Year,Letterboxd URI\n2024-01-01,Cats,2019,https://boxd.it/1\n2024-01-02,Elf,2003,https://boxd.it/2\n",
+		"watchlist.csv":     "Date,Name,Year,Letterboxd URI\n2024-01-03,Cats,2019,https://boxd.it/1\n",
+		"reviews.csv":       "Date,Name,Year,Review\n2024-01-01,Not A Film,2000,review\n",
+		"lists/xmas.csv":    "Letterboxd list export v7\n",
+		"profile.json":      `{"username":"someone"}`,
+		"deleted/diary.csv": "Date,Name,Year\n2024-01-01,Deleted,2000\n",
+	}
+	for name, contents := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		filename   string
+		data       []byte
+		wantMovies []string
+		wantShows  []string
+		wantErr    bool
+	}{
+		{
+			name:       "csv with types",
+			filename:   "shelf.CSV",
+			data:       []byte("\ufeffTitle,Year,Type,Resolution\nCats,2019,movie,SD\nFriends,1994,show,\n,2000,movie,\n"),
+			wantMovies: []string{"Cats"},
+			wantShows:  []string{"Friends"},
+		},
+		{
+			name:       "letterboxd zip",
+			filename:   "letterboxd-someone.zip",
+			data:       letterboxdZIP(t),
+			wantMovies: []string{"Cats", "Elf"},
+		},
+		{
+			name:       "trakt json",
+			filename:   "collection.json",
+			data:       []byte(traktCollection),
+			wantMovies: []string{"Cats"},
+			wantShows:  []string{"Friends"},
+		},
+		{
+			name:       "csv with repeated titles",
+			filename:   "list.csv",
+			data:       []byte("Title,Year,Resolution\nCats,2019,\ncats,2019,1080\nCats,1998,\nElf,2003,\n"),
+			wantMovies: []string{"Cats", "Cats", "Elf"},
+		},
+		{name: "csv without a title", filename: "list.csv", data: []byte("Year\n2019\n"), wantErr: true},
+		{name: "empty csv", filename: "list.csv", data: []byte("Title,Year\n"), wantErr: true},
+		{name: "unsupported file", filename: "list.xlsx", data: []byte("x"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.filename, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var movies, shows []string
+			for i := range got.Movies {
+				movies = append(movies, got.Movies[i].Title)
+			}
+			for i := range got.TV {
+				shows = append(shows, got.TV[i].Title)
+			}
+			if len(movies) != len(tt.wantMovies) || len(shows) != len(tt.wantShows) {
+				t.Fatalf("Parse() movies = %v, shows = %v, want %v and %v", movies, shows, tt.wantMovies, tt.wantShows)
+			}
+		})
+	}
+}
+
+func TestParseDetails(t *testing.T) {
+	got, err := Parse("collection.json", []byte(traktCollection))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie := got.Movies[0]; movie.Resolution != types.PlexResolution1080 || movie.Year != "2019" || movie.RatingKey != "import:trakt:123" {
+		t.Errorf("Parse() movie = %+v", movie)
+	}
+	seasons := got.TV[0].Seasons
+	if len(seasons) != 1 || len(seasons[0].Episodes) != 2 || seasons[0].LowestResolution != types.PlexResolution480 {
+		t.Errorf("Parse() seasons = %+v", seasons)
+	}
+
+	got, err = Parse("shelf.csv", []byte("title,year,resolution\nCats,2019,SD\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie := got.Movies[0]; movie.Resolution != types.PlexResolutionSD || movie.RatingKey != "import:cats(2019)" {
+		t.Errorf("Parse() csv movie = %+v", movie)
+	}
+}
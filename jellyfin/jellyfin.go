@@ -0,0 +1,370 @@
+package jellyfin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
+)
+
+// api docs https://api.jellyfin.org
+
+const (
+	ProviderName  = "Jellyfin"
+	lookupTimeout = 30
+	pageSize      = 500
+)
+
+// the media library types, mapped to the plex names used in the settings page
+var libraryTypes = map[string]string{
+	"movies":  "movie",
+	"tvshows": "show",
+	"music":   "artist",
+}
+
+type itemsResponse struct {
+	Items            []item `json:"Items"`
+	TotalRecordCount int    `json:"TotalRecordCount"`
+}
+
+type item struct {
+	ID                string        `json:"Id"`
+	Name              string        `json:"Name"`
+	CollectionType    string        `json:"CollectionType"`
+	ProductionYear    int           `json:"ProductionYear"`
+	DateCreated       string        `json:"DateCreated"`
+	PremiereDate      string        `json:"PremiereDate"`
+	IndexNumber       int           `json:"IndexNumber"`
+	ParentIndexNumber int           `json:"ParentIndexNumber"`
+	SeasonID          string        `json:"SeasonId"`
+	AlbumArtists      []nameID      `json:"AlbumArtists"`
+	MediaStreams      []mediaStream `json:"MediaStreams"`
+	// CommunityRating is out of 10, CriticRating out of 100
+	CommunityRating float64  `json:"CommunityRating"`
+	CriticRating    float64  `json:"CriticRating"`
+	UserData        userData `json:"UserData"`
+	MediaSources    []struct {
+		Size int64 `json:"Size"`
+	} `json:"MediaSources"`
+}
+
+// userData is the watch history of the UserId the requests are made for.
+type userData struct {
+	PlayCount      int    `json:"PlayCount"`
+	LastPlayedDate string `json:"LastPlayedDate"`
+}
+
+type nameID struct {
+	Name string `json:"Name"`
+	ID   string `json:"Id"`
+}
+
+type mediaStream struct {
+	Type         string `json:"Type"`
+	Language     string `json:"Language"`
+	DisplayTitle string `json:"DisplayTitle"`
+	Codec        string `json:"Codec"`
+	Width        int    `json:"Width"`
+	Height       int    `json:"Height"`
+}
+
+// Server reads a Jellyfin library. Emby serves the same api, see NewCompatible.
+type Server struct {
+	URL    string
+	UserID string
+
+	name string
+	api  *utils.APIClient
+}
+
+var _ types.MediaServer = (*Server)(nil)
+
+// New returns a Jellyfin server, the api key is created in the dashboard under API Keys.
+func New(serverURL, apiKey, userID string) *Server {
+	return NewCompatible(ProviderName, serverURL, userID, "Authorization", fmt.Sprintf("MediaBrowser Token=%q", apiKey))
+}
+
+// NewCompatible returns a server that shares the Jellyfin api but has its own name and auth header.
+func NewCompatible(name, serverURL, userID, authHeader, authValue string) *Server {
+	api := &utils.APIClient{
+		Name:    strings.ToLower(name),
+		Header:  http.Header{},
+		Timeout: lookupTimeout * time.Second,
+	}
+	api.Header.Set(authHeader, authValue)
+	api.Header.Set("Accept", "application/json")
+	return &Server{URL: strings.TrimSuffix(serverURL, "/"), UserID: userID, name: name, api: api}
+}
+
+func (s *Server) Name() string {
+	return s.name
+}
+
+func (s *Server) Libraries(ctx context.Context) (libraries []types.PlexLibrary, err error) {
+	var response itemsResponse
+	if err = s.getJSON(ctx, "/Library/MediaFolders", nil, &response); err != nil {
+		return nil, err
+	}
+	for i := range response.Items {
+		libraryType, ok := libraryTypes[response.Items[i].CollectionType]
+		if !ok {
+			continue
+		}
+		libraries = append(libraries, types.PlexLibrary{Title: response.Items[i].Name, Type: libraryType, ID: response.Items[i].ID})
+	}
+	return libraries, nil
+}
+
+func (s *Server) Movies(ctx context.Context, libraryID string) (movies []types.PlexMovie, err error) {
+	items, err := s.libraryItems(ctx, libraryID, "Movie")
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		movie := types.PlexMovie{
+			Title:      items[i].Name,
+			Year:       year(items[i].ProductionYear),
+			RatingKey:  items[i].ID,
+			Resolution: resolution(items[i].MediaStreams),
+			DateAdded:  parseDate(items[i].DateCreated),
+		}
+		movie.ViewCount, movie.LastViewedAt, movie.Rating, movie.AudienceRating = watchHistory(&items[i])
+		movie.VideoCodec, movie.AudioCodec, movie.FileSize = fileDetails(&items[i])
+		for _, stream := range items[i].MediaStreams {
+			if stream.Type != "Audio" {
+				continue
+			}
+			if stream.Language != "" && !slices.Contains(movie.AudioLanguages, stream.Language) {
+				movie.AudioLanguages = append(movie.AudioLanguages, stream.Language)
+			}
+			if !slices.Contains(movie.AudioFormats, stream.DisplayTitle) {
+				movie.AudioFormats = append(movie.AudioFormats, stream.DisplayTitle)
+			}
+		}
+		movies = append(movies, movie)
+	}
+	slog.Info("Media server movies fetched", "server", s.name, "count", len(movies))
+	return movies, nil
+}
+
+func (s *Server) TV(ctx context.Context, libraryID string) (shows []types.PlexTVShow, err error) {
+	items, err := s.libraryItems(ctx, libraryID, "Series")
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		var episodes itemsResponse
+		query := url.Values{"Fields": {"MediaStreams,MediaSources,DateCreated"}}
+		if episodesErr := s.getJSON(ctx, "/Shows/"+url.PathEscape(items[i].ID)+"/Episodes", query, &episodes); episodesErr != nil {
+			slog.Error("Failed to get episodes", "server", s.name, "show", items[i].Name, "error", episodesErr)
+			continue
+		}
+		seasons := seasonsFromEpisodes(episodes.Items)
+		// shows with no episodes are skipped, the same as plex
+		if len(seasons) == 0 {
+			continue
+		}
+		show := types.PlexTVShow{
+			Title:             items[i].Name,
+			Year:              year(items[i].ProductionYear),
+			RatingKey:         items[i].ID,
+			DateAdded:         parseDate(items[i].DateCreated),
+			FirstEpisodeAired: seasons[0].FirstEpisodeAired,
+			LastEpisodeAired:  seasons[len(seasons)-1].LastEpisodeAired,
+			Seasons:           seasons,
+		}
+		_, _, show.Rating, show.AudienceRating = watchHistory(&items[i])
+		// plays are kept per episode, not for the series
+		for j := range episodes.Items {
+			show.ViewCount += episodes.Items[j].UserData.PlayCount
+			if played := parseDate(episodes.Items[j].UserData.LastPlayedDate); played.After(show.LastViewedAt) {
+				show.LastViewedAt = played
+			}
+		}
+		shows = append(shows, show)
+	}
+	slog.Info("Media server TV shows fetched", "server", s.name, "count", len(shows))
+	return shows, nil
+}
+
+// MusicArtists groups the albums of a library by album artist, one request covers the whole library.
+func (s *Server) MusicArtists(ctx context.Context, libraryID string) (artists []types.PlexMusicArtist, err error) {
+	items, err := s.libraryItems(ctx, libraryID, "MusicAlbum")
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*types.PlexMusicArtist)
+	for i := range items {
+		album := types.PlexMusicAlbum{
+			Title: items[i].Name, RatingKey: items[i].ID, Year: year(items[i].ProductionYear), DateAdded: parseDate(items[i].DateCreated)}
+		for _, albumArtist := range items[i].AlbumArtists {
+			artist, found := byID[albumArtist.ID]
+			if !found {
+				artist = &types.PlexMusicArtist{Name: albumArtist.Name, RatingKey: albumArtist.ID, DateAdded: album.DateAdded}
+				byID[albumArtist.ID] = artist
+			}
+			if album.DateAdded.Before(artist.DateAdded) {
+				artist.DateAdded = album.DateAdded
+			}
+			artist.Albums = append(artist.Albums, album)
+		}
+	}
+	for _, artist := range byID {
+		artists = append(artists, *artist)
+	}
+	sort.Slice(artists, func(i, j int) bool {
+		return artists[i].Name < artists[j].Name
+	})
+	slog.Info("Media server music artists fetched", "server", s.name, "count", len(artists))
+	return artists, nil
+}
+
+// libraryItems pages through every item of a type in a library.
+func (s *Server) libraryItems(ctx context.Context, libraryID, itemType string) (items []item, err error) {
+	for {
+		query := url.Values{
+			"ParentId":         {libraryID},
+			"Recursive":        {"true"},
+			"IncludeItemTypes": {itemType},
+			"Fields":           {"MediaStreams,MediaSources,DateCreated,ProductionYear"},
+			"SortBy":           {"SortName"},
+			"StartIndex":       {strconv.Itoa(len(items))},
+			"Limit":            {strconv.Itoa(pageSize)},
+		}
+		var response itemsResponse
+		if err = s.getJSON(ctx, "/Items", query, &response); err != nil {
+			return nil, err
+		}
+		items = append(items, response.Items...)
+		if len(response.Items) == 0 || len(items) >= response.TotalRecordCount {
+			return items, nil
+		}
+	}
+}
+
+func seasonsFromEpisodes(episodes []item) (seasons []types.PlexTVSeason) {
+	byNumber := make(map[int]*types.PlexTVSeason)
+	for i := range episodes {
+		number := episodes[i].ParentIndexNumber
+		season, found := byNumber[number]
+		if !found {
+			season = &types.PlexTVSeason{Number: number, RatingKey: episodes[i].SeasonID}
+			byNumber[number] = season
+		}
+		episode := types.PlexTVEpisode{
+			Title:           episodes[i].Name,
+			Index:           strconv.Itoa(episodes[i].IndexNumber),
+			Resolution:      resolution(episodes[i].MediaStreams),
+			DateAdded:       parseDate(episodes[i].DateCreated),
+			OriginallyAired: parseDate(episodes[i].PremiereDate),
+		}
+		episode.VideoCodec, episode.AudioCodec, episode.FileSize = fileDetails(&episodes[i])
+		season.Episodes = append(season.Episodes, episode)
+	}
+	for _, season := range byNumber {
+		sort.Slice(season.Episodes, func(i, j int) bool {
+			a, _ := strconv.Atoi(season.Episodes[i].Index)
+			b, _ := strconv.Atoi(season.Episodes[j].Index)
+			return a < b
+		})
+		resolutions := make([]string, 0, len(season.Episodes))
+		for i := range season.Episodes {
+			resolutions = append(resolutions, season.Episodes[i].Resolution)
+		}
+		season.LowestResolution = types.LowestResolution(resolutions)
+		last := season.Episodes[len(season.Episodes)-1]
+		season.LastEpisodeAdded = last.DateAdded
+		season.LastEpisodeAired = last.OriginallyAired
+		season.FirstEpisodeAired = season.Episodes[0].OriginallyAired
+		seasons = append(seasons, *season)
+	}
+	sort.Slice(seasons, func(i, j int) bool {
+		return seasons[i].Number < seasons[j].Number
+	})
+	return seasons
+}
+
+// resolution names the first video stream the way plex does. The width is checked too, so a letterboxed 1920x800
+// film is still 1080.
+func resolution(streams []mediaStream) string {
+	for _, stream := range streams {
+		if stream.Type != "Video" {
+			continue
+		}
+		switch { //nolint:mnd // pixel thresholds
+		case stream.Width >= 3200 || stream.Height >= 2000:
+			return types.PlexResolution4K
+		case stream.Width >= 1800 || stream.Height >= 1000:
+			return types.PlexResolution1080
+		case stream.Width >= 1200 || stream.Height >= 700:
+			return types.PlexResolution720
+		case stream.Height >= 576:
+			return types.PlexResolution576
+		case stream.Height >= 480:
+			return types.PlexResolution480
+		case stream.Height > 0:
+			return types.PlexResolutionSD
+		}
+	}
+	return ""
+}
+
+// watchHistory returns the play count, last play and the critic and audience ratings out of 10.
+func watchHistory(media *item) (viewCount int, lastViewedAt time.Time, rating, audienceRating float64) {
+	return media.UserData.PlayCount, parseDate(media.UserData.LastPlayedDate), media.CriticRating / 10, media.CommunityRating //nolint:mnd // percent to out of 10
+}
+
+// fileDetails returns the codecs of the first video and audio streams, and the size of the first file.
+func fileDetails(media *item) (videoCodec, audioCodec string, fileSize int64) {
+	for _, stream := range media.MediaStreams {
+		if stream.Type == "Video" && videoCodec == "" {
+			videoCodec = stream.Codec
+		}
+		if stream.Type == "Audio" && audioCodec == "" {
+			audioCodec = stream.Codec
+		}
+	}
+	if len(media.MediaSources) > 0 {
+		fileSize = media.MediaSources[0].Size
+	}
+	return videoCodec, audioCodec, fileSize
+}
+
+func year(productionYear int) string {
+	if productionYear == 0 {
+		return ""
+	}
+	return strconv.Itoa(productionYear)
+}
+
+// parseDate reads the api dates, eg "2024-01-02T03:04:05.0000000Z".
+func parseDate(date string) time.Time {
+	parsed, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
+
+func (s *Server) getJSON(ctx context.Context, path string, query url.Values, target any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	if s.UserID != "" {
+		query.Set("UserId", s.UserID)
+	}
+	requestURL := s.URL + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	return s.api.GetJSON(ctx, requestURL, target)
+}
@@ -0,0 +1,147 @@
+package jellyfin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+const (
+	testAPIKey = "secret"
+	testUserID = "user1"
+)
+
+// standIn serves a small Jellyfin library. Movies are paged one at a time to exercise paging.
+func standIn(t *testing.T, authHeader, authValue string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(authHeader) != authValue {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("UserId") != testUserID {
+			http.Error(w, "missing user", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path == "/Library/MediaFolders":
+			fmt.Fprint(w, `{"Items":[{"Name":"Films","Id":"lib-movies","CollectionType":"movies"},
+				{"Name":"Shows","Id":"lib-tv","CollectionType":"tvshows"},
+				{"Name":"Photos","Id":"lib-photos","CollectionType":"homevideos"}],"TotalRecordCount":3}`)
+		case r.URL.Path == "/Items" && query.Get("IncludeItemTypes") == "Movie" && query.Get("StartIndex") == "0":
+			fmt.Fprint(w, `{"Items":[{"Id":"m1","Name":"Cats","ProductionYear":2019,"DateCreated":"2024-01-02T03:04:05.0000000Z",
+				"CommunityRating":6.5,"CriticRating":80,"UserData":{"PlayCount":3,"LastPlayedDate":"2025-01-02T00:00:00.0000000Z"},
+				"MediaStreams":[{"Type":"Video","Width":1920,"Height":800},
+				{"Type":"Audio","Language":"eng","DisplayTitle":"English - TrueHD - 7.1"}]}],"TotalRecordCount":2}`)
+		case r.URL.Path == "/Items" && query.Get("IncludeItemTypes") == "Movie" && query.Get("StartIndex") == "1":
+			fmt.Fprint(w, `{"Items":[{"Id":"m2","Name":"Elf","ProductionYear":2003,
+				"MediaStreams":[{"Type":"Video","Width":720,"Height":576}]}],"TotalRecordCount":2}`)
+		case r.URL.Path == "/Items" && query.Get("IncludeItemTypes") == "Series":
+			fmt.Fprint(w, `{"Items":[{"Id":"s1","Name":"Friends","ProductionYear":1994},{"Id":"s2","Name":"Empty"}],"TotalRecordCount":2}`)
+		case r.URL.Path == "/Shows/s1/Episodes":
+			fmt.Fprint(w, `{"Items":[
+				{"Name":"The One Where Monica Gets a Roommate","IndexNumber":1,"ParentIndexNumber":1,"SeasonId":"s1-1",
+				 "PremiereDate":"1994-09-22T00:00:00.0000000Z","UserData":{"PlayCount":2},"MediaStreams":[{"Type":"Video","Width":1920,"Height":1080}]},
+				{"Name":"The One with the Sonogram at the End","IndexNumber":2,"ParentIndexNumber":1,"SeasonId":"s1-1",
+				 "PremiereDate":"1994-09-29T00:00:00.0000000Z","MediaStreams":[{"Type":"Video","Width":640,"Height":480}]},
+				{"Name":"The One with Ross's New Girlfriend","IndexNumber":1,"ParentIndexNumber":2,"SeasonId":"s1-2",
+				 "PremiereDate":"1995-09-21T00:00:00.0000000Z","MediaStreams":[{"Type":"Video","Width":3840,"Height":2160}]}]}`)
+		case r.URL.Path == "/Shows/s2/Episodes":
+			fmt.Fprint(w, `{"Items":[]}`)
+		case r.URL.Path == "/Items" && query.Get("IncludeItemTypes") == "MusicAlbum":
+			fmt.Fprint(w, `{"Items":[
+				{"Id":"a1","Name":"One in a Million","ProductionYear":1996,"AlbumArtists":[{"Name":"Aaliyah","Id":"ar1"}]},
+				{"Id":"a2","Name":"Age Ain't Nothing but a Number","ProductionYear":1994,"AlbumArtists":[{"Name":"Aaliyah","Id":"ar1"}]},
+				{"Id":"a3","Name":"Homework","ProductionYear":1997,"AlbumArtists":[{"Name":"Daft Punk","Id":"ar2"}]}],"TotalRecordCount":3}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestServer(t *testing.T) {
+	server := standIn(t, "Authorization", `MediaBrowser Token="secret"`)
+	defer server.Close()
+	jellyfin := New(server.URL+"/", testAPIKey, testUserID)
+	ctx := context.Background()
+
+	libraries, err := jellyfin.Libraries(ctx)
+	if err != nil || len(libraries) != 2 || libraries[0].Type != "movie" || libraries[1].Type != "show" {
+		t.Fatalf("Libraries() = %v, error = %v", libraries, err)
+	}
+
+	movies, err := jellyfin.Movies(ctx, "lib-movies")
+	if err != nil || len(movies) != 2 {
+		t.Fatalf("Movies() = %v, error = %v", movies, err)
+	}
+	shows, err := jellyfin.TV(ctx, "lib-tv")
+	if err != nil || len(shows) != 1 {
+		t.Fatalf("TV() = %v, error = %v", shows, err)
+	}
+	seasons := shows[0].Seasons
+	if len(seasons) != 2 || seasons[0].LowestResolution != types.PlexResolution480 || len(seasons[0].Episodes) != 2 ||
+		seasons[1].LowestResolution != types.PlexResolution4K {
+		t.Errorf("TV() seasons = %+v", seasons)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "movie resolution", got: movies[0].Resolution, want: types.PlexResolution1080},
+		{name: "movie year", got: movies[0].Year, want: "2019"},
+		{name: "movie audio language", got: movies[0].AudioLanguages[0], want: "eng"},
+		{name: "movie date added", got: movies[0].DateAdded.Year(), want: 2024},
+		{name: "movie plays", got: movies[0].ViewCount, want: 3},
+		{name: "movie critic rating", got: movies[0].Rating, want: 8.0},
+		{name: "movie community rating", got: movies[0].AudienceRating, want: 6.5},
+		{name: "movie last played", got: movies[0].LastViewedAt.Year(), want: 2025},
+		{name: "narrow movie resolution", got: movies[1].Resolution, want: types.PlexResolution576},
+		{name: "show first aired", got: shows[0].FirstEpisodeAired.Year(), want: 1994},
+		{name: "show last aired", got: shows[0].LastEpisodeAired.Year(), want: 1995},
+		{name: "show plays", got: shows[0].ViewCount, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	artists, err := jellyfin.MusicArtists(ctx, "lib-music")
+	if err != nil || len(artists) != 2 || artists[0].Name != "Aaliyah" || len(artists[0].Albums) != 2 {
+		t.Errorf("MusicArtists() = %+v, error = %v", artists, err)
+	}
+
+	if _, err := New(server.URL, "wrong", testUserID).Libraries(ctx); err == nil {
+		t.Error("Libraries() expected an error for a bad api key")
+	}
+}
+
+func TestResolution(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          string
+	}{
+		{width: 3840, height: 1600, want: types.PlexResolution4K},
+		{width: 1920, height: 800, want: types.PlexResolution1080},
+		{width: 1280, height: 720, want: types.PlexResolution720},
+		{width: 720, height: 480, want: types.PlexResolution480},
+		{width: 320, height: 240, want: types.PlexResolutionSD},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := resolution([]mediaStream{{Type: "Audio"}, {Type: "Video", Width: tt.width, Height: tt.height}}); got != tt.want {
+				t.Errorf("resolution(%dx%d) = %q, want %q", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package lastfm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sourcegraph/conc/iter"
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
+)
+
+// api docs https://www.last.fm/api/show/artist.getSimilar
+
+const (
+	DefaultURL        = "https://ws.audioscrobbler.com/2.0"
+	ProviderName      = "Last.fm"
+	lookupTimeout     = 10
+	maxAttempts       = 4
+	rateLimitPause    = 2 * time.Second
+	similarLimit      = 20
+	lastfmConcurrency = 2
+	// errorRateLimited is the last.fm error code for too many requests, it is sent with a 200 or 429
+	errorRateLimited = 29
+)
+
+var (
+	lastfmURL = utils.NewBaseURL(DefaultURL)
+	api       = &utils.APIClient{
+		Name:          "lastfm",
+		Timeout:       lookupTimeout * time.Second,
+		MaxAttempts:   maxAttempts,
+		RateLimitWait: rateLimitPause,
+		RateLimited: func(body []byte) bool {
+			var response similarResponse
+			return json.Unmarshal(body, &response) == nil && response.Error == errorRateLimited
+		},
+	}
+)
+
+type similarResponse struct {
+	SimilarArtists struct {
+		Artist []struct {
+			Name  string `json:"name"`
+			MBID  string `json:"mbid"`
+			Match string `json:"match"`
+			URL   string `json:"url"`
+		} `json:"artist"`
+	} `json:"similarartists"`
+	Error   int    `json:"error"`
+	Message string `json:"message"`
+}
+
+// SetURL points Last.fm lookups at a mirror, proxy or fixture server. An empty url restores the default.
+func SetURL(baseURL string) {
+	lastfmURL.Set(baseURL)
+}
+
+// SimilarArtists returns the artists Last.fm lists as similar to a plex artist, most similar first.
+func SimilarArtists(ctx context.Context, plexArtist *types.PlexMusicArtist, apiKey string) (similar types.MusicSimilarArtistResponse, err error) {
+	similar.PlexMusicArtist = *plexArtist
+	query := url.Values{}
+	query.Set("method", "artist.getsimilar")
+	query.Set("artist", plexArtist.Name)
+	query.Set("autocorrect", "1")
+	query.Set("limit", strconv.Itoa(similarLimit))
+	query.Set("api_key", apiKey)
+	query.Set("format", "json")
+	var response similarResponse
+	if err := getJSON(ctx, lastfmURL.String()+"/?"+query.Encode(), &response); err != nil {
+		return similar, err
+	}
+	for _, artist := range response.SimilarArtists.Artist {
+		similar.SimilarArtists = append(similar.SimilarArtists, types.MusicSimilarArtistResult{Name: artist.Name, URL: artist.URL})
+	}
+	return similar, nil
+}
+
+// GetSimilarArtistsInParallel looks up the similar artists of each plex artist, artists that fail are returned without any.
+func GetSimilarArtistsInParallel(ctx context.Context, progressFunc func(), plexArtists []types.PlexMusicArtist, apiKey string) []types.MusicSimilarArtistResponse {
+	mapper := iter.Mapper[types.PlexMusicArtist, types.MusicSimilarArtistResponse]{
+		MaxGoroutines: lastfmConcurrency,
+	}
+	return mapper.Map(plexArtists, func(artist *types.PlexMusicArtist) types.MusicSimilarArtistResponse {
+		if ctx.Err() != nil {
+			return types.MusicSimilarArtistResponse{PlexMusicArtist: *artist}
+		}
+		similar, err := SimilarArtists(ctx, artist, apiKey)
+		if err != nil {
+			fmt.Printf("lastfm: unable to find similar artists for %s: %s\n", artist.Name, err.Error())
+		}
+		if progressFunc != nil {
+			progressFunc()
+		}
+		return similar
+	})
+}
+
+// getJSON decodes a Last.fm response, waiting and retrying when rate limited. Last.fm explains its errors in the
+// body, whatever the status code.
+func getJSON(ctx context.Context, inputURL string, target *similarResponse) error {
+	body, err := api.Get(ctx, inputURL)
+	var statusErr *utils.StatusError
+	if errors.As(err, &statusErr) {
+		body = statusErr.Body
+	} else if err != nil {
+		return err
+	}
+	*target = similarResponse{}
+	parseErr := json.Unmarshal(body, target)
+	if target.Error != 0 {
+		return fmt.Errorf("lastfm: error %d: %s", target.Error, target.Message)
+	}
+	if err != nil {
+		return err
+	}
+	if parseErr != nil {
+		return fmt.Errorf("lastfm: unable to parse response: %w", parseErr)
+	}
+	return nil
+}
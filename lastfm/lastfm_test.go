@@ -0,0 +1,43 @@
+package lastfm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/fixtures/fixturestest"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestSimilarArtistsOffline(t *testing.T) {
+	SetURL(fixturestest.Start(t).LastFM)
+	t.Cleanup(func() { SetURL("") })
+
+	got := GetSimilarArtistsInParallel(context.Background(), nil,
+		[]types.PlexMusicArtist{{Name: "The Beatles"}, {Name: "Unknown Artist"}}, "key")
+	if len(got) != 2 || len(got[0].SimilarArtists) != 3 {
+		t.Fatalf("GetSimilarArtistsInParallel() = %+v", got)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "artist order", got: got[0].Name, want: "The Beatles"},
+		{name: "unknown artist order", got: got[1].Name, want: "Unknown Artist"},
+		{name: "most similar artist", got: got[0].SimilarArtists[0].Name, want: "John Lennon"},
+		{name: "similar artist url", got: got[0].SimilarArtists[0].URL, want: "https://www.last.fm/music/John+Lennon"},
+		{name: "unknown artist has no similar artists", got: len(got[1].SimilarArtists), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %+v, want %+v", tt.got, tt.want)
+			}
+		})
+	}
+
+	if _, err := SimilarArtists(context.Background(), &types.PlexMusicArtist{Name: "Unknown Artist"}, "key"); err == nil {
+		t.Error("SimilarArtists() expected an error for an unknown artist")
+	}
+}
@@ -0,0 +1,35 @@
+package mediaserver
+
+import (
+	"fmt"
+
+	"github.com/tphoney/plex-lookup/emby"
+	"github.com/tphoney/plex-lookup/jellyfin"
+	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+const (
+	Plex     = "plex"
+	Jellyfin = "jellyfin"
+	Emby     = "emby"
+)
+
+// IsPlex reports whether the configured media server is Plex, playlists, filters, write back and webhooks need it.
+func IsPlex(config *types.Configuration) bool {
+	return config.MediaServer == "" || config.MediaServer == Plex
+}
+
+// New returns the configured media server.
+func New(config *types.Configuration) (types.MediaServer, error) {
+	switch config.MediaServer {
+	case "", Plex:
+		return plex.Server{IP: config.PlexIP, Token: config.PlexToken}, nil
+	case Jellyfin:
+		return jellyfin.New(config.MediaServerURL, config.MediaServerAPIKey, config.MediaServerUserID), nil
+	case Emby:
+		return emby.New(config.MediaServerURL, config.MediaServerAPIKey, config.MediaServerUserID), nil
+	default:
+		return nil, fmt.Errorf("mediaserver: unknown media server %q", config.MediaServer)
+	}
+}
@@ -0,0 +1,32 @@
+package mediaserver
+
+import (
+	"testing"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		mediaServer string
+		wantName    string
+		wantErr     bool
+	}{
+		{mediaServer: "", wantName: "Plex"},
+		{mediaServer: Plex, wantName: "Plex"},
+		{mediaServer: Jellyfin, wantName: "Jellyfin"},
+		{mediaServer: Emby, wantName: "Emby"},
+		{mediaServer: "kodi", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mediaServer, func(t *testing.T) {
+			server, err := New(&types.Configuration{MediaServer: tt.mediaServer})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && server.Name() != tt.wantName {
+				t.Errorf("New().Name() = %q, want %q", server.Name(), tt.wantName)
+			}
+		})
+	}
+}
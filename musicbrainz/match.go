@@ -0,0 +1,180 @@
+package musicbrainz
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/michiwend/gomusicbrainz"
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
+)
+
+// Points for picking the MusicBrainz artist that is the plex artist. A candidate needs one of the name scores to be
+// picked at all, the rest separate candidates with the same name.
+const (
+	exactNameScore      = 100
+	nameScore           = 90
+	aliasScore          = 80
+	disambiguationScore = 30
+	tributeScore        = -50
+	// albumScore is for each plex album in the candidate's release groups, up to maxAlbumScore
+	albumScore    = 15
+	maxAlbumScore = 60
+	// albumCandidates is how many of the best named candidates have their release groups compared
+	albumCandidates = 3
+)
+
+var (
+	// tributeWords in a disambiguation comment mark an act playing someone else's songs
+	tributeWords = []string{"tribute", "cover", "karaoke", "impersonat"}
+	// nameHint splits a plex name like "Nirvana (UK band)" into the name and a hint to compare with disambiguations
+	nameHint = regexp.MustCompile(`^(.+?)\s*\(([^()]+)\)$`)
+)
+
+type candidate struct {
+	artist      *gomusicbrainz.Artist
+	score       int
+	searchScore int
+}
+
+// unsortName turns a sort name like "Beatles, The" back into "The Beatles".
+func unsortName(sortName string) string {
+	if i := strings.LastIndex(sortName, ", "); i > 0 {
+		return sortName[i+2:] + " " + sortName[:i]
+	}
+	return sortName
+}
+
+// splitNameHint returns the name to search for and a lower case hint, the hint is empty for most names.
+func splitNameHint(plexName string) (name, hint string) {
+	if match := nameHint.FindStringSubmatch(plexName); match != nil {
+		return match[1], strings.ToLower(match[2])
+	}
+	return plexName, ""
+}
+
+// nameMatchScore is how well a candidate's name, sort name or aliases match the plex name, 0 for no match.
+func nameMatchScore(plexName string, artist *gomusicbrainz.Artist) int {
+	if artist.Name == plexName {
+		return exactNameScore
+	}
+	name := utils.NormalisedArtistName(plexName)
+	if name == "" {
+		return 0
+	}
+	if utils.NormalisedArtistName(artist.Name) == name || utils.NormalisedArtistName(unsortName(artist.SortName)) == name {
+		return nameScore
+	}
+	for _, alias := range artist.Aliases {
+		if utils.NormalisedArtistName(alias.Name) == name || utils.NormalisedArtistName(unsortName(alias.SortName)) == name {
+			return aliasScore
+		}
+	}
+	return 0
+}
+
+// disambiguationMatchScore rewards a disambiguation that matches the hint in the plex name and penalises tribute
+// and cover acts, unless the plex name says it is one.
+func disambiguationMatchScore(plexName, hint, disambiguation string) (score int) {
+	disambiguation = strings.ToLower(disambiguation)
+	if disambiguation == "" {
+		return 0
+	}
+	if hint != "" && (strings.Contains(disambiguation, hint) || strings.Contains(hint, disambiguation)) {
+		score += disambiguationScore
+	}
+	for _, word := range tributeWords {
+		if strings.Contains(disambiguation, word) && !strings.Contains(strings.ToLower(plexName), word) {
+			return score + tributeScore
+		}
+	}
+	return score
+}
+
+// albumMatchScore counts the plex albums in a candidate's release group titles.
+func albumMatchScore(plexAlbums []types.PlexMusicAlbum, releaseTitles map[string]bool) int {
+	score := 0
+	for i := range plexAlbums {
+		if releaseTitles[utils.SanitizedAlbumTitle(plexAlbums[i].Title)] {
+			score += albumScore
+		}
+	}
+	return min(score, maxAlbumScore)
+}
+
+// scoreCandidates scores the search results by name and disambiguation, dropping those whose name does not match,
+// best first.
+func scoreCandidates(plexArtist *types.PlexMusicArtist, resp *gomusicbrainz.ArtistSearchResponse) (candidates []candidate) {
+	name, hint := splitNameHint(plexArtist.Name)
+	for _, artist := range resp.Artists {
+		score := nameMatchScore(plexArtist.Name, artist)
+		if score == 0 && hint != "" {
+			score = nameMatchScore(name, artist)
+		}
+		if score == 0 {
+			continue
+		}
+		score += disambiguationMatchScore(plexArtist.Name, hint, artist.Disambiguation)
+		candidates = append(candidates, candidate{artist: artist, score: score, searchScore: resp.Scores[artist]})
+	}
+	sortCandidates(candidates)
+	return candidates
+}
+
+// sortCandidates orders by score, then by MusicBrainz's own search score, keeping the search order for ties.
+func sortCandidates(candidates []candidate) {
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		if byScore := cmp.Compare(b.score, a.score); byScore != 0 {
+			return byScore
+		}
+		return cmp.Compare(b.searchScore, a.searchScore)
+	})
+}
+
+// pickArtist chooses between the candidates. When the best few tie on name and plex knows the artist's albums, their
+// release groups are compared with the plex albums. If that comparison fails the name order stands.
+func (c *Client) pickArtist(ctx context.Context, plexArtist *types.PlexMusicArtist, candidates []candidate) (*gomusicbrainz.Artist, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("artist not found")
+	}
+	tied := 1
+	for tied < min(len(candidates), albumCandidates) && candidates[tied].score == candidates[0].score {
+		tied++
+	}
+	if tied == 1 || len(plexArtist.Albums) == 0 {
+		return candidates[0].artist, nil
+	}
+	compared := slices.Clone(candidates[:tied])
+	for i := range compared {
+		releaseTitles, err := c.releaseTitles(ctx, string(compared[i].artist.ID))
+		if err != nil {
+			slog.Warn("musicbrainz: unable to compare albums, picking by name", "artist", plexArtist.Name, "error", err)
+			return candidates[0].artist, nil
+		}
+		compared[i].score += albumMatchScore(plexArtist.Albums, releaseTitles)
+	}
+	sortCandidates(compared)
+	return compared[0].artist, nil
+}
+
+// releaseTitles returns the sanitised titles of an artist's release groups, of any type or status.
+func (c *Client) releaseTitles(ctx context.Context, artistID string) (map[string]bool, error) {
+	var resp *gomusicbrainz.ReleaseGroupSearchResponse
+	err := c.request(ctx, func(ws2 *gomusicbrainz.WS2Client) (searchErr error) {
+		resp, searchErr = ws2.SearchReleaseGroup("arid:"+artistID, lookupLimit, -1)
+		return searchErr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("musicbrainz: unable to search for the releases of %s: %w", artistID, err)
+	}
+	titles := make(map[string]bool)
+	for _, releaseGroup := range resp.ReleaseGroups {
+		titles[utils.SanitizedAlbumTitle(releaseGroup.Title)] = true
+	}
+	return titles, nil
+}
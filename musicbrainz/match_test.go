@@ -0,0 +1,149 @@
+package musicbrainz
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/michiwend/gomusicbrainz"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestNameMatchScore(t *testing.T) {
+	beatles := &gomusicbrainz.Artist{Name: "The Beatles", SortName: "Beatles, The",
+		Aliases: []*gomusicbrainz.Alias{{Name: "ザ・ビートルズ", SortName: "Beatles, The"}}}
+	beyonce := &gomusicbrainz.Artist{Name: "Beyoncé", SortName: "Beyoncé",
+		Aliases: []*gomusicbrainz.Alias{{Name: "Beyoncé Knowles", SortName: "Knowles, Beyoncé"}}}
+	tests := []struct {
+		plexName string
+		artist   *gomusicbrainz.Artist
+		want     int
+	}{
+		{plexName: "The Beatles", artist: beatles, want: exactNameScore},
+		{plexName: "Beatles", artist: beatles, want: nameScore},
+		{plexName: "the beatles", artist: beatles, want: nameScore},
+		{plexName: "Beyonce", artist: beyonce, want: nameScore},
+		{plexName: "Beyonce Knowles", artist: beyonce, want: aliasScore},
+		{plexName: "Simon & Garfunkel", artist: &gomusicbrainz.Artist{Name: "Simon and Garfunkel"}, want: nameScore},
+		{plexName: "The Beatles Revival Band", artist: beatles, want: 0},
+		{plexName: "!!!", artist: &gomusicbrainz.Artist{Name: "Chk Chk Chk"}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plexName, func(t *testing.T) {
+			if got := nameMatchScore(tt.plexName, tt.artist); got != tt.want {
+				t.Errorf("nameMatchScore(%q, %q) = %d, want %d", tt.plexName, tt.artist.Name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreCandidates(t *testing.T) {
+	resp := &gomusicbrainz.ArtistSearchResponse{Artists: []*gomusicbrainz.Artist{
+		{ID: "tribute", Name: "Nirvana", Disambiguation: "Nirvana tribute band"},
+		{ID: "uk", Name: "Nirvana", Disambiguation: "60s UK band"},
+		{ID: "us", Name: "Nirvana", Disambiguation: "90s US grunge band"},
+		{ID: "other", Name: "Nirvana Sound System"},
+	}}
+	resp.Scores = gomusicbrainz.ScoreMap{resp.Artists[0]: 100, resp.Artists[1]: 100, resp.Artists[2]: 100, resp.Artists[3]: 80}
+	tests := []struct {
+		plexName string
+		want     []gomusicbrainz.MBID
+	}{
+		{plexName: "Nirvana", want: []gomusicbrainz.MBID{"uk", "us", "tribute"}},
+		{plexName: "Nirvana (US grunge band)", want: []gomusicbrainz.MBID{"us", "uk", "tribute"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plexName, func(t *testing.T) {
+			candidates := scoreCandidates(&types.PlexMusicArtist{Name: tt.plexName}, resp)
+			var got []gomusicbrainz.MBID
+			for i := range candidates {
+				got = append(got, candidates[i].artist.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("scoreCandidates(%q) = %v, want %v", tt.plexName, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFindArtistByAlbums has two artists with the same name, the plex albums pick the second.
+func TestFindArtistByAlbums(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		query := r.URL.Query().Get("query")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><metadata xmlns="http://musicbrainz.org/ns/mmd-2.0#" xmlns:ext="http://musicbrainz.org/ns/ext#-2.0">`)
+		switch {
+		case r.URL.Path == "/ws/2/artist":
+			fmt.Fprint(w, `<artist-list count="2" offset="0">
+				<artist id="first" ext:score="100"><name>Bush</name><sort-name>Bush</sort-name><disambiguation>English rock band</disambiguation></artist>
+				<artist id="second" ext:score="100"><name>Bush</name><sort-name>Bush</sort-name><disambiguation>Canadian rock band</disambiguation></artist>
+				</artist-list>`)
+		case strings.HasPrefix(query, "arid:second"):
+			fmt.Fprint(w, `<release-group-list count="2" offset="0">
+				<release-group id="rg1" type="Album"><title>Bush</title></release-group>
+				<release-group id="rg2" type="Album"><title>Bush (Remastered)</title></release-group>
+				</release-group-list>`)
+		default:
+			fmt.Fprint(w, `<release-group-list count="1" offset="0"><release-group id="rg3" type="Album"><title>Sixteen Stone</title></release-group></release-group-list>`)
+		}
+		fmt.Fprint(w, `</metadata>`)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL + "/ws/2")
+
+	got, err := client.findArtist(t.Context(), &types.PlexMusicArtist{Name: "Bush", Albums: []types.PlexMusicAlbum{{Title: "Bush"}}})
+	if err != nil || got.ID != "second" {
+		t.Errorf("findArtist() = %+v, error = %v, want the artist with the album", got, err)
+	}
+	// without albums the first search result wins
+	got, err = client.findArtist(t.Context(), &types.PlexMusicArtist{Name: "Bush"})
+	if err != nil || got.ID != "first" {
+		t.Errorf("findArtist() = %+v, error = %v, want the first result", got, err)
+	}
+	if _, err := client.findArtist(t.Context(), &types.PlexMusicArtist{Name: "Bush Tetras"}); err == nil {
+		t.Error("findArtist() expected an error when no name matches")
+	}
+}
+
+func TestPickArtist(t *testing.T) {
+	defer func(wait time.Duration) { retryWait = wait }(retryWait)
+	retryWait = time.Millisecond
+	var requests atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		http.Error(w, "", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	client := NewClient(down.URL + "/ws/2")
+	first := &gomusicbrainz.Artist{ID: "first", Name: "Bush"}
+	second := &gomusicbrainz.Artist{ID: "second", Name: "Bush"}
+	plexArtist := &types.PlexMusicArtist{Name: "Bush", Albums: []types.PlexMusicAlbum{{Title: "Sixteen Stone"}}}
+	tests := []struct {
+		name         string
+		candidates   []candidate
+		want         *gomusicbrainz.Artist
+		wantRequests bool
+	}{
+		{name: "best name wins without comparing albums",
+			candidates: []candidate{{artist: first, score: exactNameScore}, {artist: second, score: nameScore}}, want: first},
+		{name: "failed album comparison keeps the name order",
+			candidates: []candidate{{artist: first, score: exactNameScore}, {artist: second, score: exactNameScore}}, want: first,
+			wantRequests: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			got, err := client.pickArtist(t.Context(), plexArtist, tt.candidates)
+			if err != nil || got != tt.want {
+				t.Errorf("pickArtist() = %+v, error = %v, want %+v", got, err, tt.want)
+			}
+			if (requests.Load() > 0) != tt.wantRequests {
+				t.Errorf("pickArtist() made %d requests, want requests %v", requests.Load(), tt.wantRequests)
+			}
+		})
+	}
+}
@@ -3,11 +3,16 @@ package musicbrainz
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/michiwend/gomusicbrainz"
+	"github.com/sourcegraph/conc/iter"
 	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
 )
 
 // library docs https://github.com/michiwend/gomusicbrainz/blob/master/release_group.go
@@ -19,107 +24,313 @@ const (
 	agentVersion  = "0.0.1"
 	lookupLimit   = 100
 	lookupTimeout = 2
+	// publicHost is the MusicBrainz server that allows one request a second, see
+	// https://musicbrainz.org/doc/MusicBrainz_API/Rate_Limiting
+	publicHost = "musicbrainz.org"
+	// maxAttempts is how many times a failed request is made before giving up
+	maxAttempts            = 3
+	musicBrainzConcurrency = 4
 )
 
-func SearchMusicBrainzArtist(ctx context.Context, plexArtist *types.PlexMusicArtist, musicBrainzURL string) (artist types.MusicSearchResponse, err error) {
-	// Check for cancellation
-	select {
-	case <-ctx.Done():
-		return artist, ctx.Err()
-	default:
+var (
+	// publicLimiter is shared by every client of the public server
+	publicLimiter = utils.NewLimiter(time.Second, 1)
+	// retryWait is the pause after the first failed attempt, it grows with each attempt
+	retryWait = lookupTimeout * time.Second
+)
+
+// releaseTypeQueries select each of types.AlbumTypes, albums, EPs and singles without a secondary type, and the
+// secondary types whatever their primary type.
+var releaseTypeQueries = map[string]string{
+	types.AlbumTypeAlbum:       "(primarytype:album AND -secondarytype:*)",
+	types.AlbumTypeEP:          "(primarytype:ep AND -secondarytype:*)",
+	types.AlbumTypeSingle:      "(primarytype:single AND -secondarytype:*)",
+	types.AlbumTypeLive:        "secondarytype:live",
+	types.AlbumTypeCompilation: "secondarytype:compilation",
+	types.AlbumTypeSoundtrack:  "secondarytype:soundtrack",
+	types.AlbumTypeRemix:       "secondarytype:remix",
+}
+
+// Client searches a MusicBrainz server. Requests to musicbrainz.org share one limiter that keeps to its one request
+// a second policy, a local mirror is not limited.
+type Client struct {
+	url     string
+	limiter *utils.Limiter
+}
+
+// NewClient returns a client for the MusicBrainz web service at musicBrainzURL.
+func NewClient(musicBrainzURL string) *Client {
+	c := &Client{url: musicBrainzURL}
+	if parsed, err := url.Parse(musicBrainzURL); err == nil &&
+		(parsed.Hostname() == publicHost || strings.HasSuffix(parsed.Hostname(), "."+publicHost)) {
+		c.limiter = publicLimiter
 	}
+	return c
+}
 
-	artist.PlexMusicArtist = *plexArtist
-	client, err := gomusicbrainz.NewWS2Client(
-		musicBrainzURL, agent, agentVersion, "")
+// request waits for the limiter then makes the request, retrying failures a few times. The MusicBrainz library
+// hides the status code, a 503 from the rate limiter shows up as an EOF or XML error.
+func (c *Client) request(ctx context.Context, do func(ws2 *gomusicbrainz.WS2Client) error) (err error) {
+	ws2, err := gomusicbrainz.NewWS2Client(c.url, agent, agentVersion, "")
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		if c.limiter != nil {
+			if waitErr := c.limiter.Wait(ctx); waitErr != nil {
+				return waitErr
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = do(ws2)
+		if err == nil || attempt == maxAttempts {
+			return err
+		}
+		fmt.Printf("!")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * retryWait):
+		}
+	}
+}
+
+// GetArtistsInParallel finds each plex artist and their releases of the albumTypes. Artists that are not found, or
+// whose lookups fail, are returned without results.
+func (c *Client) GetArtistsInParallel(ctx context.Context, progressFunc func(), plexArtists []types.PlexMusicArtist, albumTypes []string) []types.MusicSearchResponse {
+	mapper := iter.Mapper[types.PlexMusicArtist, types.MusicSearchResponse]{
+		MaxGoroutines: musicBrainzConcurrency,
+	}
+	return mapper.Map(plexArtists, func(plexArtist *types.PlexMusicArtist) types.MusicSearchResponse {
+		if ctx.Err() != nil {
+			return types.MusicSearchResponse{PlexMusicArtist: *plexArtist}
+		}
+		result, err := c.SearchArtist(ctx, plexArtist, albumTypes)
+		if err != nil && ctx.Err() == nil {
+			slog.Debug("musicbrainz: artist lookup failed", "artist", plexArtist.Name, "error", err)
+		}
+		if progressFunc != nil {
+			progressFunc()
+		}
+		fmt.Print(".")
+		return result
+	})
+}
+
+// GetSimilarArtistsInParallel returns the artists MusicBrainz relates to each plex artist.
+func (c *Client) GetSimilarArtistsInParallel(ctx context.Context, progressFunc func(), plexArtists []types.PlexMusicArtist) []types.MusicSimilarArtistResponse {
+	mapper := iter.Mapper[types.PlexMusicArtist, types.MusicSimilarArtistResponse]{
+		MaxGoroutines: musicBrainzConcurrency,
+	}
+	return mapper.Map(plexArtists, func(plexArtist *types.PlexMusicArtist) types.MusicSimilarArtistResponse {
+		if ctx.Err() != nil {
+			return types.MusicSimilarArtistResponse{PlexMusicArtist: *plexArtist}
+		}
+		similar, _ := c.SearchSimilarArtists(ctx, plexArtist)
+		if progressFunc != nil {
+			progressFunc()
+		}
+		return similar
+	})
+}
 
+// SearchArtist finds the plex artist and their releases of the albumTypes.
+func (c *Client) SearchArtist(ctx context.Context, plexArtist *types.PlexMusicArtist, albumTypes []string) (artist types.MusicSearchResponse, err error) {
+	artist.PlexMusicArtist = *plexArtist
+	mbArtist, err := c.findArtist(ctx, plexArtist)
 	if err != nil {
 		return artist, err
 	}
-	// encode the artist name according to lucene query syntax
-	r := strings.NewReplacer(
-		"+", `\`,
-		"-", `\`,
-		"&&", `\`,
-		"||", `\`,
-		"!", `\`,
-		"(", `\`,
-		")", `\`,
-		"{", `\`,
-		"}", `\`,
-		"[", `\`,
-		"]", `\`,
-		"^", `\`,
-		`"`, `\`,
-		"~", `\`,
-		"*", `\`,
-		"?", `\`,
-		":", `\`,
-		`\`, `\`,
-		"/", `\`)
-
-	encodedArtist := r.Replace(plexArtist.Name)
-	resp, err := client.SearchArtist(encodedArtist, -1, -1)
+	found := types.MusicArtistSearchResult{
+		Name: mbArtist.Name,
+		ID:   fmt.Sprintf("%v", mbArtist.ID),
+	}
+	found.URL = fmt.Sprintf("https://musicbrainz.org/artist/%v", found.ID)
+	// get the albums
+	found.FoundAlbums, _ = c.SearchAlbums(ctx, found.ID, albumTypes)
+	artist.MusicSearchResults = append(artist.MusicSearchResults, found)
+	return artist, nil
+}
+
+// luceneEscaper blanks out the characters lucene query syntax treats as operators.
+var luceneEscaper = strings.NewReplacer(
+	"+", `\`,
+	"-", `\`,
+	"&&", `\`,
+	"||", `\`,
+	"!", `\`,
+	"(", `\`,
+	")", `\`,
+	"{", `\`,
+	"}", `\`,
+	"[", `\`,
+	"]", `\`,
+	"^", `\`,
+	`"`, `\`,
+	"~", `\`,
+	"*", `\`,
+	"?", `\`,
+	":", `\`,
+	`\`, `\`,
+	"/", `\`)
 
+// findArtist searches for the plex artist, matching names, sort names and aliases, and telling artists with the same
+// name apart by their disambiguation and albums.
+func (c *Client) findArtist(ctx context.Context, plexArtist *types.PlexMusicArtist) (*gomusicbrainz.Artist, error) {
+
+	name, _ := splitNameHint(plexArtist.Name)
+	encodedArtist := luceneEscaper.Replace(name)
+	var resp *gomusicbrainz.ArtistSearchResponse
+	err := c.request(ctx, func(ws2 *gomusicbrainz.WS2Client) (searchErr error) {
+		resp, searchErr = ws2.SearchArtist(encodedArtist, -1, -1)
+		return searchErr
+	})
 	if err != nil {
-		// check for a 503 error
-		if err.Error() == "EOF" {
-			fmt.Printf("!")
-			time.Sleep(lookupTimeout * time.Second)
-			return SearchMusicBrainzArtist(ctx, plexArtist, musicBrainzURL)
-		}
+		return nil, fmt.Errorf("musicbrainz: unable to search for %s: %w", plexArtist.Name, err)
 	}
+	return c.pickArtist(ctx, plexArtist, scoreCandidates(plexArtist, resp))
+}
 
-	for i := range resp.Artists {
-		if resp.Artists[i].Name != plexArtist.Name {
+// SearchAlbums returns the official releases of the albumTypes by the MusicBrainz artist.
+func (c *Client) SearchAlbums(ctx context.Context, artistID string, albumTypes []string) (albums []types.MusicAlbumSearchResult, err error) {
+	var typeQueries []string
+	for _, albumType := range albumTypes {
+		typeQueries = append(typeQueries, releaseTypeQueries[albumType])
+	}
+	queryURL := fmt.Sprintf("arid:%v AND status:official AND (%s)",
+		artistID, strings.Join(typeQueries, " OR "))
+	var resp *gomusicbrainz.ReleaseGroupSearchResponse
+	err = c.request(ctx, func(ws2 *gomusicbrainz.WS2Client) (searchErr error) {
+		resp, searchErr = ws2.SearchReleaseGroup(queryURL, lookupLimit, -1)
+		return searchErr
+	})
+	if err != nil {
+		return albums, fmt.Errorf("musicbrainz: unable to search for the releases of %s: %w", artistID, err)
+	}
+	for i := range resp.ReleaseGroups {
+		// the type is the first secondary type, or the primary type when there are none
+		albumType := strings.ToLower(resp.ReleaseGroups[i].Type)
+		if !slices.Contains(albumTypes, albumType) {
 			continue
 		}
-		found := types.MusicArtistSearchResult{
-			Name: resp.Artists[i].Name,
-			ID:   fmt.Sprintf("%v", resp.Artists[i].ID),
-		}
-		url := fmt.Sprintf("https://musicbrainz.org/artist/%v", found.ID)
-		found.URL = url
-		// get the albums
-		found.FoundAlbums, _ = SearchMusicBrainzAlbums(found.ID, musicBrainzURL)
-		artist.MusicSearchResults = append(artist.MusicSearchResults, found)
-		break
+		year := resp.ReleaseGroups[i].FirstReleaseDate.Year()
+		albums = append(albums, types.MusicAlbumSearchResult{
+			Title: resp.ReleaseGroups[i].Title,
+			ID:    fmt.Sprintf("%v", resp.ReleaseGroups[i].ID),
+			Year:  fmt.Sprintf("%v", year),
+			URL:   fmt.Sprintf("https://musicbrainz.org/release-group/%v", resp.ReleaseGroups[i].ID),
+			Type:  albumType,
+		})
+	}
+	return albums, nil
+}
+
+// SearchSimilarArtists returns the artists MusicBrainz relates to a plex artist, eg band members, the bands they
+// were in and collaborations. MusicBrainz has no similarity data, so these are the nearest thing.
+func (c *Client) SearchSimilarArtists(ctx context.Context, plexArtist *types.PlexMusicArtist) (similar types.MusicSimilarArtistResponse, err error) {
+	similar.PlexMusicArtist = *plexArtist
+	found, err := c.findArtist(ctx, plexArtist)
+	if err != nil {
+		return similar, err
+	}
+	var artist *gomusicbrainz.Artist
+	err = c.request(ctx, func(ws2 *gomusicbrainz.WS2Client) (lookupErr error) {
+		artist, lookupErr = ws2.LookupArtist(found.ID, "artist-rels")
+		return lookupErr
+	})
+	if err != nil {
+		return similar, fmt.Errorf("musicbrainz: unable to look up relations of %s: %w", plexArtist.Name, err)
 	}
-	if len(artist.MusicSearchResults) == 0 {
-		err = fmt.Errorf("artist not found")
+	seen := make(map[gomusicbrainz.MBID]bool)
+	for _, relation := range artist.Relations["artist"] {
+		related, ok := relation.(*gomusicbrainz.ArtistRelation)
+		if !ok || related.Artist.ID == "" || seen[related.Artist.ID] {
+			continue
+		}
+		seen[related.Artist.ID] = true
+		similar.SimilarArtists = append(similar.SimilarArtists, types.MusicSimilarArtistResult{
+			Name: related.Artist.Name,
+			URL:  fmt.Sprintf("https://musicbrainz.org/artist/%v", related.Artist.ID),
+		})
 	}
-	return artist, err
+	return similar, nil
 }
 
-func SearchMusicBrainzAlbums(artistID, musicBrainzURL string) (albums []types.MusicAlbumSearchResult, err error) {
-	client, err := gomusicbrainz.NewWS2Client(
-		musicBrainzURL, agent, agentVersion, "")
+// Name is shown in the incomplete albums report.
+func (c *Client) Name() string {
+	return "MusicBrainz"
+}
 
+// AlbumTracks returns the tracklist of a release group, taken from its earliest official release. Each disc
+// (medium) is numbered from 1.
+func (c *Client) AlbumTracks(ctx context.Context, releaseGroupID string) (tracks []types.AlbumTrack, err error) {
+	var releaseGroup *gomusicbrainz.ReleaseGroup
+	err = c.request(ctx, func(ws2 *gomusicbrainz.WS2Client) (lookupErr error) {
+		releaseGroup, lookupErr = ws2.LookupReleaseGroup(gomusicbrainz.MBID(releaseGroupID), "releases")
+		return lookupErr
+	})
 	if err != nil {
-		return albums, err
+		return tracks, fmt.Errorf("musicbrainz: unable to look up the releases of %s: %w", releaseGroupID, err)
 	}
-
-	queryURL := fmt.Sprintf("arid:%v AND status:official AND primarytype:album AND -secondarytype:*",
-		artistID)
-	resp, err := client.SearchReleaseGroup(queryURL, lookupLimit, -1)
+	release := originalRelease(releaseGroup.Releases)
+	if release == nil {
+		return tracks, fmt.Errorf("musicbrainz: no official release of %s", releaseGroupID)
+	}
+	err = c.request(ctx, func(ws2 *gomusicbrainz.WS2Client) (lookupErr error) {
+		release, lookupErr = ws2.LookupRelease(release.ID, "recordings")
+		return lookupErr
+	})
 	if err != nil {
-		if err.Error() == "EOF" {
-			fmt.Printf("!")
-			time.Sleep(lookupTimeout * time.Second)
-			return SearchMusicBrainzAlbums(artistID, musicBrainzURL)
+		return tracks, fmt.Errorf("musicbrainz: unable to look up the tracks of %s: %w", releaseGroupID, err)
+	}
+	for i, medium := range release.Mediums {
+		disc := medium.Position
+		if disc == 0 {
+			disc = i + 1
+		}
+		for _, track := range medium.Tracks {
+			tracks = append(tracks, types.AlbumTrack{Disc: disc, Number: track.Position, Title: track.Recording.Title})
 		}
 	}
-	for i := range resp.ReleaseGroups {
-		if resp.ReleaseGroups[i].Type == "Album" {
-			year := resp.ReleaseGroups[i].FirstReleaseDate.Year()
-			albums = append(albums, types.MusicAlbumSearchResult{
-				Title: resp.ReleaseGroups[i].Title,
-				ID:    fmt.Sprintf("%v", resp.ReleaseGroups[i].ID),
-				Year:  fmt.Sprintf("%v", year),
-				URL:   fmt.Sprintf("https://musicbrainz.org/release-group/%v", resp.ReleaseGroups[i].ID),
-			})
+	return tracks, nil
+}
+
+// AlbumFormats returns the physical formats, eg CD or 12" Vinyl, of the releases of an album by the artist.
+func (c *Client) AlbumFormats(ctx context.Context, artist, album string) (formats []string, err error) {
+	query := fmt.Sprintf(`release:"%s" AND artist:"%s"`, luceneEscaper.Replace(album), luceneEscaper.Replace(artist))
+	var resp *gomusicbrainz.ReleaseSearchResponse
+	err = c.request(ctx, func(ws2 *gomusicbrainz.WS2Client) (searchErr error) {
+		resp, searchErr = ws2.SearchRelease(query, lookupLimit, -1)
+		return searchErr
+	})
+	if err != nil {
+		return formats, fmt.Errorf("musicbrainz: unable to search for the releases of %s: %w", album, err)
+	}
+	title := utils.SanitizedAlbumTitle(album)
+	for _, release := range resp.Releases {
+		// the search also matches titles that only share some words
+		if utils.SanitizedAlbumTitle(release.Title) != title {
+			continue
+		}
+		for _, medium := range release.Mediums {
+			if medium.Format != "" && !slices.Contains(formats, medium.Format) {
+				formats = append(formats, medium.Format)
+			}
 		}
 	}
+	return formats, nil
+}
 
-	return albums, err
+// originalRelease is the earliest official release, releases without a date go last.
+func originalRelease(releases []*gomusicbrainz.Release) (original *gomusicbrainz.Release) {
+	for _, release := range releases {
+		if !strings.EqualFold(release.Status, "official") {
+			continue
+		}
+		if original == nil || !release.Date.IsZero() && (original.Date.IsZero() || release.Date.Before(original.Date.Time)) {
+			original = release
+		}
+	}
+	return original
 }
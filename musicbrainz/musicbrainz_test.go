@@ -1,8 +1,15 @@
 package musicbrainz
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/tphoney/plex-lookup/fixtures"
 	"github.com/tphoney/plex-lookup/types"
 )
 
@@ -51,13 +58,13 @@ func TestSearchMusicBrainzArtist(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotArtist, err := SearchMusicBrainzArtist(t.Context(), tt.args, musicBrainzURL)
+			gotArtist, err := NewClient(musicBrainzURL).SearchArtist(t.Context(), tt.args, []string{types.AlbumTypeAlbum})
 			if (err != nil) != tt.wantErr {
-				t.Errorf("SearchMusicBrainzArtist() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("SearchArtist() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if len(gotArtist.MusicSearchResults) == 0 {
-				t.Errorf("SearchMusicBrainzArtist() returned no music search results")
+				t.Errorf("SearchArtist() returned no music search results")
 				return
 			}
 			if len(tt.wantArtist.MusicSearchResults) == 0 {
@@ -65,10 +72,10 @@ func TestSearchMusicBrainzArtist(t *testing.T) {
 				return
 			}
 			if gotArtist.MusicSearchResults[0].Name != tt.wantArtist.MusicSearchResults[0].Name {
-				t.Errorf("SearchMusicBrainzArtist() Name = %v, want %v", gotArtist, tt.wantArtist)
+				t.Errorf("SearchArtist() Name = %v, want %v", gotArtist, tt.wantArtist)
 			}
 			if len(gotArtist.MusicSearchResults[0].FoundAlbums) <= len(tt.wantArtist.MusicSearchResults[0].FoundAlbums) {
-				t.Errorf("SearchMusicBrainzArtist() Albums size is bigger than expected: got %d, want %d",
+				t.Errorf("SearchArtist() Albums size is bigger than expected: got %d, want %d",
 					len(gotArtist.MusicSearchResults[0].FoundAlbums), len(tt.wantArtist.MusicSearchResults[0].FoundAlbums))
 			}
 		})
@@ -78,11 +85,11 @@ func TestSearchMusicBrainzArtist(t *testing.T) {
 // debug test for individual artists
 func TestSearchMusicBrainzArtistDebug(t *testing.T) {
 	artist := &types.PlexMusicArtist{Name: "Aaliyah"}
-	artistSearchResult, err := SearchMusicBrainzArtist(t.Context(), artist, musicBrainzURL)
+	artistSearchResult, err := NewClient(musicBrainzURL).SearchArtist(t.Context(), artist, []string{types.AlbumTypeAlbum})
 	if err != nil {
-		t.Errorf("SearchMusicBrainzArtist() error = %v", err)
+		t.Errorf("SearchArtist() error = %v", err)
 	}
-	t.Logf("SearchMusicBrainzArtist() = %v", artistSearchResult)
+	t.Logf("SearchArtist() = %v", artistSearchResult)
 }
 
 func TestSearchMusicBrainzAlbums(t *testing.T) {
@@ -104,14 +111,165 @@ func TestSearchMusicBrainzAlbums(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotAlbums, err := SearchMusicBrainzAlbums(tt.args.artistID, musicBrainzURL)
+			gotAlbums, err := NewClient(musicBrainzURL).SearchAlbums(t.Context(), tt.args.artistID, []string{types.AlbumTypeAlbum})
 			if (err != nil) != tt.wantErr {
-				t.Errorf("SearchMusicBrainzAlbums() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("SearchAlbums() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if len(gotAlbums) < tt.wantedAlbumCount {
-				t.Errorf("SearchMusicBrainzAlbums() = %v, wanted at least %d albums, got %d", len(gotAlbums), tt.wantedAlbumCount, len(gotAlbums))
+				t.Errorf("SearchAlbums() = %v, wanted at least %d albums, got %d", len(gotAlbums), tt.wantedAlbumCount, len(gotAlbums))
 			}
 		})
 	}
 }
+
+func TestSearchMusicBrainzArtistOffline(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+
+	client := NewClient(fixtures.ProviderURLs(server.URL).MusicBrainz)
+	got, err := client.SearchArtist(t.Context(), &types.PlexMusicArtist{Name: "The Beatles"}, []string{types.AlbumTypeAlbum})
+	if err != nil {
+		t.Fatalf("SearchArtist() error = %v", err)
+	}
+	if got.MusicSearchResults[0].ID != "b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d" {
+		t.Errorf("SearchArtist() ID = %s", got.MusicSearchResults[0].ID)
+	}
+	if len(got.MusicSearchResults[0].FoundAlbums) != 17 {
+		t.Errorf("SearchArtist() found %d albums, want 17", len(got.MusicSearchResults[0].FoundAlbums))
+	}
+	// the recording only has studio albums
+	live, err := client.SearchAlbums(t.Context(), got.MusicSearchResults[0].ID, []string{types.AlbumTypeLive})
+	if err != nil || len(live) != 0 {
+		t.Errorf("SearchAlbums() live = %v, error = %v", live, err)
+	}
+}
+
+func TestSearchMusicBrainzSimilarArtistsOffline(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+	client := NewClient(fixtures.ProviderURLs(server.URL).MusicBrainz)
+
+	got, err := client.SearchSimilarArtists(t.Context(), &types.PlexMusicArtist{Name: "The Beatles"})
+	if err != nil {
+		t.Fatalf("SearchSimilarArtists() error = %v", err)
+	}
+	// john lennon is both a member and a supporting musician, he is only listed once
+	if len(got.SimilarArtists) != 2 || got.SimilarArtists[0].Name != "John Lennon" || got.SimilarArtists[1].Name != "Paul McCartney" {
+		t.Errorf("SearchSimilarArtists() = %+v", got.SimilarArtists)
+	}
+	if _, err := client.SearchSimilarArtists(t.Context(), &types.PlexMusicArtist{Name: "Unknown Artist"}); err == nil {
+		t.Error("SearchSimilarArtists() expected an error for an unknown artist")
+	}
+}
+
+func TestGetArtistsInParallelOffline(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+
+	var progress atomic.Int32
+	got := NewClient(fixtures.ProviderURLs(server.URL).MusicBrainz).GetArtistsInParallel(t.Context(), func() { progress.Add(1) },
+		[]types.PlexMusicArtist{{Name: "The Beatles"}, {Name: "Unknown Artist"}}, []string{types.AlbumTypeAlbum})
+	if len(got) != 2 || got[0].Name != "The Beatles" || got[1].Name != "Unknown Artist" || progress.Load() != 2 {
+		t.Fatalf("GetArtistsInParallel() = %+v, progress = %d", got, progress.Load())
+	}
+	if len(got[0].MusicSearchResults) == 0 || len(got[0].MusicSearchResults[0].FoundAlbums) != 17 {
+		t.Errorf("GetArtistsInParallel() The Beatles = %+v", got[0].MusicSearchResults)
+	}
+	if len(got[1].MusicSearchResults) != 0 {
+		t.Errorf("GetArtistsInParallel() expected no match for an unrecorded artist, but got %v", got[1].MusicSearchResults)
+	}
+}
+
+func TestRequestRetries(t *testing.T) {
+	defer func(wait time.Duration) { retryWait = wait }(retryWait)
+	retryWait = time.Millisecond
+	var requests atomic.Int32
+	fixtureHandler := fixtures.Handler()
+	// the first request fails like the public server's rate limiter, the rest are replayed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "", http.StatusServiceUnavailable)
+			return
+		}
+		fixtureHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	client := NewClient(fixtures.ProviderURLs(server.URL).MusicBrainz)
+
+	if _, err := client.SearchArtist(t.Context(), &types.PlexMusicArtist{Name: "The Beatles"}, []string{types.AlbumTypeAlbum}); err != nil {
+		t.Fatalf("SearchArtist() error = %v, expected the failed request to be retried", err)
+	}
+	if requests.Load() < 2 {
+		t.Errorf("SearchArtist() made %d requests, expected the failed request to be retried", requests.Load())
+	}
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	client = NewClient(down.URL + "/ws/2")
+	if _, err := client.SearchArtist(t.Context(), &types.PlexMusicArtist{Name: "The Beatles"}, nil); err == nil {
+		t.Error("SearchArtist() expected an error when the server is down")
+	}
+}
+
+func TestNewClientLimiter(t *testing.T) {
+	if NewClient("https://musicbrainz.org/ws/2").limiter == nil || NewClient("http://localhost:5000").limiter != nil {
+		t.Error("NewClient() expected only the public server to be limited")
+	}
+}
+
+func TestAlbumTracks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><metadata xmlns="http://musicbrainz.org/ns/mmd-2.0#">`)
+		switch r.URL.Path {
+		case "/ws/2/release-group/revolver":
+			fmt.Fprint(w, `<release-group id="revolver" type="Album"><title>Revolver</title><release-list count="3">
+				<release id="reissue"><title>Revolver</title><status>Official</status><date>2009-09-09</date></release>
+				<release id="bootleg"><title>Revolver</title><status>Bootleg</status><date>1965-01-01</date></release>
+				<release id="original"><title>Revolver</title><status>Official</status><date>1966-08-05</date></release>
+				</release-list></release-group>`)
+		case "/ws/2/release/original":
+			fmt.Fprint(w, `<release id="original"><title>Revolver</title><medium-list count="2">
+				<medium><position>1</position><track-list count="2">
+					<track id="t1"><position>1</position><recording id="r1"><title>Taxman</title></recording></track>
+					<track id="t2"><position>2</position><recording id="r2"><title>Eleanor Rigby</title></recording></track>
+				</track-list></medium>
+				<medium><position>2</position><track-list count="1">
+					<track id="t3"><position>1</position><recording id="r3"><title>Rain</title></recording></track>
+				</track-list></medium>
+				</medium-list></release>`)
+		}
+		fmt.Fprint(w, `</metadata>`)
+	}))
+	defer server.Close()
+
+	got, err := NewClient(server.URL+"/ws/2").AlbumTracks(t.Context(), "revolver")
+	want := []types.AlbumTrack{{Disc: 1, Number: 1, Title: "Taxman"}, {Disc: 1, Number: 2, Title: "Eleanor Rigby"}, {Disc: 2, Number: 1, Title: "Rain"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("AlbumTracks() = %+v, error = %v, want %+v", got, err, want)
+	}
+}
+
+func TestAlbumFormats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if query := r.URL.Query().Get("query"); query != `release:"Kid A" AND artist:"Radiohead"` {
+			t.Errorf("AlbumFormats() query = %q", query)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><metadata xmlns="http://musicbrainz.org/ns/mmd-2.0#"><release-list count="3">
+			<release id="cd"><title>Kid A</title><medium-list count="1"><medium><format>CD</format></medium></medium-list></release>
+			<release id="vinyl"><title>Kid A</title><medium-list count="2"><medium><format>10" Vinyl</format></medium>
+				<medium><format>CD</format></medium></medium-list></release>
+			<release id="other"><title>Kid A Mnesia</title><medium-list count="1"><medium><format>Cassette</format></medium></medium-list></release>
+			</release-list></metadata>`)
+	}))
+	defer server.Close()
+
+	got, err := NewClient(server.URL+"/ws/2").AlbumFormats(t.Context(), "Radiohead", "Kid A")
+	want := []string{"CD", `10" Vinyl`}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("AlbumFormats() = %q, error = %v, want %q", got, err, want)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"regexp"
 	"slices"
 	"sort"
 	"strconv"
@@ -59,7 +61,7 @@ type MovieContainer struct {
 		AudienceRatingImage   string `xml:"audienceRatingImage,attr"`
 		PrimaryExtraKey       string `xml:"primaryExtraKey,attr"`
 		RatingImage           string `xml:"ratingImage,attr"`
-		Media                 struct {
+		Media                 []struct {
 			Text            string `xml:",chardata"`
 			ID              string `xml:"id,attr"`
 			Duration        string `xml:"duration,attr"`
@@ -74,7 +76,7 @@ type MovieContainer struct {
 			Container       string `xml:"container,attr"`
 			VideoFrameRate  string `xml:"videoFrameRate,attr"`
 			VideoProfile    string `xml:"videoProfile,attr"`
-			Part            struct {
+			Part            []struct {
 				Text         string `xml:",chardata"`
 				ID           string `xml:"id,attr"`
 				Key          string `xml:"key,attr"`
@@ -293,6 +295,7 @@ type TVContainer struct {
 		ContentRating         string `xml:"contentRating,attr"`
 		Summary               string `xml:"summary,attr"`
 		Index                 string `xml:"index,attr"`
+		Rating                string `xml:"rating,attr"`
 		AudienceRating        string `xml:"audienceRating,attr"`
 		ViewCount             string `xml:"viewCount,attr"`
 		LastViewedAt          string `xml:"lastViewedAt,attr"`
@@ -626,6 +629,44 @@ type AlbumContainer struct {
 	} `xml:"Directory"`
 }
 
+type TrackContainer struct {
+	XMLName xml.Name `xml:"MediaContainer"`
+	Track   []struct {
+		RatingKey   string `xml:"ratingKey,attr"`
+		Title       string `xml:"title,attr"`
+		Index       string `xml:"index,attr"`
+		ParentIndex string `xml:"parentIndex,attr"`
+	} `xml:"Track"`
+}
+
+type TrackQualityContainer struct {
+	XMLName xml.Name `xml:"MediaContainer"`
+	Track   []struct {
+		ParentRatingKey string `xml:"parentRatingKey,attr"`
+		Media           []struct {
+			AudioCodec string `xml:"audioCodec,attr"`
+			Bitrate    string `xml:"bitrate,attr"`
+			Part       []struct {
+				Stream []struct {
+					StreamType   string `xml:"streamType,attr"`
+					BitDepth     string `xml:"bitDepth,attr"`
+					SamplingRate string `xml:"samplingRate,attr"`
+				} `xml:"Stream"`
+			} `xml:"Part"`
+		} `xml:"Media"`
+	} `xml:"Track"`
+}
+
+type FilterValueContainer struct {
+	XMLName   xml.Name `xml:"MediaContainer"`
+	Size      string   `xml:"size,attr"`
+	Directory []struct {
+		Key     string `xml:"key,attr"`
+		FastKey string `xml:"fastKey,attr"`
+		Title   string `xml:"title,attr"`
+	} `xml:"Directory"`
+}
+
 type PlaylistContainer struct {
 	XMLName  xml.Name `xml:"MediaContainer"`
 	Text     string   `xml:",chardata"`
@@ -1027,28 +1068,109 @@ type Filter struct {
 	Modifier string
 }
 
-func AllMovies(ipAddress, libraryID, plexToken string) (movieList []types.PlexMovie) {
-	url := fmt.Sprintf("http://%s:32400/library/sections/%s/all", ipAddress, libraryID)
+// lookupSourceFields are the library tags that can be used to pick what to look up, instead of a playlist.
+var lookupSourceFields = []string{"collection", "label", "genre", "decade"}
+
+var filterExpressionRegex = regexp.MustCompile(`^([A-Za-z][A-Za-z.]*)([!<>]*)=(.+)$`)
+
+// String encodes the filter as a query parameter, Plex puts the modifier before the "=", eg "year>>=1990".
+func (f Filter) String() string {
+	return f.Name + f.Modifier + "=" + url.QueryEscape(f.Value)
+}
 
-	response, err := makePlexAPIRequest(url, plexToken)
+// ParseFilters parses Plex filter expressions separated by "&", eg "resolution=sd&year<<=2000&unwatched=1".
+// They are passed to Plex as is and evaluated server side.
+func ParseFilters(expression string) (filters []Filter, err error) {
+	for _, part := range strings.Split(expression, "&") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		match := filterExpressionRegex.FindStringSubmatch(part)
+		if match == nil {
+			return nil, fmt.Errorf("plex: invalid filter %q, expected eg year>>=1990", part)
+		}
+		filters = append(filters, Filter{Name: match[1], Modifier: match[2], Value: strings.TrimSpace(match[3])})
+	}
+	return filters, nil
+}
+
+// LookupSourceFilters turns a lookup source from the web forms, eg "collection:123" or "decade:1990", and a filter
+// expression into library filters. Playlists and "all" have no source filters.
+func LookupSourceFilters(source, expression string) (filters []Filter, err error) {
+	if field, value, found := strings.Cut(source, ":"); found && slices.Contains(lookupSourceFields, field) {
+		filters = append(filters, Filter{Name: field, Value: value})
+	}
+	expressionFilters, err := ParseFilters(expression)
 	if err != nil {
-		slog.Error("GetPlexMovies: error making request", "error", err)
-		return movieList
+		return nil, err
+	}
+	return append(filters, expressionFilters...), nil
+}
+
+// GetLookupSources lists the collections, labels, genres and decades of a library.
+func GetLookupSources(ipAddress, plexToken, libraryID string) (sources []types.PlexLookupSource) {
+	for _, field := range lookupSourceFields {
+		sourceURL := fmt.Sprintf("%s/library/sections/%s/%s", plexURL(ipAddress), libraryID, field)
+		response, err := makePlexAPIRequest(sourceURL, plexToken)
+		if err != nil {
+			slog.Error("GetLookupSources: error making request", "field", field, "error", err)
+			continue
+		}
+		var container FilterValueContainer
+		if err := xml.Unmarshal([]byte(response), &container); err != nil {
+			slog.Error("GetLookupSources: error parsing XML", "field", field, "error", err)
+			continue
+		}
+		for i := range container.Directory {
+			sources = append(sources, types.PlexLookupSource{
+				Field: field, Title: container.Directory[i].Title, Key: container.Directory[i].Key})
+		}
 	}
+	return sources
+}
 
-	movieList = extractMovies(response)
+func libraryURL(ipAddress, libraryID string, filters []Filter) string {
+	libraryURL := fmt.Sprintf("%s/library/sections/%s/all", plexURL(ipAddress), libraryID)
+	if len(filters) == 0 {
+		return libraryURL
+	}
+	query := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		query = append(query, filter.String())
+	}
+	return libraryURL + "?" + strings.Join(query, "&")
+}
+
+func AllMovies(ipAddress, libraryID, plexToken string) (movieList []types.PlexMovie, err error) {
+	return GetFilteredMovies(ipAddress, plexToken, libraryID, nil)
+}
+
+// GetFilteredMovies returns the movies of a library that match all of the filters.
+func GetFilteredMovies(ipAddress, plexToken, libraryID string, filters []Filter) (movieList []types.PlexMovie, err error) {
+	requestURL := libraryURL(ipAddress, libraryID, filters)
+
+	response, err := makePlexAPIRequest(requestURL, plexToken)
+	if err != nil {
+		return movieList, fmt.Errorf("plex: unable to list movies: %w", err)
+	}
+
+	movieList, err = extractMovies(response)
+	if err != nil {
+		return movieList, fmt.Errorf("plex: unable to parse movies: %w", err)
+	}
 	// we need to make an API request for each movie to get audio languages
 	detailedMovies := iter.Map(movieList, func(m *types.PlexMovie) types.PlexMovie {
 		return getMovieDetailsValue(ipAddress, plexToken, m)
 	})
 	slog.Info("Plex movies fetched", "count", len(detailedMovies))
-	return detailedMovies
+	return detailedMovies, nil
 }
 
 // getMovieDetailsValue is a value-returning version for use with iter.Map
 func getMovieDetailsValue(ipAddress, plexToken string, movie *types.PlexMovie) types.PlexMovie {
-	url := fmt.Sprintf("http://%s:32400/library/metadata/%s", ipAddress, movie.RatingKey)
-	response, err := makePlexAPIRequest(url, plexToken)
+	requestURL := fmt.Sprintf("%s/library/metadata/%s", plexURL(ipAddress), movie.RatingKey)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
 		slog.Error("getPlexMovieDetails: error making request", "error", err)
 		return *movie
@@ -1060,49 +1182,88 @@ func getMovieDetailsValue(ipAddress, plexToken string, movie *types.PlexMovie) t
 		return *movie
 	}
 	languages := make(map[string]struct{})
+	formats := make(map[string]struct{})
 	for i := range container.Video.Media.Part.Stream {
-		if container.Video.Media.Part.Stream[i].StreamType == "2" {
+		if container.Video.Media.Part.Stream[i].StreamType == audioStreamType {
 			languages[container.Video.Media.Part.Stream[i].Language] = struct{}{}
+			// the display title carries the codec extensions, eg "English (TrueHD 7.1 Atmos)"
+			formats[container.Video.Media.Part.Stream[i].DisplayTitle] = struct{}{}
 		}
 	}
 	var langs []string
 	for lang := range languages {
 		langs = append(langs, lang)
 	}
+	var audioFormats []string
+	for format := range formats {
+		audioFormats = append(audioFormats, format)
+	}
 	movie.AudioLanguages = langs
+	movie.AudioFormats = audioFormats
 	return *movie
 }
 
-func extractMovies(xmlString string) (movieList []types.PlexMovie) {
+func extractMovies(xmlString string) (movieList []types.PlexMovie, err error) {
 	var container MovieContainer
-	err := xml.Unmarshal([]byte(xmlString), &container)
+	err = xml.Unmarshal([]byte(xmlString), &container)
 	if err != nil {
-		slog.Error("extractMovies: error parsing XML", "error", err)
-		return
+		return movieList, err
 	}
 
 	for i := range container.Video {
-		movieList = append(movieList, types.PlexMovie{
-			Title:      container.Video[i].Title,
-			Year:       container.Video[i].Year,
-			RatingKey:  container.Video[i].RatingKey,
-			Resolution: container.Video[i].Media.VideoResolution,
-			DateAdded:  parsePlexDate(container.Video[i].AddedAt)})
+		viewCount, _ := strconv.Atoi(container.Video[i].ViewCount)
+		rating, _ := strconv.ParseFloat(container.Video[i].Rating, 64)
+		audienceRating, _ := strconv.ParseFloat(container.Video[i].AudienceRating, 64)
+		movie := types.PlexMovie{
+			Title:          container.Video[i].Title,
+			Year:           container.Video[i].Year,
+			RatingKey:      container.Video[i].RatingKey,
+			DateAdded:      parsePlexDate(container.Video[i].AddedAt),
+			ViewCount:      viewCount,
+			LastViewedAt:   parsePlexDate(container.Video[i].LastViewedAt),
+			Rating:         rating,
+			AudienceRating: audienceRating}
+		// a movie can have several versions (Media), each split over one or more files (Part)
+		for _, media := range container.Video[i].Media {
+			version := types.PlexMovieVersion{Resolution: media.VideoResolution, VideoCodec: media.VideoCodec,
+				AudioCodec: media.AudioCodec}
+			for _, part := range media.Part {
+				size, _ := strconv.ParseInt(part.Size, 10, 64)
+				version.Files = append(version.Files, part.File)
+				version.FileSize += size
+			}
+			movie.Versions = append(movie.Versions, version)
+		}
+		// the first version is the one plex plays by default
+		if len(movie.Versions) > 0 {
+			movie.Resolution = movie.Versions[0].Resolution
+			movie.VideoCodec = movie.Versions[0].VideoCodec
+			movie.AudioCodec = movie.Versions[0].AudioCodec
+			movie.FileSize = movie.Versions[0].FileSize
+		}
+		movieList = append(movieList, movie)
 	}
-	return movieList
+	return movieList, nil
 }
 
 // =================================================================================================
-func AllTV(ipAddress, plexToken, libraryID string) (tvShowList []types.PlexTVShow) {
-	url := fmt.Sprintf("http://%s:32400/library/sections/%s/all", ipAddress, libraryID)
+func AllTV(ipAddress, plexToken, libraryID string) (tvShowList []types.PlexTVShow, err error) {
+	return GetFilteredTV(ipAddress, plexToken, libraryID, nil)
+}
 
-	response, err := makePlexAPIRequest(url, plexToken)
+// GetFilteredTV returns the TV shows of a library that match all of the filters.
+func GetFilteredTV(ipAddress, plexToken, libraryID string, filters []Filter) (tvShowList []types.PlexTVShow, err error) {
+	requestURL := libraryURL(ipAddress, libraryID, filters)
+
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
-		slog.Error("AllTV: error making request", "error", err)
-		return tvShowList
+		return tvShowList, fmt.Errorf("plex: unable to list TV shows: %w", err)
 	}
 
-	tvShowList = extractTVShows(response)
+	tvShowList, err = extractTVShows(response)
+	if err != nil {
+		return tvShowList, fmt.Errorf("plex: unable to parse TV shows: %w", err)
+	}
 	// now we need to get the episodes for each TV show
 	for i := range tvShowList {
 		tvShowList[i].Seasons = getPlexTVSeasons(ipAddress, plexToken, tvShowList[i].RatingKey)
@@ -1118,13 +1279,13 @@ func AllTV(ipAddress, plexToken, libraryID string) (tvShowList []types.PlexTVSho
 		}
 	}
 	slog.Info("Plex TV shows fetched", "count", len(filteredTVShows))
-	return filteredTVShows
+	return filteredTVShows, nil
 }
 
 func getPlexTVSeasons(ipAddress, plexToken, ratingKey string) (seasonList []types.PlexTVSeason) {
-	url := fmt.Sprintf("http://%s:32400/library/metadata/%s/children?", ipAddress, ratingKey)
+	requestURL := fmt.Sprintf("%s/library/metadata/%s/children?", plexURL(ipAddress), ratingKey)
 
-	response, err := makePlexAPIRequest(url, plexToken)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
 		slog.Error("getPlexTVSeasons: error making request", "error", err)
 		return seasonList
@@ -1146,7 +1307,7 @@ func getPlexTVSeasons(ipAddress, plexToken, ratingKey string) (seasonList []type
 		for j := range detailedSeasons[i].Episodes {
 			listOfResolutions = append(listOfResolutions, detailedSeasons[i].Episodes[j].Resolution)
 		}
-		detailedSeasons[i].LowestResolution = findLowestResolution(listOfResolutions)
+		detailedSeasons[i].LowestResolution = types.LowestResolution(listOfResolutions)
 		detailedSeasons[i].LastEpisodeAdded = detailedSeasons[i].Episodes[len(detailedSeasons[i].Episodes)-1].DateAdded
 		detailedSeasons[i].LastEpisodeAired = detailedSeasons[i].Episodes[len(detailedSeasons[i].Episodes)-1].OriginallyAired
 		detailedSeasons[i].FirstEpisodeAired = detailedSeasons[i].Episodes[0].OriginallyAired
@@ -1160,8 +1321,8 @@ func getPlexTVSeasons(ipAddress, plexToken, ratingKey string) (seasonList []type
 
 // getTVEpisodesValue is a value-returning version for use with iter.Map
 func getTVEpisodesValue(ipAddress, plexToken string, season *types.PlexTVSeason) types.PlexTVSeason {
-	url := fmt.Sprintf("http://%s:32400/library/metadata/%s/children?", ipAddress, season.RatingKey)
-	response, err := makePlexAPIRequest(url, plexToken)
+	requestURL := fmt.Sprintf("%s/library/metadata/%s/children?", plexURL(ipAddress), season.RatingKey)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
 		slog.Error("getTVEpisodesValue: error making request", "error", err)
 		return *season
@@ -1173,20 +1334,24 @@ func getTVEpisodesValue(ipAddress, plexToken string, season *types.PlexTVSeason)
 	return *season
 }
 
-func extractTVShows(xmlString string) (showList []types.PlexTVShow) {
+func extractTVShows(xmlString string) (showList []types.PlexTVShow, err error) {
 	var container TVContainer
-	err := xml.Unmarshal([]byte(xmlString), &container)
+	err = xml.Unmarshal([]byte(xmlString), &container)
 	if err != nil {
-		slog.Error("extractTVShows: error parsing XML", "error", err)
-		return
+		return showList, err
 	}
 
 	for i := range container.Directory {
+		viewCount, _ := strconv.Atoi(container.Directory[i].ViewCount)
+		rating, _ := strconv.ParseFloat(container.Directory[i].Rating, 64)
+		audienceRating, _ := strconv.ParseFloat(container.Directory[i].AudienceRating, 64)
 		showList = append(showList, types.PlexTVShow{
 			Title: container.Directory[i].Title, Year: container.Directory[i].Year,
-			DateAdded: parsePlexDate(container.Directory[i].AddedAt), RatingKey: container.Directory[i].RatingKey})
+			DateAdded: parsePlexDate(container.Directory[i].AddedAt), RatingKey: container.Directory[i].RatingKey,
+			ViewCount: viewCount, LastViewedAt: parsePlexDate(container.Directory[i].LastViewedAt),
+			Rating: rating, AudienceRating: audienceRating})
 	}
-	return showList
+	return showList, nil
 }
 
 func extractTVSeasons(xmlString string) (seasonList []types.PlexTVSeason) {
@@ -1222,28 +1387,32 @@ func extractTVEpisodes(xmlString string) (episodeList []types.PlexTVEpisode) {
 		if err != nil {
 			originallyAired = time.Time{}
 		}
+		fileSize, _ := strconv.ParseInt(container.Video[i].Media.Part.Size, 10, 64)
 		episodeList = append(episodeList, types.PlexTVEpisode{
 			Title: container.Video[i].Title, Resolution: container.Video[i].Media.VideoResolution,
+			VideoCodec: container.Video[i].Media.VideoCodec, AudioCodec: container.Video[i].Media.AudioCodec, FileSize: fileSize,
 			Index: container.Video[i].Index, DateAdded: dateAdded, OriginallyAired: originallyAired})
 	}
 	return episodeList
 }
 
 // =================================================================================================
-func AllMusicArtists(ipAddress, plexToken, libraryID string) (artists []types.PlexMusicArtist) {
-	url := fmt.Sprintf("http://%s:32400/library/sections/%s/all", ipAddress, libraryID)
+func AllMusicArtists(ipAddress, plexToken, libraryID string) (artists []types.PlexMusicArtist, err error) {
+	return GetFilteredMusicArtists(ipAddress, plexToken, libraryID, nil)
+}
+
+// GetFilteredMusicArtists returns the artists of a library that match all of the filters.
+func GetFilteredMusicArtists(ipAddress, plexToken, libraryID string, filters []Filter) (artists []types.PlexMusicArtist, err error) {
+	requestURL := libraryURL(ipAddress, libraryID, filters)
 
-	response, err := makePlexAPIRequest(url, plexToken)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
-		slog.Error("AllMusicArtists: error making request", "error", err)
-		return artists
+		return artists, fmt.Errorf("plex: unable to list music artists: %w", err)
 	}
 
 	artists, err = extractMusicArtists(response)
-
 	if err != nil {
-		slog.Error("AllMusicArtists: error extracting artists", "error", err)
-		return artists
+		return artists, fmt.Errorf("plex: unable to parse music artists: %w", err)
 	}
 	// now we need to get the albums for each artist
 	for i := range artists {
@@ -1251,13 +1420,22 @@ func AllMusicArtists(ipAddress, plexToken, libraryID string) (artists []types.Pl
 	}
 
 	slog.Info("Plex music artists fetched", "count", len(artists))
-	return artists
+	return artists, nil
+}
+
+// ListMusicArtists returns the artists of a library without their albums, which is a single request.
+func ListMusicArtists(ipAddress, plexToken, libraryID string) (artists []types.PlexMusicArtist, err error) {
+	response, err := makePlexAPIRequest(libraryURL(ipAddress, libraryID, nil), plexToken)
+	if err != nil {
+		return artists, fmt.Errorf("plex: unable to list music artists: %w", err)
+	}
+	return extractMusicArtists(response)
 }
 
 func GetArtistMusicAlbums(ipAddress, plexToken, libraryID, ratingKey string) (albums []types.PlexMusicAlbum) {
-	url := fmt.Sprintf("http://%s:32400/library/sections/%s/all?artist.id=%s&type=9", ipAddress, libraryID, ratingKey)
+	requestURL := fmt.Sprintf("%s/library/sections/%s/all?artist.id=%s&type=9", plexURL(ipAddress), libraryID, ratingKey)
 
-	response, err := makePlexAPIRequest(url, plexToken)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
 		slog.Error("GetArtistMusicAlbums: error making request", "error", err)
 		return albums
@@ -1267,6 +1445,66 @@ func GetArtistMusicAlbums(ipAddress, plexToken, libraryID, ratingKey string) (al
 	return albums
 }
 
+// GetAlbumTracks returns the tracks of an album, tracks without a disc number are on disc 1.
+func GetAlbumTracks(ipAddress, plexToken, ratingKey string) (tracks []types.AlbumTrack, err error) {
+	response, err := makePlexAPIRequest(fmt.Sprintf("%s/library/metadata/%s/children", plexURL(ipAddress), ratingKey), plexToken)
+	if err != nil {
+		return tracks, fmt.Errorf("plex: unable to get album tracks: %w", err)
+	}
+	return extractAlbumTracks(response)
+}
+
+func extractAlbumTracks(xmlString string) (tracks []types.AlbumTrack, err error) {
+	var container TrackContainer
+	if err = xml.Unmarshal([]byte(xmlString), &container); err != nil {
+		return tracks, fmt.Errorf("plex: unable to parse album tracks: %w", err)
+	}
+	for i := range container.Track {
+		number, _ := strconv.Atoi(container.Track[i].Index)
+		disc, _ := strconv.Atoi(container.Track[i].ParentIndex)
+		tracks = append(tracks, types.AlbumTrack{Disc: max(disc, 1), Number: number, Title: container.Track[i].Title})
+	}
+	return tracks, nil
+}
+
+// GetMusicTrackQualities returns the audio quality of every track in a music library, in one request. The sample
+// rate and bit depth are only known when plex includes the audio stream in the listing.
+func GetMusicTrackQualities(ipAddress, plexToken, libraryID string) (tracks []types.PlexTrackQuality, err error) {
+	requestURL := fmt.Sprintf("%s/library/sections/%s/all?type=10", plexURL(ipAddress), libraryID)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
+	if err != nil {
+		return tracks, fmt.Errorf("plex: unable to list music tracks: %w", err)
+	}
+	return extractTrackQualities(response)
+}
+
+func extractTrackQualities(xmlString string) (tracks []types.PlexTrackQuality, err error) {
+	var container TrackQualityContainer
+	if err = xml.Unmarshal([]byte(xmlString), &container); err != nil {
+		return tracks, fmt.Errorf("plex: unable to parse music tracks: %w", err)
+	}
+	for i := range container.Track {
+		if len(container.Track[i].Media) == 0 {
+			continue
+		}
+		// the first version is the one plex plays
+		media := container.Track[i].Media[0]
+		quality := types.AudioQuality{Codec: strings.ToLower(media.AudioCodec)}
+		quality.Bitrate, _ = strconv.Atoi(media.Bitrate)
+		for _, part := range media.Part {
+			for _, stream := range part.Stream {
+				if stream.StreamType == audioStreamType {
+					quality.BitDepth, _ = strconv.Atoi(stream.BitDepth)
+					quality.SampleRate, _ = strconv.Atoi(stream.SamplingRate)
+				}
+			}
+		}
+		quality.Lossless = types.IsLosslessCodec(quality.Codec)
+		tracks = append(tracks, types.PlexTrackQuality{AlbumRatingKey: container.Track[i].ParentRatingKey, AudioQuality: quality})
+	}
+	return tracks, nil
+}
+
 func extractMusicArtists(xmlString string) (artists []types.PlexMusicArtist, err error) {
 	var container ArtistContainer
 	err = xml.Unmarshal([]byte(xmlString), &container)
@@ -1304,9 +1542,9 @@ func extractMusicAlbums(xmlString string) (albums []types.PlexMusicAlbum, err er
 
 // =================================================================================================
 func GetPlexLibraries(ipAddress, plexToken string) (libraryList []types.PlexLibrary, err error) {
-	url := fmt.Sprintf("http://%s:32400/library/sections", ipAddress)
+	requestURL := fmt.Sprintf("%s/library/sections", plexURL(ipAddress))
 
-	response, err := makePlexAPIRequest(url, plexToken)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
 		slog.Error("GetPlexLibraries: error making request", "error", err)
 		return libraryList, err
@@ -1335,9 +1573,9 @@ func extractLibraries(xmlString string) (libraryList []types.PlexLibrary, err er
 
 func GetPlaylists(ipAddress, plexToken, libraryID string) (playlists []types.PlexPlaylist, err error) {
 	start := time.Now()
-	url := fmt.Sprintf("http://%s:32400/playlists?sectionID=%s", ipAddress, libraryID)
+	requestURL := fmt.Sprintf("%s/playlists?sectionID=%s", plexURL(ipAddress), libraryID)
 
-	response, err := makePlexAPIRequest(url, plexToken)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
 		slog.Error("GetPlaylists: error making request", "error", err)
 		return playlists, err
@@ -1368,8 +1606,8 @@ func extractPlaylists(xmlString string) (playlistList []types.PlexPlaylist, err
 }
 
 func GetMoviesFromPlaylist(ipAddress, plexToken, ratingKey string) (playlistItems []types.PlexMovie) {
-	url := fmt.Sprintf("http://%s:32400/playlists/%s/items", ipAddress, ratingKey)
-	response, err := makePlexAPIRequest(url, plexToken)
+	requestURL := fmt.Sprintf("%s/playlists/%s/items", plexURL(ipAddress), ratingKey)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
 		slog.Error("GetMoviesFromPlaylist: error making request", "error", err)
 		return playlistItems
@@ -1383,8 +1621,8 @@ func GetMoviesFromPlaylist(ipAddress, plexToken, ratingKey string) (playlistItem
 }
 
 func GetTVFromPlaylist(ipAddress, plexToken, ratingKey string) (playlistItems []types.PlexTVShow) {
-	url := fmt.Sprintf("http://%s:32400/playlists/%s/items", ipAddress, ratingKey)
-	response, err := makePlexAPIRequest(url, plexToken)
+	requestURL := fmt.Sprintf("%s/playlists/%s/items", plexURL(ipAddress), ratingKey)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
 		slog.Error("GetTVFromPlaylist: error making request", "error", err)
 		return playlistItems
@@ -1398,8 +1636,8 @@ func GetTVFromPlaylist(ipAddress, plexToken, ratingKey string) (playlistItems []
 }
 
 func GetArtistsFromPlaylist(ipAddress, plexToken, ratingKey string) (playlistItems []types.PlexMusicArtist) {
-	url := fmt.Sprintf("http://%s:32400/playlists/%s/items", ipAddress, ratingKey)
-	response, err := makePlexAPIRequest(url, plexToken)
+	requestURL := fmt.Sprintf("%s/playlists/%s/items", plexURL(ipAddress), ratingKey)
+	response, err := makePlexAPIRequest(requestURL, plexToken)
 	if err != nil {
 		slog.Error("GetArtistsFromPlaylist: error making request", "error", err)
 		return playlistItems
@@ -1509,7 +1747,7 @@ func extractTVFromPlaylist(xmlString string) (playlistItems []types.PlexTVShow,
 			bla.Seasons[j].FirstEpisodeAired = bla.Seasons[j].Episodes[0].OriginallyAired
 			bla.Seasons[j].LastEpisodeAired = bla.Seasons[j].Episodes[len(bla.Seasons[j].Episodes)-1].OriginallyAired
 			bla.Seasons[j].LastEpisodeAdded = bla.Seasons[j].Episodes[len(bla.Seasons[j].Episodes)-1].DateAdded
-			bla.Seasons[j].LowestResolution = findLowestResolution(listOfResolutions)
+			bla.Seasons[j].LowestResolution = types.LowestResolution(listOfResolutions)
 		}
 		bla.FirstEpisodeAired = tvShows[i].Seasons[0].FirstEpisodeAired
 		bla.LastEpisodeAired = tvShows[i].Seasons[len(tvShows[i].Seasons)-1].LastEpisodeAired
@@ -1563,6 +1801,181 @@ func extractArtistsFromPlaylist(xmlString string) (playlistItems []types.PlexMus
 
 // =================================================================================================
 
+// Plex item types, used when editing the tags of library items.
+const (
+	ItemTypeMovie  = "1"
+	ItemTypeShow   = "2"
+	ItemTypeArtist = "8"
+)
+
+// audioStreamType is the streamType of audio streams in a media part.
+const audioStreamType = "2"
+
+// where results can be written back to.
+const (
+	WriteBackLabel      = "label"
+	WriteBackCollection = "collection"
+	WriteBackPlaylist   = "playlist"
+)
+
+type ServerContainer struct {
+	XMLName           xml.Name `xml:"MediaContainer"`
+	MachineIdentifier string   `xml:"machineIdentifier,attr"`
+}
+
+type ItemTagsContainer struct {
+	XMLName xml.Name `xml:"MediaContainer"`
+	Items   []struct {
+		RatingKey  string `xml:"ratingKey,attr"`
+		Label      []Tag  `xml:"Label"`
+		Collection []Tag  `xml:"Collection"`
+	} `xml:",any"`
+}
+
+type Tag struct {
+	Tag string `xml:"tag,attr"`
+}
+
+// RefreshMetadata asks Plex to refresh the metadata of a library item, Plex does this in the background.
+func RefreshMetadata(ipAddress, plexToken, ratingKey string) error {
+	return makePlexAPIWrite(http.MethodPut, fmt.Sprintf("%s/library/metadata/%s/refresh", plexURL(ipAddress), ratingKey), plexToken)
+}
+
+// GetMovie returns a single movie with its audio details.
+func GetMovie(ipAddress, plexToken, ratingKey string) (movie types.PlexMovie, err error) {
+	response, err := makePlexAPIRequest(fmt.Sprintf("%s/library/metadata/%s", plexURL(ipAddress), ratingKey), plexToken)
+	if err != nil {
+		return movie, err
+	}
+	movies, err := extractMovies(response)
+	if err != nil {
+		return movie, fmt.Errorf("plex: unable to parse movie %s: %w", ratingKey, err)
+	}
+	if len(movies) == 0 {
+		return movie, fmt.Errorf("plex: movie %s not found", ratingKey)
+	}
+	return getMovieDetailsValue(ipAddress, plexToken, &movies[0]), nil
+}
+
+// GetTVShow returns a single TV show with its seasons and episodes.
+func GetTVShow(ipAddress, plexToken, ratingKey string) (show types.PlexTVShow, err error) {
+	response, err := makePlexAPIRequest(fmt.Sprintf("%s/library/metadata/%s", plexURL(ipAddress), ratingKey), plexToken)
+	if err != nil {
+		return show, err
+	}
+	shows, err := extractTVShows(response)
+	if err != nil {
+		return show, fmt.Errorf("plex: unable to parse TV show %s: %w", ratingKey, err)
+	}
+	if len(shows) == 0 {
+		return show, fmt.Errorf("plex: TV show %s not found", ratingKey)
+	}
+	show = shows[0]
+	show.Seasons = getPlexTVSeasons(ipAddress, plexToken, ratingKey)
+	if len(show.Seasons) > 0 {
+		show.FirstEpisodeAired = show.Seasons[0].FirstEpisodeAired
+		show.LastEpisodeAired = show.Seasons[len(show.Seasons)-1].LastEpisodeAired
+	}
+	return show, nil
+}
+
+// WriteBack adds the items to a label, a collection or a new playlist called name.
+func WriteBack(ipAddress, plexToken, libraryID, itemType, target, name string, ratingKeys []string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len(ratingKeys) == 0 {
+		return fmt.Errorf("plex: a name and at least one item are needed to write back")
+	}
+	if target == WriteBackPlaylist {
+		playlistType := "video"
+		if itemType == ItemTypeArtist {
+			playlistType = "audio"
+		}
+		return CreatePlaylist(ipAddress, plexToken, name, playlistType, ratingKeys)
+	}
+	return AddTag(ipAddress, plexToken, libraryID, itemType, target, name, ratingKeys)
+}
+
+// AddTag adds a label or collection to library items, keeping the tags they already have. Adding a collection tag
+// creates the collection if it does not exist, and both show up in Plex smart filters.
+func AddTag(ipAddress, plexToken, libraryID, itemType, field, tag string, ratingKeys []string) error {
+	if field != WriteBackLabel && field != WriteBackCollection {
+		return fmt.Errorf("plex: cannot write back to %q", field)
+	}
+	for _, ratingKey := range ratingKeys {
+		tags, err := itemTags(ipAddress, plexToken, ratingKey, field)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(tags, tag) {
+			continue
+		}
+		tags = append(tags, tag)
+		query := url.Values{}
+		query.Set("type", itemType)
+		query.Set("id", ratingKey)
+		query.Set(field+".locked", "1")
+		for i, existing := range tags {
+			query.Set(fmt.Sprintf("%s[%d].tag.tag", field, i), existing)
+		}
+		requestURL := fmt.Sprintf("%s/library/sections/%s/all?%s", plexURL(ipAddress), libraryID, query.Encode())
+		if err := makePlexAPIWrite(http.MethodPut, requestURL, plexToken); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreatePlaylist creates a playlist of library items.
+func CreatePlaylist(ipAddress, plexToken, title, playlistType string, ratingKeys []string) error {
+	response, err := makePlexAPIRequest(plexURL(ipAddress)+"/", plexToken)
+	if err != nil {
+		return err
+	}
+	var server ServerContainer
+	if err := xml.Unmarshal([]byte(response), &server); err != nil || server.MachineIdentifier == "" {
+		return fmt.Errorf("plex: unable to find the server identifier")
+	}
+	query := url.Values{}
+	query.Set("type", playlistType)
+	query.Set("title", title)
+	query.Set("smart", "0")
+	query.Set("uri", fmt.Sprintf("server://%s/com.plexapp.plugins.library/library/metadata/%s",
+		server.MachineIdentifier, strings.Join(ratingKeys, ",")))
+	return makePlexAPIWrite(http.MethodPost, plexURL(ipAddress)+"/playlists?"+query.Encode(), plexToken)
+}
+
+func itemTags(ipAddress, plexToken, ratingKey, field string) (tags []string, err error) {
+	response, err := makePlexAPIRequest(fmt.Sprintf("%s/library/metadata/%s", plexURL(ipAddress), ratingKey), plexToken)
+	if err != nil {
+		return nil, err
+	}
+	var container ItemTagsContainer
+	if err := xml.Unmarshal([]byte(response), &container); err != nil {
+		return nil, fmt.Errorf("plex: unable to read tags of %s: %w", ratingKey, err)
+	}
+	for i := range container.Items {
+		itemTags := container.Items[i].Label
+		if field == WriteBackCollection {
+			itemTags = container.Items[i].Collection
+		}
+		for _, tag := range itemTags {
+			tags = append(tags, tag.Tag)
+		}
+	}
+	return tags, nil
+}
+
+// =================================================================================================
+
+// plexURL returns the base url of the plex server. ipAddress is normally a bare host, but a full url
+// such as http://localhost:9191/plex can be used to reach plex through a proxy or a fixture server.
+func plexURL(ipAddress string) string {
+	if strings.Contains(ipAddress, "://") {
+		return strings.TrimSuffix(ipAddress, "/")
+	}
+	return fmt.Sprintf("http://%s:32400", ipAddress)
+}
+
 func makePlexAPIRequest(inputURL, plexToken string) (response string, err error) {
 	req, err := http.NewRequestWithContext(context.Background(), "GET", inputURL, http.NoBody)
 	if err != nil {
@@ -1589,29 +2002,52 @@ func makePlexAPIRequest(inputURL, plexToken string) (response string, err error)
 	return string(body), nil
 }
 
-func findLowestResolution(resolutions []string) (lowestResolution string) {
-	if slices.Contains(resolutions, types.PlexResolutionSD) {
-		return types.PlexResolutionSD
+func makePlexAPIWrite(method, inputURL, plexToken string) error {
+	req, err := http.NewRequestWithContext(context.Background(), method, inputURL, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("plex: unable to create request: %w", err)
 	}
-	if slices.Contains(resolutions, types.PlexResolution240) {
-		return types.PlexResolution240
+	req.Header.Set("X-Plex-Token", plexToken)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("plex: unable to send request: %w", err)
 	}
-	if slices.Contains(resolutions, types.PlexResolution480) {
-		return types.PlexResolution480
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("plex: %s %s returned %d", method, req.URL.Path, resp.StatusCode)
 	}
-	if slices.Contains(resolutions, types.PlexResolution576) {
-		return types.PlexResolution576
+	return nil
+}
+
+// SeasonQuality breaks a season down by episode resolution, so a season with a couple of SD episodes is not hidden
+// behind its LowestResolution.
+func SeasonQuality(season *types.PlexTVSeason) (quality types.SeasonQuality) {
+	if len(season.Episodes) == 0 {
+		return quality
 	}
-	if slices.Contains(resolutions, types.PlexResolution720) {
-		return types.PlexResolution720
+	quality.Counts = make(map[string]int)
+	best := -1
+	for i := range season.Episodes {
+		rank := types.ResolutionRank(season.Episodes[i].Resolution)
+		// an unknown resolution says nothing about the season's quality
+		if rank < 0 {
+			continue
+		}
+		quality.Counts[season.Episodes[i].Resolution]++
+		best = max(best, rank)
 	}
-	if slices.Contains(resolutions, types.PlexResolution1080) {
-		return types.PlexResolution1080
+	quality.Mixed = len(quality.Counts) > 1
+	if !quality.Mixed {
+		return quality
 	}
-	if slices.Contains(resolutions, types.PlexResolution4K) {
-		return types.PlexResolution4K
+	for i := range season.Episodes {
+		if rank := types.ResolutionRank(season.Episodes[i].Resolution); rank >= 0 && rank < best {
+			quality.LowerEpisodes = append(quality.LowerEpisodes, season.Episodes[i])
+		}
 	}
-	return ""
+	return quality
 }
 
 func parsePlexDate(plexDate string) (parsedDate time.Time) {
@@ -1,10 +1,16 @@
 package plex
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/tphoney/plex-lookup/fixtures"
 	types "github.com/tphoney/plex-lookup/types"
 )
 
@@ -22,7 +28,10 @@ func TestFindMovieDetails(t *testing.T) {
 		t.Errorf("Error reading testdata/movies.xml: %s", err)
 	}
 
-	processed := extractMovies(string(rawdata))
+	processed, err := extractMovies(string(rawdata))
+	if err != nil {
+		t.Fatalf("extractMovies() error = %v", err)
+	}
 	expected := []types.PlexMovie{
 		{
 			Title:      "Chaos Theory",
@@ -57,23 +66,278 @@ func TestFindMovieDetails(t *testing.T) {
 	}
 }
 
+func TestExtractMovieVersions(t *testing.T) {
+	processed, err := extractMovies(`<MediaContainer size="1"><Video ratingKey="1" title="Cats" year="2019">
+		<Media videoResolution="4k" videoCodec="hevc"><Part file="/movies/Cats 4k.mkv" size="50000"/></Media>
+		<Media videoResolution="sd" videoCodec="mpeg2video"><Part file="/movies/Cats cd1.avi" size="700"/><Part file="/movies/Cats cd2.avi" size="650"/></Media>
+	</Video></MediaContainer>`)
+	if err != nil || len(processed) != 1 || len(processed[0].Versions) != 2 {
+		t.Fatalf("extractMovies() = %+v", processed)
+	}
+	movie := processed[0]
+	if movie.Resolution != types.PlexResolution4K || movie.FileSize != 50000 || movie.VideoCodec != "hevc" {
+		t.Errorf("extractMovies() first version = %+v", movie)
+	}
+	if sd := movie.Versions[1]; sd.Resolution != types.PlexResolutionSD || sd.FileSize != 1350 || len(sd.Files) != 2 {
+		t.Errorf("extractMovies() second version = %+v", sd)
+	}
+}
+
+func TestExtractAlbumTracks(t *testing.T) {
+	tracks, err := extractAlbumTracks(`<MediaContainer size="3">
+		<Track ratingKey="11" title="Come Together" index="1" parentIndex="1"/>
+		<Track ratingKey="12" title="Something" index="2" parentIndex="1"/>
+		<Track ratingKey="13" title="Her Majesty" index="17"/>
+	</MediaContainer>`)
+	if err != nil || len(tracks) != 3 {
+		t.Fatalf("extractAlbumTracks() = %+v, error = %v", tracks, err)
+	}
+	if tracks[1] != (types.AlbumTrack{Disc: 1, Number: 2, Title: "Something"}) || tracks[2].Disc != 1 || tracks[2].Number != 17 {
+		t.Errorf("extractAlbumTracks() = %+v", tracks)
+	}
+}
+
+func TestExtractTrackQualities(t *testing.T) {
+	tracks, err := extractTrackQualities(`<MediaContainer size="3">
+		<Track ratingKey="11" parentRatingKey="10"><Media audioCodec="mp3" bitrate="192"><Part/></Media></Track>
+		<Track ratingKey="21" parentRatingKey="20"><Media audioCodec="FLAC" bitrate="1011">
+			<Part><Stream streamType="2" bitDepth="24" samplingRate="96000"/></Part></Media></Track>
+		<Track ratingKey="31" parentRatingKey="30"/>
+	</MediaContainer>`)
+	if err != nil || len(tracks) != 2 {
+		t.Fatalf("extractTrackQualities() = %+v, error = %v", tracks, err)
+	}
+	if tracks[0] != (types.PlexTrackQuality{AlbumRatingKey: "10", AudioQuality: types.AudioQuality{Codec: "mp3", Bitrate: 192}}) {
+		t.Errorf("extractTrackQualities()[0] = %+v", tracks[0])
+	}
+	want := types.AudioQuality{Codec: "flac", Bitrate: 1011, BitDepth: 24, SampleRate: 96000, Lossless: true}
+	if tracks[1].AlbumRatingKey != "20" || tracks[1].AudioQuality != want {
+		t.Errorf("extractTrackQualities()[1] = %+v, want %+v", tracks[1], want)
+	}
+}
+
 func TestGetPlexMovies(t *testing.T) {
 	if plexIP == "" || plexMovieLibraryID == "" || plexToken == "" {
 		t.Skip("ACCEPTANCE TEST: PLEX environment variables not set")
 	}
-	result := AllMovies(plexIP, plexMovieLibraryID, plexToken)
-
+	result, err := AllMovies(plexIP, plexMovieLibraryID, plexToken)
+	if err != nil {
+		t.Fatalf("AllMovies() error = %v", err)
+	}
 	if len(result) == 0 {
 		t.Errorf("Expected at least one TV show, but got %d", len(result))
 	}
 }
 
+func TestGetPlexMoviesOffline(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+	plexURL := fixtures.ProviderURLs(server.URL).Plex
+
+	libraries, err := GetPlexLibraries(plexURL, "token")
+	if err != nil || len(libraries) != 3 {
+		t.Fatalf("GetPlexLibraries() = %v, error = %v", libraries, err)
+	}
+	result, err := AllMovies(plexURL, libraries[0].ID, "token")
+	if err != nil || len(result) != 3 {
+		t.Fatalf("Expected 3 recorded movies, but got %d, error = %v", len(result), err)
+	}
+	for i := range result {
+		if len(result[i].AudioLanguages) == 0 {
+			t.Errorf("Expected audio languages from the detail page for %s", result[i].Title)
+		}
+	}
+	movie := result[0]
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "plays", got: movie.ViewCount, want: 1},
+		{name: "critic rating", got: movie.Rating, want: 3.0},
+		{name: "audience rating", got: movie.AudienceRating, want: 5.8},
+		{name: "last viewed", got: movie.LastViewedAt.Unix(), want: int64(1628768050)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("%s %s = %v, want %v", movie.Title, tt.name, tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerOffline(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+	plexServer := Server{IP: fixtures.ProviderURLs(server.URL).Plex, Token: "token"}
+
+	libraries, err := plexServer.Libraries(context.Background())
+	if err != nil || len(libraries) != 3 {
+		t.Fatalf("Libraries() = %v, error = %v", libraries, err)
+	}
+	movies, err := plexServer.Movies(context.Background(), libraries[0].ID)
+	if err != nil || len(movies) != 3 {
+		t.Errorf("Movies() returned %d movies, error = %v", len(movies), err)
+	}
+}
+
+func TestGetLookupSourcesOffline(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+	plexURL := fixtures.ProviderURLs(server.URL).Plex
+
+	sources := GetLookupSources(plexURL, "token", "3")
+	if len(sources) != 5 {
+		t.Fatalf("Expected 2 collections and 3 decades, but got %v", sources)
+	}
+	if sources[0].Value() != "collection:74513" || sources[4].Value() != "decade:1990" {
+		t.Errorf("GetLookupSources() = %v", sources)
+	}
+	filters, err := LookupSourceFilters(sources[0].Value(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := GetFilteredMovies(plexURL, "token", "3", filters); err != nil || len(result) != 3 {
+		t.Errorf("Expected 3 recorded movies, but got %d", len(result))
+	}
+}
+
+func TestLookupSourceFilters(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		expression string
+		wantURL    string
+		wantErr    bool
+	}{
+		{
+			name:    "playlist has no filters",
+			source:  "12345",
+			wantURL: "http://plex:32400/library/sections/1/all",
+		},
+		{
+			name:       "decade with an expression",
+			source:     "decade:1990",
+			expression: "resolution=sd & unwatched=1",
+			wantURL:    "http://plex:32400/library/sections/1/all?decade=1990&resolution=sd&unwatched=1",
+		},
+		{
+			name:       "ampersand separates expressions",
+			source:     "all",
+			expression: "title=fast & furious",
+			wantErr:    true,
+		},
+		{
+			name:       "modifiers",
+			source:     "label:7",
+			expression: "resolution<<=720&addedAt>>=-30d&title!=cats 2",
+			wantURL:    "http://plex:32400/library/sections/1/all?label=7&resolution<<=720&addedAt>>=-30d&title!=cats+2",
+		},
+		{
+			name:       "not an expression",
+			source:     "all",
+			expression: "resolution",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := LookupSourceFilters(tt.source, tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LookupSourceFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := libraryURL("plex", "1", filters); got != tt.wantURL {
+				t.Errorf("libraryURL() = %v, want %v", got, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestWriteBack(t *testing.T) {
+	var mu sync.Mutex
+	var writes []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/":
+			fmt.Fprint(w, `<MediaContainer size="0" machineIdentifier="abc123"></MediaContainer>`)
+		case r.Method == http.MethodGet && r.URL.Path == "/library/metadata/1":
+			fmt.Fprint(w, `<MediaContainer size="1"><Video ratingKey="1"><Label tag="keep-me"/></Video></MediaContainer>`)
+		case r.Method == http.MethodGet && r.URL.Path == "/library/metadata/2":
+			fmt.Fprint(w, `<MediaContainer size="1"><Directory ratingKey="2"><Label tag="upgrade-4k"/></Directory></MediaContainer>`)
+		default:
+			mu.Lock()
+			writes = append(writes, r)
+			mu.Unlock()
+		}
+	}))
+	defer server.Close()
+
+	err := WriteBack(server.URL, "token", "3", ItemTypeMovie, WriteBackLabel, "upgrade-4k", []string{"1", "2"})
+	if err != nil {
+		t.Fatalf("WriteBack() label error = %v", err)
+	}
+	// item 2 already has the label so only item 1 is edited
+	if len(writes) != 1 || writes[0].Method != http.MethodPut || writes[0].URL.Path != "/library/sections/3/all" {
+		t.Fatalf("WriteBack() label writes = %v", writes)
+	}
+	query := writes[0].URL.Query()
+	if query.Get("id") != "1" || query.Get("label[0].tag.tag") != "keep-me" || query.Get("label[1].tag.tag") != "upgrade-4k" {
+		t.Errorf("WriteBack() label query = %v", query)
+	}
+
+	writes = nil
+	err = WriteBack(server.URL, "token", "3", ItemTypeMovie, WriteBackPlaylist, "Upgrades", []string{"1", "2"})
+	if err != nil {
+		t.Fatalf("WriteBack() playlist error = %v", err)
+	}
+	if len(writes) != 1 || writes[0].Method != http.MethodPost || writes[0].URL.Path != "/playlists" {
+		t.Fatalf("WriteBack() playlist writes = %v", writes)
+	}
+	wantURI := "server://abc123/com.plexapp.plugins.library/library/metadata/1,2"
+	if got := writes[0].URL.Query().Get("uri"); got != wantURI {
+		t.Errorf("WriteBack() playlist uri = %v, want %v", got, wantURI)
+	}
+
+	if err := WriteBack(server.URL, "token", "3", ItemTypeMovie, WriteBackLabel, " ", []string{"1"}); err == nil {
+		t.Error("WriteBack() expected an error without a name")
+	}
+}
+
+func TestServerLibraryErrors(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	plexURL := fixtures.ProviderURLs(server.URL).Plex
+	server.Close()
+
+	plexServer := Server{IP: plexURL, Token: "token"}
+	tests := []struct {
+		name  string
+		fetch func() error
+	}{
+		{name: "movies", fetch: func() error { _, err := plexServer.Movies(context.Background(), "1"); return err }},
+		{name: "tv", fetch: func() error { _, err := plexServer.TV(context.Background(), "2"); return err }},
+		{name: "music", fetch: func() error { _, err := plexServer.MusicArtists(context.Background(), "3"); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fetch(); err == nil {
+				t.Error("expected an error from an unreachable server")
+			}
+		})
+	}
+}
+
 func TestGetPlexTV(t *testing.T) {
 	if plexIP == "" || plexTVLibraryID == "" || plexToken == "" {
 		t.Skip("ACCEPTANCE TEST: PLEX environment variables not set")
 	}
-	result := AllTV(plexIP, plexToken, plexTVLibraryID)
-
+	result, err := AllTV(plexIP, plexToken, plexTVLibraryID)
+	if err != nil {
+		t.Fatalf("AllTV() error = %v", err)
+	}
 	if len(result) == 0 {
 		t.Fatalf("Expected at least one TV show, but got %d", len(result))
 	}
@@ -106,8 +370,10 @@ func TestGetPlexMusic(t *testing.T) {
 	if plexIP == "" || plexMusicLibraryID == "" || plexToken == "" {
 		t.Skip("ACCEPTANCE TEST: PLEX environment variables not set")
 	}
-	result := AllMusicArtists(plexIP, plexToken, plexMusicLibraryID)
-
+	result, err := AllMusicArtists(plexIP, plexToken, plexMusicLibraryID)
+	if err != nil {
+		t.Fatalf("AllMusicArtists() error = %v", err)
+	}
 	if len(result) == 0 {
 		t.Fatalf("Expected at least one album, but got %d", len(result))
 	}
@@ -164,34 +430,30 @@ func TestGetTVFromPlaylist(t *testing.T) {
 		t.Errorf("Expected at least one item, but got %d", len(items))
 	}
 }
-func Test_findLowestResolution(t *testing.T) {
-	tests := []struct {
-		name                 string
-		resolutions          []string
-		wantLowestResolution string
-	}{
-		{
-			name:                 "SD is lowest",
-			resolutions:          []string{types.PlexResolutionSD, types.PlexResolution240, types.PlexResolution720, types.PlexResolution1080},
-			wantLowestResolution: types.PlexResolutionSD,
-		},
-		{
-			name:                 "4k is lowest",
-			resolutions:          []string{types.PlexResolution4K, types.PlexResolution4K},
-			wantLowestResolution: types.PlexResolution4K,
-		},
-		{
-			name:                 "720 is lowest",
-			resolutions:          []string{types.PlexResolution720, types.PlexResolution1080, types.PlexResolution720, types.PlexResolution1080},
-			wantLowestResolution: types.PlexResolution720,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if gotLowestResolution := findLowestResolution(tt.resolutions); gotLowestResolution != tt.wantLowestResolution {
-				t.Errorf("findLowestResolution() = %v, want %v", gotLowestResolution, tt.wantLowestResolution)
-			}
-		})
+func TestSeasonQuality(t *testing.T) {
+	season := types.PlexTVSeason{Number: 3, Episodes: []types.PlexTVEpisode{
+		{Index: "1", Resolution: types.PlexResolution1080},
+		{Index: "2", Resolution: types.PlexResolutionSD},
+		{Index: "3", Resolution: types.PlexResolution1080},
+		{Index: "4", Resolution: types.PlexResolution720},
+	}}
+	quality := SeasonQuality(&season)
+	if !quality.Mixed {
+		t.Error("SeasonQuality() expected a mixed season")
+	}
+	if quality.Counts[types.PlexResolution1080] != 2 || quality.Counts[types.PlexResolutionSD] != 1 {
+		t.Errorf("SeasonQuality() counts = %v", quality.Counts)
+	}
+	if len(quality.LowerEpisodes) != 2 || quality.LowerEpisodes[0].Index != "2" || quality.LowerEpisodes[1].Index != "4" {
+		t.Errorf("SeasonQuality() lower episodes = %v", quality.LowerEpisodes)
+	}
+	season.Episodes = season.Episodes[:1]
+	if quality := SeasonQuality(&season); quality.Mixed || len(quality.LowerEpisodes) != 0 {
+		t.Errorf("SeasonQuality() single resolution season = %+v", quality)
+	}
+	season.Episodes = append(season.Episodes, types.PlexTVEpisode{Index: "2"}, types.PlexTVEpisode{Index: "3", Resolution: "unknown"})
+	if quality := SeasonQuality(&season); quality.Mixed || len(quality.LowerEpisodes) != 0 || len(quality.Counts) != 1 {
+		t.Errorf("SeasonQuality() season with unknown resolutions = %+v", quality)
 	}
 }
 
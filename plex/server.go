@@ -0,0 +1,38 @@
+package plex
+
+import (
+	"context"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+const ProviderName = "Plex"
+
+// Server is a Plex server as a types.MediaServer. Playlists, filters and write back are Plex only, so they stay as
+// package functions.
+type Server struct {
+	IP    string
+	Token string
+}
+
+var _ types.MediaServer = Server{}
+
+func (Server) Name() string {
+	return ProviderName
+}
+
+func (s Server) Libraries(_ context.Context) ([]types.PlexLibrary, error) {
+	return GetPlexLibraries(s.IP, s.Token)
+}
+
+func (s Server) Movies(_ context.Context, libraryID string) ([]types.PlexMovie, error) {
+	return AllMovies(s.IP, libraryID, s.Token)
+}
+
+func (s Server) TV(_ context.Context, libraryID string) ([]types.PlexTVShow, error) {
+	return AllTV(s.IP, s.Token, libraryID)
+}
+
+func (s Server) MusicArtists(_ context.Context, libraryID string) ([]types.PlexMusicArtist, error) {
+	return AllMusicArtists(s.IP, s.Token, libraryID)
+}
@@ -0,0 +1,230 @@
+package prices
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+const (
+	historyFileName = "price_history.json"
+	notifyTimeout   = 10 * time.Second
+)
+
+// Observation is a price seen for a disc at a point in time.
+type Observation struct {
+	Price  types.Price
+	SeenAt time.Time
+	// Alerted is set once a price alert has been sent at this price
+	Alerted bool `json:",omitempty"`
+}
+
+// History is the price history of each disc, keyed by the disc's product page url.
+type History struct {
+	mu    sync.Mutex
+	path  string
+	discs map[string][]Observation
+}
+
+// Alert is a disc whose current price is at or below the target price.
+type Alert struct {
+	Title  string
+	URL    string
+	Price  types.Price
+	Target float64
+}
+
+// DefaultPath is where the price history is kept when no file is configured.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return historyFileName
+	}
+	return filepath.Join(dir, "plex-lookup", historyFileName)
+}
+
+// Load reads the price history from path. A missing file gives an empty history that is created on the first Save.
+func Load(path string) (*History, error) {
+	if path == "" {
+		path = DefaultPath()
+	}
+	history := &History{path: path, discs: make(map[string][]Observation)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return history, nil
+	}
+	if err != nil {
+		return history, fmt.Errorf("prices: unable to read history: %w", err)
+	}
+	if err := json.Unmarshal(data, &history.discs); err != nil {
+		return history, fmt.Errorf("prices: unable to parse history: %w", err)
+	}
+	return history, nil
+}
+
+// Record adds a price for a disc. Only changes are kept, so repeated scans at the same price do not grow the history.
+func (h *History) Record(discURL string, price types.Price, seenAt time.Time) {
+	if price.Amount <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	observations := h.discs[discURL]
+	if len(observations) > 0 && observations[len(observations)-1].Price == price {
+		return
+	}
+	h.discs[discURL] = append(observations, Observation{Price: price, SeenAt: seenAt})
+}
+
+// Unalerted returns the alerts for discs that have not been alerted before, or are now cheaper than when they last
+// were. Every alert is new to a nil history.
+func (h *History) Unalerted(alerts []Alert) (fresh []Alert) {
+	if h == nil {
+		return alerts
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, alert := range alerts {
+		if last, found := h.lastAlerted(alert.URL); found && last.Currency == alert.Price.Currency &&
+			last.Amount <= alert.Price.Amount {
+			continue
+		}
+		fresh = append(fresh, alert)
+	}
+	return fresh
+}
+
+// MarkAlerted remembers that the alerts were sent, so Unalerted skips them until the price drops again.
+func (h *History) MarkAlerted(alerts []Alert, alertedAt time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, alert := range alerts {
+		observations := h.discs[alert.URL]
+		if len(observations) > 0 && observations[len(observations)-1].Price == alert.Price {
+			observations[len(observations)-1].Alerted = true
+			continue
+		}
+		h.discs[alert.URL] = append(observations, Observation{Price: alert.Price, SeenAt: alertedAt, Alerted: true})
+	}
+}
+
+// lastAlerted is the price of the latest alert for a disc, the caller holds the lock.
+func (h *History) lastAlerted(discURL string) (price types.Price, found bool) {
+	observations := h.discs[discURL]
+	for i := len(observations) - 1; i >= 0; i-- {
+		if observations[i].Alerted {
+			return observations[i].Price, true
+		}
+	}
+	return price, false
+}
+
+// Observations returns the recorded prices for a disc, oldest first.
+func (h *History) Observations(discURL string) []Observation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Observation(nil), h.discs[discURL]...)
+}
+
+// Lowest returns the lowest price recorded for a disc.
+func (h *History) Lowest(discURL string) (lowest types.Price, found bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, observation := range h.discs[discURL] {
+		if !found || observation.Price.Amount < lowest.Amount {
+			lowest = observation.Price
+			found = true
+		}
+	}
+	return lowest, found
+}
+
+// Describe formats the current price of a disc with its lowest recorded price, eg "GBP 17.35 (lowest GBP 12.99)".
+// It is safe to call on a nil history.
+func (h *History) Describe(discURL string, current types.Price) string {
+	if current.Amount <= 0 {
+		return ""
+	}
+	description := Format(current)
+	if h == nil {
+		return description
+	}
+	if lowest, found := h.Lowest(discURL); found && lowest.Amount < current.Amount {
+		description += fmt.Sprintf(" (lowest %s)", Format(lowest))
+	}
+	return description
+}
+
+// Format formats a price as "GBP 17.35".
+func Format(price types.Price) string {
+	return strings.TrimSpace(fmt.Sprintf("%s %.2f", price.Currency, price.Amount))
+}
+
+// Save writes the history to disk, replacing the previous file in one step.
+func (h *History) Save() error {
+	// concurrent jobs save through the same temporary file, so the whole save holds the lock
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	data, err := json.MarshalIndent(h.discs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("prices: unable to encode history: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o750); err != nil {
+		return fmt.Errorf("prices: unable to create history directory: %w", err)
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("prices: unable to write history: %w", err)
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// Notify posts the alerts to a webhook. The body has a "text" summary that chat webhooks display, and the alerts
+// themselves for anything that wants to process them.
+func Notify(ctx context.Context, webhookURL string, alerts []Alert) error {
+	if webhookURL == "" || len(alerts) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(alerts)+1)
+	lines = append(lines, fmt.Sprintf("plex-lookup: %d discs at or below your target price", len(alerts)))
+	for _, alert := range alerts {
+		lines = append(lines, fmt.Sprintf("%s %s %s", alert.Title, Format(alert.Price), alert.URL))
+	}
+	body, err := json.Marshal(struct {
+		Text   string  `json:"text"`
+		Alerts []Alert `json:"alerts"`
+	}{Text: strings.Join(lines, "\n"), Alerts: alerts})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("prices: unable to create notification: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("prices: unable to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("prices: notification webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
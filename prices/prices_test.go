@@ -0,0 +1,136 @@
+package prices
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+const discURL = "https://www.blu-ray.com/movies/Cats-Blu-ray/77635/"
+
+func TestHistoryRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	history, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	start := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	history.Record(discURL, types.Price{Amount: 17.35, Currency: "GBP"}, start)
+	history.Record(discURL, types.Price{Amount: 17.35, Currency: "GBP"}, start.Add(24*time.Hour))
+	history.Record(discURL, types.Price{Amount: 9.99, Currency: "GBP"}, start.Add(48*time.Hour))
+	history.Record(discURL, types.Price{Amount: 12.99, Currency: "GBP"}, start.Add(72*time.Hour))
+	history.Record(discURL, types.Price{}, start.Add(96*time.Hour))
+
+	if got := len(history.Observations(discURL)); got != 3 {
+		t.Errorf("Observations() = %d, want 3 price changes", got)
+	}
+	if got := history.Describe(discURL, types.Price{Amount: 12.99, Currency: "GBP"}); got != "GBP 12.99 (lowest GBP 9.99)" {
+		t.Errorf("Describe() = %q", got)
+	}
+
+	if err := history.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	lowest, found := reloaded.Lowest(discURL)
+	if !found || lowest.Amount != 9.99 {
+		t.Errorf("Lowest() after reload = %v, %v, want 9.99", lowest, found)
+	}
+}
+
+func TestConcurrentSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	history, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			history.Record(fmt.Sprintf("%s/%d", discURL, i), types.Price{Amount: 9.99, Currency: "GBP"}, time.Now())
+			errs <- history.Save()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Save() error = %v", err)
+		}
+	}
+	if _, err := Load(path); err != nil {
+		t.Errorf("Load() after concurrent saves error = %v", err)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var received struct {
+		Text   string  `json:"text"`
+		Alerts []Alert `json:"alerts"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	alerts := []Alert{{Title: "Cats - Blu-ray", URL: discURL, Price: types.Price{Amount: 9.99, Currency: "GBP"}, Target: 10}}
+	if err := Notify(t.Context(), server.URL, alerts); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if len(received.Alerts) != 1 || received.Text == "" {
+		t.Errorf("Notify() sent %+v", received)
+	}
+	if err := Notify(t.Context(), "", alerts); err != nil {
+		t.Errorf("Notify() without a webhook should do nothing, got %v", err)
+	}
+}
+
+func TestUnalerted(t *testing.T) {
+	history, err := Load(filepath.Join(t.TempDir(), "prices.json"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	start := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	alert := func(amount float64) Alert {
+		return Alert{Title: "Cats - Blu-ray", URL: discURL, Price: types.Price{Amount: amount, Currency: "GBP"}, Target: 10}
+	}
+	history.Record(discURL, alert(9.99).Price, start)
+	history.MarkAlerted([]Alert{alert(9.99)}, start)
+	tests := []struct {
+		name  string
+		alert Alert
+		want  int
+	}{
+		{name: "same price", alert: alert(9.99), want: 0},
+		{name: "higher price", alert: alert(12.99), want: 0},
+		{name: "lower price", alert: alert(8.99), want: 1},
+		{name: "other disc", alert: Alert{URL: "https://www.blu-ray.com/movies/Elf/1/", Price: types.Price{Amount: 5, Currency: "GBP"}}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := history.Unalerted([]Alert{tt.alert}); len(got) != tt.want {
+				t.Errorf("Unalerted() = %v, want %d alerts", got, tt.want)
+			}
+		})
+	}
+	if got := len(history.Observations(discURL)); got != 1 {
+		t.Errorf("MarkAlerted() at the recorded price added an observation, got %d", got)
+	}
+	if got := (*History)(nil).Unalerted([]Alert{alert(9.99)}); len(got) != 1 {
+		t.Errorf("Unalerted() on a nil history = %v, want every alert", got)
+	}
+}
@@ -0,0 +1,69 @@
+package priority
+
+import (
+	"math"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+// The score is out of 100, higher means buy the upgrade sooner.
+const (
+	playsWeight     = 40
+	recencyWeight   = 25
+	ratingWeight    = 20
+	headroomWeight  = 15
+	playsForFull    = 5
+	recencyWindow   = 365 * 24 * time.Hour
+	maxRating       = 10
+	unknownHeadroom = 10
+	// headroomStep is the points for each resolution below 4k, up to headroomWeight
+	headroomStep = 5
+)
+
+// headroom is how much better a disc could be than the current copy, out of headroomWeight. Unknown resolutions are
+// not ok.
+func headroom(resolution string) (points float64, ok bool) {
+	rank := types.ResolutionRank(resolution)
+	if rank < 0 {
+		return 0, false
+	}
+	return math.Min(headroomWeight, float64(headroomStep*(len(types.PlexResolutions)-1-rank))), true
+}
+
+// Score combines how often and how recently a title was watched, its rating and how much a disc would improve on
+// the current resolution:
+//   - plays, up to 40 points, full marks at 5 plays
+//   - recency, up to 25 points, falling to nothing a year after the last play
+//   - rating, up to 20 points, the higher of the critic and audience ratings
+//   - resolution, up to 15 points for sd, none for 4k
+func Score(viewCount int, lastViewedAt time.Time, rating, audienceRating float64, resolution string, now time.Time) int {
+	score := playsWeight * math.Min(float64(viewCount), playsForFull) / playsForFull
+	if !lastViewedAt.IsZero() {
+		if since := now.Sub(lastViewedAt); since < recencyWindow {
+			score += recencyWeight * (1 - math.Max(since.Hours(), 0)/recencyWindow.Hours())
+		}
+	}
+	score += ratingWeight * math.Min(math.Max(rating, audienceRating), maxRating) / maxRating
+	if points, ok := headroom(resolution); ok {
+		score += points
+	} else {
+		score += unknownHeadroom
+	}
+	return int(math.Round(score))
+}
+
+// Movie scores a movie.
+func Movie(movie *types.PlexMovie, now time.Time) int {
+	return Score(movie.ViewCount, movie.LastViewedAt, movie.Rating, movie.AudienceRating, movie.Resolution, now)
+}
+
+// TVShow scores a TV show by its lowest resolution season, the season most worth replacing.
+func TVShow(show *types.PlexTVShow, now time.Time) int {
+	resolutions := make([]string, 0, len(show.Seasons))
+	for i := range show.Seasons {
+		resolutions = append(resolutions, show.Seasons[i].LowestResolution)
+	}
+	resolution := types.LowestResolution(resolutions)
+	return Score(show.ViewCount, show.LastViewedAt, show.Rating, show.AudienceRating, resolution, now)
+}
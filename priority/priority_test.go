@@ -0,0 +1,55 @@
+package priority
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestScore(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		movie types.PlexMovie
+		want  int
+	}{
+		{name: "never watched 4k", movie: types.PlexMovie{Resolution: types.PlexResolution4K}, want: 0},
+		{name: "never watched sd", movie: types.PlexMovie{Resolution: types.PlexResolutionSD}, want: 15},
+		{name: "unknown resolution", movie: types.PlexMovie{}, want: 10},
+		{
+			name: "favourite in sd",
+			movie: types.PlexMovie{Resolution: types.PlexResolutionSD, ViewCount: 12, LastViewedAt: now,
+				Rating: 6, AudienceRating: 9},
+			want: 40 + 25 + 18 + 15,
+		},
+		{
+			name: "watched once half a year ago",
+			movie: types.PlexMovie{Resolution: types.PlexResolution1080, ViewCount: 1,
+				LastViewedAt: now.Add(-recencyWindow / 2), Rating: 5},
+			want: 8 + 13 + 10 + 5,
+		},
+		{
+			name:  "watched years ago",
+			movie: types.PlexMovie{Resolution: types.PlexResolution720, ViewCount: 2, LastViewedAt: now.AddDate(-3, 0, 0)},
+			want:  16 + 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Movie(&tt.movie, now); got != tt.want {
+				t.Errorf("Movie() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTVShow(t *testing.T) {
+	show := types.PlexTVShow{ViewCount: 5, Seasons: []types.PlexTVSeason{
+		{Number: 1, LowestResolution: types.PlexResolution1080},
+		{Number: 2, LowestResolution: types.PlexResolution480},
+	}}
+	if got := TVShow(&show, time.Now()); got != 40+15 {
+		t.Errorf("TVShow() = %d, want %d", got, 40+15)
+	}
+}
@@ -3,22 +3,57 @@ package spotify
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"strconv"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sourcegraph/conc/iter"
 	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
 )
 
 const (
-	spotifyAPIURL      = "https://api.spotify.com/v1"
+	DefaultAPIURL      = "https://api.spotify.com/v1"
+	DefaultAccountsURL = "https://accounts.spotify.com"
 	lookupTimeout      = 10
 	spotifyConcurrency = 2
+	// epTracks is the fewest tracks on an EP, spotify calls releases with fewer tracks singles
+	epTracks = 4
+	// albumPageSize is the most releases spotify returns per page
+	albumPageSize = 50
+	// maxAlbumPages stops runaway paging, 1000 releases is more than any artist has
+	maxAlbumPages = 20
+	// tokenRefreshMargin requests a new token this long before the current one expires
+	tokenRefreshMargin = time.Minute
+	// maxAttempts is how many times a rate limited request is made before giving up
+	maxAttempts = 4
+)
+
+var (
+	spotifyAPIURL      = utils.NewBaseURL(DefaultAPIURL)
+	spotifyAccountsURL = utils.NewBaseURL(DefaultAccountsURL)
+	// rateLimitWait is the pause after a 429 without a usable Retry-After, it grows with each attempt
+	rateLimitWait = 2 * time.Second
+	// spotifyGroups are the include_groups holding each release type, spotify files EPs as singles and live
+	// albums, soundtracks and remixes as albums, so it can only tell albums, EPs, singles and compilations apart.
+	spotifyGroups = map[string]string{
+		types.AlbumTypeAlbum:       "album",
+		types.AlbumTypeEP:          "single",
+		types.AlbumTypeSingle:      "single",
+		types.AlbumTypeLive:        "album",
+		types.AlbumTypeCompilation: "compilation",
+		types.AlbumTypeSoundtrack:  "album",
+		types.AlbumTypeRemix:       "album",
+	}
+	// editionSuffix matches re-release notes after a dash, eg "Abbey Road - Remastered 2009" or "1 - Deluxe Edition"
+	editionSuffix = regexp.MustCompile(`(?i)\s+-\s+[^-]*(edition|remaster|deluxe|expanded|anniversary|version|mono|stereo|mix)[^-]*$`)
 )
 
 type ArtistResponse struct {
@@ -85,21 +120,82 @@ type AlbumsResponse struct {
 		Type                 string `json:"type"`
 		URI                  string `json:"uri"`
 	} `json:"items"`
-	Limit    int64 `json:"limit"`
-	Next     any   `json:"next"`
-	Offset   int64 `json:"offset"`
-	Previous any   `json:"previous"`
-	Total    int64 `json:"total"`
+	Limit    int64  `json:"limit"`
+	Next     string `json:"next"`
+	Offset   int64  `json:"offset"`
+	Previous any    `json:"previous"`
+	Total    int64  `json:"total"`
+}
+
+type AlbumTracksResponse struct {
+	Items []struct {
+		DiscNumber  int    `json:"disc_number"`
+		TrackNumber int    `json:"track_number"`
+		Name        string `json:"name"`
+		ID          string `json:"id"`
+	} `json:"items"`
+	Next  string `json:"next"`
+	Total int64  `json:"total"`
 }
 
 type SimilarArtistsResponse struct {
 	Artists []struct {
+		ExternalUrls struct {
+			Spotify string `json:"spotify"`
+		} `json:"external_urls"`
 		Name string `json:"name"`
 		ID   string `json:"id"`
 	}
 }
 
-func GetArtistsInParallel(ctx context.Context, progressFunc func(), plexArtists []types.PlexMusicArtist, token string) []types.MusicSearchResponse {
+// SetURLs points the Spotify web API and OAuth requests at a mirror, proxy or fixture server. Empty urls restore the defaults.
+func SetURLs(apiURL, accountsURL string) {
+	spotifyAPIURL.Set(apiURL)
+	spotifyAccountsURL.Set(accountsURL)
+}
+
+// Client makes spotify web API requests with a client credentials token, requesting a new token when the current
+// one expires or is rejected. It is safe to share between goroutines.
+type Client struct {
+	clientID     string
+	clientSecret string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewClient returns a client for the spotify app credentials, the first request fetches a token.
+func NewClient(clientID, clientSecret string) *Client {
+	return &Client{clientID: clientID, clientSecret: clientSecret}
+}
+
+// Token returns the current access token, requesting a new one when there is none or it is about to expire.
+func (c *Client) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires.Add(-tokenRefreshMargin)) {
+		return c.token, nil
+	}
+	token, expiresIn, err := requestToken(ctx, c.clientID, c.clientSecret)
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	c.expires = time.Now().Add(expiresIn)
+	return c.token, nil
+}
+
+// expire drops a token spotify rejected, unless another request already replaced it.
+func (c *Client) expire(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+func (c *Client) GetArtistsInParallel(ctx context.Context, progressFunc func(), plexArtists []types.PlexMusicArtist) []types.MusicSearchResponse {
 	mapper := iter.Mapper[types.PlexMusicArtist, types.MusicSearchResponse]{
 		MaxGoroutines: spotifyConcurrency,
 	}
@@ -110,7 +206,7 @@ func GetArtistsInParallel(ctx context.Context, progressFunc func(), plexArtists
 			return types.MusicSearchResponse{}
 		default:
 		}
-		result := searchSpotifyArtistValue(ctx, artist, token)
+		result := c.searchSpotifyArtistValue(ctx, artist)
 		if progressFunc != nil {
 			progressFunc()
 		}
@@ -120,7 +216,8 @@ func GetArtistsInParallel(ctx context.Context, progressFunc func(), plexArtists
 	return artistsSearchResults
 }
 
-func GetAlbumsInParallel(ctx context.Context, progressFunc func(), artistsSearchResults []types.MusicSearchResponse, token string) []types.MusicSearchResponse {
+// GetAlbumsInParallel looks up the releases of each artist found by GetArtistsInParallel, keeping the albumTypes.
+func (c *Client) GetAlbumsInParallel(ctx context.Context, progressFunc func(), artistsSearchResults []types.MusicSearchResponse, albumTypes []string) []types.MusicSearchResponse {
 	mapper := iter.Mapper[types.MusicSearchResponse, types.MusicSearchResponse]{
 		MaxGoroutines: spotifyConcurrency,
 	}
@@ -131,7 +228,7 @@ func GetAlbumsInParallel(ctx context.Context, progressFunc func(), artistsSearch
 			return types.MusicSearchResponse{}
 		default:
 		}
-		res := searchSpotifyAlbumValue(ctx, result, token)
+		res := c.searchSpotifyAlbumValue(ctx, result, albumTypes)
 		if progressFunc != nil {
 			progressFunc()
 		}
@@ -141,13 +238,52 @@ func GetAlbumsInParallel(ctx context.Context, progressFunc func(), artistsSearch
 	return enrichedArtistSearchResults
 }
 
+// GetSimilarArtistsInParallel looks up the related artists of each artist found by GetArtistsInParallel, artists
+// spotify did not find are returned without any.
+func (c *Client) GetSimilarArtistsInParallel(ctx context.Context, progressFunc func(), artistsSearchResults []types.MusicSearchResponse) []types.MusicSimilarArtistResponse {
+	mapper := iter.Mapper[types.MusicSearchResponse, types.MusicSimilarArtistResponse]{
+		MaxGoroutines: spotifyConcurrency,
+	}
+	return mapper.Map(artistsSearchResults, func(result *types.MusicSearchResponse) types.MusicSimilarArtistResponse {
+		similar := types.MusicSimilarArtistResponse{PlexMusicArtist: result.PlexMusicArtist}
+		if ctx.Err() != nil || len(result.MusicSearchResults) == 0 {
+			return similar
+		}
+		similar.SimilarArtists = c.searchSpotifySimilarArtists(ctx, result.MusicSearchResults[0].ID)
+		if progressFunc != nil {
+			progressFunc()
+		}
+		return similar
+	})
+}
+
+func (c *Client) searchSpotifySimilarArtists(ctx context.Context, artistID string) (similar []types.MusicSimilarArtistResult) {
+	body, err := c.makeRequest(ctx, fmt.Sprintf("%s/artists/%s/related-artists", spotifyAPIURL.String(), artistID))
+	if err != nil {
+		fmt.Printf("searchSpotifySimilarArtists: unable to read response from spotify: %s\n", err.Error())
+		return similar
+	}
+	var similarResponse SimilarArtistsResponse
+	if err := json.Unmarshal(body, &similarResponse); err != nil {
+		fmt.Printf("searchSpotifySimilarArtists: unable to parse response from spotify: %s\n", err.Error())
+		return similar
+	}
+	for i := range similarResponse.Artists {
+		similar = append(similar, types.MusicSimilarArtistResult{
+			Name: similarResponse.Artists[i].Name,
+			URL:  similarResponse.Artists[i].ExternalUrls.Spotify,
+		})
+	}
+	return similar
+}
+
 // searchSpotifyArtistValue is a value-returning version for use with iter.Map
-func searchSpotifyArtistValue(ctx context.Context, plexArtist *types.PlexMusicArtist, token string) types.MusicSearchResponse {
+func (c *Client) searchSpotifyArtistValue(ctx context.Context, plexArtist *types.PlexMusicArtist) types.MusicSearchResponse {
 	searchResults := types.MusicSearchResponse{}
 	searchResults.PlexMusicArtist = *plexArtist
 	urlEncodedArtist := url.QueryEscape(plexArtist.Name)
-	artistURL := fmt.Sprintf("%s/search?q=%s&type=artist&limit=10", spotifyAPIURL, urlEncodedArtist)
-	body, err := makeRequest(artistURL, token, ctx)
+	artistURL := fmt.Sprintf("%s/search?q=%s&type=artist&limit=10", spotifyAPIURL.String(), urlEncodedArtist)
+	body, err := c.makeRequest(ctx, artistURL)
 	if err != nil {
 		fmt.Printf("lookupArtist: unable to read response from spotify: %s\n", err.Error())
 		return searchResults
@@ -171,37 +307,132 @@ func searchSpotifyArtistValue(ctx context.Context, plexArtist *types.PlexMusicAr
 	return searchResults
 }
 
-// searchSpotifyAlbumValue is a value-returning version for use with iter.Map
-func searchSpotifyAlbumValue(ctx context.Context, m *types.MusicSearchResponse, token string) types.MusicSearchResponse {
+// searchSpotifyAlbumValue is a value-returning version for use with iter.Map. It follows the next links until every
+// page of the artist's releases is read, then merges re-releases of the same album.
+func (c *Client) searchSpotifyAlbumValue(ctx context.Context, m *types.MusicSearchResponse, albumTypes []string) types.MusicSearchResponse {
 	result := *m
 	if len(result.MusicSearchResults) == 0 {
 		fmt.Printf("SearchSpotifyAlbums: no artist found for %v\n", result.PlexMusicArtist)
 		return result
 	}
-	albumURL := fmt.Sprintf("%s/artists/%s/albums?include_groups=album&limit=50&", spotifyAPIURL, result.MusicSearchResults[0].ID)
-	body, err := makeRequest(albumURL, token, ctx)
-	if err != nil {
-		fmt.Printf("lookupArtistAlbums: unable to parse response from spotify: %s\n", err.Error())
-		return result
+	var groups []string
+	for _, albumType := range albumTypes {
+		if group := spotifyGroups[albumType]; group != "" && !slices.Contains(groups, group) {
+			groups = append(groups, group)
+		}
 	}
-	var albumsResponse AlbumsResponse
-	_ = json.Unmarshal(body, &albumsResponse)
+	albumURL := fmt.Sprintf("%s/artists/%s/albums?include_groups=%s&limit=%d", spotifyAPIURL.String(), result.MusicSearchResults[0].ID,
+		strings.Join(groups, ","), albumPageSize)
 	albums := make([]types.MusicAlbumSearchResult, 0)
-	for i := range albumsResponse.Items {
-		year := strings.Split(albumsResponse.Items[i].ReleaseDate, "-")[0]
-		albums = append(albums, types.MusicAlbumSearchResult{
-			Title: albumsResponse.Items[i].Name,
-			ID:    albumsResponse.Items[i].ID,
-			URL:   albumsResponse.Items[i].ExternalUrls.Spotify,
-			Year:  year,
-		})
+	for page := 0; albumURL != "" && page < maxAlbumPages; page++ {
+		body, err := c.makeRequest(ctx, albumURL)
+		if err != nil {
+			fmt.Printf("lookupArtistAlbums: unable to read response from spotify: %s\n", err.Error())
+			break
+		}
+		var albumsResponse AlbumsResponse
+		if err := json.Unmarshal(body, &albumsResponse); err != nil {
+			fmt.Printf("lookupArtistAlbums: unable to parse response from spotify: %s\n", err.Error())
+			break
+		}
+		for i := range albumsResponse.Items {
+			albumType := spotifyAlbumType(albumsResponse.Items[i].AlbumType, albumsResponse.Items[i].TotalTracks)
+			if !slices.Contains(albumTypes, albumType) {
+				continue
+			}
+			year := strings.Split(albumsResponse.Items[i].ReleaseDate, "-")[0]
+			albums = append(albums, types.MusicAlbumSearchResult{
+				Title: albumsResponse.Items[i].Name,
+				ID:    albumsResponse.Items[i].ID,
+				URL:   albumsResponse.Items[i].ExternalUrls.Spotify,
+				Year:  year,
+				Type:  albumType,
+			})
+		}
+		albumURL = albumsResponse.Next
 	}
-	result.MusicSearchResults[0].FoundAlbums = albums
+	result.MusicSearchResults[0].FoundAlbums = mergeReleases(albums)
 	return result
 }
 
+// Name is shown in the incomplete albums report.
+func (c *Client) Name() string {
+	return "Spotify"
+}
+
+// AlbumTracks returns the tracklist of a spotify album, following the next links of long albums.
+func (c *Client) AlbumTracks(ctx context.Context, albumID string) (tracks []types.AlbumTrack, err error) {
+	tracksURL := fmt.Sprintf("%s/albums/%s/tracks?limit=%d", spotifyAPIURL.String(), albumID, albumPageSize)
+	for page := 0; tracksURL != "" && page < maxAlbumPages; page++ {
+		body, requestErr := c.makeRequest(ctx, tracksURL)
+		if requestErr != nil {
+			return tracks, fmt.Errorf("spotify: unable to get the tracks of %s: %w", albumID, requestErr)
+		}
+		var tracksResponse AlbumTracksResponse
+		if jsonErr := json.Unmarshal(body, &tracksResponse); jsonErr != nil {
+			return tracks, fmt.Errorf("spotify: unable to parse the tracks of %s: %w", albumID, jsonErr)
+		}
+		for i := range tracksResponse.Items {
+			tracks = append(tracks, types.AlbumTrack{
+				Disc:   max(tracksResponse.Items[i].DiscNumber, 1),
+				Number: tracksResponse.Items[i].TrackNumber,
+				Title:  tracksResponse.Items[i].Name,
+			})
+		}
+		tracksURL = tracksResponse.Next
+	}
+	return tracks, nil
+}
+
+// mergeReleases keeps one of each album spotify lists several times, eg regional, deluxe or remastered re-releases.
+// The earliest release wins, then the shortest title, the albums stay in the order spotify listed them.
+func mergeReleases(albums []types.MusicAlbumSearchResult) []types.MusicAlbumSearchResult {
+	merged := make([]types.MusicAlbumSearchResult, 0, len(albums))
+	index := make(map[string]int)
+	for i := range albums {
+		key := releaseKey(albums[i].Title) + "|" + albums[i].Type
+		j, found := index[key]
+		if !found {
+			index[key] = len(merged)
+			merged = append(merged, albums[i])
+			continue
+		}
+		kept := merged[j]
+		if albums[i].Year < kept.Year || albums[i].Year == kept.Year && len(albums[i].Title) < len(kept.Title) {
+			merged[j] = albums[i]
+		}
+	}
+	return merged
+}
+
+// releaseKey is the album title without bracketed or " - Deluxe Edition" style re-release notes.
+func releaseKey(title string) string {
+	return utils.SanitizedAlbumTitle(editionSuffix.ReplaceAllString(title, ""))
+}
+
+// spotifyAlbumType maps a spotify album_type to one of types.AlbumTypes.
+func spotifyAlbumType(albumType string, totalTracks int64) string {
+	switch albumType {
+	case "single":
+		if totalTracks >= epTracks {
+			return types.AlbumTypeEP
+		}
+		return types.AlbumTypeSingle
+	case "compilation":
+		return types.AlbumTypeCompilation
+	default:
+		return types.AlbumTypeAlbum
+	}
+}
+
+// SpotifyOAuthToken requests a client credentials token, use a Client to have it refreshed when it expires.
 func SpotifyOAuthToken(ctx context.Context, clientID, clientSecret string) (token string, err error) {
-	oauthURL := "https://accounts.spotify.com/api/token"
+	token, _, err = requestToken(ctx, clientID, clientSecret)
+	return token, err
+}
+
+func requestToken(ctx context.Context, clientID, clientSecret string) (token string, expiresIn time.Duration, err error) {
+	oauthURL := spotifyAccountsURL.String() + "/api/token"
 	client := &http.Client{
 		Timeout: time.Second * lookupTimeout,
 	}
@@ -213,61 +444,54 @@ func SpotifyOAuthToken(ctx context.Context, clientID, clientSecret string) (toke
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	response, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("spotifyOauthToken: get failed from spotify: %s", err.Error())
+		return "", 0, fmt.Errorf("spotifyOauthToken: get failed from spotify: %s", err.Error())
 	}
 	defer response.Body.Close()
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return "", fmt.Errorf("spotifyOauthToken: unable to read response from spotify: %s", err.Error())
+		return "", 0, fmt.Errorf("spotifyOauthToken: unable to read response from spotify: %s", err.Error())
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("spotifyOauthToken: status code not OK: %d", response.StatusCode)
 	}
 	var oauthResponse struct {
 		AccessToken string `json:"access_token"`
 		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
 	}
 	err = json.Unmarshal(body, &oauthResponse)
 	if err != nil {
-		return "", fmt.Errorf("getOauthToken: unable to parse response from spotify: %s", err.Error())
+		return "", 0, fmt.Errorf("getOauthToken: unable to parse response from spotify: %s", err.Error())
 	}
-	return oauthResponse.AccessToken, nil
+	if oauthResponse.AccessToken == "" {
+		return "", 0, errors.New("spotifyOauthToken: no access token in the response from spotify")
+	}
+	return oauthResponse.AccessToken, time.Duration(oauthResponse.ExpiresIn) * time.Second, nil
 }
 
-func makeRequest(inputURL, token string, ctx context.Context) (rawResponse []byte, err error) {
-	client := &http.Client{
-		Timeout: time.Second * lookupTimeout,
-	}
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, inputURL, http.NoBody)
-	bearer := fmt.Sprintf("Bearer %s", token)
-	req.Header.Add("Authorization", bearer)
-	var response *http.Response
-	for {
-		response, err = client.Do(req)
+// makeRequest gets a spotify API url. It waits out rate limits a few times and asks for a new token once when the
+// current one is rejected.
+func (c *Client) makeRequest(ctx context.Context, inputURL string) ([]byte, error) {
+	for refreshed := false; ; refreshed = true {
+		token, err := c.Token(ctx)
 		if err != nil {
-			response.Body.Close()
 			return nil, err
 		}
-		if response.StatusCode == http.StatusTooManyRequests {
-			wait := response.Header.Get("Retry-After")
-			waitSeconds, _ := strconv.Atoi(wait)
-			if waitSeconds > lookupTimeout {
-				fmt.Printf("spotify: rate limited for %d seconds\n", waitSeconds)
-			}
-			time.Sleep(time.Duration(waitSeconds) * time.Second)
-			continue
+		api := &utils.APIClient{
+			Name:          "spotify",
+			Header:        http.Header{"Authorization": {"Bearer " + token}},
+			Timeout:       lookupTimeout * time.Second,
+			MaxAttempts:   maxAttempts,
+			RateLimitWait: rateLimitWait,
 		}
-		if response.StatusCode == http.StatusOK {
-			break
+		body, err := api.Get(ctx, inputURL)
+		var statusErr *utils.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized && !refreshed {
+			c.expire(token)
+			continue
 		}
+		return body, err
 	}
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
-	}
-	// check for a 200 status code
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("spotify: status code not OK: %d", response.StatusCode)
-	}
-	return body, nil
 }
 
 func artistStringMatcher(dbName, webName string) bool {
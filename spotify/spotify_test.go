@@ -1,9 +1,15 @@
 package spotify
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/tphoney/plex-lookup/fixtures"
 	"github.com/tphoney/plex-lookup/types"
 )
 
@@ -16,9 +22,9 @@ func TestGetArtistsInParallel(t *testing.T) {
 	if spotifyClientID == "" || spotifyClientSecret == "" {
 		t.Skip("SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET not set")
 	}
-	token, err := SpotifyOAuthToken(t.Context(), spotifyClientID, spotifyClientSecret)
-	if err != nil {
-		t.Errorf("GetSpotifyToken() returned an error: %s", err)
+	client := NewClient(spotifyClientID, spotifyClientSecret)
+	if _, err := client.Token(t.Context()); err != nil {
+		t.Errorf("Token() returned an error: %s", err)
 	}
 
 	plexArtists := []types.PlexMusicArtist{
@@ -28,7 +34,7 @@ func TestGetArtistsInParallel(t *testing.T) {
 		{Name: "The Kinks"},
 	}
 
-	got := GetArtistsInParallel(t.Context(), nil, plexArtists, token)
+	got := client.GetArtistsInParallel(t.Context(), nil, plexArtists)
 
 	if len(got) != len(plexArtists) {
 		t.Errorf("GetSpotifyArtistsInParallel() returned %d results, expected %d", len(got), len(plexArtists))
@@ -39,13 +45,13 @@ func TestSearchSpotifyArtist(t *testing.T) {
 	if spotifyClientID == "" || spotifyClientSecret == "" {
 		t.Skip("SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET not set")
 	}
-	token, err := SpotifyOAuthToken(t.Context(), spotifyClientID, spotifyClientSecret)
-	if err != nil {
-		t.Errorf("GetSpotifyToken() returned an error: %s", err)
+	client := NewClient(spotifyClientID, spotifyClientSecret)
+	if _, err := client.Token(t.Context()); err != nil {
+		t.Errorf("Token() returned an error: %s", err)
 	}
 
 	plexArtist := &types.PlexMusicArtist{Name: "The Beatles"}
-	got := searchSpotifyArtistValue(t.Context(), plexArtist, token)
+	got := client.searchSpotifyArtistValue(t.Context(), plexArtist)
 
 	if len(got.MusicSearchResults) != 1 {
 		t.Fatalf("SearchSpotifyArtist() returned %d results, expected 1", len(got.MusicSearchResults))
@@ -73,14 +79,14 @@ func TestSearchSpotifyArtistDebug(t *testing.T) {
 	if spotifyClientID == "" || spotifyClientSecret == "" {
 		t.Skip("SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET not set")
 	}
-	token, err := SpotifyOAuthToken(t.Context(), spotifyClientID, spotifyClientSecret)
-	if err != nil {
-		t.Errorf("GetSpotifyToken() returned an error: %s", err)
+	client := NewClient(spotifyClientID, spotifyClientSecret)
+	if _, err := client.Token(t.Context()); err != nil {
+		t.Errorf("Token() returned an error: %s", err)
 	}
 
 	plexArtist := &types.PlexMusicArtist{Name: "Angel Olsen"}
 
-	got := searchSpotifyArtistValue(t.Context(), plexArtist, token)
+	got := client.searchSpotifyArtistValue(t.Context(), plexArtist)
 
 	t.Logf("SearchSpotifyArtist() = %+v", got)
 }
@@ -89,9 +95,9 @@ func TestSearchSpotifyAlbums(t *testing.T) {
 	if spotifyClientID == "" || spotifyClientSecret == "" {
 		t.Skip("SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET not set")
 	}
-	token, err := SpotifyOAuthToken(t.Context(), spotifyClientID, spotifyClientSecret)
-	if err != nil {
-		t.Errorf("GetSpotifyToken() returned an error: %s", err)
+	client := NewClient(spotifyClientID, spotifyClientSecret)
+	if _, err := client.Token(t.Context()); err != nil {
+		t.Errorf("Token() returned an error: %s", err)
 	}
 	type args struct {
 		m *types.MusicSearchResponse
@@ -111,7 +117,7 @@ func TestSearchSpotifyAlbums(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := searchSpotifyAlbumValue(t.Context(), tt.args.m, token)
+			got := client.searchSpotifyAlbumValue(t.Context(), tt.args.m, []string{types.AlbumTypeAlbum})
 
 			if len(got.MusicSearchResults) == 0 {
 				t.Fatalf("SearchSpotifyAlbums() returned no music search results")
@@ -127,9 +133,9 @@ func TestSearchSpotifyAlbumsDebug(t *testing.T) {
 	if spotifyClientID == "" || spotifyClientSecret == "" {
 		t.Skip("SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET not set")
 	}
-	token, err := SpotifyOAuthToken(t.Context(), spotifyClientID, spotifyClientSecret)
-	if err != nil {
-		t.Errorf("GetSpotifyToken() returned an error: %s", err)
+	client := NewClient(spotifyClientID, spotifyClientSecret)
+	if _, err := client.Token(t.Context()); err != nil {
+		t.Errorf("Token() returned an error: %s", err)
 	}
 
 	want := types.MusicSearchResponse{
@@ -142,7 +148,203 @@ func TestSearchSpotifyAlbumsDebug(t *testing.T) {
 		},
 	}
 
-	got := searchSpotifyAlbumValue(t.Context(), &want, token)
+	got := client.searchSpotifyAlbumValue(t.Context(), &want, []string{types.AlbumTypeAlbum})
 
 	t.Logf("SearchSpotifyAlbum() = %v", got.MusicSearchResults)
 }
+
+func TestGetAlbumsInParallelOffline(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+	urls := fixtures.ProviderURLs(server.URL)
+	SetURLs(urls.SpotifyAPI, urls.SpotifyAccounts)
+	defer SetURLs("", "")
+
+	token, err := SpotifyOAuthToken(t.Context(), "client-id", "client-secret")
+	if err != nil || token == "" {
+		t.Fatalf("SpotifyOAuthToken() token = %q, error = %v", token, err)
+	}
+	client := NewClient("client-id", "client-secret")
+	artists := client.GetArtistsInParallel(t.Context(), nil, []types.PlexMusicArtist{{Name: "The Beatles"}, {Name: "Unknown Artist"}})
+	got := client.GetAlbumsInParallel(t.Context(), nil, artists, []string{types.AlbumTypeAlbum})
+	if len(got) != 2 {
+		t.Fatalf("GetAlbumsInParallel() returned %d results, expected 2", len(got))
+	}
+	if len(got[0].MusicSearchResults) == 0 || len(got[0].MusicSearchResults[0].FoundAlbums) != 8 {
+		t.Fatalf("Expected 8 recorded albums for The Beatles, but got %v", got[0].MusicSearchResults)
+	}
+	if albumType := got[0].MusicSearchResults[0].FoundAlbums[0].Type; albumType != types.AlbumTypeAlbum {
+		t.Errorf("Expected the album type %q, but got %q", types.AlbumTypeAlbum, albumType)
+	}
+	// the recording only has albums
+	singles := client.GetAlbumsInParallel(t.Context(), nil, artists[:1], []string{types.AlbumTypeSingle, types.AlbumTypeEP})
+	if len(singles[0].MusicSearchResults[0].FoundAlbums) != 0 {
+		t.Errorf("Expected no singles or EPs, but got %v", singles[0].MusicSearchResults[0].FoundAlbums)
+	}
+	if len(got[1].MusicSearchResults) != 0 {
+		t.Errorf("Expected no match for an unrecorded artist, but got %v", got[1].MusicSearchResults)
+	}
+}
+
+func TestGetSimilarArtistsInParallelOffline(t *testing.T) {
+	server := httptest.NewServer(fixtures.Handler())
+	defer server.Close()
+	urls := fixtures.ProviderURLs(server.URL)
+	SetURLs(urls.SpotifyAPI, urls.SpotifyAccounts)
+	defer SetURLs("", "")
+
+	client := NewClient("client-id", "client-secret")
+	artists := client.GetArtistsInParallel(t.Context(), nil, []types.PlexMusicArtist{{Name: "The Beatles"}, {Name: "Unknown Artist"}})
+	got := client.GetSimilarArtistsInParallel(t.Context(), nil, artists)
+	if len(got) != 2 || got[0].Name != "The Beatles" || got[1].Name != "Unknown Artist" {
+		t.Fatalf("GetSimilarArtistsInParallel() = %+v", got)
+	}
+	if len(got[0].SimilarArtists) != 2 || got[0].SimilarArtists[1].Name != "The Kinks" ||
+		got[0].SimilarArtists[1].URL != "https://open.spotify.com/artist/1SQRv42e4PjEYfPhS0Tk9E" {
+		t.Errorf("GetSimilarArtistsInParallel() similar = %+v", got[0].SimilarArtists)
+	}
+	if len(got[1].SimilarArtists) != 0 {
+		t.Errorf("Expected no similar artists for an unrecorded artist, but got %v", got[1].SimilarArtists)
+	}
+}
+
+func TestSpotifyAlbumType(t *testing.T) {
+	tests := []struct {
+		albumType   string
+		totalTracks int64
+		want        string
+	}{
+		{albumType: "album", totalTracks: 12, want: types.AlbumTypeAlbum},
+		{albumType: "single", totalTracks: 1, want: types.AlbumTypeSingle},
+		{albumType: "single", totalTracks: 5, want: types.AlbumTypeEP},
+		{albumType: "compilation", totalTracks: 20, want: types.AlbumTypeCompilation},
+	}
+	for _, tt := range tests {
+		if got := spotifyAlbumType(tt.albumType, tt.totalTracks); got != tt.want {
+			t.Errorf("spotifyAlbumType(%q, %d) = %q, want %q", tt.albumType, tt.totalTracks, got, tt.want)
+		}
+	}
+}
+
+// TestAlbumPagesAndTokenRefresh pages through two pages of albums, the first token expires at once and the second is
+// rejected, so each page needs a new token.
+func TestAlbumPagesAndTokenRefresh(t *testing.T) {
+	var tokens atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/token":
+			fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":1}`, tokens.Add(1))
+		case r.Header.Get("Authorization") == "Bearer token-2":
+			http.Error(w, `{"error":{"status":401,"message":"The access token expired"}}`, http.StatusUnauthorized)
+		case r.URL.Query().Get("offset") == "":
+			fmt.Fprintf(w, `{"items":[
+				{"album_type":"album","name":"Abbey Road (Remastered)","id":"a1","release_date":"2009-09-09"},
+				{"album_type":"album","name":"Revolver","id":"a2","release_date":"1966-08-05"}],
+				"next":"%s/artists/beatles/albums?offset=2"}`, server.URL)
+		default:
+			fmt.Fprint(w, `{"items":[
+				{"album_type":"album","name":"Abbey Road","id":"a3","release_date":"1969-09-26"},
+				{"album_type":"album","name":"Revolver - Super Deluxe Edition","id":"a4","release_date":"2022-10-28"},
+				{"album_type":"album","name":"Let It Be","id":"a5","release_date":"1970-05-08"}],"next":null}`)
+		}
+	}))
+	defer server.Close()
+	SetURLs(server.URL, server.URL)
+	defer SetURLs("", "")
+
+	client := NewClient("client-id", "client-secret")
+	artist := &types.MusicSearchResponse{MusicSearchResults: []types.MusicArtistSearchResult{{ID: "beatles"}}}
+	got := client.searchSpotifyAlbumValue(t.Context(), artist, []string{types.AlbumTypeAlbum}).MusicSearchResults[0].FoundAlbums
+	want := []string{"a3", "a2", "a5"}
+	if len(got) != len(want) {
+		t.Fatalf("searchSpotifyAlbumValue() = %+v, want the albums %v", got, want)
+	}
+	for i := range want {
+		if got[i].ID != want[i] {
+			t.Errorf("searchSpotifyAlbumValue()[%d] = %+v, want the album %s", i, got[i], want[i])
+		}
+	}
+	if tokens.Load() != 3 {
+		t.Errorf("Expected 3 tokens, one expired and one rejected, but got %d", tokens.Load())
+	}
+}
+
+func TestMakeRequestRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/token" {
+			fmt.Fprint(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`)
+			return
+		}
+		requests.Add(1)
+		w.Header().Set("Retry-After", "soon")
+		http.Error(w, `{"error":{"status":429,"message":"API rate limit exceeded"}}`, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	SetURLs(server.URL, server.URL)
+	defer SetURLs("", "")
+	wait := rateLimitWait
+	rateLimitWait = time.Millisecond
+	defer func() { rateLimitWait = wait }()
+
+	client := NewClient("client-id", "client-secret")
+	if _, err := client.makeRequest(t.Context(), server.URL+"/artists/beatles"); err == nil {
+		t.Errorf("makeRequest() returned no error for a request that is always rate limited")
+	}
+	if requests.Load() != maxAttempts {
+		t.Errorf("makeRequest() made %d requests, want %d", requests.Load(), maxAttempts)
+	}
+}
+
+func TestMergeReleases(t *testing.T) {
+	albums := []types.MusicAlbumSearchResult{
+		{Title: "1 (Remastered)", Year: "2015", Type: types.AlbumTypeCompilation},
+		{Title: "Help!", Year: "1965", Type: types.AlbumTypeAlbum},
+		{Title: "1", Year: "2000", Type: types.AlbumTypeCompilation},
+		{Title: "Help! - Deluxe Edition", Year: "1965", Type: types.AlbumTypeAlbum},
+		{Title: "Help!", Year: "1965", Type: types.AlbumTypeSingle},
+		{Title: "Rubber Soul - Mono Version", Year: "1965", Type: types.AlbumTypeAlbum},
+	}
+	got := mergeReleases(albums)
+	want := []string{"1 2000", "Help! 1965", "Help! 1965", "Rubber Soul - Mono Version 1965"}
+	if len(got) != len(want) {
+		t.Fatalf("mergeReleases() = %+v, want %v", got, want)
+	}
+	for i := range want {
+		if fmt.Sprintf("%s %s", got[i].Title, got[i].Year) != want[i] {
+			t.Errorf("mergeReleases()[%d] = %+v, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAlbumTracks(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/token":
+			fmt.Fprint(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`)
+		case r.URL.Path != "/albums/abbey/tracks":
+			http.NotFound(w, r)
+		case r.URL.Query().Get("offset") == "":
+			fmt.Fprintf(w, `{"items":[{"disc_number":1,"track_number":1,"name":"Come Together"}],"next":"%s/albums/abbey/tracks?offset=1"}`, server.URL)
+		default:
+			fmt.Fprint(w, `{"items":[{"disc_number":1,"track_number":2,"name":"Something"}],"next":null}`)
+		}
+	}))
+	defer server.Close()
+	SetURLs(server.URL, server.URL)
+	defer SetURLs("", "")
+
+	client := NewClient("client-id", "client-secret")
+	got, err := client.AlbumTracks(t.Context(), "abbey")
+	if err != nil || len(got) != 2 || got[1] != (types.AlbumTrack{Disc: 1, Number: 2, Title: "Something"}) {
+		t.Errorf("AlbumTracks() = %+v, error = %v", got, err)
+	}
+	if _, err := client.AlbumTracks(t.Context(), "missing"); err == nil {
+		t.Error("AlbumTracks() expected an error for an unknown album")
+	}
+}
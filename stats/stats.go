@@ -0,0 +1,247 @@
+package stats
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+const (
+	gigabyte = 1 << 30
+	unknown  = "unknown"
+)
+
+// resolutionOrder is lowest first, the same order plex ranks resolutions.
+var resolutionOrder = append(slices.Clone(types.PlexResolutions), unknown)
+
+// sizeBuckets are the file size ranges, each bucket holds files below its limit in GB.
+var sizeBuckets = []struct {
+	Name  string
+	Limit int64
+}{
+	{Name: "< 1 GB", Limit: 1},
+	{Name: "1-5 GB", Limit: 5},
+	{Name: "5-15 GB", Limit: 15},
+	{Name: "15-30 GB", Limit: 30},
+	{Name: "30+ GB", Limit: 0},
+}
+
+// Count is one bar of a distribution.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Section is the statistics of one library. Movies and TV are counted per file (movie or episode), music per album.
+type Section struct {
+	Titles         int     `json:"titles"`
+	Files          int     `json:"files"`
+	TotalSize      int64   `json:"totalSize"`
+	Resolutions    []Count `json:"resolutions,omitempty"`
+	VideoCodecs    []Count `json:"videoCodecs,omitempty"`
+	AudioCodecs    []Count `json:"audioCodecs,omitempty"`
+	AudioLanguages []Count `json:"audioLanguages,omitempty"`
+	FileSizes      []Count `json:"fileSizes,omitempty"`
+	Decades        []Count `json:"decades,omitempty"`
+	AddedByYear    []Count `json:"addedByYear,omitempty"`
+}
+
+// Library is the statistics of the movie, TV and music libraries, a library that was not fetched is nil.
+type Library struct {
+	Movies *Section `json:"movies,omitempty"`
+	TV     *Section `json:"tv,omitempty"`
+	Music  *Section `json:"music,omitempty"`
+}
+
+// counter collects a distribution and sorts it when done.
+type counter map[string]int
+
+func (c counter) add(name string) {
+	if name == "" {
+		name = unknown
+	}
+	c[name]++
+}
+
+// byCount sorts the most common first, ties by name.
+func (c counter) byCount() (counts []Count) {
+	for name, count := range c {
+		counts = append(counts, Count{Name: name, Count: count})
+	}
+	slices.SortFunc(counts, func(a, b Count) int {
+		if byCount := cmp.Compare(b.Count, a.Count); byCount != 0 {
+			return byCount
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return counts
+}
+
+// byName sorts by name, for decades and years.
+func (c counter) byName() (counts []Count) {
+	counts = c.byCount()
+	slices.SortFunc(counts, func(a, b Count) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return counts
+}
+
+// inOrder sorts by a fixed order, names not in the order go last.
+func (c counter) inOrder(order []string) (counts []Count) {
+	counts = c.byCount()
+	slices.SortStableFunc(counts, func(a, b Count) int {
+		return cmp.Compare(orderIndex(order, a.Name), orderIndex(order, b.Name))
+	})
+	return counts
+}
+
+func orderIndex(order []string, name string) int {
+	if i := slices.Index(order, name); i >= 0 {
+		return i
+	}
+	return len(order)
+}
+
+func sizeBucket(size int64) string {
+	if size <= 0 {
+		return unknown
+	}
+	for _, bucket := range sizeBuckets {
+		if bucket.Limit == 0 || size < bucket.Limit*gigabyte {
+			return bucket.Name
+		}
+	}
+	return unknown
+}
+
+func sizeOrder() (order []string) {
+	for _, bucket := range sizeBuckets {
+		order = append(order, bucket.Name)
+	}
+	return append(order, unknown)
+}
+
+func decade(year string) string {
+	number, err := strconv.Atoi(year)
+	if err != nil || number <= 0 {
+		return unknown
+	}
+	return fmt.Sprintf("%ds", number/10*10) //nolint:mnd // years in a decade
+}
+
+func addedYear(added time.Time) string {
+	if added.IsZero() {
+		return unknown
+	}
+	return strconv.Itoa(added.Year())
+}
+
+// file is what we count for each movie or episode.
+type file struct {
+	resolution, videoCodec, audioCodec string
+	size                               int64
+}
+
+type sectionCounter struct {
+	section                                                                 Section
+	resolutions, videoCodecs, audioCodecs, languages, sizes, decades, added counter
+}
+
+func newSectionCounter() *sectionCounter {
+	return &sectionCounter{resolutions: counter{}, videoCodecs: counter{}, audioCodecs: counter{}, languages: counter{},
+		sizes: counter{}, decades: counter{}, added: counter{}}
+}
+
+func (s *sectionCounter) addFile(f file) {
+	s.section.Files++
+	s.section.TotalSize += f.size
+	s.resolutions.add(f.resolution)
+	s.videoCodecs.add(f.videoCodec)
+	s.audioCodecs.add(f.audioCodec)
+	s.sizes.add(sizeBucket(f.size))
+}
+
+func (s *sectionCounter) done() *Section {
+	s.section.Resolutions = s.resolutions.inOrder(resolutionOrder)
+	s.section.VideoCodecs = s.videoCodecs.byCount()
+	s.section.AudioCodecs = s.audioCodecs.byCount()
+	s.section.AudioLanguages = s.languages.byCount()
+	s.section.FileSizes = s.sizes.inOrder(sizeOrder())
+	s.section.Decades = s.decades.byName()
+	s.section.AddedByYear = s.added.byName()
+	return &s.section
+}
+
+// Movies counts a movie library.
+func Movies(movies []types.PlexMovie) *Section {
+	s := newSectionCounter()
+	for i := range movies {
+		s.section.Titles++
+		s.addFile(file{resolution: movies[i].Resolution, videoCodec: movies[i].VideoCodec, audioCodec: movies[i].AudioCodec,
+			size: movies[i].FileSize})
+		for _, language := range movies[i].AudioLanguages {
+			s.languages.add(language)
+		}
+		s.decades.add(decade(movies[i].Year))
+		s.added.add(addedYear(movies[i].DateAdded))
+	}
+	return s.done()
+}
+
+// TV counts a TV library, resolutions, codecs and sizes are per episode, decades and added dates per show.
+func TV(shows []types.PlexTVShow) *Section {
+	s := newSectionCounter()
+	for i := range shows {
+		s.section.Titles++
+		for j := range shows[i].Seasons {
+			for _, episode := range shows[i].Seasons[j].Episodes {
+				s.addFile(file{resolution: episode.Resolution, videoCodec: episode.VideoCodec, audioCodec: episode.AudioCodec,
+					size: episode.FileSize})
+			}
+		}
+		s.decades.add(decade(shows[i].Year))
+		s.added.add(addedYear(shows[i].DateAdded))
+	}
+	return s.done()
+}
+
+// Music counts a music library by album. Plex only lists codecs and sizes per track, so they are not counted.
+func Music(artists []types.PlexMusicArtist) *Section {
+	s := newSectionCounter()
+	for i := range artists {
+		s.section.Titles++
+		for _, album := range artists[i].Albums {
+			s.section.Files++
+			s.decades.add(decade(album.Year))
+			s.added.add(addedYear(album.DateAdded))
+		}
+	}
+	return s.done()
+}
+
+// Collect fetches and counts each library with an ID, an empty ID skips that library.
+func Collect(ctx context.Context, server types.MediaServer, movieLibraryID, tvLibraryID, musicLibraryID string) (library Library, err error) {
+	var errs []error
+	if movieLibraryID != "" {
+		movies, moviesErr := server.Movies(ctx, movieLibraryID)
+		errs = append(errs, moviesErr)
+		library.Movies = Movies(movies)
+	}
+	if tvLibraryID != "" {
+		shows, tvErr := server.TV(ctx, tvLibraryID)
+		errs = append(errs, tvErr)
+		library.TV = TV(shows)
+	}
+	if musicLibraryID != "" {
+		artists, musicErr := server.MusicArtists(ctx, musicLibraryID)
+		errs = append(errs, musicErr)
+		library.Music = Music(artists)
+	}
+	return library, errors.Join(errs...)
+}
@@ -0,0 +1,85 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+type stubServer struct {
+	movies []types.PlexMovie
+	err    error
+}
+
+func (stubServer) Name() string { return "stub" }
+
+func (stubServer) Libraries(_ context.Context) ([]types.PlexLibrary, error) { return nil, nil }
+
+func (s stubServer) Movies(_ context.Context, _ string) ([]types.PlexMovie, error) {
+	return s.movies, s.err
+}
+
+func (stubServer) TV(_ context.Context, _ string) ([]types.PlexTVShow, error) { return nil, nil }
+
+func (stubServer) MusicArtists(_ context.Context, _ string) ([]types.PlexMusicArtist, error) {
+	return []types.PlexMusicArtist{{Name: "Aaliyah", Albums: []types.PlexMusicAlbum{{Year: "1994"}, {Year: "1996"}, {Year: "2001"}}}}, nil
+}
+
+func TestMovies(t *testing.T) {
+	added := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	movies := []types.PlexMovie{
+		{Year: "1997", Resolution: types.PlexResolution1080, VideoCodec: "h264", AudioCodec: "ac3", FileSize: 8 << 30,
+			AudioLanguages: []string{"English", "French"}, DateAdded: added},
+		{Year: "1999", Resolution: types.PlexResolutionSD, VideoCodec: "mpeg2video", AudioCodec: "ac3", FileSize: 512 << 20,
+			AudioLanguages: []string{"English"}, DateAdded: added},
+		{Year: "2019", Resolution: types.PlexResolution4K, VideoCodec: "hevc", AudioCodec: "truehd", FileSize: 60 << 30},
+	}
+	got := Movies(movies)
+	if got.Titles != 3 || got.Files != 3 || got.TotalSize != 8<<30+512<<20+60<<30 {
+		t.Errorf("Movies() totals = %d titles, %d files, %d bytes", got.Titles, got.Files, got.TotalSize)
+	}
+	checks := []struct {
+		name string
+		got  []Count
+		want []Count
+	}{
+		{"resolutions", got.Resolutions, []Count{{"sd", 1}, {"1080", 1}, {"4k", 1}}},
+		{"audio codecs", got.AudioCodecs, []Count{{"ac3", 2}, {"truehd", 1}}},
+		{"languages", got.AudioLanguages, []Count{{"English", 2}, {"French", 1}}},
+		{"file sizes", got.FileSizes, []Count{{"< 1 GB", 1}, {"5-15 GB", 1}, {"30+ GB", 1}}},
+		{"decades", got.Decades, []Count{{"1990s", 2}, {"2010s", 1}}},
+		{"added", got.AddedByYear, []Count{{"2023", 2}, {"unknown", 1}}},
+	}
+	for _, check := range checks {
+		if !reflect.DeepEqual(check.got, check.want) {
+			t.Errorf("Movies() %s = %v, want %v", check.name, check.got, check.want)
+		}
+	}
+}
+
+func TestTV(t *testing.T) {
+	shows := []types.PlexTVShow{{Title: "Friends", Year: "1994", Seasons: []types.PlexTVSeason{
+		{Episodes: []types.PlexTVEpisode{{Resolution: types.PlexResolution480}, {Resolution: types.PlexResolution1080, FileSize: 2 << 30}}},
+	}}}
+	got := TV(shows)
+	if got.Titles != 1 || got.Files != 2 || !reflect.DeepEqual(got.FileSizes, []Count{{"1-5 GB", 1}, {"unknown", 1}}) {
+		t.Errorf("TV() = %+v", got)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	library, err := Collect(context.Background(), stubServer{movies: []types.PlexMovie{{Year: "2001"}}}, "1", "", "3")
+	if err != nil || library.Movies == nil || library.TV != nil || library.Music == nil {
+		t.Fatalf("Collect() = %+v, error = %v", library, err)
+	}
+	if library.Music.Titles != 1 || library.Music.Files != 3 || len(library.Music.Resolutions) != 0 {
+		t.Errorf("Collect() music = %+v", library.Music)
+	}
+	if _, err := Collect(context.Background(), stubServer{err: errors.New("offline")}, "1", "", ""); err == nil {
+		t.Error("Collect() expected the movie library error")
+	}
+}
@@ -0,0 +1,104 @@
+package tvmaze
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
+)
+
+// api docs https://www.tvmaze.com/api
+
+const (
+	DefaultURL     = "https://api.tvmaze.com"
+	ProviderName   = "TVmaze"
+	lookupTimeout  = 10
+	maxAttempts    = 4
+	rateLimitPause = 2 * time.Second
+)
+
+var (
+	tvmazeURL = utils.NewBaseURL(DefaultURL)
+	api       = &utils.APIClient{
+		Name:          "tvmaze",
+		Timeout:       lookupTimeout * time.Second,
+		MaxAttempts:   maxAttempts,
+		RateLimitWait: rateLimitPause,
+	}
+)
+
+type showSearchResult struct {
+	Score float64 `json:"score"`
+	Show  show    `json:"show"`
+}
+
+type show struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Premiered string `json:"premiered"`
+}
+
+type episode struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Season  int    `json:"season"`
+	Number  *int   `json:"number"`
+	Airdate string `json:"airdate"`
+}
+
+// Guide looks up aired episodes on TVmaze, it needs no api key.
+type Guide struct{}
+
+var _ types.EpisodeGuide = Guide{}
+
+// SetURL points TVmaze lookups at a mirror, proxy or fixture server. An empty url restores the default.
+func SetURL(baseURL string) {
+	tvmazeURL.Set(baseURL)
+}
+
+func (Guide) Name() string {
+	return ProviderName
+}
+
+// Episodes finds the show on TVmaze and returns its episodes, specials without an episode number are skipped.
+func (Guide) Episodes(ctx context.Context, plexShow *types.PlexTVShow) (episodes []types.GuideEpisode, err error) {
+	showID, err := findShow(ctx, plexShow)
+	if err != nil {
+		return nil, err
+	}
+	var rawEpisodes []episode
+	if err := api.GetJSON(ctx, fmt.Sprintf("%s/shows/%d/episodes", tvmazeURL.String(), showID), &rawEpisodes); err != nil {
+		return nil, err
+	}
+	for _, raw := range rawEpisodes {
+		if raw.Number == nil {
+			continue
+		}
+		aired, _ := time.Parse(time.DateOnly, raw.Airdate)
+		episodes = append(episodes, types.GuideEpisode{Season: raw.Season, Number: *raw.Number, Title: raw.Name, Aired: aired})
+	}
+	return episodes, nil
+}
+
+// findShow prefers a show with the same name that premiered in the plex year, then any show with the same name.
+func findShow(ctx context.Context, plexShow *types.PlexTVShow) (showID int, err error) {
+	var results []showSearchResult
+	if err := api.GetJSON(ctx, tvmazeURL.String()+"/search/shows?q="+url.QueryEscape(plexShow.Title), &results); err != nil {
+		return 0, err
+	}
+	for i := range results {
+		if strings.EqualFold(results[i].Show.Name, plexShow.Title) && strings.HasPrefix(results[i].Show.Premiered, plexShow.Year) {
+			return results[i].Show.ID, nil
+		}
+	}
+	for i := range results {
+		if strings.EqualFold(results[i].Show.Name, plexShow.Title) {
+			return results[i].Show.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("tvmaze: no show found for %q", plexShow.Title)
+}
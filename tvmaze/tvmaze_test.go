@@ -0,0 +1,44 @@
+package tvmaze
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/fixtures/fixturestest"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestEpisodesOffline(t *testing.T) {
+	SetURL(fixturestest.Start(t).TVMaze)
+	t.Cleanup(func() { SetURL("") })
+
+	episodes, err := Guide{}.Episodes(context.Background(), &types.PlexTVShow{Title: "Friends", Year: "1994"})
+	if err != nil {
+		t.Fatalf("Episodes() error = %v", err)
+	}
+	// the recording has six numbered episodes and one unnumbered special
+	if len(episodes) != 6 {
+		t.Fatalf("Episodes() returned %d episodes, want 6", len(episodes))
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "season", got: episodes[3].Season, want: 1},
+		{name: "number", got: episodes[3].Number, want: 4},
+		{name: "aired", got: episodes[3].Aired.Format("2006-01-02"), want: "1994-10-13"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("Episodes()[3] %s = %v, want %v", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (Guide{}).Episodes(context.Background(), &types.PlexTVShow{Title: "No Such Show"}); err == nil {
+		t.Error("Episodes() expected an error for an unknown show")
+	}
+}
@@ -2,6 +2,9 @@ package types
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -21,10 +24,56 @@ const (
 	StringTrue         = "true"
 )
 
+// PlexResolutions are the resolutions plex reports, lowest first.
+var PlexResolutions = []string{PlexResolutionSD, PlexResolution240, PlexResolution480, PlexResolution576,
+	PlexResolution720, PlexResolution1080, PlexResolution4K}
+
+// ResolutionRank is where a resolution is in PlexResolutions, -1 for an unknown or empty resolution.
+func ResolutionRank(resolution string) int {
+	return slices.Index(PlexResolutions, resolution)
+}
+
+// LowestResolution is the lowest of the known resolutions, empty when none are known.
+func LowestResolution(resolutions []string) string {
+	for _, resolution := range PlexResolutions {
+		if slices.Contains(resolutions, resolution) {
+			return resolution
+		}
+	}
+	return ""
+}
+
+// Music release types. Album is a studio album, ep and single are the other primary types and the rest are
+// secondary types, as MusicBrainz names them.
+const (
+	AlbumTypeAlbum       = "album"
+	AlbumTypeEP          = "ep"
+	AlbumTypeSingle      = "single"
+	AlbumTypeLive        = "live"
+	AlbumTypeCompilation = "compilation"
+	AlbumTypeSoundtrack  = "soundtrack"
+	AlbumTypeRemix       = "remix"
+)
+
+// AlbumTypes are the release types a music lookup can search for.
+var AlbumTypes = []string{AlbumTypeAlbum, AlbumTypeEP, AlbumTypeSingle, AlbumTypeLive, AlbumTypeCompilation,
+	AlbumTypeSoundtrack, AlbumTypeRemix}
+
+// losslessCodecs are the audio codecs, as plex names them, that keep everything the master had.
+var losslessCodecs = []string{"flac", "alac", "wav", "pcm", "aiff", "ape", "wavpack", "wv", "dsd", "dsf", "dff", "truehd", "mlp"}
+
+// IsLosslessCodec reports whether an audio codec is lossless.
+func IsLosslessCodec(codec string) bool {
+	codec = strings.ToLower(codec)
+	return slices.Contains(losslessCodecs, codec) || strings.HasPrefix(codec, "pcm_")
+}
+
 // TVSearchResponse is the new dedicated struct for TV search results.
 type TVSearchResponse struct {
 	PlexTVShow
-	SearchURL       string
+	SearchURL string
+	// SearchFailed is set when the provider could not be searched, eg a network error
+	SearchFailed    bool
 	TVSearchResults []TVSearchResult
 	Matches4k       int
 	MatchesBluray   int
@@ -41,11 +90,21 @@ type MusicSearchResponse struct {
 // MovieSearchResponse is the new dedicated struct for movie search results.
 type MovieSearchResponse struct {
 	PlexMovie
-	SearchURL          string
+	SearchURL string
+	// SearchFailed is set when the provider could not be searched, eg a network error
+	SearchFailed       bool
 	Matches4k          int
 	MatchesBluray      int
 	MatchesDVD         int
 	MovieSearchResults []MovieSearchResult
+	// Regions holds the best matches per amazon region when several regions are compared
+	Regions []RegionAvailability
+}
+
+// RegionAvailability is what a single amazon region has for a title.
+type RegionAvailability struct {
+	Region string
+	Discs  []MovieSearchResult
 }
 
 type Configuration struct {
@@ -55,14 +114,40 @@ type Configuration struct {
 	PlexTVLibraryID     string
 	PlexMusicLibraryID  string
 	AmazonRegion        string
+	AmazonURL           string
+	CinemaParadisoURL   string
 	MusicBrainzURL      string
 	SpotifyClientID     string
 	SpotifyClientSecret string
+	SpotifyAPIURL       string
+	SpotifyAccountsURL  string
+	PriceHistoryFile    string
+	PriceAlertWebhook   string
+	WantedListFile      string
+	TVMazeURL           string
+	LastFMAPIKey        string
+	LastFMURL           string
+	DiscogsToken        string
+	DiscogsURL          string
+	DeezerURL           string
+	// PlexWebhookSecret must be sent as ?token= by the plex webhook, the webhook is disabled without it
+	PlexWebhookSecret string
+	// MediaServer is plex, jellyfin or emby, empty means plex. The library IDs are used for every server.
+	MediaServer       string
+	MediaServerURL    string
+	MediaServerAPIKey string
+	MediaServerUserID string
 }
 
 type MovieLookupFilters struct {
 	AudioLanguage string
 	NewerVersion  bool
+	// DiscAudio only keeps discs with this immersive audio format when the Plex copy lacks it, eg "Atmos" or "DTS:X"
+	DiscAudio string
+	// DiscRegion only keeps discs that play in this region, eg "B"
+	DiscRegion string
+	// TargetPrice only keeps discs at or below this price, in the currency of the amazon region
+	TargetPrice float64
 }
 
 type PlexLookupFilters struct {
@@ -77,7 +162,29 @@ type PlexMovie struct {
 	RatingKey      string
 	Resolution     string
 	AudioLanguages []string
+	AudioFormats   []string
 	DateAdded      time.Time
+	VideoCodec     string
+	AudioCodec     string
+	// FileSize is in bytes
+	FileSize     int64
+	ViewCount    int
+	LastViewedAt time.Time
+	// Rating is the critic rating and AudienceRating the audience rating, both out of 10
+	Rating         float64
+	AudienceRating float64
+	// Versions are the copies of the movie on the server, the first is the one described above
+	Versions []PlexMovieVersion
+}
+
+// PlexMovieVersion is one copy of a movie, a copy can be split over several files.
+type PlexMovieVersion struct {
+	Resolution string
+	VideoCodec string
+	AudioCodec string
+	Files      []string
+	// FileSize is the total of the files in bytes
+	FileSize int64
 }
 
 type MovieSearchResult struct {
@@ -89,6 +196,31 @@ type MovieSearchResult struct {
 	Year        string
 	ReleaseDate time.Time
 	NewRelease  bool
+	Disc        DiscDetails
+	Price       Price
+}
+
+// Price is a retailer price, an Amount of 0 means no price was found.
+type Price struct {
+	Amount   float64
+	Currency string
+}
+
+// DiscDetails are the specifications listed on a disc's product page.
+type DiscDetails struct {
+	VideoCodec      string
+	VideoResolution string
+	HDRFormats      []string
+	AudioTracks     []DiscAudioTrack
+	Subtitles       []string
+	// RegionCodes lists the regions every disc in the set plays in, a region free set has A, B and C
+	RegionCodes    []string
+	RuntimeMinutes int
+}
+
+type DiscAudioTrack struct {
+	Language string
+	Format   string
 }
 
 // ==============================================================================================================
@@ -100,6 +232,11 @@ type PlexTVShow struct {
 	FirstEpisodeAired time.Time
 	LastEpisodeAired  time.Time
 	Seasons           []PlexTVSeason
+	// ViewCount is the number of episode plays
+	ViewCount      int
+	LastViewedAt   time.Time
+	Rating         float64
+	AudienceRating float64
 }
 
 type PlexTVSeason struct {
@@ -112,10 +249,22 @@ type PlexTVSeason struct {
 	Episodes          []PlexTVEpisode
 }
 
+// SeasonQuality is the episode level resolution breakdown of a season.
+type SeasonQuality struct {
+	// Counts is the number of episodes at each resolution
+	Counts map[string]int
+	// LowerEpisodes are the episodes below the season's best resolution
+	LowerEpisodes []PlexTVEpisode
+	Mixed         bool
+}
+
 type PlexTVEpisode struct {
 	Title           string
 	Index           string
 	Resolution      string
+	VideoCodec      string
+	AudioCodec      string
+	FileSize        int64
 	DateAdded       time.Time
 	OriginallyAired time.Time
 }
@@ -139,6 +288,7 @@ type TVSeasonResult struct {
 	Format      string
 	BoxSet      bool
 	ReleaseDate time.Time
+	Price       Price
 }
 
 // ==============================================================================================================
@@ -173,6 +323,34 @@ type MusicAlbumSearchResult struct {
 	ID             string
 	URL            string
 	Year           string
+	// Type is one of AlbumTypes
+	Type string
+	// Formats, Labels and the marketplace are only known to Discogs. LowestPrice is in the currency of the Discogs
+	// account.
+	Formats     []string
+	Labels      []string
+	ForSale     int
+	LowestPrice float64
+}
+
+// ParseAlbumTypes reads release types from form values or a comma separated flag, no types means studio albums.
+func ParseAlbumTypes(values []string) (albumTypes []string, err error) {
+	for _, value := range values {
+		for _, albumType := range strings.Split(value, ",") {
+			albumType = strings.ToLower(strings.TrimSpace(albumType))
+			if albumType == "" || slices.Contains(albumTypes, albumType) {
+				continue
+			}
+			if !slices.Contains(AlbumTypes, albumType) {
+				return nil, fmt.Errorf("types: unknown album type %q, use one of %s", albumType, strings.Join(AlbumTypes, ", "))
+			}
+			albumTypes = append(albumTypes, albumType)
+		}
+	}
+	if len(albumTypes) == 0 {
+		albumTypes = []string{AlbumTypeAlbum}
+	}
+	return albumTypes, nil
 }
 
 type MusicSimilarArtistResult struct {
@@ -180,6 +358,14 @@ type MusicSimilarArtistResult struct {
 	URL             string
 	Owned           bool
 	SimilarityCount int
+	// SimilarTo are the plex artists that list this artist as related
+	SimilarTo []string
+}
+
+// MusicSimilarArtistResponse is the artists a provider lists as related to a plex artist.
+type MusicSimilarArtistResponse struct {
+	PlexMusicArtist
+	SimilarArtists []MusicSimilarArtistResult
 }
 
 // ==============================================================================================================
@@ -195,6 +381,100 @@ type PlexPlaylist struct {
 	RatingKey string
 }
 
+// PlexLookupSource is a collection, label, genre or decade of a library.
+type PlexLookupSource struct {
+	Field string
+	Title string
+	Key   string
+}
+
+// Value is how the lookup source is sent by the web forms, eg "collection:123".
+func (s PlexLookupSource) Value() string {
+	return s.Field + ":" + s.Key
+}
+
+// MediaServer is a library the lookups compare against, eg Plex, Jellyfin or Emby.
+type MediaServer interface {
+	Name() string
+	Libraries(ctx context.Context) ([]PlexLibrary, error)
+	Movies(ctx context.Context, libraryID string) ([]PlexMovie, error)
+	TV(ctx context.Context, libraryID string) ([]PlexTVShow, error)
+	MusicArtists(ctx context.Context, libraryID string) ([]PlexMusicArtist, error)
+}
+
+// EpisodeGuide is a source of what episodes of a TV show have aired, eg TVmaze, TVDB or TMDB.
+type EpisodeGuide interface {
+	Name() string
+	Episodes(ctx context.Context, show *PlexTVShow) ([]GuideEpisode, error)
+}
+
+type GuideEpisode struct {
+	Season int
+	Number int
+	Title  string
+	Aired  time.Time
+}
+
+// MissingEpisodesResponse compares a Plex TV show with an episode guide.
+type MissingEpisodesResponse struct {
+	PlexTVShow
+	Guide string
+	// MissingEpisodes are aired episodes of seasons that are in Plex
+	MissingEpisodes []GuideEpisode
+	// MissingSeasons are aired seasons that are not in Plex at all
+	MissingSeasons []int
+	Err            error
+}
+
+// AlbumTrack is a track of an album, Disc is 1 on single disc albums.
+type AlbumTrack struct {
+	Disc   int
+	Number int
+	Title  string
+}
+
+// TrackList is a source of album tracklists, eg Spotify or MusicBrainz. The album ID is the provider's.
+type TrackList interface {
+	Name() string
+	AlbumTracks(ctx context.Context, albumID string) ([]AlbumTrack, error)
+}
+
+// IncompleteAlbumResponse compares the tracks of a Plex album with a provider's tracklist.
+type IncompleteAlbumResponse struct {
+	Artist string
+	PlexMusicAlbum
+	// Album is the provider's copy of the album
+	Album          MusicAlbumSearchResult
+	TrackList      string
+	PlexTracks     int
+	ProviderTracks int
+	MissingTracks  []AlbumTrack
+	Err            error
+}
+
+// AudioQuality is the audio of a track, or of an album made from the qualities of its tracks. Bitrate is in kbps
+// and SampleRate in Hz, zero when the media server does not list them.
+type AudioQuality struct {
+	Codec      string `json:"codec"`
+	Bitrate    int    `json:"bitrate,omitempty"`
+	BitDepth   int    `json:"bitDepth,omitempty"`
+	SampleRate int    `json:"sampleRate,omitempty"`
+	Lossless   bool   `json:"lossless"`
+}
+
+// PlexTrackQuality is the audio quality of one track of an album.
+type PlexTrackQuality struct {
+	AlbumRatingKey string
+	AudioQuality
+}
+
+// ReleaseFormats is a source of the physical formats an album was released on, eg CD or vinyl from MusicBrainz or
+// Discogs.
+type ReleaseFormats interface {
+	Name() string
+	AlbumFormats(ctx context.Context, artist, album string) ([]string, error)
+}
+
 // JobTracker interface for managing background job progress and cancellation.
 type JobTracker interface {
 	CreateJob(jobType string, total int) (string, context.Context)
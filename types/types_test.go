@@ -0,0 +1,44 @@
+package types
+
+import "testing"
+
+func TestLowestResolution(t *testing.T) {
+	tests := []struct {
+		name                 string
+		resolutions          []string
+		wantLowestResolution string
+	}{
+		{
+			name:                 "SD is lowest",
+			resolutions:          []string{PlexResolutionSD, PlexResolution240, PlexResolution720, PlexResolution1080},
+			wantLowestResolution: PlexResolutionSD,
+		},
+		{
+			name:                 "4k is lowest",
+			resolutions:          []string{PlexResolution4K, PlexResolution4K},
+			wantLowestResolution: PlexResolution4K,
+		},
+		{
+			name:                 "unknown resolutions are skipped",
+			resolutions:          []string{"", "2k", PlexResolution1080},
+			wantLowestResolution: PlexResolution1080,
+		},
+		{
+			name:                 "none known",
+			resolutions:          []string{""},
+			wantLowestResolution: "",
+		},
+		{
+			name:                 "720 is lowest",
+			resolutions:          []string{PlexResolution720, PlexResolution1080, PlexResolution720, PlexResolution1080},
+			wantLowestResolution: PlexResolution720,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if gotLowestResolution := LowestResolution(tt.resolutions); gotLowestResolution != tt.wantLowestResolution {
+				t.Errorf("LowestResolution() = %v, want %v", gotLowestResolution, tt.wantLowestResolution)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultAPITimeout = 10 * time.Second
+
+// apiHTTPClient is shared so connections are reused, each attempt has its own timeout
+var apiHTTPClient = &http.Client{}
+
+// APIClient gets JSON from a provider's web API, waiting out rate limits a few times before giving up.
+type APIClient struct {
+	// Name prefixes errors, eg "tvmaze"
+	Name string
+	// Header is sent with every request, eg a User-Agent or token
+	Header http.Header
+	// Limiter, when set, is waited on before every attempt
+	Limiter *Limiter
+	// Timeout is for each attempt, 10 seconds when unset
+	Timeout time.Duration
+	// MaxAttempts is how many times a rate limited request is made, once when unset
+	MaxAttempts int
+	// RateLimitWait is the pause after a rate limit without a usable Retry-After, it grows with each attempt
+	RateLimitWait time.Duration
+	// RateLimited spots rate limit errors an API sends in the body rather than as a 429
+	RateLimited func(body []byte) bool
+}
+
+// StatusError is a response that was not 200 OK, Body holds any error the API explained it with.
+type StatusError struct {
+	Name       string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: status code not OK: %d", e.Name, e.StatusCode)
+}
+
+// Get returns the body of a 200 OK response, other statuses are a *StatusError.
+func (c *APIClient) Get(ctx context.Context, inputURL string) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultAPITimeout
+	}
+	for attempt := 1; ; attempt++ {
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		resp, body, err := c.do(ctx, inputURL, timeout)
+		if err != nil {
+			return nil, err
+		}
+		rateLimited := resp.StatusCode == http.StatusTooManyRequests || (c.RateLimited != nil && c.RateLimited(body))
+		if rateLimited && attempt < c.MaxAttempts {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(RetryAfter(resp.Header.Get("Retry-After"), attempt, c.RateLimitWait)):
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, &StatusError{Name: c.Name, StatusCode: resp.StatusCode, Body: body}
+		}
+		return body, nil
+	}
+}
+
+// do makes one attempt, reading the whole body before its timeout.
+func (c *APIClient) do(ctx context.Context, inputURL string, timeout time.Duration) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, inputURL, http.NoBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: unable to create request: %w", c.Name, err)
+	}
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
+	resp, err := apiHTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: request failed: %w", c.Name, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: unable to read response: %w", c.Name, err)
+	}
+	return resp, body, nil
+}
+
+// GetJSON decodes a 200 OK response into target.
+func (c *APIClient) GetJSON(ctx context.Context, inputURL string, target any) error {
+	body, err := c.Get(ctx, inputURL)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("%s: unable to parse response: %w", c.Name, err)
+	}
+	return nil
+}
+
+// RetryAfter is how long to wait after a rate limit, the Retry-After seconds when the API sends them otherwise wait
+// times the attempt.
+func RetryAfter(header string, attempt int, wait time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Duration(attempt) * wait
+}
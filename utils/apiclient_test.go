@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAPIClientGetJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		// statuses are answered in turn, the last one repeats
+		statuses     []int
+		body         string
+		wantRequests int32
+		wantStatus   int
+		wantErr      bool
+	}{
+		{name: "ok", statuses: []int{http.StatusOK}, body: `{"id":1}`, wantRequests: 1},
+		{name: "rate limited then ok", statuses: []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			body: `{"id":1}`, wantRequests: 3},
+		{name: "rate limited every attempt", statuses: []int{http.StatusTooManyRequests}, body: `{}`, wantRequests: 3,
+			wantStatus: http.StatusTooManyRequests, wantErr: true},
+		{name: "rate limited in the body", statuses: []int{http.StatusOK}, body: `{"error":4}`, wantRequests: 3},
+		{name: "not found", statuses: []int{http.StatusNotFound}, body: `{}`, wantRequests: 1,
+			wantStatus: http.StatusNotFound, wantErr: true},
+		{name: "not json", statuses: []int{http.StatusOK}, body: `<html>`, wantRequests: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("User-Agent") != "plex-lookup" {
+					t.Errorf("User-Agent = %q, want the client header", r.Header.Get("User-Agent"))
+				}
+				request := int(requests.Add(1))
+				w.WriteHeader(tt.statuses[min(request, len(tt.statuses))-1])
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+			client := &APIClient{
+				Name:          "test",
+				Header:        http.Header{"User-Agent": {"plex-lookup"}},
+				MaxAttempts:   3,
+				RateLimitWait: time.Millisecond,
+				RateLimited: func(body []byte) bool {
+					return strings.Contains(string(body), `"error":4`)
+				},
+			}
+			var target struct {
+				ID int `json:"id"`
+			}
+			err := client.GetJSON(t.Context(), server.URL, &target)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var statusErr *StatusError
+			if tt.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus) {
+				t.Errorf("GetJSON() error = %v, want the status %d", err, tt.wantStatus)
+			}
+			if requests.Load() != tt.wantRequests {
+				t.Errorf("GetJSON() made %d requests, want %d", requests.Load(), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	wait := 2 * time.Second
+	tests := []struct {
+		name    string
+		header  string
+		attempt int
+		want    time.Duration
+	}{
+		{name: "seconds", header: "7", attempt: 1, want: 7 * time.Second},
+		{name: "missing", header: "", attempt: 1, want: wait},
+		{name: "unparsable grows", header: "soon", attempt: 3, want: 3 * wait},
+		{name: "zero", header: "0", attempt: 2, want: 2 * wait},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RetryAfter(tt.header, tt.attempt, wait); got != tt.want {
+				t.Errorf("RetryAfter(%q, %d) = %s, want %s", tt.header, tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// BaseURL is a provider endpoint that the settings page can change while lookups are reading it.
+type BaseURL struct {
+	defaultURL string
+	current    atomic.Pointer[string]
+}
+
+// NewBaseURL returns an endpoint set to defaultURL.
+func NewBaseURL(defaultURL string) *BaseURL {
+	u := &BaseURL{defaultURL: defaultURL}
+	u.Set("")
+	return u
+}
+
+// Set points the endpoint at a mirror, proxy or fixture server. An empty url restores the default.
+func (u *BaseURL) Set(baseURL string) {
+	if baseURL == "" {
+		baseURL = u.defaultURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	u.current.Store(&baseURL)
+}
+
+// String returns the current endpoint, without a trailing slash.
+func (u *BaseURL) String() string {
+	return *u.current.Load()
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBaseURL(t *testing.T) {
+	u := NewBaseURL("https://www.blu-ray.com")
+	tests := []struct {
+		name string
+		set  string
+		want string
+	}{
+		{name: "mirror", set: "http://localhost:8080/bluray/", want: "http://localhost:8080/bluray"},
+		{name: "default", set: "", want: "https://www.blu-ray.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u.Set(tt.set)
+			if got := u.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseURLConcurrent(t *testing.T) {
+	// run with -race, settings are saved while lookups read the url
+	u := NewBaseURL("https://www.blu-ray.com")
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			u.Set("http://localhost:8080")
+		}()
+		go func() {
+			defer wg.Done()
+			_ = u.String()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket, it lets burst requests through at once then one every interval.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewLimiter returns a full bucket of burst tokens that refills one token each interval.
+func NewLimiter(interval time.Duration, burst int) *Limiter {
+	return &Limiter{interval: interval, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until the request may be made, or the context is cancelled.
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+float64(now.Sub(l.last))/float64(l.interval))
+	l.last = now
+	l.tokens--
+	delay := time.Duration(-l.tokens * float64(l.interval))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// give the token back, the request was not made
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
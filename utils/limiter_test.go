@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	interval := 20 * time.Millisecond
+	l := NewLimiter(interval, 2)
+	start := time.Now()
+	for range 4 {
+		if err := l.Wait(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the burst goes at once, the next two wait an interval each
+	if elapsed := time.Since(start); elapsed < 2*interval-5*time.Millisecond {
+		t.Errorf("4 requests took %v, want at least %v", elapsed, 2*interval)
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := NewLimiter(time.Hour, 0).Wait(ctx); err == nil {
+		t.Error("Wait() expected an error for a cancelled context")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/rainycape/unidecode"
 
@@ -124,3 +125,20 @@ func SanitizedAlbumTitle(title string) string {
 
 	return title
 }
+
+// NormalisedArtistName folds case, accents, punctuation, "&" and a leading "the", so "Beatles" matches "The Beatles"
+// and "Beyonce" matches "Beyoncé". A name of only punctuation, like "!!!", is kept as it is.
+func NormalisedArtistName(name string) string {
+	folded := strings.ToLower(unidecode.Unidecode(name))
+	folded = strings.ReplaceAll(folded, "&", " and ")
+	words := strings.FieldsFunc(folded, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return strings.ToLower(strings.TrimSpace(name))
+	}
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	return strings.Join(words, "")
+}
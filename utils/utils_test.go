@@ -170,3 +170,25 @@ func TestSanitizedAlbumTitle(t *testing.T) {
 		}
 	}
 }
+
+func TestNormalisedArtistName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "The Beatles", want: "beatles"},
+		{name: "Beyoncé", want: "beyonce"},
+		{name: "R.E.M.", want: "rem"},
+		{name: "Simon & Garfunkel", want: "simonandgarfunkel"},
+		{name: "The The", want: "the"},
+		{name: "Sigur Rós", want: "sigurros"},
+		{name: " !!! ", want: "!!!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalisedArtistName(tt.name); got != tt.want {
+				t.Errorf("NormalisedArtistName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
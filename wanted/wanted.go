@@ -0,0 +1,228 @@
+package wanted
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+const (
+	listFileName = "wanted.json"
+	TypeMovie    = "movie"
+	TypeShow     = "show"
+)
+
+// Item is a Plex title with a better disc available.
+type Item struct {
+	RatingKey  string
+	Type       string
+	Title      string
+	Year       string
+	Resolution string
+	// Formats are the disc formats that would be an upgrade
+	Formats []string
+	// Provider is the disc site the upgrade was found on, eg amazon.ProviderName
+	Provider string
+	AddedAt  time.Time
+}
+
+// List is the persisted wanted / upgrade list, keyed by Plex rating key.
+type List struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]Item
+}
+
+// DefaultPath is where the wanted list is kept when no file is configured.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return listFileName
+	}
+	return filepath.Join(dir, "plex-lookup", listFileName)
+}
+
+// Load reads the wanted list from path. A missing file gives an empty list that is created on the first Save.
+func Load(path string) (*List, error) {
+	if path == "" {
+		path = DefaultPath()
+	}
+	list := &List{path: path, items: make(map[string]Item)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return list, nil
+	}
+	if err != nil {
+		return list, fmt.Errorf("wanted: unable to read list: %w", err)
+	}
+	if err := json.Unmarshal(data, &list.items); err != nil {
+		return list, fmt.Errorf("wanted: unable to parse list: %w", err)
+	}
+	return list, nil
+}
+
+// Add adds or replaces an item.
+func (l *List) Add(item Item) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items[item.RatingKey] = item
+}
+
+// Remove removes an item by rating key, and any item of the same type with the same title and year, returning the
+// removed items. A new rip can be added to Plex as a new item, so the rating key alone is not enough.
+func (l *List) Remove(itemType, ratingKey, title, year string) (removed []Item) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, item := range l.items {
+		sameTitle := item.Type == itemType && strings.EqualFold(item.Title, title) && item.Year == year
+		if key == ratingKey || (title != "" && sameTitle) {
+			removed = append(removed, item)
+			delete(l.items, key)
+		}
+	}
+	return removed
+}
+
+// Get returns an item by rating key.
+func (l *List) Get(ratingKey string) (item Item, found bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	item, found = l.items[ratingKey]
+	return item, found
+}
+
+// Items returns every item, sorted by title.
+func (l *List) Items() (items []Item) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, item := range l.items {
+		items = append(items, item)
+	}
+	slices.SortFunc(items, func(a, b Item) int {
+		return strings.Compare(a.Title, b.Title)
+	})
+	return items
+}
+
+// Save writes the list to disk, replacing the previous file in one step.
+func (l *List) Save() error {
+	// concurrent jobs save through the same temporary file, so the whole save holds the lock
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data, err := json.MarshalIndent(l.items, "", "  ")
+	if err != nil {
+		return fmt.Errorf("wanted: unable to encode list: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o750); err != nil {
+		return fmt.Errorf("wanted: unable to create list directory: %w", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("wanted: unable to write list: %w", err)
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// UpdateMovies adds the movies that have a better disc available on the provider, and removes the ones the provider
+// no longer has an upgrade for. Items found on another provider, or whose search failed, are kept.
+func (l *List) UpdateMovies(searchResults []types.MovieSearchResponse, provider string) {
+	for i := range searchResults {
+		switch item, ok := FromMovie(&searchResults[i]); {
+		case ok:
+			item.Provider = provider
+			l.Add(item)
+		case !searchResults[i].SearchFailed:
+			l.removeFromProvider(searchResults[i].RatingKey, provider)
+		}
+	}
+}
+
+// UpdateTV adds the shows that have a better disc available on the provider, and removes the ones the provider no
+// longer has an upgrade for. Items found on another provider, or whose search failed, are kept.
+func (l *List) UpdateTV(searchResults []types.TVSearchResponse, provider string) {
+	for i := range searchResults {
+		switch item, ok := FromTVShow(&searchResults[i]); {
+		case ok:
+			item.Provider = provider
+			l.Add(item)
+		case !searchResults[i].SearchFailed:
+			l.removeFromProvider(searchResults[i].RatingKey, provider)
+		}
+	}
+}
+
+// removeFromProvider removes an item that was found on the provider.
+func (l *List) removeFromProvider(ratingKey, provider string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if item, found := l.items[ratingKey]; found && item.Provider == provider {
+		delete(l.items, ratingKey)
+	}
+}
+
+// FromMovie returns a wanted item when a best match disc is better than the Plex copy.
+func FromMovie(result *types.MovieSearchResponse) (item Item, ok bool) {
+	var formats []string
+	for i := range result.MovieSearchResults {
+		disc := &result.MovieSearchResults[i]
+		if disc.BestMatch && isUpgrade(disc.Format, result.Resolution) && !slices.Contains(formats, disc.Format) {
+			formats = append(formats, disc.Format)
+		}
+	}
+	if len(formats) == 0 {
+		return item, false
+	}
+	return Item{RatingKey: result.RatingKey, Type: TypeMovie, Title: result.Title, Year: result.Year,
+		Resolution: result.Resolution, Formats: formats, AddedAt: time.Now()}, true
+}
+
+// FromTVShow returns a wanted item when a best match season disc is better than the lowest resolution of that
+// season in Plex, or is a season Plex does not have.
+func FromTVShow(result *types.TVSearchResponse) (item Item, ok bool) {
+	plexSeasons := make(map[int]string)
+	for i := range result.Seasons {
+		plexSeasons[result.Seasons[i].Number] = result.Seasons[i].LowestResolution
+	}
+	var formats []string
+	for i := range result.TVSearchResults {
+		if !result.TVSearchResults[i].BestMatch {
+			continue
+		}
+		for _, season := range result.TVSearchResults[i].Seasons {
+			// box sets and unnumbered seasons cannot be matched to a plex season
+			if season.BoxSet || season.Number <= 0 {
+				continue
+			}
+			resolution, inPlex := plexSeasons[season.Number]
+			if (!inPlex || isUpgrade(season.Format, resolution)) && !slices.Contains(formats, season.Format) {
+				formats = append(formats, season.Format)
+			}
+		}
+	}
+	if len(formats) == 0 {
+		return item, false
+	}
+	return Item{RatingKey: result.RatingKey, Type: TypeShow, Title: result.Title, Year: result.Year,
+		Formats: formats, AddedAt: time.Now()}, true
+}
+
+// isUpgrade reports whether a disc format is better than a Plex resolution.
+func isUpgrade(format, resolution string) bool {
+	switch format {
+	case types.Disk4K:
+		return resolution != types.PlexResolution4K
+	case types.DiskBluray:
+		return resolution != types.PlexResolution4K && resolution != types.PlexResolution1080
+	default:
+		return false
+	}
+}
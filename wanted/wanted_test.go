@@ -0,0 +1,93 @@
+package wanted
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestFromMovie(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution string
+		formats    []string
+		wantOK     bool
+		want       []string
+	}{
+		{name: "sd copy", resolution: types.PlexResolutionSD, formats: []string{types.DiskBluray, types.Disk4K}, wantOK: true, want: []string{types.DiskBluray, types.Disk4K}},
+		{name: "1080 copy", resolution: types.PlexResolution1080, formats: []string{types.DiskBluray, types.Disk4K}, wantOK: true, want: []string{types.Disk4K}},
+		{name: "4k copy", resolution: types.PlexResolution4K, formats: []string{types.DiskBluray, types.Disk4K}},
+		{name: "only dvd", resolution: types.PlexResolutionSD, formats: []string{types.DiskDVD}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := types.MovieSearchResponse{PlexMovie: types.PlexMovie{Title: "Cats", RatingKey: "1", Resolution: tt.resolution}}
+			for _, format := range tt.formats {
+				result.MovieSearchResults = append(result.MovieSearchResults, types.MovieSearchResult{Format: format, BestMatch: true})
+			}
+			// results that are not the best match never count
+			result.MovieSearchResults = append(result.MovieSearchResults, types.MovieSearchResult{Format: types.Disk4K})
+			item, ok := FromMovie(&result)
+			if ok != tt.wantOK {
+				t.Fatalf("FromMovie() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && len(item.Formats) != len(tt.want) {
+				t.Errorf("FromMovie() formats = %v, want %v", item.Formats, tt.want)
+			}
+		})
+	}
+}
+
+func TestListRemoveAndSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wanted.json")
+	list, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.Add(Item{RatingKey: "1", Type: TypeMovie, Title: "Cats", Year: "1998"})
+	list.Add(Item{RatingKey: "2", Type: TypeMovie, Title: "Cats", Year: "2019"})
+	list.Add(Item{RatingKey: "3", Type: TypeShow, Title: "Friends", Year: "1994"})
+	// a new rip gets a new rating key, it still matches on title and year
+	if removed := list.Remove(TypeMovie, "99", "cats", "2019"); len(removed) != 1 {
+		t.Errorf("Remove() removed %d items, want 1", len(removed))
+	}
+	if err := list.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := loaded.Items()
+	if len(items) != 2 || items[0].RatingKey != "1" || items[1].RatingKey != "3" {
+		t.Errorf("Items() after reload = %v", items)
+	}
+}
+
+func TestUpdateMovies(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		result   types.MovieSearchResponse
+		wantKept bool
+	}{
+		{name: "no upgrade on the same provider", provider: "Amazon", wantKept: false},
+		{name: "no upgrade on another provider", provider: "Cinema Paradiso", wantKept: true},
+		{name: "search failed", provider: "Amazon", result: types.MovieSearchResponse{SearchFailed: true}, wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := Load(filepath.Join(t.TempDir(), "wanted.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			list.Add(Item{RatingKey: "1", Type: TypeMovie, Title: "Cats", Year: "1998", Provider: "Amazon"})
+			tt.result.PlexMovie = types.PlexMovie{Title: "Cats", Year: "1998", RatingKey: "1", Resolution: types.PlexResolution4K}
+			list.UpdateMovies([]types.MovieSearchResponse{tt.result}, tt.provider)
+			if _, found := list.Get("1"); found != tt.wantKept {
+				t.Errorf("UpdateMovies() kept = %v, want %v", found, tt.wantKept)
+			}
+		})
+	}
+}
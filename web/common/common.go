@@ -0,0 +1,185 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/tphoney/plex-lookup/health"
+	"github.com/tphoney/plex-lookup/importlist"
+	"github.com/tphoney/plex-lookup/mediaserver"
+	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/prices"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+// RenderParserWarning warns the user when every page in the search batch came back without any results markup.
+func RenderParserWarning(status health.ParserStatus) string {
+	if !status.LikelyBroken {
+		return ""
+	}
+	return fmt.Sprintf(`<article class="container"><strong>%s parser likely broken:</strong> all %d search pages were structurally empty, the site layout may have changed.</article>`,
+		html.EscapeString(status.Provider), status.Searches)
+}
+
+// PricedDisc is a best match disc, or one season of it, with the price scraped from its product page.
+type PricedDisc struct {
+	Title string
+	URL   string
+	Price types.Price
+}
+
+// MovieDiscs lists the best match discs of a movie.
+func MovieDiscs(searchResult *types.MovieSearchResponse) (discs []PricedDisc) {
+	for i := range searchResult.MovieSearchResults {
+		result := &searchResult.MovieSearchResults[i]
+		if result.BestMatch {
+			discs = append(discs, PricedDisc{Title: fmt.Sprintf("%s - %s", result.FoundTitle, result.Format), URL: result.URL, Price: result.Price})
+		}
+	}
+	return discs
+}
+
+// TVDiscs lists the seasons of the best match discs of a show.
+func TVDiscs(searchResult *types.TVSearchResponse) (discs []PricedDisc) {
+	for i := range searchResult.TVSearchResults {
+		result := &searchResult.TVSearchResults[i]
+		if !result.BestMatch {
+			continue
+		}
+		for _, season := range result.Seasons {
+			discs = append(discs, PricedDisc{
+				Title: fmt.Sprintf("%s season %d - %s", result.FoundTitle, season.Number, season.Format), URL: season.URL, Price: season.Price})
+		}
+	}
+	return discs
+}
+
+// RecordPrices adds the price of every disc to the price history. It does nothing without a history.
+func RecordPrices[T any](history *prices.History, searchResults []T, discs func(*T) []PricedDisc) {
+	if history == nil {
+		return
+	}
+	now := time.Now()
+	for i := range searchResults {
+		for _, disc := range discs(&searchResults[i]) {
+			history.Record(disc.URL, disc.Price, now)
+		}
+	}
+	if err := history.Save(); err != nil {
+		slog.Error("Failed to save price history", "error", err)
+	}
+}
+
+// FilterTargetPrice keeps the results that have a disc priced at or below the target, with an alert for each disc.
+// When the target has a currency, discs priced in another currency are not compared.
+func FilterTargetPrice[T any](searchResults []T, target types.Price, discs func(*T) []PricedDisc) (filtered []T, alerts []prices.Alert) {
+	for i := range searchResults {
+		matched := false
+		for _, disc := range discs(&searchResults[i]) {
+			if target.Currency != "" && disc.Price.Currency != target.Currency {
+				continue
+			}
+			if disc.Price.Amount > 0 && disc.Price.Amount <= target.Amount {
+				alerts = append(alerts, prices.Alert{Title: disc.Title, URL: disc.URL, Price: disc.Price, Target: target.Amount})
+				matched = true
+			}
+		}
+		if matched {
+			filtered = append(filtered, searchResults[i])
+		}
+	}
+	return filtered, alerts
+}
+
+// NotifyPriceAlerts posts the alerts that were not sent before at the same or a lower price, and remembers them in
+// the price history.
+func NotifyPriceAlerts(ctx context.Context, history *prices.History, webhookURL string, alerts []prices.Alert) {
+	if webhookURL == "" {
+		return
+	}
+	fresh := history.Unalerted(alerts)
+	if err := prices.Notify(ctx, webhookURL, fresh); err != nil {
+		slog.Error("Failed to send price alert", "error", err)
+		return
+	}
+	if history == nil || len(fresh) == 0 {
+		return
+	}
+	history.MarkAlerted(fresh, time.Now())
+	if err := history.Save(); err != nil {
+		slog.Error("Failed to save price history", "error", err)
+	}
+}
+
+// RenderPriceAlerts counts the discs at or below the target price, nothing is shown when no target was applied.
+func RenderPriceAlerts(alerts []prices.Alert, target types.Price) string {
+	if target.Amount <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(`<article class="container"><strong>%d discs at or below your target price of %s</strong></article>`,
+		len(alerts), html.EscapeString(prices.Format(target)))
+}
+
+// WriteBack adds the checked results of a form made by RenderWriteBack to a Plex label or collection, or creates a
+// playlist of them. The noun names the titles in the reply, eg "movies".
+func WriteBack(w http.ResponseWriter, r *http.Request, config *types.Configuration, libraryID, itemType, noun string) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) //nolint:mnd // 1 MB limit
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	if !mediaserver.IsPlex(config) {
+		fmt.Fprint(w, `<strong>Write back is only available for Plex</strong>`)
+		return
+	}
+	// imported titles are not in plex
+	ratingKeys := slices.DeleteFunc(r.Form["ratingKey"], importlist.IsImported)
+	target := r.FormValue("writeBack")
+	err := plex.WriteBack(config.PlexIP, config.PlexToken, libraryID, itemType, target, r.FormValue("writeBackName"), ratingKeys)
+	if err != nil {
+		slog.Error("Failed to write back to Plex", "target", target, "error", err)
+		fmt.Fprintf(w, `<strong>Failed to write back to Plex:</strong> %s`, html.EscapeString(err.Error()))
+		return
+	}
+	fmt.Fprintf(w, `Added %d %s to the Plex %s %q`, len(ratingKeys), noun, html.EscapeString(target), html.EscapeString(r.FormValue("writeBackName")))
+}
+
+// RenderWriteBack wraps the results in a form, so the checked titles can be written back to Plex.
+func RenderWriteBack(endpoint, results string) string {
+	return fmt.Sprintf(`<form hx-post=%q hx-target="#writeback">%s
+		<fieldset role="group">
+			<select name="writeBack" aria-label="Write back to Plex">
+				<option value="%s" selected>Add a label</option>
+				<option value="%s">Add to a collection</option>
+				<option value="%s">Create a playlist</option>
+			</select>
+			<input type="text" name="writeBackName" placeholder="eg upgrade-4k" required>
+			<button type="submit">Write checked titles to Plex</button>
+		</fieldset>
+		<div id="writeback"></div></form>`, endpoint, results, plex.WriteBackLabel, plex.WriteBackCollection, plex.WriteBackPlaylist)
+}
+
+// ImportedList reads the optional uploaded export, found is false when no file was uploaded.
+func ImportedList(r *http.Request) (list importlist.List, found bool, err error) {
+	file, header, err := r.FormFile("importFile")
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+		return list, false, nil
+	}
+	if err != nil {
+		return list, false, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, importlist.MaxSize))
+	if err != nil {
+		return list, false, err
+	}
+	list, err = importlist.Parse(header.Filename, data)
+	return list, true, err
+}
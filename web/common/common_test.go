@@ -0,0 +1,123 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/health"
+	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/prices"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestRenderParserWarning(t *testing.T) {
+	tests := []struct {
+		name   string
+		status health.ParserStatus
+		want   string
+	}{
+		{name: "healthy", status: health.ParserStatus{Provider: "Amazon", Searches: 6, EmptyPages: 2}, want: ""},
+		{name: "broken", status: health.ParserStatus{Provider: "Amazon", Searches: 6, EmptyPages: 6, LikelyBroken: true}, want: "Amazon parser likely broken"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RenderParserWarning(tt.status)
+			if (tt.want == "" && got != "") || !strings.Contains(got, tt.want) {
+				t.Errorf("RenderParserWarning() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterTargetPrice(t *testing.T) {
+	movies := []types.MovieSearchResponse{
+		{
+			PlexMovie: types.PlexMovie{Title: "Cats"},
+			MovieSearchResults: []types.MovieSearchResult{
+				{FoundTitle: "Cats", Format: types.DiskBluray, BestMatch: true, Price: types.Price{Amount: 9.99, Currency: "GBP"}},
+				{FoundTitle: "Cats", BestMatch: false, Price: types.Price{Amount: 1.99, Currency: "GBP"}},
+			},
+		},
+		{
+			PlexMovie:          types.PlexMovie{Title: "Elf"},
+			MovieSearchResults: []types.MovieSearchResult{{FoundTitle: "Elf", BestMatch: true, Price: types.Price{Amount: 14.99, Currency: "GBP"}}},
+		},
+		{
+			PlexMovie:          types.PlexMovie{Title: "Gummo"},
+			MovieSearchResults: []types.MovieSearchResult{{FoundTitle: "Gummo", BestMatch: true}},
+		},
+		{
+			PlexMovie:          types.PlexMovie{Title: "Heat"},
+			MovieSearchResults: []types.MovieSearchResult{{FoundTitle: "Heat", BestMatch: true, Price: types.Price{Amount: 5.99, Currency: "USD"}}},
+		},
+	}
+	filtered, alerts := FilterTargetPrice(movies, types.Price{Amount: 10, Currency: "GBP"}, MovieDiscs)
+	if len(filtered) != 1 || filtered[0].Title != "Cats" {
+		t.Errorf("FilterTargetPrice() kept %v, want only Cats", filtered)
+	}
+	if len(alerts) != 1 || alerts[0].Price.Amount != 9.99 || alerts[0].Title != "Cats - Blu-ray" {
+		t.Errorf("FilterTargetPrice() alerts = %v", alerts)
+	}
+
+	shows := []types.TVSearchResponse{{
+		PlexTVShow: types.PlexTVShow{Title: "Friends"},
+		TVSearchResults: []types.TVSearchResult{{FoundTitle: "Friends", BestMatch: true, Seasons: []types.TVSeasonResult{
+			{Number: 1, Format: types.DiskBluray, Price: types.Price{Amount: 12.5, Currency: "GBP"}},
+			{Number: 2, Format: types.DiskBluray, Price: types.Price{Amount: 7.5, Currency: "GBP"}},
+		}}},
+	}}
+	filteredShows, alerts := FilterTargetPrice(shows, types.Price{Amount: 10}, TVDiscs)
+	if len(filteredShows) != 1 || len(alerts) != 1 || alerts[0].Title != "Friends season 2 - Blu-ray" {
+		t.Errorf("FilterTargetPrice() TV = %v, alerts = %v", filteredShows, alerts)
+	}
+}
+
+func TestRenderPriceAlerts(t *testing.T) {
+	alerts := []prices.Alert{{Title: "Cats - Blu-ray", Price: types.Price{Amount: 9.99, Currency: "GBP"}, Target: 10}}
+	if got := RenderPriceAlerts(alerts, types.Price{Amount: 10, Currency: "GBP"}); !strings.Contains(got, "1 discs at or below your target price of GBP 10.00") {
+		t.Errorf("RenderPriceAlerts() = %s", got)
+	}
+	// cinema paradiso and region comparisons do not apply the target
+	if got := RenderPriceAlerts(nil, types.Price{}); got != "" {
+		t.Errorf("RenderPriceAlerts() without an applied target = %s, want nothing", got)
+	}
+}
+
+func TestWriteBackNotPlex(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/movieswriteback", strings.NewReader("writeBack=label&writeBackName=4k&ratingKey=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	WriteBack(w, req, &types.Configuration{MediaServer: "jellyfin"}, "1", plex.ItemTypeMovie, "movies")
+	if !strings.Contains(w.Body.String(), "only available for Plex") {
+		t.Errorf("WriteBack() = %q, want a Plex only message", w.Body.String())
+	}
+}
+
+func TestImportedList(t *testing.T) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("importFile", "shelf.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(file, "Title,Year\nCats,2019\nElf,2003\n")
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/moviesprocess", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	list, found, err := ImportedList(req)
+	if err != nil || !found || len(list.Movies) != 2 {
+		t.Errorf("ImportedList() = %+v, %v, error = %v", list, found, err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/moviesprocess", strings.NewReader("playlist=all"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, found, err = ImportedList(req); found || err != nil {
+		t.Errorf("ImportedList() without a file found = %v, error = %v", found, err)
+	}
+}
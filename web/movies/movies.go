@@ -1,6 +1,8 @@
 package movies
 
 import (
+	"cmp"
+	"context"
 	_ "embed"
 	"fmt"
 	"html"
@@ -8,13 +10,23 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/tphoney/plex-lookup/amazon"
 	"github.com/tphoney/plex-lookup/cinemaparadiso"
+	"github.com/tphoney/plex-lookup/health"
+	"github.com/tphoney/plex-lookup/importlist"
+	"github.com/tphoney/plex-lookup/mediaserver"
 	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/prices"
+	"github.com/tphoney/plex-lookup/priority"
 	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/wanted"
+	"github.com/tphoney/plex-lookup/web/common"
 )
 
 var (
@@ -23,8 +35,10 @@ var (
 )
 
 type MoviesConfig struct {
-	Config     *types.Configuration
-	JobTracker types.JobTracker
+	Config       *types.Configuration
+	JobTracker   types.JobTracker
+	PriceHistory *prices.History
+	Wanted       *wanted.List
 }
 
 func MoviesHandler(w http.ResponseWriter, _ *http.Request) {
@@ -42,6 +56,10 @@ func (c MoviesConfig) PlaylistHTML(w http.ResponseWriter, _ *http.Request) {
 		 <input type="radio" id="playlist-all" name="playlist" value="all" checked />
 		 All: dont use a playlist. (SLOW, only use for small libraries)
 	 </label>`
+	if !mediaserver.IsPlex(c.Config) {
+		fmt.Fprint(w, playlistHTML+`</fieldset>`)
+		return
+	}
 	playlists, _ := plex.GetPlaylists(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexMovieLibraryID)
 	slog.Debug("Movie playlists fetched", "count", len(playlists))
 	for i := range playlists {
@@ -52,6 +70,13 @@ func (c MoviesConfig) PlaylistHTML(w http.ResponseWriter, _ *http.Request) {
 			playlists[i].RatingKey, playlists[i].RatingKey, playlists[i].RatingKey, playlists[i].Title)
 	}
 
+	for _, source := range plex.GetLookupSources(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexMovieLibraryID) {
+		playlistHTML += fmt.Sprintf(
+			`<label for=%q>
+				<input type="radio" id=%q name="playlist" value=%q/>%s: %s
+			</label>`,
+			source.Value(), source.Value(), source.Value(), source.Field, source.Title)
+	}
 	playlistHTML += `</fieldset>`
 	fmt.Fprint(w, playlistHTML)
 }
@@ -63,7 +88,8 @@ func (c MoviesConfig) ProcessHTML(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) //nolint:mnd // 1 MB limit
+	// an uploaded export can be a few MB
+	r.Body = http.MaxBytesReader(w, r.Body, importlist.MaxSize)
 
 	playlist := r.FormValue("playlist")
 	lookup := r.FormValue("lookup")
@@ -71,33 +97,84 @@ func (c MoviesConfig) ProcessHTML(w http.ResponseWriter, r *http.Request) {
 	lookupFilters := types.MovieLookupFilters{
 		AudioLanguage: r.FormValue("language"),
 		NewerVersion:  r.FormValue("newerVersion") == types.StringTrue,
+		DiscAudio:     r.FormValue("discAudio"),
+		DiscRegion:    r.FormValue("discRegion"),
+	}
+	lookupFilters.TargetPrice, _ = strconv.ParseFloat(r.FormValue("targetPrice"), 64)
+
+	plexFilters, filterErr := plex.LookupSourceFilters(playlist, r.FormValue("plexFilter"))
+	if filterErr != nil {
+		http.Error(w, filterErr.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// fetch from plex
 	var plexMovies []types.PlexMovie
-	if playlist == "all" {
-		plexMovies = plex.AllMovies(c.Config.PlexIP, c.Config.PlexMovieLibraryID, c.Config.PlexToken)
-	} else {
+	imported, isImport, importErr := common.ImportedList(r)
+	if importErr != nil {
+		http.Error(w, importErr.Error(), http.StatusBadRequest)
+		return
+	}
+	var libraryErr error
+	switch {
+	case isImport:
+		plexMovies = imported.Movies
+	case !mediaserver.IsPlex(c.Config):
+		// playlists and filters are plex only, other servers search the whole library
+		var server types.MediaServer
+		server, libraryErr = mediaserver.New(c.Config)
+		if libraryErr == nil {
+			plexMovies, libraryErr = server.Movies(r.Context(), c.Config.PlexMovieLibraryID)
+		}
+	case len(plexFilters) > 0:
+		plexMovies, libraryErr = plex.GetFilteredMovies(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexMovieLibraryID, plexFilters)
+	case playlist == "all":
+		plexMovies, libraryErr = plex.AllMovies(c.Config.PlexIP, c.Config.PlexMovieLibraryID, c.Config.PlexToken)
+	default:
 		plexMovies = plex.GetMoviesFromPlaylist(c.Config.PlexIP, c.Config.PlexToken, playlist)
 	}
+	if libraryErr != nil {
+		slog.Error("Failed to get movies from the media server", "error", libraryErr)
+		http.Error(w, libraryErr.Error(), http.StatusBadGateway)
+		return
+	}
 
+	sortByPriority := r.FormValue("sortByPriority") == types.StringTrue
+	// comparing regions searches amazon once per region
+	regions := parseRegions(r.FormValue("compareRegions"))
+	compareRegions := lookup != "cinemaParadiso" && len(regions) > 1
 	totalMovies := len(plexMovies)
-	jobID, ctx := tracker.CreateJob("movies", totalMovies)
+	totalSearches := totalMovies
+	if compareRegions {
+		totalSearches *= len(regions)
+	}
+	jobID, ctx := tracker.CreateJob("movies", totalSearches)
 
 	// write initial progress bar
-	fmt.Fprintf(w, `<div hx-get="/progress/%s" hx-trigger="every 250ms" class="container" id="progress"><progress value="0" max="%d"></progress></div>`, html.EscapeString(url.PathEscape(jobID)), totalMovies) //nolint:gosec // jobID is path-escaped then HTML-escaped
+	fmt.Fprintf(w, `<div hx-get="/progress/%s" hx-trigger="every 250ms" class="container" id="progress"><progress value="0" max="%d"></progress></div>`, html.EscapeString(url.PathEscape(jobID)), totalSearches) //nolint:gosec // jobID is path-escaped then HTML-escaped
 
 	go func() {
 		startTime := time.Now()
 		var searchResults []types.MovieSearchResponse
+		var alerts []prices.Alert
+		// priceTarget is only set when the target price was applied
+		var priceTarget types.Price
+		var parserStatus health.ParserStatus
 
 		var count atomic.Int32
 		progressFunc := func() {
 			tracker.UpdateProgress(jobID, int(count.Add(1)), "Processing movies")
 		}
 
-		if lookup == "cinemaParadiso" {
-			searchResults = cinemaparadiso.MoviesInParallel(ctx, progressFunc, plexMovies)
+		switch {
+		case compareRegions:
+			// the first region's results carry the disc details and prices
+			searchResults, parserStatus = amazon.MoviesInRegions(ctx, progressFunc, plexMovies, lookupFilters.AudioLanguage, regions)
+			c.updateWanted(searchResults, amazon.ProviderName)
+			searchResults, alerts, priceTarget = c.filterAmazonDiscs(ctx, searchResults, lookupFilters, regions[0])
+		case lookup == "cinemaParadiso":
+			searchResults, parserStatus = cinemaparadiso.MoviesInParallel(ctx, progressFunc, plexMovies)
+			c.updateWanted(searchResults, cinemaparadiso.ProviderName)
 			if lookupFilters.NewerVersion {
 				var scrapeCount atomic.Int32
 				scrapeProgressFunc := func() {
@@ -105,30 +182,41 @@ func (c MoviesConfig) ProcessHTML(w http.ResponseWriter, r *http.Request) {
 				}
 				searchResults = cinemaparadiso.ScrapeMoviesParallel(ctx, scrapeProgressFunc, searchResults)
 			}
-		} else {
-			searchResults = amazon.MoviesInParallel(ctx, progressFunc, plexMovies, lookupFilters.AudioLanguage, c.Config.AmazonRegion)
-			// if we are filtering by newer version, we need to search again
-			if lookupFilters.NewerVersion {
+		default:
+			searchResults, parserStatus = amazon.MoviesInParallel(ctx, progressFunc, plexMovies, lookupFilters.AudioLanguage, c.Config.AmazonRegion)
+			c.updateWanted(searchResults, amazon.ProviderName)
+			// release dates and disc specifications are only on the product pages
+			if lookupFilters.NewerVersion || lookupFilters.DiscAudio != "" || lookupFilters.DiscRegion != "" || lookupFilters.TargetPrice > 0 {
 				var scrapeCount atomic.Int32
 				scrapeProgressFunc := func() {
-					tracker.UpdateProgress(jobID, int(scrapeCount.Add(1)), "Scraping release dates")
+					tracker.UpdateProgress(jobID, int(scrapeCount.Add(1)), "Scraping disc details")
 				}
 				searchResults = amazon.ScrapeMovieTitlesParallel(ctx, scrapeProgressFunc, searchResults, c.Config.AmazonRegion)
+				searchResults, alerts, priceTarget = c.filterAmazonDiscs(ctx, searchResults, lookupFilters, c.Config.AmazonRegion)
 			}
 		}
 
+		if sortByPriority {
+			sortMoviesByPriority(searchResults, time.Now())
+		}
 		// Generate results table HTML
-		resultsHTML := fmt.Sprintf(`<table class="table-sortable">%s</tbody></table>
+		table := renderTable(searchResults, c.PriceHistory)
+		if compareRegions {
+			table = renderRegionTable(searchResults, regions)
+		}
+		resultsHTML := fmt.Sprintf(`%s%s%s
 			 <script>document.querySelector('.table-sortable').tsortable()</script>`,
-			renderTable(searchResults))
+			common.RenderParserWarning(parserStatus), common.RenderPriceAlerts(alerts, priceTarget),
+			common.RenderWriteBack("/movieswriteback", `<table class="table-sortable">`+table+`</tbody></table>`))
 
 		tracker.MarkComplete(jobID, resultsHTML)
 		fmt.Printf("\nProcessed %d movies in %v\n", totalMovies, time.Since(startTime))
 	}()
 }
 
-func renderTable(searchResults []types.MovieSearchResponse) (tableRows string) {
-	tableRows = `<thead><tr><th data-sort="string"><strong>Plex Title</strong></th><th data-sort="string"><strong>Plex Audio</strong></th><th data-sort="string"><strong>Plex Resolution</strong></th><th data-sort="int"><strong>Blu-ray</strong></th><th data-sort="int"><strong>4K-ray</strong></th><th data-sort="string"><strong>New release</strong></th><th><strong>Available Discs</strong></th></tr></thead><tbody>`
+func renderTable(searchResults []types.MovieSearchResponse, history *prices.History) (tableRows string) {
+	tableRows = `<thead><tr><th data-sort="string"><strong>Plex Title</strong></th><th data-sort="string"><strong>Plex Audio</strong></th><th data-sort="string"><strong>Plex Resolution</strong></th><th data-sort="int"><strong>Priority</strong></th><th data-sort="int"><strong>Blu-ray</strong></th><th data-sort="int"><strong>4K-ray</strong></th><th data-sort="string"><strong>New release</strong></th><th><strong>Available Discs</strong></th></tr></thead><tbody>`
+	now := time.Now()
 	for i := range searchResults {
 		newRelease := "no"
 		for j := range searchResults[i].MovieSearchResults {
@@ -137,15 +225,26 @@ func renderTable(searchResults []types.MovieSearchResponse) (tableRows string) {
 				break
 			}
 		}
+		// titles with discs to buy are checked, ready to be written back to plex
+		checked := ""
+		if searchResults[i].MatchesBluray+searchResults[i].Matches4k > 0 {
+			checked = " checked"
+		}
 		tableRows += fmt.Sprintf(
-			`<tr><td><a href=%q target="_blank">%s [%v]</a></td><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%s</td>`,
-			searchResults[i].SearchURL, searchResults[i].Title, searchResults[i].Year, searchResults[i].AudioLanguages,
-			searchResults[i].Resolution, searchResults[i].MatchesBluray, searchResults[i].Matches4k, newRelease)
+			`<tr><td><input type="checkbox" name="ratingKey" value=%q%s> <a href=%q target="_blank">%s [%v]</a></td><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%d</td><td>%s</td>`,
+			searchResults[i].RatingKey, checked, searchResults[i].SearchURL, searchResults[i].Title, searchResults[i].Year, searchResults[i].AudioLanguages,
+			searchResults[i].Resolution, priority.Movie(&searchResults[i].PlexMovie, now), searchResults[i].MatchesBluray, searchResults[i].Matches4k, newRelease)
 		if searchResults[i].MatchesBluray+searchResults[i].Matches4k > 0 {
 			tableRows += "<td>"
 			for _, result := range searchResults[i].MovieSearchResults {
 				if result.BestMatch && (result.Format == types.DiskBluray || result.Format == types.Disk4K) {
 					tableRows += fmt.Sprintf(`<a href=%q target="_blank">%s - %s</a><br>`, result.URL, result.FoundTitle, result.Format)
+					if summary := discSummary(&result.Disc); summary != "" {
+						tableRows += fmt.Sprintf(`<small>%s</small><br>`, html.EscapeString(summary))
+					}
+					if price := history.Describe(result.URL, result.Price); price != "" {
+						tableRows += fmt.Sprintf(`<small>%s</small><br>`, html.EscapeString(price))
+					}
 				}
 			}
 			tableRows += "</td>"
@@ -156,3 +255,171 @@ func renderTable(searchResults []types.MovieSearchResponse) (tableRows string) {
 	}
 	return tableRows // Return the generated HTML for table rows
 }
+
+// renderRegionTable shows each region's discs side by side, the region with the earliest 4K release is in bold.
+func renderRegionTable(searchResults []types.MovieSearchResponse, regions []string) (tableRows string) {
+	tableRows = `<thead><tr><th data-sort="string"><strong>Plex Title</strong></th><th data-sort="string"><strong>Plex Resolution</strong></th>`
+	for _, region := range regions {
+		tableRows += fmt.Sprintf(`<th><strong>%s</strong></th>`, html.EscapeString(strings.ToUpper(region)))
+	}
+	tableRows += `</tr></thead><tbody>`
+	for i := range searchResults {
+		tableRows += fmt.Sprintf(`<tr><td><input type="checkbox" name="ratingKey" value=%q> <a href=%q target="_blank">%s [%v]</a></td><td>%s</td>`,
+			searchResults[i].RatingKey, searchResults[i].SearchURL, searchResults[i].Title, searchResults[i].Year, searchResults[i].Resolution)
+		first4K := firstRegionWith4K(searchResults[i].Regions)
+		for _, availability := range searchResults[i].Regions {
+			if len(availability.Discs) == 0 {
+				tableRows += `<td>-</td>`
+				continue
+			}
+			tableRows += "<td>"
+			if availability.Region == first4K {
+				tableRows += "<strong>"
+			}
+			for _, disc := range availability.Discs {
+				released := "unknown"
+				if !disc.ReleaseDate.IsZero() {
+					released = disc.ReleaseDate.Format(time.DateOnly)
+				}
+				tableRows += fmt.Sprintf(`<a href=%q target="_blank">%s</a> %s<br>`, disc.URL, disc.Format, released)
+			}
+			if availability.Region == first4K {
+				tableRows += "</strong>"
+			}
+			tableRows += "</td>"
+		}
+		tableRows += "</tr>"
+	}
+	return tableRows
+}
+
+// firstRegionWith4K returns the region whose 4K disc was released first, or "" when no region has a dated 4K disc.
+func firstRegionWith4K(regions []types.RegionAvailability) (first string) {
+	var earliest time.Time
+	for _, availability := range regions {
+		for _, disc := range availability.Discs {
+			if disc.Format != types.Disk4K || disc.ReleaseDate.IsZero() {
+				continue
+			}
+			if earliest.IsZero() || disc.ReleaseDate.Before(earliest) {
+				earliest = disc.ReleaseDate
+				first = availability.Region
+			}
+		}
+	}
+	return first
+}
+
+// parseRegions turns "uk, US,de" into a de-duplicated list of region codes.
+func parseRegions(value string) (regions []string) {
+	for _, region := range strings.Split(value, ",") {
+		region = strings.ToLower(strings.TrimSpace(region))
+		if region != "" && !slices.Contains(regions, region) {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// filterDiscs keeps the movies that have a best match disc passing the disc audio and region filters.
+func filterDiscs(searchResults []types.MovieSearchResponse, filters types.MovieLookupFilters) (filtered []types.MovieSearchResponse) {
+	if filters.DiscAudio == "" && filters.DiscRegion == "" {
+		return searchResults
+	}
+	for i := range searchResults {
+		for j := range searchResults[i].MovieSearchResults {
+			result := &searchResults[i].MovieSearchResults[j]
+			if result.BestMatch && discMatchesFilters(&searchResults[i].PlexMovie, &result.Disc, filters) {
+				filtered = append(filtered, searchResults[i])
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+func discMatchesFilters(movie *types.PlexMovie, disc *types.DiscDetails, filters types.MovieLookupFilters) bool {
+	if filters.DiscRegion != "" && !slices.Contains(disc.RegionCodes, filters.DiscRegion) {
+		return false
+	}
+	if filters.DiscAudio != "" {
+		discHasAudio := slices.ContainsFunc(disc.AudioTracks, func(track types.DiscAudioTrack) bool {
+			return containsFold(track.Format, filters.DiscAudio)
+		})
+		plexHasAudio := slices.ContainsFunc(movie.AudioFormats, func(format string) bool {
+			return containsFold(format, filters.DiscAudio)
+		})
+		if !discHasAudio || plexHasAudio {
+			return false
+		}
+	}
+	return true
+}
+
+// filterAmazonDiscs records the scraped prices, then applies the disc filters and the target price in the region's currency.
+// The target is only returned when it was applied.
+func (c MoviesConfig) filterAmazonDiscs(ctx context.Context, searchResults []types.MovieSearchResponse, filters types.MovieLookupFilters,
+	region string) (filtered []types.MovieSearchResponse, alerts []prices.Alert, target types.Price) {
+	common.RecordPrices(c.PriceHistory, searchResults, common.MovieDiscs)
+	filtered = filterDiscs(searchResults, filters)
+	if filters.TargetPrice > 0 {
+		target = types.Price{Amount: filters.TargetPrice, Currency: amazon.RegionCurrency(region)}
+		filtered, alerts = common.FilterTargetPrice(filtered, target, common.MovieDiscs)
+		common.NotifyPriceAlerts(ctx, c.PriceHistory, c.Config.PriceAlertWebhook, alerts)
+	}
+	return filtered, alerts, target
+}
+
+// updateWanted keeps the wanted list in step with the latest lookup on the provider.
+func (c MoviesConfig) updateWanted(searchResults []types.MovieSearchResponse, provider string) {
+	if c.Wanted == nil {
+		return
+	}
+	c.Wanted.UpdateMovies(searchResults, provider)
+	if err := c.Wanted.Save(); err != nil {
+		slog.Error("Failed to save wanted list", "error", err)
+	}
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// discSummary is a one line description of a scraped disc, eg "Dolby Vision, HDR10 | Dolby Atmos | Region B".
+func discSummary(disc *types.DiscDetails) string {
+	var parts []string
+	if len(disc.HDRFormats) > 0 {
+		parts = append(parts, strings.Join(disc.HDRFormats, ", "))
+	}
+	var immersive []string
+	for _, track := range disc.AudioTracks {
+		for _, format := range []string{"Atmos", "DTS:X"} {
+			if containsFold(track.Format, format) && !slices.Contains(immersive, format) {
+				immersive = append(immersive, format)
+			}
+		}
+	}
+	if len(immersive) > 0 {
+		parts = append(parts, strings.Join(immersive, ", "))
+	}
+	switch len(disc.RegionCodes) {
+	case 0:
+	case 3: //nolint:mnd // A, B and C
+		parts = append(parts, "Region free")
+	default:
+		parts = append(parts, "Region "+strings.Join(disc.RegionCodes, ", "))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// WriteBackHTML adds the checked results to a Plex label or collection, or creates a playlist of them.
+func (c MoviesConfig) WriteBackHTML(w http.ResponseWriter, r *http.Request) {
+	common.WriteBack(w, r, c.Config, c.Config.PlexMovieLibraryID, plex.ItemTypeMovie, "movies")
+}
+
+// sortMoviesByPriority puts the movies most worth upgrading first.
+func sortMoviesByPriority(searchResults []types.MovieSearchResponse, now time.Time) {
+	slices.SortStableFunc(searchResults, func(a, b types.MovieSearchResponse) int {
+		return cmp.Compare(priority.Movie(&b.PlexMovie, now), priority.Movie(&a.PlexMovie, now))
+	})
+}
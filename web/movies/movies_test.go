@@ -0,0 +1,93 @@
+package movies
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestDiscMatchesFilters(t *testing.T) {
+	atmosDisc := types.DiscDetails{
+		AudioTracks: []types.DiscAudioTrack{{Language: "English", Format: "Dolby Atmos"}},
+		RegionCodes: []string{"B"},
+	}
+	tests := []struct {
+		name    string
+		movie   types.PlexMovie
+		disc    types.DiscDetails
+		filters types.MovieLookupFilters
+		want    bool
+	}{
+		{
+			name:    "no disc filters",
+			disc:    types.DiscDetails{},
+			filters: types.MovieLookupFilters{},
+			want:    true,
+		},
+		{
+			name:    "disc has atmos and plex copy does not",
+			movie:   types.PlexMovie{AudioFormats: []string{"English (AC3 5.1)"}},
+			disc:    atmosDisc,
+			filters: types.MovieLookupFilters{DiscAudio: "Atmos"},
+			want:    true,
+		},
+		{
+			name:    "plex copy already has atmos",
+			movie:   types.PlexMovie{AudioFormats: []string{"English (TrueHD 7.1 Atmos)"}},
+			disc:    atmosDisc,
+			filters: types.MovieLookupFilters{DiscAudio: "Atmos"},
+			want:    false,
+		},
+		{
+			name:    "disc lacks dts:x",
+			disc:    atmosDisc,
+			filters: types.MovieLookupFilters{DiscAudio: "DTS:X"},
+			want:    false,
+		},
+		{
+			name:    "disc plays in region",
+			disc:    atmosDisc,
+			filters: types.MovieLookupFilters{DiscRegion: "B"},
+			want:    true,
+		},
+		{
+			name:    "disc locked to another region",
+			disc:    atmosDisc,
+			filters: types.MovieLookupFilters{DiscRegion: "A"},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := discMatchesFilters(&tt.movie, &tt.disc, tt.filters); got != tt.want {
+				t.Errorf("discMatchesFilters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRegions(t *testing.T) {
+	got := parseRegions(" uk, US,,de,uk ")
+	if want := []string{"uk", "us", "de"}; !slices.Equal(got, want) {
+		t.Errorf("parseRegions() = %v, want %v", got, want)
+	}
+}
+
+func TestFirstRegionWith4K(t *testing.T) {
+	regions := []types.RegionAvailability{
+		{Region: "uk", Discs: []types.MovieSearchResult{{Format: types.Disk4K, ReleaseDate: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}}},
+		{Region: "us", Discs: []types.MovieSearchResult{
+			{Format: types.DiskBluray, ReleaseDate: time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{Format: types.Disk4K, ReleaseDate: time.Date(2023, 11, 7, 0, 0, 0, 0, time.UTC)},
+		}},
+		{Region: "de"},
+	}
+	if got := firstRegionWith4K(regions); got != "us" {
+		t.Errorf("firstRegionWith4K() = %q, want us", got)
+	}
+	if got := firstRegionWith4K(regions[2:]); got != "" {
+		t.Errorf("firstRegionWith4K() = %q, want no region", got)
+	}
+}
@@ -1,6 +1,7 @@
 package music
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"html"
@@ -12,28 +13,36 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/lithammer/fuzzysearch/fuzzy"
+	"github.com/tphoney/plex-lookup/completeness"
+	"github.com/tphoney/plex-lookup/deezer"
+	"github.com/tphoney/plex-lookup/discogs"
+	"github.com/tphoney/plex-lookup/mediaserver"
 	"github.com/tphoney/plex-lookup/musicbrainz"
 	"github.com/tphoney/plex-lookup/plex"
 	"github.com/tphoney/plex-lookup/spotify"
 	"github.com/tphoney/plex-lookup/types"
-	"github.com/tphoney/plex-lookup/utils"
 )
 
 var (
 	//go:embed music.html
 	musicPage string
 
-	spotifyToken string
+	// spotifyClient is shared by lookups so its token is reused until it expires, it is replaced when the
+	// credentials change in settings
+	spotifyClient      *spotify.Client
+	spotifyCredentials string
+	spotifyMu          sync.Mutex
 )
 
 const (
 	lookupTypeMusicBrainz = "musicbrainz"
 	lookupTypeSpotify     = "spotify"
-	minArtistsForEstimate = 50
+	lookupTypeDiscogs     = "discogs"
+	lookupTypeDeezer      = "deezer"
 )
 
 type MusicConfig struct {
@@ -56,6 +65,10 @@ func (c MusicConfig) PlaylistHTML(w http.ResponseWriter, _ *http.Request) {
 		 <input type="radio" id="playlist-all" name="playlist" value="all" checked />
 		 All: dont use a playlist. (SLOW, only use for small libraries)
 	 </label>`
+	if !mediaserver.IsPlex(c.Config) {
+		fmt.Fprint(w, playlistHTML+`</fieldset>`)
+		return
+	}
 	playlists, _ := plex.GetPlaylists(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexMusicLibraryID)
 	slog.Debug("Music playlists fetched", "count", len(playlists))
 	for i := range playlists {
@@ -66,6 +79,13 @@ func (c MusicConfig) PlaylistHTML(w http.ResponseWriter, _ *http.Request) {
 			playlists[i].RatingKey, playlists[i].RatingKey, playlists[i].RatingKey, playlists[i].Title)
 	}
 
+	for _, source := range plex.GetLookupSources(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexMusicLibraryID) {
+		playlistHTML += fmt.Sprintf(
+			`<label for=%q>
+				<input type="radio" id=%q name="playlist" value=%q/>%s: %s
+			</label>`,
+			source.Value(), source.Value(), source.Value(), source.Field, source.Title)
+	}
 	playlistHTML += `</fieldset>`
 	fmt.Fprint(w, playlistHTML)
 }
@@ -78,23 +98,35 @@ func (c MusicConfig) validateLookupConfig(w http.ResponseWriter, r *http.Request
 			return false
 		}
 	}
+	if lookup == lookupTypeDiscogs && c.Config.DiscogsToken == "" {
+		fmt.Fprintf(w, `<div class="container"><b>Discogs token is not set</b>. Please set in <a href="/settings">settings.</a></div>`)
+		return false
+	}
 	if lookup == lookupTypeSpotify {
 		if c.Config.SpotifyClientID == "" || c.Config.SpotifyClientSecret == "" {
 			fmt.Fprintf(w, `<div class="container"><b>Spotify Client ID or Secret is not set</b>. Please set in <a href="/settings">settings.</a></div>`)
 			return false
 		}
-		if spotifyToken == "" {
-			var err error
-			spotifyToken, err = spotify.SpotifyOAuthToken(r.Context(), c.Config.SpotifyClientID, c.Config.SpotifyClientSecret)
-			if err != nil {
-				fmt.Fprintf(w, `<div class="alert alert-danger" role="alert">Failed to get Spotify OAuth token<br>%s</div>`, err.Error())
-				return false
-			}
+		if _, err := c.spotifyAPI().Token(r.Context()); err != nil {
+			fmt.Fprintf(w, `<div class="alert alert-danger" role="alert">Failed to get Spotify OAuth token<br>%s</div>`, err.Error())
+			return false
 		}
 	}
 	return true
 }
 
+// spotifyAPI returns the shared spotify client for the configured credentials.
+func (c MusicConfig) spotifyAPI() *spotify.Client {
+	spotifyMu.Lock()
+	defer spotifyMu.Unlock()
+	credentials := c.Config.SpotifyClientID + ":" + c.Config.SpotifyClientSecret
+	if spotifyClient == nil || spotifyCredentials != credentials {
+		spotifyClient = spotify.NewClient(c.Config.SpotifyClientID, c.Config.SpotifyClientSecret)
+		spotifyCredentials = credentials
+	}
+	return spotifyClient
+}
+
 func (c MusicConfig) ProcessHTML(w http.ResponseWriter, r *http.Request) {
 	tracker := c.JobTracker
 	if tracker == nil {
@@ -110,23 +142,27 @@ func (c MusicConfig) ProcessHTML(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get artists from plex
-	var plexMusic []types.PlexMusicArtist
-	if playlist == "all" {
-		plexMusic = plex.AllMusicArtists(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexMusicLibraryID)
-	} else {
-		plexMusic = plex.GetArtistsFromPlaylist(c.Config.PlexIP, c.Config.PlexToken, playlist)
+	plexFilters, filterErr := plex.LookupSourceFilters(playlist, r.FormValue("plexFilter"))
+	if filterErr != nil {
+		http.Error(w, filterErr.Error(), http.StatusBadRequest)
+		return
+	}
+	albumTypes, albumTypesErr := types.ParseAlbumTypes(r.Form["albumTypes"])
+	if albumTypesErr != nil {
+		http.Error(w, albumTypesErr.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Limit for non-local musicbrainz
-	totalArtists := len(plexMusic)
-	if lookup == lookupTypeMusicBrainz && strings.Contains(c.Config.MusicBrainzURL, "musicbrainz.org") {
-		if len(plexMusic) > minArtistsForEstimate {
-			plexMusic = plexMusic[:minArtistsForEstimate]
-			totalArtists = minArtistsForEstimate
-		}
+	checkTracks := r.FormValue("checkTracks") == types.StringTrue && mediaserver.IsPlex(c.Config)
+
+	// Get artists from plex
+	plexMusic, serverErr := c.plexArtists(r, playlist, plexFilters)
+	if serverErr != nil {
+		http.Error(w, serverErr.Error(), http.StatusBadGateway)
+		return
 	}
 
+	totalArtists := len(plexMusic)
 	// Create job
 	jobID, ctx := tracker.CreateJob("music", totalArtists)
 
@@ -137,47 +173,153 @@ func (c MusicConfig) ProcessHTML(w http.ResponseWriter, r *http.Request) {
 	go func() {
 		startTime := time.Now()
 		var artistsSearchResults []types.MusicSearchResponse
+		var trackList types.TrackList
 
 		switch lookup {
 		case "musicbrainz":
-			for i := range plexMusic {
-				// Check cancellation
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-				fmt.Print(".")
-				searchResult, _ := musicbrainz.SearchMusicBrainzArtist(ctx, &plexMusic[i], c.Config.MusicBrainzURL)
-				artistsSearchResults = append(artistsSearchResults, searchResult)
-				tracker.UpdateProgress(jobID, i+1, "Searching MusicBrainz")
+			// on the public server each artist takes about two seconds, a large library is best left overnight
+			var artistCount atomic.Int32
+			progressFunc := func() {
+				tracker.UpdateProgress(jobID, int(artistCount.Add(1)), "Searching MusicBrainz")
+			}
+			client := musicbrainz.NewClient(c.Config.MusicBrainzURL)
+			artistsSearchResults = client.GetArtistsInParallel(ctx, progressFunc, plexMusic, albumTypes)
+			if ctx.Err() != nil {
+				return
+			}
+			trackList = client
+		case lookupTypeDiscogs:
+			// the albums missing from plex also have their marketplace looked up, a request each
+			var artistCount atomic.Int32
+			artistProgressFunc := func() {
+				tracker.UpdateProgress(jobID, int(artistCount.Add(1)), "Searching artists")
+			}
+			client := discogs.NewClient(c.Config.DiscogsToken)
+			artistsSearchResults = client.GetArtistsInParallel(ctx, artistProgressFunc, plexMusic)
+			var albumCount atomic.Int32
+			albumProgressFunc := func() {
+				tracker.UpdateProgress(jobID, int(albumCount.Add(1)), "Fetching albums")
+			}
+			artistsSearchResults = client.GetAlbumsInParallel(ctx, albumProgressFunc, artistsSearchResults, albumTypes)
+			if ctx.Err() != nil {
+				return
+			}
+			trackList = client
+		case lookupTypeDeezer:
+			var artistCount atomic.Int32
+			artistProgressFunc := func() {
+				tracker.UpdateProgress(jobID, int(artistCount.Add(1)), "Searching artists")
+			}
+			client := deezer.NewClient()
+			artistsSearchResults = client.GetArtistsInParallel(ctx, artistProgressFunc, plexMusic)
+			var albumCount atomic.Int32
+			albumProgressFunc := func() {
+				tracker.UpdateProgress(jobID, int(albumCount.Add(1)), "Fetching albums")
+			}
+			artistsSearchResults = client.GetAlbumsInParallel(ctx, albumProgressFunc, artistsSearchResults, albumTypes)
+			if ctx.Err() != nil {
+				return
 			}
+			trackList = client
 		default:
 			// Search spotify
 			var artistCount atomic.Int32
 			artistProgressFunc := func() {
 				tracker.UpdateProgress(jobID, int(artistCount.Add(1)), "Searching artists")
 			}
-			artistsSearchResults = spotify.GetArtistsInParallel(ctx, artistProgressFunc, plexMusic, spotifyToken)
+			artistsSearchResults = c.spotifyAPI().GetArtistsInParallel(ctx, artistProgressFunc, plexMusic)
 			var albumCount atomic.Int32
 			albumProgressFunc := func() {
 				tracker.UpdateProgress(jobID, int(albumCount.Add(1)), "Fetching albums")
 			}
-			artistsSearchResults = spotify.GetAlbumsInParallel(ctx, albumProgressFunc, artistsSearchResults, spotifyToken)
-			// sanitise album titles
-			artistsSearchResults = sanitizeAlbumTitles(artistsSearchResults)
+			artistsSearchResults = c.spotifyAPI().GetAlbumsInParallel(ctx, albumProgressFunc, artistsSearchResults, albumTypes)
+			trackList = c.spotifyAPI()
+		}
+		// sanitise album titles
+		artistsSearchResults = completeness.SanitizeAlbumTitles(artistsSearchResults)
+
+		// the owned albums are paired with the lookup's copies before the table drops them
+		incompleteHTML := ""
+		if checkTracks {
+			albums := completeness.OwnedAlbums(artistsSearchResults)
+			var trackCount atomic.Int32
+			trackProgressFunc := func() {
+				tracker.UpdateProgress(jobID, int(trackCount.Add(1))*totalArtists/max(len(albums), 1), "Checking tracks")
+			}
+			checked := completeness.IncompleteInParallel(ctx, trackProgressFunc, trackList, c.plexAlbumTracks, albums)
+			if ctx.Err() != nil {
+				return
+			}
+			incompleteHTML = renderIncompleteAlbums(completeness.Incomplete(checked), len(albums))
 		}
 
 		// Generate results table HTML
 		tableHTML := renderArtistAlbumsTable(artistsSearchResults)
-		resultsHTML := fmt.Sprintf(`<table class="table-sortable" hx-boost="true">%s</tbody></table>
-		<script>document.querySelector('.table-sortable').tsortable()</script>`, tableHTML)
+		resultsHTML := fmt.Sprintf(`%s<table class="table-sortable" hx-boost="true">%s</tbody></table>
+		<script>document.querySelectorAll('.table-sortable').forEach(table => table.tsortable())</script>`, incompleteHTML, tableHTML)
 
 		tracker.MarkComplete(jobID, resultsHTML)
 		fmt.Printf("\nProcessed %d artists in %v\n", len(plexMusic), time.Since(startTime))
 	}()
 }
 
+// plexAlbumTracks fetches the tracks of an owned album for the track check.
+func (c MusicConfig) plexAlbumTracks(_ context.Context, album *types.PlexMusicAlbum) ([]types.AlbumTrack, error) {
+	return plex.GetAlbumTracks(c.Config.PlexIP, c.Config.PlexToken, album.RatingKey)
+}
+
+// renderIncompleteAlbums lists the owned albums missing tracks, and those that could not be checked.
+func renderIncompleteAlbums(incomplete []types.IncompleteAlbumResponse, checked int) string {
+	if len(incomplete) == 0 {
+		return fmt.Sprintf(`<p>All %d owned albums found by the lookup have every track.</p>`, checked)
+	}
+	rows := fmt.Sprintf(`<h3>Incomplete albums</h3><p>%d of %d owned albums are missing tracks or could not be checked.</p>
+	<table class="table-sortable"><thead><tr><th data-sort="string"><strong>Artist</strong></th><th data-sort="string"><strong>Album</strong></th>
+	<th data-sort="int"><strong>Tracks in Plex</strong></th><th data-sort="int"><strong>Tracks listed</strong></th><th><strong>Missing tracks</strong></th></tr></thead><tbody>`,
+		len(incomplete), checked)
+	for i := range incomplete {
+		missing := ""
+		if incomplete[i].Err != nil {
+			missing = "unable to check: " + html.EscapeString(incomplete[i].Err.Error())
+		}
+		var tracks []string
+		for _, track := range incomplete[i].MissingTracks {
+			tracks = append(tracks, html.EscapeString(fmt.Sprintf("%d-%d %s", track.Disc, track.Number, track.Title)))
+		}
+		if len(tracks) > 0 {
+			missing = renderAccordian(tracks)
+		}
+		rows += fmt.Sprintf(`<tr><td>%s</td><td><a href=%q target="_blank">%s (%s)</a> <small>%s</small></td><td>%d</td><td>%d</td><td>%s</td></tr>`,
+			html.EscapeString(incomplete[i].Artist), incomplete[i].Album.URL, html.EscapeString(incomplete[i].Title), incomplete[i].Year,
+			incomplete[i].TrackList, incomplete[i].PlexTracks, incomplete[i].ProviderTracks, missing)
+	}
+	return rows + `</tbody></table>`
+}
+
+// plexArtists returns the artists in a playlist or lookup source, or the whole library.
+func (c MusicConfig) plexArtists(r *http.Request, playlist string, plexFilters []plex.Filter) (plexMusic []types.PlexMusicArtist, err error) {
+	switch {
+	case !mediaserver.IsPlex(c.Config):
+		// playlists and filters are plex only, other servers search the whole library
+		var server types.MediaServer
+		server, err = mediaserver.New(c.Config)
+		if err == nil {
+			plexMusic, err = server.MusicArtists(r.Context(), c.Config.PlexMusicLibraryID)
+		}
+	case len(plexFilters) > 0:
+		plexMusic, err = plex.GetFilteredMusicArtists(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexMusicLibraryID, plexFilters)
+	case playlist == "all":
+		plexMusic, err = plex.AllMusicArtists(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexMusicLibraryID)
+	default:
+		plexMusic = plex.GetArtistsFromPlaylist(c.Config.PlexIP, c.Config.PlexToken, playlist)
+	}
+	if err != nil {
+		slog.Error("Failed to get music artists from the media server", "error", err)
+		return nil, err
+	}
+	return plexMusic, nil
+}
+
 func renderArtistAlbumsTable(artistsSearchResults []types.MusicSearchResponse) (tableRows string) {
 	searchResults := filterMusicSearchResults(artistsSearchResults)
 	tableRows = `<thead><tr><th data-sort="string"><strong>Plex Artist</strong></th><th data-sort="int">First album</th><th data-sort="int">Last album</th><th data-sort="int"><strong>Owned Albums</strong></th><th data-sort="int"><strong>Wanted Albums</strong></th></tr></thead><tbody>`
@@ -198,7 +340,16 @@ func renderArtistAlbumsTable(artistsSearchResults []types.MusicSearchResponse) (
 func stringsFromFoundAlbums(albums []types.MusicAlbumSearchResult) []string {
 	var titles []string
 	for _, album := range albums {
-		entry := fmt.Sprintf("<a href=%q target=\"_blank\">%s (%s)</a>", album.URL, album.Title, album.Year)
+		entry := fmt.Sprintf("<a href=%q target=\"_blank\">%s (%s, %s)</a>", album.URL, album.Title, album.Year, album.Type)
+		if len(album.Formats) > 0 {
+			entry += " " + html.EscapeString(strings.Join(album.Formats, ", "))
+		}
+		if len(album.Labels) > 0 {
+			entry += " on " + html.EscapeString(strings.Join(album.Labels, ", "))
+		}
+		if album.ForSale > 0 {
+			entry += fmt.Sprintf(", %d for sale from %.2f", album.ForSale, album.LowestPrice)
+		}
 		titles = append(titles, entry)
 	}
 	return titles
@@ -213,18 +364,6 @@ func renderAccordian(s []string) string {
 	return retval
 }
 
-func sanitizeAlbumTitles(artistsSearchResults []types.MusicSearchResponse) []types.MusicSearchResponse {
-	for i := range artistsSearchResults {
-		if len(artistsSearchResults[i].MusicSearchResults) > 0 {
-			for j := range artistsSearchResults[i].MusicSearchResults[0].FoundAlbums {
-				artistsSearchResults[i].MusicSearchResults[0].FoundAlbums[j].SanitizedTitle =
-					utils.SanitizedAlbumTitle(artistsSearchResults[i].MusicSearchResults[0].FoundAlbums[j].Title)
-			}
-		}
-	}
-	return artistsSearchResults
-}
-
 func filterMusicSearchResults(searchResults []types.MusicSearchResponse) []types.MusicSearchResponse {
 	searchResults = markOwnedAlbumsInSearchResult(searchResults)
 	searchResults = removeOlderSearchedAlbums(searchResults)
@@ -254,7 +393,7 @@ func markOwnedAlbumsInSearchResult(searchResults []types.MusicSearchResponse) []
 					append(searchResults[i].MusicSearchResults[0].OwnedAlbums, plexAlbum.Title+" ("+plexAlbum.Year+")")
 				// make a deep copy of the albums in the search results
 				albumsCopy := append([]types.MusicAlbumSearchResult(nil), searchResults[i].MusicSearchResults[0].FoundAlbums...)
-				searchIDsToRemove = append(searchIDsToRemove, findMatchingAlbumFromSearch(plexAlbum, albumsCopy)...)
+				searchIDsToRemove = append(searchIDsToRemove, completeness.MatchingAlbumIDs(plexAlbum, albumsCopy)...)
 			}
 			searchResults[i].MusicSearchResults[0].FoundAlbums = removeOwnedFromSearchResults(searchResults[i].MusicSearchResults[0].FoundAlbums, searchIDsToRemove)
 		}
@@ -294,38 +433,6 @@ func markOwnedAlbumsInSearchResult(searchResults []types.MusicSearchResponse) []
 	return searchResults
 }
 
-func findMatchingAlbumFromSearch(plexAlbum types.PlexMusicAlbum, original []types.MusicAlbumSearchResult) (foundIDs []string) {
-	plexSanitizedTitle := utils.SanitizedAlbumTitle(plexAlbum.Title)
-	sanitizedAlbumTitles := make([]string, 0)
-	for _, searchAlbum := range original {
-		sanitizedAlbumTitles = append(sanitizedAlbumTitles, searchAlbum.SanitizedTitle)
-	}
-	matches := fuzzy.RankFind(plexSanitizedTitle, sanitizedAlbumTitles)
-	sort.Sort(matches)
-
-	for _, match := range matches {
-		if match.Distance < 0 {
-			continue // Skip negative scores
-		}
-		// Find the index of the matched album in the original slice
-		for j := range original {
-			if original[j].SanitizedTitle == match.Target {
-				foundIDs = append(foundIDs, original[j].ID)
-			}
-		}
-	}
-	keys := make(map[string]bool)
-	cleaned := []string{}
-
-	for _, entry := range foundIDs {
-		if _, value := keys[entry]; !value {
-			keys[entry] = true
-			cleaned = append(cleaned, entry)
-		}
-	}
-	return cleaned
-}
-
 func removeOwnedFromSearchResults(original []types.MusicAlbumSearchResult, toRemove []string) []types.MusicAlbumSearchResult {
 	if len(toRemove) == 0 {
 		return original
@@ -0,0 +1,186 @@
+package music
+
+import (
+	"cmp"
+	_ "embed"
+	"fmt"
+	"html"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tphoney/plex-lookup/lastfm"
+	"github.com/tphoney/plex-lookup/mediaserver"
+	"github.com/tphoney/plex-lookup/musicbrainz"
+	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/utils"
+)
+
+var (
+	//go:embed similar.html
+	similarPage string
+)
+
+const lookupTypeLastFM = "lastfm"
+
+func SimilarHandler(w http.ResponseWriter, _ *http.Request) {
+	tmpl := template.Must(template.New("similar").Parse(similarPage))
+	err := tmpl.Execute(w, nil)
+	if err != nil {
+		http.Error(w, "Failed to render similar artists page", http.StatusInternalServerError)
+		return
+	}
+}
+
+// SimilarHTML starts a job that finds the artists related to the chosen plex artists, and ranks the ones not in
+// plex by how many plex artists they are related to.
+func (c MusicConfig) SimilarHTML(w http.ResponseWriter, r *http.Request) {
+	tracker := c.JobTracker
+	if tracker == nil {
+		http.Error(w, "Job tracker not available", http.StatusInternalServerError)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) //nolint:mnd // 1 MB limit
+
+	playlist := r.FormValue("playlist")
+	lookup := r.FormValue("lookup")
+	if lookup == lookupTypeLastFM && c.Config.LastFMAPIKey == "" {
+		fmt.Fprintf(w, `<div class="container"><b>Last.fm API key is not set</b>. Please set in <a href="/settings">settings.</a></div>`)
+		return
+	}
+	if !c.validateLookupConfig(w, r, lookup) {
+		return
+	}
+
+	plexFilters, filterErr := plex.LookupSourceFilters(playlist, r.FormValue("plexFilter"))
+	if filterErr != nil {
+		http.Error(w, filterErr.Error(), http.StatusBadRequest)
+		return
+	}
+	plexMusic, owned, serverErr := c.similarSourceArtists(r, playlist, plexFilters)
+	if serverErr != nil {
+		http.Error(w, serverErr.Error(), http.StatusBadGateway)
+		return
+	}
+
+	jobID, ctx := tracker.CreateJob("similar", len(plexMusic))
+	fmt.Fprintf(w, `<div hx-get="/progress/%s" hx-trigger="every 250ms" class="container" id="progress"><progress value="0" max="%d"></progress></div>`, html.EscapeString(url.PathEscape(jobID)), len(plexMusic)) //nolint:gosec // jobID is path-escaped then HTML-escaped
+
+	go func() {
+		startTime := time.Now()
+		var responses []types.MusicSimilarArtistResponse
+		var count atomic.Int32
+		progressFunc := func() {
+			tracker.UpdateProgress(jobID, int(count.Add(1)), "Finding similar artists")
+		}
+		switch lookup {
+		case lookupTypeMusicBrainz:
+			responses = musicbrainz.NewClient(c.Config.MusicBrainzURL).GetSimilarArtistsInParallel(ctx, progressFunc, plexMusic)
+		case lookupTypeLastFM:
+			responses = lastfm.GetSimilarArtistsInParallel(ctx, progressFunc, plexMusic, c.Config.LastFMAPIKey)
+		default:
+			var artistCount atomic.Int32
+			artistProgressFunc := func() {
+				tracker.UpdateProgress(jobID, int(artistCount.Add(1)), "Searching artists")
+			}
+			client := c.spotifyAPI()
+			artistsSearchResults := client.GetArtistsInParallel(ctx, artistProgressFunc, plexMusic)
+			responses = client.GetSimilarArtistsInParallel(ctx, progressFunc, artistsSearchResults)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		tracker.MarkComplete(jobID, renderSimilarArtists(rankSimilarArtists(responses, owned)))
+		fmt.Printf("\nFound similar artists for %d artists in %v\n", len(plexMusic), time.Since(startTime))
+	}()
+}
+
+// similarSourceArtists returns the artists to find similar artists for, and every artist in the library so that
+// suggestions already in plex are marked as owned. Albums are not needed, so the whole plex library is listed
+// without them.
+func (c MusicConfig) similarSourceArtists(r *http.Request, playlist string, plexFilters []plex.Filter) (plexMusic, owned []types.PlexMusicArtist, err error) {
+	if mediaserver.IsPlex(c.Config) {
+		owned, err = plex.ListMusicArtists(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexMusicLibraryID)
+		if err != nil {
+			slog.Error("Failed to list plex music artists", "error", err)
+			return nil, nil, err
+		}
+		if playlist == "all" && len(plexFilters) == 0 {
+			return owned, owned, nil
+		}
+		plexMusic, err = c.plexArtists(r, playlist, plexFilters)
+		return plexMusic, owned, err
+	}
+	plexMusic, err = c.plexArtists(r, playlist, plexFilters)
+	return plexMusic, plexMusic, err
+}
+
+// rankSimilarArtists merges the similar artists of every plex artist. Each suggestion counts the plex artists it is
+// related to, suggestions not in plex come first, most related first.
+func rankSimilarArtists(responses []types.MusicSimilarArtistResponse, owned []types.PlexMusicArtist) (ranked []types.MusicSimilarArtistResult) {
+	ownedKeys := make(map[string]bool, len(owned))
+	for i := range owned {
+		ownedKeys[utils.NormalisedArtistName(owned[i].Name)] = true
+	}
+	index := make(map[string]int)
+	for i := range responses {
+		sourceKey := utils.NormalisedArtistName(responses[i].Name)
+		seen := map[string]bool{sourceKey: true}
+		for _, similar := range responses[i].SimilarArtists {
+			key := utils.NormalisedArtistName(similar.Name)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			position, found := index[key]
+			if !found {
+				position = len(ranked)
+				index[key] = position
+				ranked = append(ranked, types.MusicSimilarArtistResult{Name: similar.Name, URL: similar.URL, Owned: ownedKeys[key]})
+			}
+			ranked[position].SimilarityCount++
+			ranked[position].SimilarTo = append(ranked[position].SimilarTo, responses[i].Name)
+		}
+	}
+	slices.SortStableFunc(ranked, func(a, b types.MusicSimilarArtistResult) int {
+		if a.Owned != b.Owned {
+			if a.Owned {
+				return 1
+			}
+			return -1
+		}
+		if byCount := cmp.Compare(b.SimilarityCount, a.SimilarityCount); byCount != 0 {
+			return byCount
+		}
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return ranked
+}
+
+func renderSimilarArtists(ranked []types.MusicSimilarArtistResult) string {
+	tableRows := `<thead><tr><th data-sort="string"><strong>Artist</strong></th><th data-sort="int"><strong>Similar to</strong></th></tr></thead><tbody>`
+	var ownedNames []string
+	for i := range ranked {
+		if ranked[i].Owned {
+			ownedNames = append(ownedNames, html.EscapeString(ranked[i].Name))
+			continue
+		}
+		var similarTo []string
+		for _, name := range ranked[i].SimilarTo {
+			similarTo = append(similarTo, html.EscapeString(name))
+		}
+		tableRows += fmt.Sprintf(`<tr><td><a href=%q target="_blank">%s</a></td><td>%s</td></tr>`,
+			ranked[i].URL, html.EscapeString(ranked[i].Name), renderAccordian(similarTo))
+	}
+	return fmt.Sprintf(`<table class="table-sortable" hx-boost="true">%s</tbody></table>
+		<script>document.querySelector('.table-sortable').tsortable()</script>
+		<details><summary>%d similar artists are already in plex</summary><ul><li>%s</li></ul></details>`,
+		tableRows, len(ownedNames), strings.Join(ownedNames, "</li><li>"))
+}
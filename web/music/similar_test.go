@@ -0,0 +1,49 @@
+package music
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestRankSimilarArtists(t *testing.T) {
+	responses := []types.MusicSimilarArtistResponse{
+		{PlexMusicArtist: types.PlexMusicArtist{Name: "The Beatles"}, SimilarArtists: []types.MusicSimilarArtistResult{
+			{Name: "The Kinks", URL: "kinks"}, {Name: "The Rolling Stones"}, {Name: "The Beatles"}, {Name: "the kinks"},
+		}},
+		{PlexMusicArtist: types.PlexMusicArtist{Name: "The Rolling Stones"}, SimilarArtists: []types.MusicSimilarArtistResult{
+			{Name: "The Kinks"}, {Name: "The Who"}, {Name: "The Beatles"},
+		}},
+		{PlexMusicArtist: types.PlexMusicArtist{Name: "Blur"}},
+	}
+	owned := []types.PlexMusicArtist{{Name: "The Beatles"}, {Name: "The Rolling Stones"}, {Name: "Blur"}}
+
+	ranked := rankSimilarArtists(responses, owned)
+	want := []struct {
+		name  string
+		count int
+		owned bool
+	}{
+		{name: "The Kinks", count: 2},
+		{name: "The Who", count: 1},
+		{name: "The Beatles", count: 1, owned: true},
+		{name: "The Rolling Stones", count: 1, owned: true},
+	}
+	if len(ranked) != len(want) {
+		t.Fatalf("rankSimilarArtists() = %+v", ranked)
+	}
+	for i, w := range want {
+		if ranked[i].Name != w.name || ranked[i].SimilarityCount != w.count || ranked[i].Owned != w.owned {
+			t.Errorf("rankSimilarArtists()[%d] = %+v, want %+v", i, ranked[i], w)
+		}
+	}
+	if ranked[0].URL != "kinks" || strings.Join(ranked[0].SimilarTo, ",") != "The Beatles,The Rolling Stones" {
+		t.Errorf("rankSimilarArtists()[0] = %+v", ranked[0])
+	}
+
+	body := renderSimilarArtists(ranked)
+	if !strings.Contains(body, "The Who") || !strings.Contains(body, "2 similar artists are already in plex") {
+		t.Errorf("renderSimilarArtists() = %s", body)
+	}
+}
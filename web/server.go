@@ -14,11 +14,22 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/tphoney/plex-lookup/amazon"
+	"github.com/tphoney/plex-lookup/cinemaparadiso"
+	"github.com/tphoney/plex-lookup/deezer"
+	"github.com/tphoney/plex-lookup/discogs"
+	"github.com/tphoney/plex-lookup/lastfm"
+	"github.com/tphoney/plex-lookup/prices"
+	"github.com/tphoney/plex-lookup/spotify"
+	"github.com/tphoney/plex-lookup/tvmaze"
 	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/wanted"
 	"github.com/tphoney/plex-lookup/web/movies"
 	"github.com/tphoney/plex-lookup/web/music"
 	"github.com/tphoney/plex-lookup/web/settings"
+	"github.com/tphoney/plex-lookup/web/statistics"
 	"github.com/tphoney/plex-lookup/web/tv"
+	"github.com/tphoney/plex-lookup/web/webhooks"
 )
 
 var (
@@ -30,6 +41,8 @@ var (
 
 	port            string = "9090"
 	config          *types.Configuration
+	priceHistory    *prices.History
+	wantedList      *wanted.List
 	jobTracker      *JobTracker
 	cleanupCtx      context.Context
 	cleanupCancel   context.CancelFunc
@@ -168,6 +181,16 @@ func (jt *JobTracker) CleanupOldJobs() {
 
 func StartServer(startingConfig *types.Configuration) {
 	config = startingConfig
+	applyProviderURLs(config)
+	var err error
+	priceHistory, err = prices.Load(config.PriceHistoryFile)
+	if err != nil {
+		slog.Warn("Failed to load price history, starting a new one", "error", err)
+	}
+	wantedList, err = wanted.Load(config.WantedListFile)
+	if err != nil {
+		slog.Warn("Failed to load wanted list, starting a new one", "error", err)
+	}
 	jobTracker = NewJobTracker()
 	cleanupCtx, cleanupCancel = context.WithCancel(context.Background()) //nolint:gosec // cleanupCancel is called by StopCleanup
 
@@ -201,16 +224,30 @@ func StartServer(startingConfig *types.Configuration) {
 	mux.HandleFunc("/settings/plexinfook", settings.SettingsConfig{Config: config}.PlexInformationOKHTML)
 
 	mux.HandleFunc("/movies", movies.MoviesHandler)
-	mux.HandleFunc("/moviesprocess", movies.MoviesConfig{Config: config, JobTracker: jobTracker}.ProcessHTML)
+	mux.HandleFunc("/moviesprocess", movies.MoviesConfig{Config: config, JobTracker: jobTracker, PriceHistory: priceHistory, Wanted: wantedList}.ProcessHTML)
 	mux.HandleFunc("/moviesplaylists", movies.MoviesConfig{Config: config}.PlaylistHTML)
+	mux.HandleFunc("/movieswriteback", movies.MoviesConfig{Config: config}.WriteBackHTML)
 
 	mux.HandleFunc("/tv", tv.TVHandler)
-	mux.HandleFunc("/tvprocess", tv.TVConfig{Config: config, JobTracker: jobTracker}.ProcessHTML)
+	mux.HandleFunc("/tvprocess", tv.TVConfig{Config: config, JobTracker: jobTracker, PriceHistory: priceHistory, Wanted: wantedList, Guide: tvmaze.Guide{}}.ProcessHTML)
 	mux.HandleFunc("/tvplaylists", tv.TVConfig{Config: config}.PlaylistHTML)
+	mux.HandleFunc("/tvwriteback", tv.TVConfig{Config: config}.WriteBackHTML)
 
 	mux.HandleFunc("/music", music.MusicHandler)
 	mux.HandleFunc("/musicprocess", music.MusicConfig{Config: config, JobTracker: jobTracker}.ProcessHTML)
 	mux.HandleFunc("/musicplaylists", music.MusicConfig{Config: config}.PlaylistHTML)
+	mux.HandleFunc("/music/similar", music.SimilarHandler)
+	mux.HandleFunc("/music/similar/process", music.MusicConfig{Config: config, JobTracker: jobTracker}.SimilarHTML)
+
+	mux.HandleFunc("/stats", statistics.StatisticsHandler)
+	mux.HandleFunc("/statshtml", statistics.StatisticsConfig{Config: config}.HTML)
+	mux.HandleFunc("/stats.json", statistics.StatisticsConfig{Config: config}.JSON)
+	mux.HandleFunc("/duplicateshtml", statistics.StatisticsConfig{Config: config}.DuplicatesHTML)
+	mux.HandleFunc("/duplicates.json", statistics.StatisticsConfig{Config: config}.DuplicatesJSON)
+	mux.HandleFunc("/audioqualityhtml", statistics.StatisticsConfig{Config: config, JobTracker: jobTracker}.AudioQualityHTML)
+	mux.HandleFunc("/audioquality.json", statistics.StatisticsConfig{Config: config}.AudioQualityJSON)
+
+	mux.HandleFunc("/webhooks/plex", webhooks.WebhooksConfig{Config: config, Wanted: wantedList}.PlexHandler)
 
 	// Job management endpoints
 	mux.HandleFunc("/progress/", progressHandler)
@@ -218,7 +255,7 @@ func StartServer(startingConfig *types.Configuration) {
 
 	mux.HandleFunc("/", indexHandler)
 	mux.HandleFunc("/settings/save", settingsSaveHandler)
-	err := http.ListenAndServe(fmt.Sprintf(":%s", port), mux) //nolint: gosec
+	err = http.ListenAndServe(fmt.Sprintf(":%s", port), mux) //nolint: gosec
 	if err != nil {
 		slog.Error("Failed to start server", "port", port, "error", err)
 		panic(err)
@@ -243,10 +280,27 @@ func settingsSaveHandler(w http.ResponseWriter, r *http.Request) {
 	config.PlexMovieLibraryID = r.FormValue("plexMovieLibraryID")
 	config.PlexTVLibraryID = r.FormValue("plexTVLibraryID")
 	config.PlexMusicLibraryID = r.FormValue("plexMusicLibraryID")
+	config.MediaServer = r.FormValue("mediaServer")
+	config.MediaServerURL = r.FormValue("mediaServerURL")
+	config.MediaServerAPIKey = r.FormValue("mediaServerAPIKey")
+	config.MediaServerUserID = r.FormValue("mediaServerUserID")
 	config.AmazonRegion = r.FormValue("amazonRegion")
 	config.MusicBrainzURL = r.FormValue("musicBrainzURL")
 	config.SpotifyClientID = r.FormValue("spotifyClientID")
 	config.SpotifyClientSecret = r.FormValue("spotifyClientSecret")
+	config.AmazonURL = r.FormValue("amazonURL")
+	config.CinemaParadisoURL = r.FormValue("cinemaParadisoURL")
+	config.SpotifyAPIURL = r.FormValue("spotifyAPIURL")
+	config.SpotifyAccountsURL = r.FormValue("spotifyAccountsURL")
+	config.TVMazeURL = r.FormValue("tvMazeURL")
+	config.LastFMAPIKey = r.FormValue("lastFMAPIKey")
+	config.LastFMURL = r.FormValue("lastFMURL")
+	config.DiscogsToken = r.FormValue("discogsToken")
+	config.DiscogsURL = r.FormValue("discogsURL")
+	config.DeezerURL = r.FormValue("deezerURL")
+	config.PriceAlertWebhook = r.FormValue("priceAlertWebhook")
+	config.PlexWebhookSecret = r.FormValue("plexWebhookSecret")
+	applyProviderURLs(config)
 	fmt.Fprint(w, `<h2>Saved!</h2><a href="/">Back</a>`)
 	slog.Info("Settings saved",
 		"plexIP_changed", oldConfig.PlexIP != config.PlexIP,
@@ -254,13 +308,39 @@ func settingsSaveHandler(w http.ResponseWriter, r *http.Request) {
 		"plexMovieLibraryID_changed", oldConfig.PlexMovieLibraryID != config.PlexMovieLibraryID,
 		"plexTVLibraryID_changed", oldConfig.PlexTVLibraryID != config.PlexTVLibraryID,
 		"plexMusicLibraryID_changed", oldConfig.PlexMusicLibraryID != config.PlexMusicLibraryID,
+		"mediaServer", config.MediaServer,
+		"mediaServerURL_changed", oldConfig.MediaServerURL != config.MediaServerURL,
+		"mediaServerAPIKey_changed", oldConfig.MediaServerAPIKey != config.MediaServerAPIKey,
 		"amazonRegion_changed", oldConfig.AmazonRegion != config.AmazonRegion,
 		"musicBrainzURL_changed", oldConfig.MusicBrainzURL != config.MusicBrainzURL,
 		"spotifyClientID_changed", oldConfig.SpotifyClientID != config.SpotifyClientID,
 		"spotifyClientSecret_changed", oldConfig.SpotifyClientSecret != config.SpotifyClientSecret,
+		"amazonURL_changed", oldConfig.AmazonURL != config.AmazonURL,
+		"cinemaParadisoURL_changed", oldConfig.CinemaParadisoURL != config.CinemaParadisoURL,
+		"spotifyAPIURL_changed", oldConfig.SpotifyAPIURL != config.SpotifyAPIURL,
+		"spotifyAccountsURL_changed", oldConfig.SpotifyAccountsURL != config.SpotifyAccountsURL,
+		"tvMazeURL_changed", oldConfig.TVMazeURL != config.TVMazeURL,
+		"lastFMAPIKey_changed", oldConfig.LastFMAPIKey != config.LastFMAPIKey,
+		"lastFMURL_changed", oldConfig.LastFMURL != config.LastFMURL,
+		"discogsToken_changed", oldConfig.DiscogsToken != config.DiscogsToken,
+		"discogsURL_changed", oldConfig.DiscogsURL != config.DiscogsURL,
+		"deezerURL_changed", oldConfig.DeezerURL != config.DeezerURL,
+		"priceAlertWebhook_changed", oldConfig.PriceAlertWebhook != config.PriceAlertWebhook,
+		"plexWebhookSecret_changed", oldConfig.PlexWebhookSecret != config.PlexWebhookSecret,
 	)
 }
 
+// applyProviderURLs points the providers at the configured endpoints, empty values use the public sites.
+func applyProviderURLs(c *types.Configuration) {
+	amazon.SetURL(c.AmazonURL)
+	cinemaparadiso.SetURL(c.CinemaParadisoURL)
+	spotify.SetURLs(c.SpotifyAPIURL, c.SpotifyAccountsURL)
+	tvmaze.SetURL(c.TVMazeURL)
+	lastfm.SetURL(c.LastFMURL)
+	discogs.SetURL(c.DiscogsURL)
+	deezer.SetURL(c.DeezerURL)
+}
+
 func GetOutboundIP() net.IP {
 	conn, err := (&net.Dialer{}).DialContext(context.Background(), "udp", "8.8.8.8:80")
 	if err != nil {
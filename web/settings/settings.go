@@ -4,10 +4,11 @@ import (
 	_ "embed"
 	"fmt"
 	"html/template"
+	"log/slog"
 	"net/http"
 	"path"
 
-	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/mediaserver"
 	"github.com/tphoney/plex-lookup/types"
 )
 
@@ -33,13 +34,23 @@ func SettingsHandler(w http.ResponseWriter, _ *http.Request) {
 
 func ProcessPlexLibrariesHTML(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
-	// Retrieve form fields (replace with proper values)
-	plexIP := r.FormValue("plexIP")
-	plexToken := r.FormValue("plexToken")
-
-	libraries, err := plex.GetPlexLibraries(plexIP, plexToken)
+	formConfig := types.Configuration{
+		PlexIP:            r.FormValue("plexIP"),
+		PlexToken:         r.FormValue("plexToken"),
+		MediaServer:       r.FormValue("mediaServer"),
+		MediaServerURL:    r.FormValue("mediaServerURL"),
+		MediaServerAPIKey: r.FormValue("mediaServerAPIKey"),
+		MediaServerUserID: r.FormValue("mediaServerUserID"),
+	}
+	server, err := mediaserver.New(&formConfig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	libraries, err := server.Libraries(r.Context())
 	if err != nil {
-		http.Error(w, "Failed to get plex libraries", http.StatusInternalServerError)
+		slog.Error("Failed to get libraries", "server", server.Name(), "error", err)
+		http.Error(w, fmt.Sprintf("Failed to get %s libraries", server.Name()), http.StatusInternalServerError)
 		return
 	}
 
@@ -51,7 +62,11 @@ func (c SettingsConfig) PlexInformationOKHTML(w http.ResponseWriter, r *http.Req
 	currentURL := r.Header.Get("hx-current-url")
 	// get the last part of the url
 	requestingPage := path.Base(currentURL)
-	if c.Config.PlexIP == "" || c.Config.PlexToken == "" {
+	if !mediaserver.IsPlex(c.Config) {
+		if c.Config.MediaServerURL == "" || c.Config.MediaServerAPIKey == "" {
+			fmt.Fprint(w, `<h1><a href="/settings"> Enter your media server url and api key</a></h1>`)
+		}
+	} else if c.Config.PlexIP == "" || c.Config.PlexToken == "" {
 		fmt.Fprint(w, `<h1><a href="/settings"> Enter your plex token and plex ip</a></h1>`)
 	} else {
 		switch requestingPage {
@@ -0,0 +1,293 @@
+package statistics
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tphoney/plex-lookup/audioquality"
+	"github.com/tphoney/plex-lookup/discogs"
+	"github.com/tphoney/plex-lookup/duplicates"
+	"github.com/tphoney/plex-lookup/mediaserver"
+	"github.com/tphoney/plex-lookup/musicbrainz"
+	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/stats"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+const gigabyte = 1 << 30
+
+var (
+	//go:embed statistics.html
+	statisticsPage string
+)
+
+type StatisticsConfig struct {
+	Config     *types.Configuration
+	JobTracker types.JobTracker
+}
+
+func StatisticsHandler(w http.ResponseWriter, _ *http.Request) {
+	tmpl := template.Must(template.New("statistics").Parse(statisticsPage))
+	err := tmpl.Execute(w, nil)
+	if err != nil {
+		http.Error(w, "Failed to render statistics page", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HTML renders the statistics of every configured library.
+func (c StatisticsConfig) HTML(w http.ResponseWriter, r *http.Request) {
+	library, err := c.collect(r)
+	if err != nil {
+		fmt.Fprintf(w, `<p><strong>Some libraries could not be read:</strong> %s</p>`, html.EscapeString(err.Error()))
+	}
+	fmt.Fprint(w, renderSection("Movies", library.Movies, "movies"), renderSection("TV", library.TV, "episodes"),
+		renderSection("Music", library.Music, "albums"))
+}
+
+// JSON returns the statistics of every configured library.
+func (c StatisticsConfig) JSON(w http.ResponseWriter, r *http.Request) {
+	library, err := c.collect(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if encodeErr := json.NewEncoder(w).Encode(library); encodeErr != nil {
+		slog.Error("Failed to write statistics", "error", encodeErr)
+	}
+}
+
+func (c StatisticsConfig) collect(r *http.Request) (library stats.Library, err error) {
+	server, err := mediaserver.New(c.Config)
+	if err != nil {
+		return library, err
+	}
+	library, err = stats.Collect(r.Context(), server, c.Config.PlexMovieLibraryID, c.Config.PlexTVLibraryID, c.Config.PlexMusicLibraryID)
+	if err != nil {
+		slog.Error("Failed to collect statistics", "server", server.Name(), "error", err)
+	}
+	return library, err
+}
+
+// DuplicatesHTML renders the movies with more than one copy.
+func (c StatisticsConfig) DuplicatesHTML(w http.ResponseWriter, r *http.Request) {
+	report, err := c.duplicates(r)
+	if err != nil {
+		fmt.Fprintf(w, `<p><strong>Unable to read the movie library:</strong> %s</p>`, html.EscapeString(err.Error()))
+		return
+	}
+	fmt.Fprint(w, renderDuplicates(report))
+}
+
+// DuplicatesJSON returns the movies with more than one copy.
+func (c StatisticsConfig) DuplicatesJSON(w http.ResponseWriter, r *http.Request) {
+	report, err := c.duplicates(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if encodeErr := json.NewEncoder(w).Encode(report); encodeErr != nil {
+		slog.Error("Failed to write duplicates", "error", encodeErr)
+	}
+}
+
+func (c StatisticsConfig) duplicates(r *http.Request) (report duplicates.Report, err error) {
+	server, err := mediaserver.New(c.Config)
+	if err != nil {
+		return report, err
+	}
+	movies, err := server.Movies(r.Context(), c.Config.PlexMovieLibraryID)
+	if err != nil {
+		slog.Error("Failed to read movies for duplicates", "server", server.Name(), "error", err)
+		return report, err
+	}
+	return duplicates.Movies(movies), nil
+}
+
+func renderDuplicates(report duplicates.Report) string {
+	if len(report.Duplicates) == 0 {
+		return `<p>No duplicate movies found.</p>`
+	}
+	output := fmt.Sprintf(`<p>%d movies have more than one copy, deleting the redundant copies frees %.1f GB.</p>`,
+		len(report.Duplicates), float64(report.Reclaimable)/gigabyte)
+	output += `<table><thead><tr><th><strong>Title</strong></th><th><strong>Resolution</strong></th>` +
+		`<th><strong>Codec</strong></th><th><strong>Size</strong></th><th><strong>Files</strong></th></tr></thead><tbody>`
+	for _, duplicate := range report.Duplicates {
+		for i, version := range duplicate.Copies {
+			title := ""
+			if i == 0 {
+				title = fmt.Sprintf("%s [%s]", html.EscapeString(duplicate.Title), html.EscapeString(duplicate.Year))
+			}
+			resolution := html.EscapeString(version.Resolution)
+			if version.Redundant {
+				resolution = fmt.Sprintf(`<del>%s</del> can be deleted`, resolution)
+			}
+			output += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%.1f GB</td><td>%s</td></tr>`, title, resolution,
+				html.EscapeString(version.VideoCodec), float64(version.Size)/gigabyte, html.EscapeString(strings.Join(version.Files, ", ")))
+		}
+	}
+	return output + `</tbody></table>`
+}
+
+// AudioQualityHTML renders the audio quality of the music library and the lossy albums. With formats set the lossy
+// albums are looked up on Discogs or MusicBrainz as a job, to show which were released on CD or vinyl.
+func (c StatisticsConfig) AudioQualityHTML(w http.ResponseWriter, r *http.Request) {
+	report, err := c.audioQuality(r.Context())
+	if err != nil {
+		fmt.Fprintf(w, `<p><strong>Unable to read the music library:</strong> %s</p>`, html.EscapeString(err.Error()))
+		return
+	}
+	if r.FormValue("formats") != types.StringTrue || c.JobTracker == nil || len(report.Candidates) == 0 {
+		fmt.Fprint(w, renderAudioQuality(report, ""))
+		return
+	}
+	source := c.formatsSource()
+	total := len(report.Candidates)
+	jobID, ctx := c.JobTracker.CreateJob("audioquality", total)
+	fmt.Fprintf(w, `<div hx-get="/progress/%s" hx-trigger="every 250ms" class="container" id="progress"><progress value="0" max="%d"></progress></div>`, html.EscapeString(url.PathEscape(jobID)), total) //nolint:gosec // jobID is path-escaped then HTML-escaped
+	go func() {
+		var albumCount atomic.Int32
+		progressFunc := func() {
+			c.JobTracker.UpdateProgress(jobID, int(albumCount.Add(1)), "Searching "+source.Name())
+		}
+		report.Candidates = audioquality.FormatsInParallel(ctx, progressFunc, source, report.Candidates)
+		if ctx.Err() != nil {
+			return
+		}
+		c.JobTracker.MarkComplete(jobID, renderAudioQuality(report, source.Name()))
+	}()
+}
+
+// AudioQualityJSON returns the audio quality of the music library and the lossy albums. With formats set the lossy
+// albums are looked up before the response is written, which can take minutes on a large library.
+func (c StatisticsConfig) AudioQualityJSON(w http.ResponseWriter, r *http.Request) {
+	report, err := c.audioQuality(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if r.FormValue("formats") == types.StringTrue {
+		report.Candidates = audioquality.FormatsInParallel(r.Context(), nil, c.formatsSource(), report.Candidates)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if encodeErr := json.NewEncoder(w).Encode(report); encodeErr != nil {
+		slog.Error("Failed to write audio quality", "error", encodeErr)
+	}
+}
+
+// formatsSource is Discogs when it has a token, it lists every pressing, otherwise MusicBrainz.
+func (c StatisticsConfig) formatsSource() types.ReleaseFormats {
+	if c.Config.DiscogsToken != "" {
+		return discogs.NewClient(c.Config.DiscogsToken)
+	}
+	return musicbrainz.NewClient(c.Config.MusicBrainzURL)
+}
+
+// audioQuality reads the tracks of the music library, only plex lists the codec and bitrate of every track in one
+// request.
+func (c StatisticsConfig) audioQuality(ctx context.Context) (report audioquality.Report, err error) {
+	if !mediaserver.IsPlex(c.Config) {
+		return report, errors.New("the audio quality report needs a plex server")
+	}
+	artists, err := plex.Server{IP: c.Config.PlexIP, Token: c.Config.PlexToken}.MusicArtists(ctx, c.Config.PlexMusicLibraryID)
+	if err != nil {
+		return report, err
+	}
+	tracks, err := plex.GetMusicTrackQualities(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexMusicLibraryID)
+	if err != nil {
+		slog.Error("Failed to read music tracks for audio quality", "error", err)
+		return report, err
+	}
+	return audioquality.NewReport(audioquality.Albums(artists, tracks)), nil
+}
+
+// renderAudioQuality draws the quality counts and the lossy albums, with their release formats when source is set.
+func renderAudioQuality(report audioquality.Report, source string) string {
+	output := fmt.Sprintf(`<p>%d albums: %d lossless, %d lossy, %d unknown.</p>`, report.Albums, report.Lossless, report.Lossy,
+		report.Unknown)
+	if len(report.Candidates) == 0 {
+		return output + `<p>No lossy albums found.</p>`
+	}
+	output += `<table><thead><tr><th><strong>Artist</strong></th><th><strong>Album</strong></th><th><strong>Codec</strong></th>` +
+		`<th><strong>Bitrate</strong></th>`
+	if source != "" {
+		output += fmt.Sprintf(`<th><strong>%s formats</strong></th>`, html.EscapeString(source))
+	}
+	output += `</tr></thead><tbody>`
+	for i := range report.Candidates {
+		album := report.Candidates[i]
+		bitrate := "unknown"
+		if album.Bitrate > 0 {
+			bitrate = fmt.Sprintf("%d kbps", album.Bitrate)
+		}
+		output += fmt.Sprintf(`<tr><td>%s</td><td>%s [%s]</td><td>%s</td><td>%s</td>`, html.EscapeString(album.Artist),
+			html.EscapeString(album.Title), html.EscapeString(album.Year), html.EscapeString(album.Codec), bitrate)
+		if source != "" {
+			formats := html.EscapeString(strings.Join(album.Formats, ", "))
+			switch {
+			case album.Err != nil:
+				formats = "not found"
+			case audioquality.Rippable(album.Formats):
+				formats = fmt.Sprintf(`<strong>%s</strong>`, formats)
+			}
+			output += fmt.Sprintf(`<td>%s</td>`, formats)
+		}
+		output += `</tr>`
+	}
+	return output + `</tbody></table>`
+}
+
+func renderSection(title string, section *stats.Section, files string) string {
+	if section == nil {
+		return ""
+	}
+	output := fmt.Sprintf(`<h2>%s</h2><p>%d titles, %d %s`, title, section.Titles, section.Files, files)
+	if section.TotalSize > 0 {
+		output += fmt.Sprintf(`, %.1f GB`, float64(section.TotalSize)/gigabyte)
+	}
+	output += `</p><div class="grid">`
+	for _, distribution := range []struct {
+		name   string
+		counts []stats.Count
+	}{
+		{"Resolution", section.Resolutions},
+		{"Video codec", section.VideoCodecs},
+		{"Audio codec", section.AudioCodecs},
+		{"Audio language", section.AudioLanguages},
+		{"File size", section.FileSizes},
+		{"Decade", section.Decades},
+		{"Added", section.AddedByYear},
+	} {
+		output += renderCounts(distribution.name, distribution.counts)
+	}
+	return output + `</div>`
+}
+
+// renderCounts draws a distribution as a table of progress bars, scaled to the largest count.
+func renderCounts(name string, counts []stats.Count) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	largest := 0
+	for _, count := range counts {
+		largest = max(largest, count.Count)
+	}
+	table := fmt.Sprintf(`<table><thead><tr><th colspan="3"><strong>%s</strong></th></tr></thead><tbody>`, name)
+	for _, count := range counts {
+		table += fmt.Sprintf(`<tr><td>%s</td><td>%d</td><td><progress value="%d" max="%d"></progress></td></tr>`,
+			html.EscapeString(count.Name), count.Count, count.Count, largest)
+	}
+	return table + `</tbody></table>`
+}
@@ -0,0 +1,80 @@
+package statistics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tphoney/plex-lookup/audioquality"
+	"github.com/tphoney/plex-lookup/duplicates"
+	"github.com/tphoney/plex-lookup/stats"
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestStatistics(t *testing.T) {
+	jellyfin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Items" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"Items":[{"Id":"m1","Name":"Cats","ProductionYear":2019,"MediaSources":[{"Size":2147483648}],
+			"MediaStreams":[{"Type":"Video","Codec":"hevc","Width":1920,"Height":1080},{"Type":"Audio","Codec":"aac","Language":"eng"}]}],
+			"TotalRecordCount":1}`)
+	}))
+	defer jellyfin.Close()
+	config := StatisticsConfig{Config: &types.Configuration{MediaServer: "jellyfin", MediaServerURL: jellyfin.URL,
+		MediaServerUserID: "user1", PlexMovieLibraryID: "lib-movies"}}
+
+	rec := httptest.NewRecorder()
+	config.JSON(rec, httptest.NewRequest(http.MethodGet, "/stats.json", http.NoBody))
+	var library stats.Library
+	if err := json.Unmarshal(rec.Body.Bytes(), &library); err != nil {
+		t.Fatalf("JSON() = %s, error = %v", rec.Body.String(), err)
+	}
+	if library.Movies == nil || library.Movies.Files != 1 || library.Movies.VideoCodecs[0].Name != "hevc" || library.TV != nil {
+		t.Errorf("JSON() = %+v", library)
+	}
+
+	rec = httptest.NewRecorder()
+	config.HTML(rec, httptest.NewRequest(http.MethodGet, "/statshtml", http.NoBody))
+	if body := rec.Body.String(); !strings.Contains(body, "<h2>Movies</h2>") || !strings.Contains(body, "1-5 GB") {
+		t.Errorf("HTML() = %s", body)
+	}
+}
+
+func TestRenderDuplicates(t *testing.T) {
+	report := duplicates.Movies([]types.PlexMovie{
+		{Title: "Cats", Year: "2019", RatingKey: "1", Resolution: types.PlexResolution4K, FileSize: 3 << 30},
+		{Title: "Cats", Year: "2019", RatingKey: "2", Resolution: types.PlexResolutionSD, FileSize: 1 << 30},
+	})
+	body := renderDuplicates(report)
+	if !strings.Contains(body, "frees 1.0 GB") || !strings.Contains(body, "<del>sd</del> can be deleted") {
+		t.Errorf("renderDuplicates() = %s", body)
+	}
+	if body = renderDuplicates(duplicates.Report{}); !strings.Contains(body, "No duplicate") {
+		t.Errorf("renderDuplicates() empty = %s", body)
+	}
+}
+
+func TestRenderAudioQuality(t *testing.T) {
+	report := audioquality.Report{Albums: 2, Lossless: 1, Lossy: 1, Candidates: []audioquality.Album{
+		{Artist: "Radiohead", Title: "Amnesiac", Year: "2001", AudioQuality: types.AudioQuality{Codec: "mp3", Bitrate: 128},
+			Formats: []string{"CD"}}}}
+	body := renderAudioQuality(report, "")
+	if !strings.Contains(body, "1 lossless, 1 lossy") || !strings.Contains(body, "128 kbps") || strings.Contains(body, "formats") {
+		t.Errorf("renderAudioQuality() = %s", body)
+	}
+	if body = renderAudioQuality(report, "MusicBrainz"); !strings.Contains(body, "MusicBrainz formats") || !strings.Contains(body, "<strong>CD</strong>") {
+		t.Errorf("renderAudioQuality() with formats = %s", body)
+	}
+
+	rec := httptest.NewRecorder()
+	StatisticsConfig{Config: &types.Configuration{MediaServer: "jellyfin"}}.AudioQualityJSON(rec,
+		httptest.NewRequest(http.MethodGet, "/audioquality.json", http.NoBody))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("AudioQualityJSON() status = %d, want an error without plex", rec.Code)
+	}
+}
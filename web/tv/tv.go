@@ -1,6 +1,7 @@
 package tv
 
 import (
+	"cmp"
 	_ "embed"
 	"fmt"
 	"html"
@@ -8,23 +9,64 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/tphoney/plex-lookup/amazon"
 	"github.com/tphoney/plex-lookup/cinemaparadiso"
+	"github.com/tphoney/plex-lookup/episodes"
+	"github.com/tphoney/plex-lookup/health"
+	"github.com/tphoney/plex-lookup/importlist"
+	"github.com/tphoney/plex-lookup/mediaserver"
 	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/prices"
+	"github.com/tphoney/plex-lookup/priority"
+	"github.com/tphoney/plex-lookup/tvmaze"
 	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/wanted"
+	"github.com/tphoney/plex-lookup/web/common"
 )
 
 var (
 	//go:embed tv.html
 	tvPage string
+
+	boxSetRangeRegex = regexp.MustCompile(`(?i)(?:seasons?|series)\s+(\d+)\s*(?:-|to)\s*(\d+)`)
+)
+
+// season statuses shown in the season matrix.
+const (
+	seasonMissing   = "missing from Plex"
+	seasonUpgrade   = "upgrade available"
+	seasonBest      = "already best"
+	seasonBoxSet    = "covered by box set"
+	seasonNoDisc    = "no disc found"
+	finalSeason     = 999
+	unknownDiscRank = 0
 )
 
+// seasonStatus is one row of a show's season matrix, the plex copy of a season next to the best disc for it.
+type seasonStatus struct {
+	Number         int
+	PlexResolution string
+	DiscFormat     string
+	DiscURL        string
+	BoxSetName     string
+	Status         string
+	Quality        types.SeasonQuality
+}
+
 type TVConfig struct {
-	Config     *types.Configuration
-	JobTracker types.JobTracker
+	Config       *types.Configuration
+	JobTracker   types.JobTracker
+	PriceHistory *prices.History
+	Wanted       *wanted.List
+	// Guide lists the aired episodes for the episode guide lookup, TVmaze when not set
+	Guide types.EpisodeGuide
 }
 
 func TVHandler(w http.ResponseWriter, _ *http.Request) {
@@ -42,6 +84,10 @@ func (c TVConfig) PlaylistHTML(w http.ResponseWriter, _ *http.Request) {
 		 <input type="radio" id="playlist-all" name="playlist" value="all" checked />
 		 All: dont use a playlist. (SLOW, only use for small libraries)
 	 </label>`
+	if !mediaserver.IsPlex(c.Config) {
+		fmt.Fprint(w, playlistHTML+`</fieldset>`)
+		return
+	}
 	playlists, _ := plex.GetPlaylists(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexTVLibraryID)
 	slog.Debug("TV playlists fetched", "count", len(playlists))
 	for i := range playlists {
@@ -51,6 +97,13 @@ func (c TVConfig) PlaylistHTML(w http.ResponseWriter, _ *http.Request) {
 			</label>`,
 			playlists[i].RatingKey, playlists[i].RatingKey, playlists[i].RatingKey, playlists[i].Title)
 	}
+	for _, source := range plex.GetLookupSources(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexTVLibraryID) {
+		playlistHTML += fmt.Sprintf(
+			`<label for=%q>
+				<input type="radio" id=%q name="playlist" value=%q/>%s: %s
+			</label>`,
+			source.Value(), source.Value(), source.Value(), source.Field, source.Title)
+	}
 	playlistHTML += `</fieldset>`
 	fmt.Fprint(w, playlistHTML)
 }
@@ -62,7 +115,8 @@ func (c TVConfig) ProcessHTML(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) //nolint:mnd // 1 MB limit
+	// an uploaded export can be a few MB
+	r.Body = http.MaxBytesReader(w, r.Body, importlist.MaxSize)
 
 	playlist := r.FormValue("playlist")
 	lookup := r.FormValue("lookup")
@@ -71,14 +125,49 @@ func (c TVConfig) ProcessHTML(w http.ResponseWriter, r *http.Request) {
 		AudioLanguage: r.FormValue("language"),
 		NewerVersion:  r.FormValue("newerVersion") == types.StringTrue,
 	}
+	filters.TargetPrice, _ = strconv.ParseFloat(r.FormValue("targetPrice"), 64)
+
+	plexFilters, filterErr := plex.LookupSourceFilters(playlist, r.FormValue("plexFilter"))
+	if filterErr != nil {
+		http.Error(w, filterErr.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// get TV shows from plex
 	var plexTV []types.PlexTVShow
-	if playlist == "all" {
-		plexTV = plex.AllTV(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexTVLibraryID)
-	} else {
+	imported, isImport, importErr := common.ImportedList(r)
+	if importErr != nil {
+		http.Error(w, importErr.Error(), http.StatusBadRequest)
+		return
+	}
+	var libraryErr error
+	switch {
+	case isImport:
+		plexTV = imported.TV
+	case !mediaserver.IsPlex(c.Config):
+		// playlists and filters are plex only, other servers search the whole library
+		var server types.MediaServer
+		server, libraryErr = mediaserver.New(c.Config)
+		if libraryErr == nil {
+			plexTV, libraryErr = server.TV(r.Context(), c.Config.PlexTVLibraryID)
+		}
+	case len(plexFilters) > 0:
+		plexTV, libraryErr = plex.GetFilteredTV(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexTVLibraryID, plexFilters)
+	case playlist == "all":
+		plexTV, libraryErr = plex.AllTV(c.Config.PlexIP, c.Config.PlexToken, c.Config.PlexTVLibraryID)
+	default:
 		plexTV = plex.GetTVFromPlaylist(c.Config.PlexIP, c.Config.PlexToken, playlist)
 	}
+	if libraryErr != nil {
+		slog.Error("Failed to get TV shows from the media server", "error", libraryErr)
+		http.Error(w, libraryErr.Error(), http.StatusBadGateway)
+		return
+	}
+
+	sortByPriority := r.FormValue("sortByPriority") == types.StringTrue
+	if r.FormValue("mixedResolution") == types.StringTrue {
+		plexTV = filterMixedResolution(plexTV)
+	}
 
 	totalTV := len(plexTV)
 	jobID, ctx := tracker.CreateJob("tv", totalTV)
@@ -88,46 +177,74 @@ func (c TVConfig) ProcessHTML(w http.ResponseWriter, r *http.Request) {
 	go func() {
 		startTime := time.Now()
 		var tvSearchResults []types.TVSearchResponse
+		var alerts []prices.Alert
+		// priceTarget is only set when the target price was applied
+		var priceTarget types.Price
+		var parserStatus health.ParserStatus
 
 		var count atomic.Int32
 		progressFunc := func() {
 			tracker.UpdateProgress(jobID, int(count.Add(1)), "Processing TV shows")
 		}
 
+		if lookup == "episodeGuide" {
+			guide := c.Guide
+			if guide == nil {
+				guide = tvmaze.Guide{}
+			}
+			missing := episodes.MissingInParallel(ctx, progressFunc, guide, plexTV)
+			tracker.MarkComplete(jobID, fmt.Sprintf(`<table class="table-sortable">%s</tbody></table>
+			<script>document.querySelector('.table-sortable').tsortable()</script>`, renderMissingEpisodesTable(missing)))
+			fmt.Printf("\nProcessed %d TV Shows in %v\n", totalTV, time.Since(startTime))
+			return
+		}
+
 		if lookup == "cinemaParadiso" {
-			tvSearchResults = cinemaparadiso.TVInParallel(ctx, progressFunc, plexTV)
+			tvSearchResults, parserStatus = cinemaparadiso.TVInParallel(ctx, progressFunc, plexTV)
+			c.updateWanted(tvSearchResults, cinemaparadiso.ProviderName)
 		} else {
-			tvSearchResults = amazon.TVInParallel(ctx, progressFunc, plexTV, filters.AudioLanguage, c.Config.AmazonRegion)
+			tvSearchResults, parserStatus = amazon.TVInParallel(ctx, progressFunc, plexTV, filters.AudioLanguage, c.Config.AmazonRegion)
+			c.updateWanted(tvSearchResults, amazon.ProviderName)
 			var scrapeCount atomic.Int32
 			scrapeProgressFunc := func() {
 				tracker.UpdateProgress(jobID, int(scrapeCount.Add(1)), "Scraping details")
 			}
 			tvSearchResults = amazon.ScrapeTitlesParallel(ctx, scrapeProgressFunc, tvSearchResults, c.Config.AmazonRegion)
+			common.RecordPrices(c.PriceHistory, tvSearchResults, common.TVDiscs)
+			if filters.TargetPrice > 0 {
+				priceTarget = types.Price{Amount: filters.TargetPrice, Currency: amazon.RegionCurrency(c.Config.AmazonRegion)}
+				tvSearchResults, alerts = common.FilterTargetPrice(tvSearchResults, priceTarget, common.TVDiscs)
+				common.NotifyPriceAlerts(ctx, c.PriceHistory, c.Config.PriceAlertWebhook, alerts)
+			}
 		}
 
-		resultsHTML := fmt.Sprintf(`<table class="table-sortable">%s</tbody></table>
+		if sortByPriority {
+			sortTVByPriority(tvSearchResults, time.Now())
+		}
+		resultsHTML := fmt.Sprintf(`%s%s%s
 		<script>document.querySelector('.table-sortable').tsortable()</script>`,
-			renderTVTable(tvSearchResults))
+			common.RenderParserWarning(parserStatus), common.RenderPriceAlerts(alerts, priceTarget),
+			common.RenderWriteBack("/tvwriteback", `<table class="table-sortable">`+renderTVTable(tvSearchResults, c.PriceHistory)+`</tbody></table>`))
 
 		tracker.MarkComplete(jobID, resultsHTML)
 		fmt.Printf("\nProcessed %d TV Shows in %v\n", totalTV, time.Since(startTime))
 	}()
 }
 
-func renderTVTable(searchResults []types.TVSearchResponse) (tableRows string) {
-	tableRows = `<thead><tr><th data-sort="string"><strong>Plex Title</strong></th><th data-sort="int"><strong>DVD</strong></th><th data-sort="int"><strong>Blu-ray</strong></th><th data-sort="int"><strong>4K-ray</strong></th><th><strong>Disc</strong></th></tr></thead><tbody>`
+func renderTVTable(searchResults []types.TVSearchResponse, history *prices.History) (tableRows string) {
+	tableRows = `<thead><tr><th data-sort="string"><strong>Plex Title</strong></th><th data-sort="int"><strong>Priority</strong></th><th data-sort="int"><strong>DVD</strong></th><th data-sort="int"><strong>Blu-ray</strong></th><th data-sort="int"><strong>4K-ray</strong></th><th><strong>Seasons</strong></th><th><strong>Disc</strong></th></tr></thead><tbody>`
+	now := time.Now()
 	for i := range searchResults {
-		// build up plex season / resolution row
-		plexSeasonsString := ""
-		for j := range searchResults[i].Seasons {
-			plexSeasonsString += fmt.Sprintf("Season %d %s<br>",
-				searchResults[i].PlexTVShow.Seasons[j].Number, searchResults[i].PlexTVShow.Seasons[j].LowestResolution)
+		// shows with discs to buy are checked, ready to be written back to plex
+		checked := ""
+		if searchResults[i].MatchesDVD+searchResults[i].MatchesBluray+searchResults[i].Matches4k > 0 {
+			checked = " checked"
 		}
-		plexSeasonsString = plexSeasonsString[:len(plexSeasonsString)-1] // remove trailing comma
 		tableRows += fmt.Sprintf(
-			`<tr><td><a href=%q target="_blank">%s [%v]:<br>%s</a></td><td>%d</td><td>%d</td><td>%d</td>`,
-			searchResults[i].SearchURL, searchResults[i].Title, searchResults[i].Year, plexSeasonsString,
-			searchResults[i].MatchesDVD, searchResults[i].MatchesBluray, searchResults[i].Matches4k)
+			`<tr><td><input type="checkbox" name="ratingKey" value=%q%s> <a href=%q target="_blank">%s [%v]</a></td><td>%d</td><td>%d</td><td>%d</td><td>%d</td><td>%s</td>`,
+			searchResults[i].RatingKey, checked, searchResults[i].SearchURL, searchResults[i].Title, searchResults[i].Year,
+			priority.TVShow(&searchResults[i].PlexTVShow, now), searchResults[i].MatchesDVD, searchResults[i].MatchesBluray, searchResults[i].Matches4k,
+			renderSeasonMatrix(seasonMatrix(&searchResults[i])))
 		if (searchResults[i].MatchesDVD + searchResults[i].MatchesBluray + searchResults[i].Matches4k) > 0 {
 			tableRows += "<td>"
 			for j := range searchResults[i].TVSearchResults {
@@ -147,6 +264,9 @@ func renderTVTable(searchResults []types.TVSearchResponse) (tableRows string) {
 								searchResults[i].TVSearchResults[j].URL, season.Number, season.Format)
 						}
 						tableRows += "</a><br>"
+						if price := history.Describe(season.URL, season.Price); price != "" {
+							tableRows += fmt.Sprintf(`<small>%s</small><br>`, html.EscapeString(price))
+						}
 					}
 				}
 			}
@@ -158,3 +278,237 @@ func renderTVTable(searchResults []types.TVSearchResponse) (tableRows string) {
 	}
 	return tableRows // Return the generated HTML for table rows
 }
+
+func renderMissingEpisodesTable(searchResults []types.MissingEpisodesResponse) (tableRows string) {
+	tableRows = `<thead><tr><th data-sort="string"><strong>Plex Title</strong></th><th data-sort="int"><strong>Missing Episodes</strong></th><th><strong>Missing</strong></th></tr></thead><tbody>`
+	for i := range searchResults {
+		missing := ""
+		switch {
+		case searchResults[i].Err != nil:
+			missing = fmt.Sprintf("Not found in %s", searchResults[i].Guide)
+		case len(searchResults[i].MissingEpisodes)+len(searchResults[i].MissingSeasons) == 0:
+			missing = "Complete"
+		}
+		for _, season := range searchResults[i].MissingSeasons {
+			missing += fmt.Sprintf("<strong>Season %d aired, not in Plex</strong><br>", season)
+		}
+		for _, episode := range searchResults[i].MissingEpisodes {
+			missing += fmt.Sprintf("S%02dE%02d %s (%s)<br>", episode.Season, episode.Number,
+				html.EscapeString(episode.Title), episode.Aired.Format(time.DateOnly))
+		}
+		tableRows += fmt.Sprintf(`<tr><td>%s [%v]</td><td>%d</td><td>%s</td></tr>`,
+			searchResults[i].Title, searchResults[i].Year, len(searchResults[i].MissingEpisodes), missing)
+	}
+	return tableRows
+}
+
+func renderSeasonMatrix(seasons []seasonStatus) (matrix string) {
+	for _, season := range seasons {
+		plexResolution := season.PlexResolution
+		if plexResolution == "" {
+			plexResolution = "-"
+		}
+		disc := season.DiscFormat
+		if season.BoxSetName != "" {
+			disc = fmt.Sprintf("%s %s", season.BoxSetName, season.DiscFormat)
+		}
+		if season.DiscURL != "" {
+			disc = fmt.Sprintf(`<a href=%q target="_blank">%s</a>`, season.DiscURL, disc)
+		} else if disc == "" {
+			disc = "-"
+		}
+		line := fmt.Sprintf("Season %d: %s / %s, %s", season.Number, plexResolution, disc, season.Status)
+		if season.Status == seasonMissing || season.Status == seasonUpgrade {
+			line = "<strong>" + line + "</strong>"
+		}
+		matrix += line + "<br>"
+		if season.Quality.Mixed {
+			matrix += fmt.Sprintf("<small>%s</small><br>", renderSeasonQuality(&season.Quality))
+		}
+	}
+	return matrix
+}
+
+// renderSeasonQuality lists the episode count per resolution, best first, then the episodes worth replacing.
+func renderSeasonQuality(quality *types.SeasonQuality) string {
+	resolutions := make([]string, 0, len(quality.Counts))
+	for resolution := range quality.Counts {
+		resolutions = append(resolutions, resolution)
+	}
+	slices.SortFunc(resolutions, func(a, b string) int {
+		return resolutionRank(b) - resolutionRank(a)
+	})
+	counts := make([]string, 0, len(resolutions))
+	for _, resolution := range resolutions {
+		counts = append(counts, fmt.Sprintf("%s x%d", resolution, quality.Counts[resolution]))
+	}
+	episodes := make([]string, 0, len(quality.LowerEpisodes))
+	for _, episode := range quality.LowerEpisodes {
+		episodes = append(episodes, fmt.Sprintf("E%s %s (%s)", episode.Index, html.EscapeString(episode.Title), episode.Resolution))
+	}
+	return fmt.Sprintf("mixed: %s. Replace: %s", strings.Join(counts, ", "), strings.Join(episodes, ", "))
+}
+
+// filterMixedResolution keeps the shows that have a season with episodes at different resolutions, and only those
+// seasons.
+func filterMixedResolution(plexTV []types.PlexTVShow) (filtered []types.PlexTVShow) {
+	for i := range plexTV {
+		show := plexTV[i]
+		show.Seasons = nil
+		for j := range plexTV[i].Seasons {
+			if plex.SeasonQuality(&plexTV[i].Seasons[j]).Mixed {
+				show.Seasons = append(show.Seasons, plexTV[i].Seasons[j])
+			}
+		}
+		if len(show.Seasons) > 0 {
+			filtered = append(filtered, show)
+		}
+	}
+	return filtered
+}
+
+// seasonMatrix joins the plex seasons of a show with the best match disc seasons, and classifies each season as
+// missing from plex, upgrade available, already best, covered by box set or no disc found.
+func seasonMatrix(searchResult *types.TVSearchResponse) (seasons []seasonStatus) {
+	discs := make(map[int]types.TVSeasonResult)
+	var boxSets []types.TVSeasonResult
+	for i := range searchResult.TVSearchResults {
+		if !searchResult.TVSearchResults[i].BestMatch {
+			continue
+		}
+		for _, season := range searchResult.TVSearchResults[i].Seasons {
+			switch {
+			case season.BoxSet:
+				boxSets = append(boxSets, season)
+			case season.Number <= 0 || season.Number == finalSeason:
+				// we cannot tell which season this is
+			case discRank(season.Format) > discRank(discs[season.Number].Format):
+				discs[season.Number] = season
+			}
+		}
+	}
+
+	plexSeasons := make(map[int]types.PlexTVSeason)
+	numbers := make([]int, 0, len(searchResult.Seasons)+len(discs))
+	for _, season := range searchResult.Seasons {
+		plexSeasons[season.Number] = season
+		numbers = append(numbers, season.Number)
+	}
+	for number := range discs {
+		numbers = append(numbers, number)
+	}
+	// a season plex does not have may only be sold in a box set
+	for _, boxSet := range boxSets {
+		if first, last, found := boxSetRange(boxSet.BoxSetName); found {
+			for number := first; number <= last; number++ {
+				numbers = append(numbers, number)
+			}
+		}
+	}
+	slices.Sort(numbers)
+	numbers = slices.Compact(numbers)
+
+	for _, number := range numbers {
+		plexSeason, inPlex := plexSeasons[number]
+		status := seasonStatus{Number: number, PlexResolution: plexSeason.LowestResolution, Status: seasonBest, Quality: plex.SeasonQuality(&plexSeason)}
+		plexRank := resolutionRank(plexSeason.LowestResolution)
+		if disc, found := discs[number]; found {
+			status.DiscFormat, status.DiscURL = disc.Format, disc.URL
+			switch {
+			case !inPlex:
+				status.Status = seasonMissing
+			case discRank(disc.Format) > plexRank:
+				status.Status = seasonUpgrade
+			}
+			seasons = append(seasons, status)
+			continue
+		}
+		// no single season disc, a box set may still have it
+		status.Status = seasonNoDisc
+		for _, boxSet := range boxSets {
+			if !boxSetCovers(boxSet.BoxSetName, number) {
+				continue
+			}
+			status.Status = seasonBest
+			if discRank(boxSet.Format) > plexRank {
+				status.DiscFormat, status.DiscURL, status.BoxSetName = boxSet.Format, boxSet.URL, boxSet.BoxSetName
+				status.Status = seasonBoxSet
+				break
+			}
+		}
+		seasons = append(seasons, status)
+	}
+	return seasons
+}
+
+// boxSetRange returns the seasons of a box set named eg "Seasons 1-6", a complete series has no range.
+func boxSetRange(boxSetName string) (first, last int, found bool) {
+	match := boxSetRangeRegex.FindStringSubmatch(boxSetName)
+	if match == nil {
+		return 0, 0, false
+	}
+	first, _ = strconv.Atoi(match[1])
+	last, _ = strconv.Atoi(match[2])
+	return first, last, true
+}
+
+// boxSetCovers reports whether a box set named eg "Seasons 1-6" or "The Complete Series" contains the season.
+func boxSetCovers(boxSetName string, number int) bool {
+	if first, last, found := boxSetRange(boxSetName); found {
+		return number >= first && number <= last
+	}
+	lower := strings.ToLower(boxSetName)
+	return strings.Contains(lower, "complete series") || strings.Contains(lower, "complete collection") ||
+		strings.Contains(lower, "complete box set")
+}
+
+// discRank and resolutionRank put disc formats and plex resolutions on the same scale, 720p is better than DVD but
+// still an upgrade to Blu-ray.
+func discRank(format string) int {
+	switch format {
+	case types.DiskDVD:
+		return 1
+	case types.DiskBluray:
+		return 3 //nolint:mnd
+	case types.Disk4K:
+		return 4 //nolint:mnd
+	default:
+		return unknownDiscRank
+	}
+}
+
+func resolutionRank(resolution string) int {
+	rank, hd := types.ResolutionRank(resolution), types.ResolutionRank(types.PlexResolution720)
+	switch {
+	case rank < 0:
+		return 0
+	case rank < hd:
+		return 1
+	default:
+		// 720p is 2, 1080p Blu-ray is 3 and 4k is 4
+		return rank - hd + 2 //nolint:mnd
+	}
+}
+
+// updateWanted keeps the wanted list in step with the latest lookup on the provider.
+func (c TVConfig) updateWanted(searchResults []types.TVSearchResponse, provider string) {
+	if c.Wanted == nil {
+		return
+	}
+	c.Wanted.UpdateTV(searchResults, provider)
+	if err := c.Wanted.Save(); err != nil {
+		slog.Error("Failed to save wanted list", "error", err)
+	}
+}
+
+// WriteBackHTML adds the checked results to a Plex label or collection, or creates a playlist of them.
+func (c TVConfig) WriteBackHTML(w http.ResponseWriter, r *http.Request) {
+	common.WriteBack(w, r, c.Config, c.Config.PlexTVLibraryID, plex.ItemTypeShow, "TV shows")
+}
+
+// sortTVByPriority puts the shows most worth upgrading first.
+func sortTVByPriority(searchResults []types.TVSearchResponse, now time.Time) {
+	slices.SortStableFunc(searchResults, func(a, b types.TVSearchResponse) int {
+		return cmp.Compare(priority.TVShow(&b.PlexTVShow, now), priority.TVShow(&a.PlexTVShow, now))
+	})
+}
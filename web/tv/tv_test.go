@@ -0,0 +1,111 @@
+package tv
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tphoney/plex-lookup/types"
+)
+
+func TestSeasonMatrix(t *testing.T) {
+	searchResult := types.TVSearchResponse{
+		PlexTVShow: types.PlexTVShow{
+			Title: "Friends",
+			Seasons: []types.PlexTVSeason{
+				{Number: 1, LowestResolution: types.PlexResolution480},
+				{Number: 2, LowestResolution: types.PlexResolution1080},
+				{Number: 4, LowestResolution: types.PlexResolution720},
+				{Number: 5, LowestResolution: types.PlexResolution4K},
+				{Number: 8, LowestResolution: types.PlexResolution1080},
+			},
+		},
+		TVSearchResults: []types.TVSearchResult{
+			{BestMatch: true, Seasons: []types.TVSeasonResult{{Number: 1, Format: types.DiskDVD, URL: "s1dvd"}}},
+			{BestMatch: true, Seasons: []types.TVSeasonResult{{Number: 1, Format: types.DiskBluray, URL: "s1"}}},
+			{BestMatch: true, Seasons: []types.TVSeasonResult{{Number: 2, Format: types.DiskBluray, URL: "s2"}}},
+			{BestMatch: true, Seasons: []types.TVSeasonResult{{Number: 3, Format: types.Disk4K, URL: "s3"}}},
+			{BestMatch: true, Seasons: []types.TVSeasonResult{{BoxSet: true, BoxSetName: "Seasons 1-6", Format: types.DiskBluray, URL: "box"}}},
+			{BestMatch: false, Seasons: []types.TVSeasonResult{{Number: 2, Format: types.Disk4K, URL: "other show"}}},
+		},
+	}
+	want := []seasonStatus{
+		{Number: 1, PlexResolution: types.PlexResolution480, DiscFormat: types.DiskBluray, DiscURL: "s1", Status: seasonUpgrade},
+		{Number: 2, PlexResolution: types.PlexResolution1080, DiscFormat: types.DiskBluray, DiscURL: "s2", Status: seasonBest},
+		{Number: 3, DiscFormat: types.Disk4K, DiscURL: "s3", Status: seasonMissing},
+		{Number: 4, PlexResolution: types.PlexResolution720, DiscFormat: types.DiskBluray, DiscURL: "box", BoxSetName: "Seasons 1-6", Status: seasonBoxSet},
+		{Number: 5, PlexResolution: types.PlexResolution4K, Status: seasonBest},
+		// only the box set has season 6, nothing is sold for season 8
+		{Number: 6, DiscFormat: types.DiskBluray, DiscURL: "box", BoxSetName: "Seasons 1-6", Status: seasonBoxSet},
+		{Number: 8, PlexResolution: types.PlexResolution1080, Status: seasonNoDisc},
+	}
+	if got := seasonMatrix(&searchResult); !reflect.DeepEqual(got, want) {
+		t.Errorf("seasonMatrix() = %+v, want %+v", got, want)
+	}
+}
+
+func TestBoxSetCovers(t *testing.T) {
+	tests := []struct {
+		boxSetName string
+		number     int
+		want       bool
+	}{
+		{boxSetName: "Seasons 1-6", number: 6, want: true},
+		{boxSetName: "Seasons 1-6", number: 7, want: false},
+		{boxSetName: "Series 2 to 4", number: 3, want: true},
+		{boxSetName: "The Complete Series", number: 12, want: true},
+		{boxSetName: "THE COMPLETE COLLECTION", number: 1, want: true},
+		{boxSetName: "Christmas Special", number: 1, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.boxSetName, func(t *testing.T) {
+			if got := boxSetCovers(tt.boxSetName, tt.number); got != tt.want {
+				t.Errorf("boxSetCovers(%q, %d) = %v, want %v", tt.boxSetName, tt.number, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterMixedResolution(t *testing.T) {
+	plexTV := []types.PlexTVShow{
+		{Title: "Friends", Seasons: []types.PlexTVSeason{
+			{Number: 1, Episodes: []types.PlexTVEpisode{{Index: "1", Resolution: types.PlexResolution1080}, {Index: "2", Resolution: types.PlexResolutionSD}}},
+			{Number: 2, Episodes: []types.PlexTVEpisode{{Index: "1", Resolution: types.PlexResolution1080}}},
+		}},
+		{Title: "Seinfeld", Seasons: []types.PlexTVSeason{
+			{Number: 1, Episodes: []types.PlexTVEpisode{{Index: "1", Resolution: types.PlexResolutionSD}, {Index: "2", Resolution: types.PlexResolutionSD}}},
+		}},
+	}
+	filtered := filterMixedResolution(plexTV)
+	if len(filtered) != 1 || filtered[0].Title != "Friends" || len(filtered[0].Seasons) != 1 || filtered[0].Seasons[0].Number != 1 {
+		t.Errorf("filterMixedResolution() = %+v", filtered)
+	}
+	if len(plexTV[0].Seasons) != 2 {
+		t.Error("filterMixedResolution() changed the input shows")
+	}
+}
+
+func TestRenderSeasonQuality(t *testing.T) {
+	quality := types.SeasonQuality{
+		Counts:        map[string]int{types.PlexResolutionSD: 1, types.PlexResolution1080: 20},
+		LowerEpisodes: []types.PlexTVEpisode{{Index: "4", Title: "The One with the Thumb", Resolution: types.PlexResolutionSD}},
+		Mixed:         true,
+	}
+	want := "mixed: 1080 x20, sd x1. Replace: E4 The One with the Thumb (sd)"
+	if got := renderSeasonQuality(&quality); got != want {
+		t.Errorf("renderSeasonQuality() = %q, want %q", got, want)
+	}
+}
+
+func TestSortTVByPriority(t *testing.T) {
+	now := time.Now()
+	searchResults := []types.TVSearchResponse{
+		{PlexTVShow: types.PlexTVShow{Title: "Unwatched", Seasons: []types.PlexTVSeason{{LowestResolution: types.PlexResolution1080}}}},
+		{PlexTVShow: types.PlexTVShow{Title: "Favourite", ViewCount: 40, LastViewedAt: now,
+			Seasons: []types.PlexTVSeason{{LowestResolution: types.PlexResolution480}}}},
+	}
+	sortTVByPriority(searchResults, now)
+	if searchResults[0].Title != "Favourite" {
+		t.Errorf("sortTVByPriority() first = %q, want %q", searchResults[0].Title, "Favourite")
+	}
+}
@@ -0,0 +1,195 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tphoney/plex-lookup/amazon"
+	"github.com/tphoney/plex-lookup/cinemaparadiso"
+	"github.com/tphoney/plex-lookup/plex"
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/wanted"
+)
+
+// plex webhook docs https://support.plex.tv/articles/115002267687-webhooks/
+
+const (
+	eventLibraryNew = "library.new"
+	refetchAttempts = 3
+)
+
+// refreshWait is how long plex gets to finish a metadata refresh before the item is read back, a var so tests can
+// shorten it.
+var refreshWait = 10 * time.Second
+
+type WebhooksConfig struct {
+	Config *types.Configuration
+	Wanted *wanted.List
+}
+
+// Payload is the part of a Plex webhook we use.
+type Payload struct {
+	Event    string `json:"event"`
+	Metadata struct {
+		RatingKey            string `json:"ratingKey"`
+		ParentRatingKey      string `json:"parentRatingKey"`
+		GrandparentRatingKey string `json:"grandparentRatingKey"`
+		Type                 string `json:"type"`
+		Title                string `json:"title"`
+		GrandparentTitle     string `json:"grandparentTitle"`
+		Year                 int    `json:"year"`
+	} `json:"Metadata"`
+}
+
+// PlexHandler accepts Plex webhooks. Plex posts a multipart form with the event in the "payload" field, a plain JSON
+// body is accepted too. The webhook url must carry the configured secret as ?token=, without a secret every request
+// is refused. library.new events are handled in the background, so Plex is not kept waiting.
+func (c WebhooksConfig) PlexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !c.authorised(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20) //nolint:mnd // 10 MB limit, plex attaches a thumbnail
+	payload, err := parsePayload(r)
+	if err != nil {
+		slog.Warn("Invalid Plex webhook", "error", err)
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	if payload.Event != eventLibraryNew {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	go c.ProcessLibraryNew(context.Background(), &payload)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// authorised reports whether the request carries the webhook secret.
+func (c WebhooksConfig) authorised(r *http.Request) bool {
+	if c.Config == nil || c.Config.PlexWebhookSecret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(c.Config.PlexWebhookSecret)) == 1
+}
+
+func parsePayload(r *http.Request) (payload Payload, err error) {
+	var data []byte
+	if err = r.ParseMultipartForm(1 << 20); err == nil { //nolint:mnd // 1 MB in memory
+		data = []byte(r.FormValue("payload"))
+	} else {
+		data, err = io.ReadAll(r.Body)
+		if err != nil {
+			return payload, err
+		}
+	}
+	if err = json.Unmarshal(data, &payload); err != nil {
+		return payload, fmt.Errorf("webhooks: unable to parse payload: %w", err)
+	}
+	return payload, nil
+}
+
+// ProcessLibraryNew refreshes the new item, removes its movie or show from the wanted list and looks it up again on
+// the disc site it was found on. It goes back on the list if there is still a better disc than the new copy.
+func (c WebhooksConfig) ProcessLibraryNew(ctx context.Context, payload *Payload) {
+	itemType, ratingKey, title := wanted.TypeMovie, payload.Metadata.RatingKey, payload.Metadata.Title
+	switch payload.Metadata.Type {
+	case "movie":
+	case "show":
+		itemType = wanted.TypeShow
+	case "season":
+		itemType, ratingKey, title = wanted.TypeShow, payload.Metadata.ParentRatingKey, payload.Metadata.GrandparentTitle
+	case "episode":
+		itemType, ratingKey, title = wanted.TypeShow, payload.Metadata.GrandparentRatingKey, payload.Metadata.GrandparentTitle
+	default:
+		slog.Debug("Ignoring Plex webhook", "type", payload.Metadata.Type)
+		return
+	}
+	if err := plex.RefreshMetadata(c.Config.PlexIP, c.Config.PlexToken, payload.Metadata.RatingKey); err != nil {
+		slog.Error("Failed to refresh Plex metadata", "ratingKey", payload.Metadata.RatingKey, "error", err)
+	}
+
+	year := ""
+	if payload.Metadata.Year > 0 && itemType == wanted.TypeMovie {
+		year = strconv.Itoa(payload.Metadata.Year)
+	}
+	removed := c.Wanted.Remove(itemType, ratingKey, title, year)
+	// titles that were not on the list are looked up on blu-ray.com
+	provider := amazon.ProviderName
+	for i := range removed {
+		if removed[i].Provider != "" {
+			provider = removed[i].Provider
+			break
+		}
+	}
+
+	var item wanted.Item
+	stillWanted := false
+	if itemType == wanted.TypeMovie {
+		movie, err := refetch(ctx, func() (types.PlexMovie, error) {
+			return plex.GetMovie(c.Config.PlexIP, c.Config.PlexToken, ratingKey)
+		}, func(movie *types.PlexMovie) bool { return movie.Resolution != "" })
+		if err != nil {
+			slog.Error("Failed to get the new Plex movie", "ratingKey", ratingKey, "error", err)
+		} else {
+			var results []types.MovieSearchResponse
+			if provider == cinemaparadiso.ProviderName {
+				results, _ = cinemaparadiso.MoviesInParallel(ctx, nil, []types.PlexMovie{movie})
+			} else {
+				results, _ = amazon.MoviesInParallel(ctx, nil, []types.PlexMovie{movie}, "", c.Config.AmazonRegion)
+			}
+			item, stillWanted = wanted.FromMovie(&results[0])
+		}
+	} else {
+		show, err := refetch(ctx, func() (types.PlexTVShow, error) {
+			return plex.GetTVShow(c.Config.PlexIP, c.Config.PlexToken, ratingKey)
+		}, func(show *types.PlexTVShow) bool { return len(show.Seasons) > 0 })
+		if err != nil {
+			slog.Error("Failed to get the Plex TV show", "ratingKey", ratingKey, "error", err)
+		} else {
+			var results []types.TVSearchResponse
+			if provider == cinemaparadiso.ProviderName {
+				results, _ = cinemaparadiso.TVInParallel(ctx, nil, []types.PlexTVShow{show})
+			} else {
+				results, _ = amazon.TVInParallel(ctx, nil, []types.PlexTVShow{show}, "", c.Config.AmazonRegion)
+			}
+			item, stillWanted = wanted.FromTVShow(&results[0])
+		}
+	}
+	if stillWanted {
+		item.Provider = provider
+		c.Wanted.Add(item)
+	}
+	if err := c.Wanted.Save(); err != nil {
+		slog.Error("Failed to save wanted list", "error", err)
+	}
+	slog.Info("Plex library.new processed", "type", itemType, "title", title, "provider", provider, "removed", len(removed),
+		"stillWanted", stillWanted)
+}
+
+// refetch reads an item back from plex once the refresh has had time to run, RefreshMetadata only queues it. It tries
+// again while ready reports the item is not analysed yet, and returns the last read if it never is.
+func refetch[T any](ctx context.Context, get func() (T, error), ready func(*T) bool) (item T, err error) {
+	for range refetchAttempts {
+		select {
+		case <-ctx.Done():
+			return item, ctx.Err()
+		case <-time.After(refreshWait):
+		}
+		item, err = get()
+		if err == nil && ready(&item) {
+			return item, nil
+		}
+	}
+	return item, err
+}
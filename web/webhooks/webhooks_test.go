@@ -0,0 +1,128 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tphoney/plex-lookup/amazon"
+	"github.com/tphoney/plex-lookup/fixtures"
+	"github.com/tphoney/plex-lookup/types"
+	"github.com/tphoney/plex-lookup/wanted"
+)
+
+const newMoviePayload = `{"event":"library.new","Metadata":{"ratingKey":"1","type":"movie","title":"Cats","year":2019}}`
+
+func TestPlexHandler(t *testing.T) {
+	var playBody bytes.Buffer
+	form := multipart.NewWriter(&playBody)
+	_ = form.WriteField("payload", `{"event":"media.play","Metadata":{"ratingKey":"1","type":"movie"}}`)
+	form.Close()
+	c := WebhooksConfig{Config: &types.Configuration{PlexWebhookSecret: "secret"}}
+	tests := []struct {
+		name        string
+		config      WebhooksConfig
+		target      string
+		body        string
+		contentType string
+		want        int
+	}{
+		{name: "other event", config: c, target: "/webhooks/plex?token=secret", body: playBody.String(), contentType: form.FormDataContentType(),
+			want: http.StatusNoContent},
+		{name: "invalid payload", config: c, target: "/webhooks/plex?token=secret", body: "not json", want: http.StatusBadRequest},
+		{name: "wrong secret", config: c, target: "/webhooks/plex?token=guess", body: newMoviePayload, want: http.StatusForbidden},
+		{name: "no secret sent", config: c, target: "/webhooks/plex", body: newMoviePayload, want: http.StatusForbidden},
+		{name: "no secret configured", config: WebhooksConfig{Config: &types.Configuration{}}, target: "/webhooks/plex?token=", body: newMoviePayload,
+			want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, bytes.NewBufferString(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			tt.config.PlexHandler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("PlexHandler() status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessLibraryNew(t *testing.T) {
+	defer func(wait time.Duration) { refreshWait = wait }(refreshWait)
+	refreshWait = 0
+	fixtureServer := httptest.NewServer(fixtures.Handler())
+	defer fixtureServer.Close()
+	amazon.SetURL(fixtures.ProviderURLs(fixtureServer.URL).Amazon)
+	defer amazon.SetURL("")
+
+	var refreshed atomic.Bool
+	plexServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/library/metadata/1/refresh":
+			refreshed.Store(true)
+		case r.URL.Path == "/library/metadata/1":
+			// the new rip is a 1080p copy, so the 4K disc is still wanted
+			fmt.Fprint(w, `<MediaContainer size="1"><Video ratingKey="1" title="Cats" year="2019"><Media videoResolution="1080"></Media></Video></MediaContainer>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer plexServer.Close()
+
+	list, err := wanted.Load(filepath.Join(t.TempDir(), "wanted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.Add(wanted.Item{RatingKey: "old", Type: wanted.TypeMovie, Title: "Cats", Year: "2019", Resolution: types.PlexResolutionSD,
+		Formats: []string{types.DiskBluray, types.Disk4K}})
+	list.Add(wanted.Item{RatingKey: "2", Type: wanted.TypeMovie, Title: "Elf", Year: "2003"})
+
+	c := WebhooksConfig{Config: &types.Configuration{PlexIP: plexServer.URL, AmazonRegion: "uk"}, Wanted: list}
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/plex", bytes.NewBufferString(newMoviePayload))
+	payload, err := parsePayload(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ProcessLibraryNew(context.Background(), &payload)
+
+	if !refreshed.Load() {
+		t.Error("ProcessLibraryNew() did not refresh the new item")
+	}
+	if _, found := list.Get("old"); found {
+		t.Error("ProcessLibraryNew() kept the old copy on the wanted list")
+	}
+	item, found := list.Get("1")
+	if !found || len(item.Formats) != 1 || item.Formats[0] != types.Disk4K || item.Provider != amazon.ProviderName {
+		t.Errorf("ProcessLibraryNew() new item = %+v, found %v, want only the 4K disc", item, found)
+	}
+	if _, found := list.Get("2"); !found {
+		t.Error("ProcessLibraryNew() removed an unrelated movie")
+	}
+}
+
+func TestRefetch(t *testing.T) {
+	defer func(wait time.Duration) { refreshWait = wait }(refreshWait)
+	refreshWait = 0
+	calls := 0
+	movie, err := refetch(context.Background(), func() (types.PlexMovie, error) {
+		calls++
+		if calls == 1 {
+			// plex has not analysed the new file yet
+			return types.PlexMovie{Title: "Cats"}, nil
+		}
+		return types.PlexMovie{Title: "Cats", Resolution: types.PlexResolution1080}, nil
+	}, func(movie *types.PlexMovie) bool { return movie.Resolution != "" })
+	if err != nil || movie.Resolution != types.PlexResolution1080 || calls != 2 {
+		t.Errorf("refetch() = %+v after %d calls, error = %v", movie, calls, err)
+	}
+}